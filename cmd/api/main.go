@@ -1,21 +1,60 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"time"
 
 	"github.com/panospet/small-api/internal/config"
 	"github.com/panospet/small-api/pkg/api"
 	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/migrate"
+	"github.com/panospet/small-api/pkg/ratelimit"
 	"github.com/panospet/small-api/pkg/services"
 )
 
 func main() {
 	conf := config.NewConfig()
-	db, err := services.NewDb(conf.MysqlPath)
+	db, err := services.NewDbService(conf.DatabaseUrl)
 	if err != nil {
 		log.Fatal("Error while initializing db", err)
 	}
+	// in memory databases have no schema to migrate
+	if appDb, ok := db.(*services.AppDb); ok && conf.MigrateOnStart {
+		migrateSchema(appDb.Conn.DB, appDb.Conn.DriverName())
+	}
 	redis, err := cache.NewRedisCache(conf.RedisPath)
 	bpApi := api.NewApi(db, redis)
+	if err != nil {
+		// the client of an unreachable redis is not the one of REDIS_PATH, so limits are counted in memory
+		log.Println("Redis is unavailable, rate limits hold per instance:", err)
+		bpApi.Limiter = ratelimit.NewMemoryLimiter()
+	} else {
+		bpApi.Limiter = ratelimit.NewRedisLimiter(redis.Client)
+	}
+	bpApi.ReadRate = ratelimit.Rate{Limit: conf.ReadRateLimit, Window: time.Minute}
+	bpApi.WriteRate = ratelimit.Rate{Limit: conf.WriteRateLimit, Window: time.Minute}
+	bpApi.CacheControl = conf.CacheControl
+	bpApi.MaxBatchSize = conf.MaxBatchSize
+	bpApi.CompressMinSize = conf.CompressMinSize
+	bpApi.ApiKeys = conf.ApiKeys
+	bpApi.Feed = conf.Feed
+	bpApi.StartTrashPurger(conf.TrashRetention, time.Hour)
 	bpApi.Run()
 }
+
+// migrateSchema applies the pending migrations embedded in the binary. Instances starting together take turns, and
+// the ones after the first find nothing to apply.
+func migrateSchema(db *sql.DB, driver string) {
+	m, err := migrate.NewEmbedded(db, driver)
+	if err != nil {
+		log.Fatal("Error while reading migrations ", err)
+	}
+	m.Log = log.Printf
+	count, err := m.Up(context.Background())
+	if err != nil {
+		log.Fatal("Error while migrating db ", err)
+	}
+	log.Printf("Applied %d migrations", count)
+}
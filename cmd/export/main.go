@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panospet/small-api/internal/config"
+	"github.com/panospet/small-api/pkg/export"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+func main() {
+	var format string
+	var output string
+	var compress bool
+	var orderBy string
+	var offset int
+	var limit int
+	var categories string
+	var updatedSince string
+
+	flag.StringVar(&format, "format", export.FormatCsv, "csv, ndjson or xml")
+	flag.StringVar(&output, "output", "-", "file to write, - for stdout")
+	flag.BoolVar(&compress, "gzip", false, "gzip the output")
+	flag.StringVar(&orderBy, "orderBy", "", "order of the products, e.g. category_id:asc,price:desc")
+	flag.IntVar(&offset, "offset", 0, "number of products to skip")
+	flag.IntVar(&limit, "limit", 0, "maximum number of products, 0 for all")
+	flag.StringVar(&categories, "category", "", "comma separated ids of the categories of the products")
+	flag.StringVar(&updatedSince, "updatedSince", "", "export the products updated at or after this RFC 3339 time")
+	flag.Parse()
+
+	var filter model.StreamFilter
+	var err error
+	if filter.OrderBy, err = model.ParseOrderBy(orderBy); err != nil {
+		panic(err)
+	}
+	for _, id := range strings.Split(categories, ",") {
+		if id == "" {
+			continue
+		}
+		categoryId, err := strconv.Atoi(id)
+		if err != nil {
+			panic(fmt.Sprintf("invalid category id %s", id))
+		}
+		filter.CategoryIds = append(filter.CategoryIds, categoryId)
+	}
+	if updatedSince != "" {
+		if filter.UpdatedSince, err = time.Parse(time.RFC3339, updatedSince); err != nil {
+			panic(err)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+	out = buffered
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+	conf := config.NewConfig()
+	encoder, err := export.NewEncoder(format, out, conf.Feed)
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := services.Open(conf.DatabaseUrl)
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		cancel()
+	}()
+
+	count := 0
+	rng := export.Range{Offset: offset, Limit: limit}
+	err = export.Products(ctx, db, filter, rng, func(p model.Product) error {
+		count++
+		return encoder.Encode(p)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export failed:", err)
+		os.Exit(1)
+	}
+	if err := encoder.Close(); err != nil {
+		panic(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(os.Stderr, "exported", count, "products")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/panospet/small-api/internal/config"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/importer"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+func main() {
+	var file string
+	var entity string
+	var format string
+	var mappingFile string
+	var dryRun bool
+	var workers int
+	var batchSize int
+	var user string
+
+	flag.StringVar(&file, "file", "", "file to import, - for stdin")
+	flag.StringVar(&entity, "entity", "", "product or category (default product)")
+	flag.StringVar(&format, "format", "", "csv or ndjson (default from the file extension)")
+	flag.StringVar(&mappingFile, "mapping", "", "json file with the column mapping")
+	flag.BoolVar(&dryRun, "dry-run", false, "validate everything but store nothing")
+	flag.IntVar(&workers, "workers", importer.DefaultWorkers, "number of workers")
+	flag.IntVar(&batchSize, "batch-size", importer.DefaultBatchSize, "rows per transaction")
+	flag.StringVar(&user, "user", "import", "username written in the audit log")
+	flag.Parse()
+
+	if file == "" {
+		fmt.Println("file is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	var mapping importer.Mapping
+	if mappingFile != "" {
+		var err error
+		if mapping, err = importer.LoadMapping(mappingFile); err != nil {
+			panic(err)
+		}
+	}
+	if entity != "" {
+		mapping.Entity = entity
+	}
+	if format != "" {
+		mapping.Format = format
+	}
+	if mapping.Format == "" {
+		mapping.Format = importer.FormatFromPath(file)
+	}
+
+	var input io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	conf := config.NewConfig()
+	db, err := services.Open(conf.DatabaseUrl)
+	if err != nil {
+		panic(err)
+	}
+	opts := importer.Options{
+		Mapping:   mapping,
+		BatchSize: batchSize,
+		Workers:   workers,
+		DryRun:    dryRun,
+		Actor:     &model.Actor{Username: user},
+	}
+	// without redis the import still works, but updated entities may be served stale until they expire
+	if redis, err := cache.NewRedisCache(conf.RedisPath); err == nil {
+		opts.Cache = redis
+	} else {
+		fmt.Fprintln(os.Stderr, "could not connect to redis, cache will not be updated:", err)
+	}
+
+	report, err := importer.Import(db, input, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed:", err)
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err != nil || report.Failed > 0 {
+		os.Exit(1)
+	}
+}
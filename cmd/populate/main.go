@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"time"
+
 	"github.com/panospet/small-api/internal/config"
 	"github.com/panospet/small-api/pkg/cache"
 	"github.com/panospet/small-api/pkg/common"
+	"github.com/panospet/small-api/pkg/seed"
 	"github.com/panospet/small-api/pkg/services"
 )
 
@@ -13,21 +18,44 @@ func main() {
 	var workers int
 	var amount int
 	var redisOnly bool
+	var seedValue int64
+	var profilePath string
+	var batchSize int
+	var dumpPath string
+	var dialect string
 
 	flag.BoolVar(&redisOnly, "redis-only", false, "populate only redis")
 	flag.IntVar(&workers, "workers", 10, "number of workers")
-	flag.IntVar(&amount, "amount", 1000, "total amount of products to add")
+	flag.IntVar(&amount, "amount", 0, "total amount of products to add, spread like in the profile (default: "+
+		"the amounts of the profile)")
+	flag.Int64Var(&seedValue, "seed", 0, "seed of the random data, the same seed giving the same data (default: random)")
+	flag.StringVar(&profilePath, "profile", "", "json file of the categories and products to generate (default: "+
+		"a thousand products in twenty categories)")
+	flag.IntVar(&batchSize, "batch", 500, "number of rows per insert")
+	flag.StringVar(&dumpPath, "dump", "", "write a SQL dump to this file instead of inserting, - for stdout")
+	flag.StringVar(&dialect, "dialect", "mysql", "dialect of the dump: mysql, postgres or sqlite3")
 	flag.Parse()
 
+	if dumpPath != "" {
+		w, closeDump, err := openDump(dumpPath, dialect)
+		if err != nil {
+			panic(err)
+		}
+		defer closeDump()
+		// the dump may go to stdout, so the progress goes to stderr
+		populate(w, profilePath, seedValue, amount, batchSize, os.Stderr)
+		return
+	}
+
 	conf := config.NewConfig()
 
-	db, err := services.NewDb(conf.MysqlPath)
+	db, err := services.Open(conf.DatabaseUrl)
 	if err != nil {
 		panic(err)
 	}
 	if !redisOnly {
-		fmt.Println("populating mysql...")
-		common.PopulateDb(db, workers, amount)
+		fmt.Println("populating the database...")
+		populate(seed.NewDbWriter(db.Conn, workers), profilePath, seedValue, amount, batchSize, os.Stdout)
 	}
 
 	fmt.Println("populating redis...")
@@ -35,5 +63,61 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	common.PopulateRedis(db, redis, workers)
+	result, err := common.PopulateRedis(context.Background(), db, redis, workers)
+	fmt.Println("Redis populated,", result)
+	if len(result.FailedCategories) > 0 {
+		fmt.Println("categories that could not be cached:", result.FailedCategories)
+	}
+	if len(result.FailedProducts) > 0 {
+		fmt.Println("products that could not be cached:", result.FailedProducts)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Error while populating redis: %s", err))
+	}
+}
+
+func openDump(path string, dialect string) (seed.Writer, func(), error) {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = f
+	}
+	w, err := seed.NewDumpWriter(out, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, func() {
+		if out != os.Stdout {
+			_ = out.Close()
+		}
+	}, nil
+}
+
+func populate(w seed.Writer, profilePath string, seedValue int64, amount int, batchSize int, out *os.File) {
+	profile := seed.DefaultProfile()
+	if profilePath != "" {
+		var err error
+		profile, err = seed.LoadProfile(profilePath)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if seedValue == 0 {
+		seedValue = time.Now().UnixNano()
+	}
+	fmt.Fprintln(out, "seed:", seedValue)
+	g := seed.NewGenerator(profile, seedValue)
+	if amount > 0 {
+		g.Scale(amount)
+	}
+	progress := &seed.Progress{Out: out, Total: g.Products(), Interval: time.Second}
+	result, err := seed.Seed(g, w, batchSize, progress)
+	if err != nil {
+		panic(fmt.Sprintf("Error while populating: %s", err))
+	}
+	fmt.Fprintf(out, "Added %d categories and %d products. Time: %s\n", result.Categories, result.Products,
+		result.Duration)
 }
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/panospet/small-api/pkg/api"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/client"
+	"github.com/panospet/small-api/pkg/export"
+	"github.com/panospet/small-api/pkg/importer"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/patch"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+// catalog is what the product, category, export and import commands work on: either the database itself, or a
+// running API.
+type catalog interface {
+	ListProducts(ctx context.Context, offset int, limit int, orderBy []model.Order) ([]model.Product, error)
+	GetProduct(ctx context.Context, id string) (model.Product, error)
+	CreateProduct(ctx context.Context, product model.Product) (string, error)
+	// UpdateProduct applies a JSON merge patch to a product
+	UpdateProduct(ctx context.Context, id string, patch map[string]interface{}) (model.Product, error)
+	DeleteProduct(ctx context.Context, id string) error
+	// ProductCounts counts the products of every category
+	ProductCounts(ctx context.Context) (map[int]int, error)
+	// Categories returns all categories, by position
+	Categories(ctx context.Context) ([]model.Category, error)
+	// ReorderCategories moves the categories of ids to the top, in their order, at once, and returns all categories
+	// by position
+	ReorderCategories(ctx context.Context, ids []int) ([]model.Category, error)
+	ExportProducts(ctx context.Context, opts client.ExportOptions, w io.Writer) error
+	Import(ctx context.Context, opts client.ImportOptions, r io.Reader) (client.ImportReport, error)
+}
+
+var byPosition = []model.Order{{Field: "position", Asc: true}}
+
+// dbCatalog works on the database, validating changes like the API does, and removing changed entities from the
+// cache, if there is one.
+type dbCatalog struct {
+	db    services.DbService
+	cache cache.Cacher
+	actor *model.Actor
+	// feed describes the shop of XML exports
+	feed export.Feed
+}
+
+func (c *dbCatalog) ListProducts(ctx context.Context, offset int, limit int, orderBy []model.Order) ([]model.Product,
+	error) {
+	return c.db.GetProducts(offset, limit, orderBy)
+}
+
+func (c *dbCatalog) GetProduct(ctx context.Context, id string) (model.Product, error) {
+	return c.db.GetProduct(id)
+}
+
+func (c *dbCatalog) CreateProduct(ctx context.Context, product model.Product) (string, error) {
+	if err := c.validateProduct(product); err != nil {
+		return "", err
+	}
+	return c.db.AddProduct(product, c.actor)
+}
+
+func (c *dbCatalog) UpdateProduct(ctx context.Context, id string, patch map[string]interface{}) (model.Product,
+	error) {
+	product, err := c.db.GetProduct(id)
+	if err != nil {
+		return model.Product{}, err
+	}
+	var patched model.Product
+	if err := applyPatch(product, patch, &patched); err != nil {
+		return model.Product{}, err
+	}
+	if err := c.validateProduct(patched); err != nil {
+		return model.Product{}, err
+	}
+	if err := c.db.UpdateProduct(patched, c.actor); err != nil {
+		return model.Product{}, err
+	}
+	c.uncache(func(cacher cache.Cacher) error { return cacher.DeleteProduct(id) })
+	return c.db.GetProduct(id)
+}
+
+func (c *dbCatalog) DeleteProduct(ctx context.Context, id string) error {
+	if err := c.db.DeleteProduct(id, 0, c.actor); err != nil {
+		return err
+	}
+	c.uncache(func(cacher cache.Cacher) error { return cacher.DeleteProduct(id) })
+	return nil
+}
+
+func (c *dbCatalog) ProductCounts(ctx context.Context) (map[int]int, error) {
+	counts := make(map[int]int)
+	err := c.db.StreamProducts(ctx, model.StreamFilter{}, 0, func(products []model.Product) error {
+		for _, p := range products {
+			counts[p.CategoryId]++
+		}
+		return nil
+	})
+	return counts, err
+}
+
+func (c *dbCatalog) Categories(ctx context.Context) ([]model.Category, error) {
+	return c.db.GetCategories(0, 0, byPosition)
+}
+
+func (c *dbCatalog) ReorderCategories(ctx context.Context, ids []int) ([]model.Category, error) {
+	before, err := c.Categories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := c.db.ReorderCategories(ids, c.actor)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[int]int, len(before))
+	for _, category := range before {
+		positions[category.Id] = category.Position
+	}
+	for _, category := range categories {
+		if id := category.Id; positions[id] != category.Position {
+			c.uncache(func(cacher cache.Cacher) error { return cacher.DeleteCategory(fmt.Sprintf("%d", id)) })
+		}
+	}
+	return categories, nil
+}
+
+func (c *dbCatalog) ExportProducts(ctx context.Context, opts client.ExportOptions, w io.Writer) error {
+	if opts.Format == "" {
+		opts.Format = export.FormatCsv
+	}
+	encoder, err := export.NewEncoder(opts.Format, w, c.feed)
+	if err != nil {
+		return err
+	}
+	filter := model.StreamFilter{CategoryIds: opts.CategoryIds, UpdatedSince: opts.UpdatedSince, OrderBy: opts.OrderBy}
+	rng := export.Range{Offset: opts.Offset, Limit: opts.Limit}
+	if opts.Page > 0 || opts.PerPage > 0 {
+		if rng, err = export.Page(opts.Page, opts.PerPage, opts.Offset, opts.Limit); err != nil {
+			return err
+		}
+	}
+	err = export.Products(ctx, c.db, filter, rng, encoder.Encode)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func (c *dbCatalog) Import(ctx context.Context, opts client.ImportOptions, r io.Reader) (client.ImportReport,
+	error) {
+	report, err := importer.Import(c.db, r, importer.Options{
+		Mapping: importer.Mapping{
+			Entity:    opts.Entity,
+			Format:    opts.Format,
+			Delimiter: opts.Delimiter,
+			Columns:   opts.Columns,
+		},
+		DryRun: opts.DryRun,
+		Actor:  c.actor,
+		Cache:  c.cache,
+	})
+	if err != nil {
+		return client.ImportReport{}, err
+	}
+	// the report of the API is the one of the importer
+	var converted client.ImportReport
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return client.ImportReport{}, err
+	}
+	return converted, json.Unmarshal(encoded, &converted)
+}
+
+// uncache removes a changed entity from the cache. The change is done, so a failure is only worth a warning: the
+// entity is served stale until it expires.
+func (c *dbCatalog) uncache(fn func(cacher cache.Cacher) error) {
+	if c.cache == nil {
+		return
+	}
+	if err := fn(c.cache); err != nil {
+		warn("could not remove changed entity from the cache:", err)
+	}
+}
+
+// validateProduct validates product the way the API does, its category included.
+func (c *dbCatalog) validateProduct(product model.Product) error {
+	errs, err := api.ValidateProduct(c.db, product)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// applyPatch merges patch into the json of original, like a PATCH request to the API, and decodes the result into
+// patched.
+func applyPatch(original interface{}, mergePatch map[string]interface{}, patched interface{}) error {
+	rawPatch, err := json.Marshal(mergePatch)
+	if err != nil {
+		return err
+	}
+	return patch.Merge(original, rawPatch, patched)
+}
+
+// apiCatalog works on a running API.
+type apiCatalog struct {
+	client *client.Client
+}
+
+func (c *apiCatalog) ListProducts(ctx context.Context, offset int, limit int, orderBy []model.Order) ([]model.Product,
+	error) {
+	opts := client.ListOptions{PerPage: 100, Offset: offset, Limit: limit, OrderBy: orderBy}
+	return c.client.ListProducts(ctx, opts).All()
+}
+
+func (c *apiCatalog) GetProduct(ctx context.Context, id string) (model.Product, error) {
+	return c.client.GetProduct(ctx, id, true)
+}
+
+func (c *apiCatalog) CreateProduct(ctx context.Context, product model.Product) (string, error) {
+	return c.client.CreateProduct(ctx, product)
+}
+
+func (c *apiCatalog) UpdateProduct(ctx context.Context, id string, patch map[string]interface{}) (model.Product,
+	error) {
+	return c.client.UpdateProduct(ctx, id, patch, 0)
+}
+
+func (c *apiCatalog) DeleteProduct(ctx context.Context, id string) error {
+	return c.client.DeleteProduct(ctx, id, 0)
+}
+
+func (c *apiCatalog) ProductCounts(ctx context.Context) (map[int]int, error) {
+	counts := make(map[int]int)
+	it := c.client.ListProducts(ctx, client.ListOptions{PerPage: 1000, Fields: []string{"category_id"}})
+	for it.Next() {
+		counts[it.Product().CategoryId]++
+	}
+	return counts, it.Err()
+}
+
+// Categories gets every category on its own, as the API serves lists from its cache for a while after changes,
+// e.g. after a reorder, while single categories are kept up to date.
+func (c *apiCatalog) Categories(ctx context.Context) ([]model.Category, error) {
+	listed, err := c.client.ListCategories(ctx, client.ListOptions{PerPage: 100, Fields: []string{"id"}}).All()
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]model.Category, 0, len(listed))
+	for _, l := range listed {
+		category, err := c.client.GetCategory(ctx, l.Id)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].Position != categories[j].Position {
+			return categories[i].Position < categories[j].Position
+		}
+		return categories[i].Id < categories[j].Id
+	})
+	return categories, nil
+}
+
+func (c *apiCatalog) ReorderCategories(ctx context.Context, ids []int) ([]model.Category, error) {
+	return c.client.ReorderCategories(ctx, ids)
+}
+
+func (c *apiCatalog) ExportProducts(ctx context.Context, opts client.ExportOptions, w io.Writer) error {
+	return c.client.ExportProducts(ctx, opts, w)
+}
+
+func (c *apiCatalog) Import(ctx context.Context, opts client.ImportOptions, r io.Reader) (client.ImportReport,
+	error) {
+	return c.client.Import(ctx, opts, r)
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/panospet/small-api/pkg/client"
+	"github.com/panospet/small-api/pkg/common"
+	"github.com/panospet/small-api/pkg/export"
+	"github.com/panospet/small-api/pkg/importer"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+type command struct {
+	// name is the words that select the command, e.g. "products list"
+	name        string
+	args        string
+	description string
+	// direct commands need the database and Redis, they cannot work on the API
+	direct bool
+	run    func(a *app, args []string) error
+}
+
+var commands = []command{
+	{name: "products list", args: "[flags]", description: "list products", run: productsList},
+	{name: "products get", args: "ID", description: "show a product and its category", run: productsGet},
+	{name: "products create", args: "[flags]", description: "create a product", run: productsCreate},
+	{name: "products update", args: "ID field=value...", description: "change fields of a product",
+		run: productsUpdate},
+	{name: "products delete", args: "ID", description: "move a product to the trash", run: productsDelete},
+	{name: "categories tree", args: "[flags]", description: "show categories by position, with their products",
+		run: categoriesTree},
+	{name: "categories reorder", args: "ID...", description: "move categories to the top, in the order given",
+		run: categoriesReorder},
+	{name: "users add", args: "USERNAME", description: "add a user", direct: true, run: usersAdd},
+	{name: "users disable", args: "USERNAME", description: "stop a user from authenticating", direct: true,
+		run: usersDisable},
+	{name: "users enable", args: "USERNAME", description: "let a disabled user authenticate again", direct: true,
+		run: usersEnable},
+	{name: "users passwd", args: "USERNAME", description: "change the password of a user", direct: true,
+		run: usersPasswd},
+	{name: "cache stats", description: "count what is cached", direct: true, run: cacheStats},
+	{name: "cache flush", description: "remove everything cached", direct: true, run: cacheFlush},
+	{name: "cache warm", description: "cache all products and categories", direct: true, run: cacheWarm},
+	{name: "cache inspect-key", args: "KEY", description: "show a cached value, e.g. product:ID, category:ID",
+		direct: true, run: cacheInspectKey},
+	{name: "migrate status", description: "show which migrations of the schema are applied", direct: true,
+		run: migrateStatus},
+	{name: "migrate up", description: "apply all pending migrations", direct: true, run: migrateUp},
+	{name: "migrate down", args: "[N]", description: "revert the last N migrations applied, 1 by default",
+		direct: true, run: migrateDown},
+	{name: "migrate to", args: "VERSION", description: "apply or revert migrations up to VERSION, 0 for none",
+		direct: true, run: migrateTo},
+	{name: "export", args: "[flags]", description: "export products as csv, ndjson or xml", run: exportProducts},
+	{name: "import", args: "[flags] FILE", description: "create or update products or categories from a file",
+		run: importEntities},
+}
+
+// flagSet returns the flags of a command, whose usage is shown on -h or wrong arguments.
+func flagSet(name string, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: smallctl %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a command, and checks that n positional arguments follow them, at least one if n is
+// -1.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if (n >= 0 && fs.NArg() != n) || (n < 0 && fs.NArg() == 0) {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func productsList(a *app, args []string) error {
+	fs := flagSet("products list", "[flags]")
+	offset := fs.Int("offset", 0, "number of products to skip")
+	limit := fs.Int("limit", 20, "maximum number of products, 0 for all")
+	orderBy := fs.String("orderBy", "id:asc", "order of the products, e.g. category_id:asc,price:desc")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	order, err := model.ParseOrderBy(*orderBy)
+	if err != nil {
+		return err
+	}
+	products, err := a.catalog.ListProducts(a.ctx, *offset, *limit, order)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, p := range products {
+		rows = append(rows, []string{p.Id, stringOrEmpty(p.Sku), strconv.Itoa(p.CategoryId), p.Title,
+			formatPrice(p.Price), strconv.Itoa(p.Version)})
+	}
+	return a.print(products, []string{"ID", "SKU", "CATEGORY", "TITLE", "PRICE", "VERSION"}, rows)
+}
+
+func productsGet(a *app, args []string) error {
+	fs := flagSet("products get", "ID")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	p, err := a.catalog.GetProduct(a.ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.printProduct(p)
+}
+
+func productsCreate(a *app, args []string) error {
+	fs := flagSet("products create", "[flags]")
+	var p model.Product
+	var sku string
+	fs.StringVar(&p.Title, "title", "", "title")
+	fs.IntVar(&p.CategoryId, "category", 0, "category id")
+	fs.StringVar(&p.ImageUrl, "image", "", "image url")
+	fs.StringVar(&p.Description, "description", "", "description")
+	fs.StringVar(&sku, "sku", "", "sku, to match the product on imports")
+	price := fs.Float64("price", 0, "price")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	p.Price = float32(*price)
+	if sku != "" {
+		p.Sku = &sku
+	}
+	id, err := a.catalog.CreateProduct(a.ctx, p)
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]string{"id": id}, []string{"ID"}, [][]string{{id}})
+}
+
+func productsUpdate(a *app, args []string) error {
+	fs := flagSet("products update", "ID field=value...\n\nValues are json, or strings, e.g. price=10 title=Lamp description=null")
+	if err := parse(fs, args, -1); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	patch, err := parsePatch(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	p, err := a.catalog.UpdateProduct(a.ctx, fs.Arg(0), patch)
+	if err != nil {
+		return err
+	}
+	return a.printProduct(p)
+}
+
+func productsDelete(a *app, args []string) error {
+	fs := flagSet("products delete", "ID")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if err := a.catalog.DeleteProduct(a.ctx, fs.Arg(0)); err != nil {
+		return err
+	}
+	return a.message("product %s moved to the trash", fs.Arg(0))
+}
+
+// parsePatch turns field=value arguments into a merge patch. Values that are not json are strings.
+func parsePatch(args []string) (map[string]interface{}, error) {
+	patch := make(map[string]interface{})
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected field=value, got %q", arg)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(parts[1]), &value); err != nil {
+			value = parts[1]
+		}
+		patch[parts[0]] = value
+	}
+	return patch, nil
+}
+
+type categoryNode struct {
+	Category     model.Category  `json:"category"`
+	ProductCount int             `json:"product_count"`
+	Products     []model.Product `json:"products,omitempty"`
+}
+
+func categoriesTree(a *app, args []string) error {
+	fs := flagSet("categories tree", "[flags]")
+	withProducts := fs.Bool("products", false, "show the products of every category")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	categories, err := a.catalog.Categories(a.ctx)
+	if err != nil {
+		return err
+	}
+	products := make(map[int][]model.Product)
+	counts := make(map[int]int)
+	if *withProducts {
+		all, err := a.catalog.ListProducts(a.ctx, 0, 0, []model.Order{{Field: "title", Asc: true}})
+		if err != nil {
+			return err
+		}
+		for _, p := range all {
+			products[p.CategoryId] = append(products[p.CategoryId], p)
+			counts[p.CategoryId]++
+		}
+	} else if counts, err = a.catalog.ProductCounts(a.ctx); err != nil {
+		return err
+	}
+
+	nodes := make([]categoryNode, len(categories))
+	total := 0
+	for i, c := range categories {
+		nodes[i] = categoryNode{Category: c, ProductCount: counts[c.Id], Products: products[c.Id]}
+		total += counts[c.Id]
+	}
+	if a.json {
+		return a.print(nodes, nil, nil)
+	}
+	fmt.Fprintf(a.out, "catalog: %d categories, %d products\n", len(nodes), total)
+	for i, node := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(a.out, "%s%s (id %d, position %d): %d products\n", branch, node.Category.Title,
+			node.Category.Id, node.Category.Position, node.ProductCount)
+		for j, p := range node.Products {
+			leaf := "├── "
+			if j == len(node.Products)-1 {
+				leaf = "└── "
+			}
+			fmt.Fprintf(a.out, "%s%s%s (%s)\n", indent, leaf, p.Title, p.Id)
+		}
+	}
+	return nil
+}
+
+// categoriesReorder gives the categories listed the first positions, in their order, and moves the rest after
+// them, keeping their order. The categories move in one transaction, so a failure moves none of them.
+func categoriesReorder(a *app, args []string) error {
+	fs := flagSet("categories reorder", "ID...")
+	if err := parse(fs, args, -1); err != nil {
+		return err
+	}
+	var ids []int
+	for _, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid category id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	ordered, err := a.catalog.ReorderCategories(a.ctx, ids)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, c := range ordered {
+		rows = append(rows, []string{strconv.Itoa(c.Position), strconv.Itoa(c.Id), c.Title})
+	}
+	return a.print(ordered, []string{"POSITION", "ID", "TITLE"}, rows)
+}
+
+func usersAdd(a *app, args []string) error {
+	fs := flagSet("users add", "USERNAME")
+	password := fs.String("password", "", "password, read from stdin if empty")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if err := a.readPassword(password); err != nil {
+		return err
+	}
+	if err := a.db.AddUser(model.User{Username: fs.Arg(0), Password: *password}); err != nil {
+		return err
+	}
+	return a.message("user %s added", fs.Arg(0))
+}
+
+func usersDisable(a *app, args []string) error {
+	fs := flagSet("users disable", "USERNAME")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if err := a.db.SetUserDisabled(fs.Arg(0), true); err != nil {
+		return err
+	}
+	return a.message("user %s disabled", fs.Arg(0))
+}
+
+func usersEnable(a *app, args []string) error {
+	fs := flagSet("users enable", "USERNAME")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if err := a.db.SetUserDisabled(fs.Arg(0), false); err != nil {
+		return err
+	}
+	return a.message("user %s enabled", fs.Arg(0))
+}
+
+func usersPasswd(a *app, args []string) error {
+	fs := flagSet("users passwd", "USERNAME")
+	password := fs.String("password", "", "new password, read from stdin if empty")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if err := a.readPassword(password); err != nil {
+		return err
+	}
+	if err := a.db.SetUserPassword(fs.Arg(0), *password); err != nil {
+		return err
+	}
+	return a.message("password of user %s changed", fs.Arg(0))
+}
+
+// readPassword reads a password from the first line of the input, unless one was given.
+func (a *app) readPassword(password *string) error {
+	if *password != "" {
+		return nil
+	}
+	line, err := bufio.NewReader(a.in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	*password = strings.TrimRight(line, "\r\n")
+	if *password == "" {
+		return errors.New("password is empty")
+	}
+	return nil
+}
+
+func cacheStats(a *app, args []string) error {
+	if err := a.requireCache(flagSet("cache stats", ""), args, 0); err != nil {
+		return err
+	}
+	stats, err := a.cache.Stats()
+	if err != nil {
+		return err
+	}
+	return a.print(stats, []string{"PRODUCTS", "CATEGORIES", "REQUESTS"}, [][]string{{
+		strconv.FormatInt(stats.Products, 10),
+		strconv.FormatInt(stats.Categories, 10),
+		strconv.FormatInt(stats.Requests, 10),
+	}})
+}
+
+func cacheFlush(a *app, args []string) error {
+	if err := a.requireCache(flagSet("cache flush", ""), args, 0); err != nil {
+		return err
+	}
+	if err := a.cache.Flush(); err != nil {
+		return err
+	}
+	return a.message("cache flushed")
+}
+
+func cacheWarm(a *app, args []string) error {
+	fs := flagSet("cache warm", "")
+	workers := fs.Int("workers", 4, "number of batches of products cached at the same time")
+	if err := a.requireCache(fs, args, 0); err != nil {
+		return err
+	}
+	result, err := common.PopulateRedis(a.ctx, a.db, a.cache, *workers)
+	if err != nil {
+		return err
+	}
+	if len(result.FailedCategories) > 0 || len(result.FailedProducts) > 0 {
+		return fmt.Errorf("%s: categories %v, products %v", result, result.FailedCategories, result.FailedProducts)
+	}
+	return a.message("cached %d categories and %d products", result.Categories, result.Products)
+}
+
+func cacheInspectKey(a *app, args []string) error {
+	fs := flagSet("cache inspect-key", "KEY\n\nKeys are product:ID, category:ID, or the ones of cached responses, "+
+		"e.g. json:/v1/products?page=2")
+	if err := a.requireCache(fs, args, 1); err != nil {
+		return err
+	}
+	key := fs.Arg(0)
+	var value string
+	var err error
+	switch {
+	case strings.HasPrefix(key, "product:"):
+		value, err = a.cache.GetProduct(strings.TrimPrefix(key, "product:"))
+	case strings.HasPrefix(key, "category:"):
+		value, err = a.cache.GetCategory(strings.TrimPrefix(key, "category:"))
+	default:
+		value, err = a.cache.GetApiRequest(key)
+	}
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("%s is not cached", key)
+	}
+	if a.json {
+		var decoded interface{}
+		if json.Unmarshal([]byte(value), &decoded) != nil {
+			decoded = value
+		}
+		return a.print(map[string]interface{}{"key": key, "value": decoded}, nil, nil)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(value), "", "  "); err == nil {
+		value = indented.String()
+	}
+	_, err = fmt.Fprintln(a.out, value)
+	return err
+}
+
+// requireCache parses the n arguments of a cache command, which needs a connection to redis.
+func (a *app) requireCache(fs *flag.FlagSet, args []string, n int) error {
+	if err := parse(fs, args, n); err != nil {
+		return err
+	}
+	if a.cache == nil {
+		return errors.New("redis is not connected")
+	}
+	return nil
+}
+
+func migrateStatus(a *app, args []string) error {
+	if err := parse(flagSet("migrate status", ""), args, 0); err != nil {
+		return err
+	}
+	states, err := a.migrator.Status(a.ctx)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, s := range states {
+		status := "pending"
+		switch {
+		case s.Unknown:
+			status = "unknown to this release"
+		case s.Modified:
+			status = "changed since applied"
+		case s.AppliedAt != nil:
+			status = "applied " + s.AppliedAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{strconv.Itoa(s.Version), s.Name, status})
+	}
+	return a.print(states, []string{"VERSION", "NAME", "STATUS"}, rows)
+}
+
+func migrateUp(a *app, args []string) error {
+	if err := parse(flagSet("migrate up", ""), args, 0); err != nil {
+		return err
+	}
+	count, err := a.migrator.Up(a.ctx)
+	if err != nil {
+		return err
+	}
+	return a.message("applied %d migrations", count)
+}
+
+func migrateDown(a *app, args []string) error {
+	fs := flagSet("migrate down", "[N]")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	steps := 1
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+	if fs.NArg() == 1 {
+		var err error
+		if steps, err = strconv.Atoi(fs.Arg(0)); err != nil || steps <= 0 {
+			return fmt.Errorf("invalid number of migrations %q", fs.Arg(0))
+		}
+	}
+	count, err := a.migrator.Down(a.ctx, steps)
+	if err != nil {
+		return err
+	}
+	return a.message("reverted %d migrations", count)
+}
+
+func migrateTo(a *app, args []string) error {
+	fs := flagSet("migrate to", "VERSION")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	version, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid version %q", fs.Arg(0))
+	}
+	count, err := a.migrator.To(a.ctx, version)
+	if err != nil {
+		return err
+	}
+	return a.message("applied or reverted %d migrations", count)
+}
+
+func exportProducts(a *app, args []string) error {
+	fs := flagSet("export", "[flags]")
+	var opts client.ExportOptions
+	fs.StringVar(&opts.Format, "format", export.FormatCsv, "csv, ndjson or xml")
+	fs.IntVar(&opts.Page, "page", 0, "page of the products to export, instead of all of them")
+	fs.IntVar(&opts.PerPage, "perPage", 0, "products per page (default 10)")
+	fs.IntVar(&opts.Offset, "offset", 0, "number of products to skip")
+	fs.IntVar(&opts.Limit, "limit", 0, "maximum number of products, 0 for all")
+	orderBy := fs.String("orderBy", "", "order of the products, e.g. category_id:asc,price:desc")
+	categories := fs.String("category", "", "comma separated ids of the categories of the products")
+	updatedSince := fs.String("updatedSince", "", "export the products updated at or after this RFC 3339 time")
+	output := fs.String("output", "-", "file to write, - for stdout")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	var err error
+	if opts.OrderBy, err = model.ParseOrderBy(*orderBy); err != nil {
+		return err
+	}
+	if *categories != "" {
+		for _, arg := range strings.Split(*categories, ",") {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid category id %q", arg)
+			}
+			opts.CategoryIds = append(opts.CategoryIds, id)
+		}
+	}
+	if *updatedSince != "" {
+		if opts.UpdatedSince, err = time.Parse(time.RFC3339, *updatedSince); err != nil {
+			return err
+		}
+	}
+	out := a.out
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+	if err := a.catalog.ExportProducts(a.ctx, opts, buffered); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+func importEntities(a *app, args []string) error {
+	fs := flagSet("import", "[flags] FILE\n\nFILE is csv or ndjson, - for stdin")
+	var opts client.ImportOptions
+	fs.StringVar(&opts.Entity, "entity", importer.EntityProduct, "product or category")
+	fs.StringVar(&opts.Format, "format", "", "csv or ndjson (default from the file extension)")
+	fs.StringVar(&opts.Delimiter, "delimiter", "", "delimiter of csv columns (default ,)")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "validate everything but store nothing")
+	columns := fs.String("columns", "", "names of the columns that differ from their fields, e.g. title=name,price=cost")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	file := fs.Arg(0)
+	if opts.Format == "" {
+		opts.Format = importer.FormatFromPath(file)
+	}
+	if *columns != "" {
+		opts.Columns = make(map[string]string)
+		for _, pair := range strings.Split(*columns, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("expected field=column, got %q", pair)
+			}
+			opts.Columns[parts[0]] = parts[1]
+		}
+	}
+	input := a.in
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+	report, err := a.catalog.Import(a.ctx, opts, input)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		err = a.print(report, nil, nil)
+	} else {
+		fmt.Fprintf(a.out, "%d lines: %d created, %d updated, %d unchanged, %d failed in %s\n", report.Lines,
+			report.Created, report.Updated, report.Unchanged, report.Failed, report.Duration)
+		var rows [][]string
+		for _, e := range report.Errors {
+			message := e.Message
+			if len(e.Errors) > 0 {
+				message += ": " + e.Errors.Error()
+			}
+			rows = append(rows, []string{strconv.Itoa(e.Line), e.Key, e.Code, message})
+		}
+		if len(rows) > 0 {
+			err = a.print(nil, []string{"LINE", "KEY", "CODE", "MESSAGE"}, rows)
+		}
+	}
+	if err == nil && report.Failed > 0 {
+		err = fmt.Errorf("%d lines failed", report.Failed)
+	}
+	return err
+}
+
+// print writes v as json with -o json, and a table of rows otherwise.
+func (a *app) print(v interface{}, header []string, rows [][]string) error {
+	if a.json {
+		encoder := json.NewEncoder(a.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message tells what a command did, as {"message": ...} with -o json.
+func (a *app) message(format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	if a.json {
+		return a.print(map[string]string{"message": message}, nil, nil)
+	}
+	_, err := fmt.Fprintln(a.out, message)
+	return err
+}
+
+func (a *app) printProduct(p model.Product) error {
+	if a.json {
+		// the category is not part of the json of a product
+		return a.print(struct {
+			model.Product
+			Category *model.Category `json:"category,omitempty"`
+		}{p, categoryOrNil(p.Category)}, nil, nil)
+	}
+	category := strconv.Itoa(p.CategoryId)
+	if p.Category.Id != 0 {
+		category += " (" + p.Category.Title + ")"
+	}
+	return a.print(nil, []string{"FIELD", "VALUE"}, [][]string{
+		{"id", p.Id},
+		{"sku", stringOrEmpty(p.Sku)},
+		{"category", category},
+		{"title", p.Title},
+		{"image_url", p.ImageUrl},
+		{"price", formatPrice(p.Price)},
+		{"description", p.Description},
+		{"created_at", p.CreatedAt.Format(timeFormat)},
+		{"updated_at", p.UpdatedAt.Format(timeFormat)},
+		{"version", strconv.Itoa(p.Version)},
+	})
+}
+
+const timeFormat = "2006-01-02 15:04:05"
+
+func categoryOrNil(c model.Category) *model.Category {
+	if c.Id == 0 {
+		return nil
+	}
+	return &c
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatPrice(price float32) string {
+	return strconv.FormatFloat(float64(price), 'f', 2, 32)
+}
@@ -0,0 +1,157 @@
+// Command smallctl runs the day to day operations of the catalog: products, categories, users, the cache, exports
+// and imports, and migrates the schema. It works on the database and Redis directly, configured with the DATABASE_URL
+// and REDIS_PATH of the API, or on a running API with -api:
+//
+//	smallctl migrate up
+//	smallctl products list -orderBy price:asc -limit 5
+//	smallctl -api http://localhost:8080 -user admin -password admin categories reorder 3 1 2
+//	smallctl -o json cache stats
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/panospet/small-api/internal/config"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/client"
+	"github.com/panospet/small-api/pkg/migrate"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+// errUsage is returned by commands called with the wrong arguments, after they printed their usage.
+var errUsage = errors.New("wrong usage")
+
+// app holds what the commands work on. With -api only catalog is set, as users, the cache and the schema are not
+// exposed by the API.
+type app struct {
+	ctx      context.Context
+	out      io.Writer
+	in       io.Reader
+	json     bool
+	catalog  catalog
+	db       services.DbService
+	cache    cache.Cacher
+	migrator *migrate.Migrator
+	actor    *model.Actor
+}
+
+func main() {
+	var apiUrl string
+	var user string
+	var password string
+	var output string
+
+	flag.StringVar(&apiUrl, "api", "", "url of a running API to work on, instead of the database and Redis")
+	flag.StringVar(&user, "user", "smallctl", "username for the API, and in the audit log")
+	flag.StringVar(&password, "password", os.Getenv("SMALLCTL_PASSWORD"),
+		"password for the API (default $SMALLCTL_PASSWORD)")
+	flag.StringVar(&output, "o", "table", "output format, table or json")
+	flag.Usage = usage
+	flag.Parse()
+
+	if output != "table" && output != "json" {
+		fmt.Fprintln(os.Stderr, "output must be table or json")
+		os.Exit(2)
+	}
+	cmd, args := findCommand(flag.Args())
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		cancel()
+	}()
+	a := &app{ctx: ctx, out: os.Stdout, in: os.Stdin, json: output == "json", actor: &model.Actor{Username: user}}
+	if apiUrl != "" {
+		if cmd.direct {
+			fmt.Fprintf(os.Stderr, "%s needs the database and Redis, it is not available with -api\n", cmd.name)
+			os.Exit(2)
+		}
+		var auth client.Authenticator
+		if password != "" {
+			auth = client.BasicAuth{Username: user, Password: password}
+		}
+		a.catalog = &apiCatalog{client: client.New(apiUrl, auth)}
+	} else {
+		conf := config.NewConfig()
+		db, err := services.Open(conf.DatabaseUrl)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not connect to the database:", err)
+			os.Exit(1)
+		}
+		a.db = db
+		if a.migrator, err = newMigrator(db.Conn.DB, db.Conn.DriverName()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// without redis everything but the cache commands still works, changed entities are served stale until
+		// they expire
+		if redis, err := cache.NewRedisCache(conf.RedisPath); err == nil {
+			a.cache = redis
+		} else {
+			warn("could not connect to redis, cache will not be updated:", err)
+		}
+		a.catalog = &dbCatalog{db: a.db, cache: a.cache, actor: a.actor, feed: conf.Feed}
+	}
+
+	if err := cmd.run(a, args); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, "smallctl:", err)
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: smallctl [flags] <command> [arguments]")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-34s %s\n", cmd.name+" "+cmd.args, cmd.description)
+	}
+	fmt.Fprintln(out, "\nRun smallctl <command> -h for the flags of a command.")
+}
+
+// findCommand returns the command named by the first arguments, e.g. "products list", and the rest of them.
+func findCommand(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// newMigrator returns the migrator of the schema embedded in smallctl, which tells what it does on stderr.
+func newMigrator(db *sql.DB, driver string) (*migrate.Migrator, error) {
+	m, err := migrate.NewEmbedded(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	m.Log = func(format string, v ...interface{}) {
+		warn(fmt.Sprintf(format, v...))
+	}
+	return m, nil
+}
+
+func warn(v ...interface{}) {
+	fmt.Fprintln(os.Stderr, v...)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/migrations"
+	"github.com/panospet/small-api/pkg/api"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/client"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+func newDirectApp() (*app, *services.DbServiceMock, *cache.CacherMock) {
+	db := services.NewMockDb()
+	cacher := cache.NewCacherMock()
+	actor := &model.Actor{Username: "smallctl"}
+	return &app{
+		ctx:     context.Background(),
+		db:      db,
+		cache:   cacher,
+		actor:   actor,
+		catalog: &dbCatalog{db: db, cache: cacher, actor: actor},
+	}, db, cacher
+}
+
+// newApiApp works on an API serving the mocks. The server has to be closed.
+func newApiApp() (*app, *services.DbServiceMock, *httptest.Server) {
+	db := services.NewMockDb()
+	_ = db.AddUser(model.User{Username: "admin", Password: "secret"})
+	server := httptest.NewServer(api.NewApi(db, cache.NewCacherMock()).Handler())
+	c := client.New(server.URL, client.BasicAuth{Username: "admin", Password: "secret"})
+	return &app{ctx: context.Background(), catalog: &apiCatalog{client: c}}, db, server
+}
+
+// run runs a command line of smallctl, and returns its output.
+func run(a *app, line string, input string) (string, error) {
+	var out bytes.Buffer
+	a.out = &out
+	a.in = strings.NewReader(input)
+	a.json = false
+	args := strings.Fields(line)
+	if args[0] == "-o" {
+		a.json = args[1] == "json"
+		args = args[2:]
+	}
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		panic("no command " + line)
+	}
+	err := cmd.run(a, rest)
+	return out.String(), err
+}
+
+func TestProducts(t *testing.T) {
+	direct, directDb, _ := newDirectApp()
+	remote, remoteDb, server := newApiApp()
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		app  *app
+		db   *services.DbServiceMock
+	}{{"direct", direct, directDb}, {"api", remote, remoteDb}} {
+		out, err := run(tt.app, "-o json products list -limit 3 -orderBy price:asc", "")
+		assert.Nil(t, err, tt.name)
+		var products []model.Product
+		assert.Nil(t, json.Unmarshal([]byte(out), &products), tt.name)
+		if tt.name == "api" {
+			// the mock database leaves limits to its callers
+			assert.Len(t, products, 3, tt.name)
+		}
+		assert.True(t, products[0].Price <= products[1].Price, tt.name)
+
+		id := tt.db.Products[0].Id
+		out, err = run(tt.app, "products get "+id, "")
+		assert.Nil(t, err, tt.name)
+		assert.Contains(t, out, id, tt.name)
+
+		out, err = run(tt.app, "products update "+id+" price=42 description=cheaper", "")
+		assert.Nil(t, err, tt.name)
+		assert.Contains(t, out, "42.00", tt.name)
+		assert.Equal(t, "cheaper", tt.db.Products[0].Description, tt.name)
+
+		_, err = run(tt.app, "products update "+id+" title=", "")
+		assert.NotNil(t, err, tt.name)
+
+		// the fields that the API does not let change cannot be changed on the database either
+		for _, field := range []string{"sku", "external_id", "version"} {
+			_, err = run(tt.app, "products update "+id+" "+field+"=7", "")
+			assert.NotNil(t, err, tt.name+" "+field)
+		}
+
+		out, err = run(tt.app, "-o json products create -title Lamp -category 1 -price 9.5 "+
+			"-image http://example.com/lamp.png", "")
+		assert.Nil(t, err, tt.name)
+		assert.Contains(t, out, tt.db.Products[len(tt.db.Products)-1].Id, tt.name)
+
+		out, err = run(tt.app, "products delete "+id, "")
+		assert.Nil(t, err, tt.name)
+		assert.Contains(t, out, "moved to the trash", tt.name)
+	}
+}
+
+func TestProductsCreateInvalid(t *testing.T) {
+	a, db, _ := newDirectApp()
+	count := len(db.Products)
+	_, err := run(a, "products create -title Lamp -category 1", "")
+	assert.NotNil(t, err)
+	assert.Len(t, db.Products, count)
+
+	// the category has to exist, as it has to for the API
+	_, err = run(a, "products create -title Lamp -category 99999 -price 9.5 -image http://example.com/lamp.png", "")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "category with id 99999 does not exist")
+	}
+	assert.Len(t, db.Products, count)
+	_, err = run(a, "products update "+db.Products[0].Id+" category_id=99999", "")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, 99999, db.Products[0].CategoryId)
+}
+
+func TestCategoriesTree(t *testing.T) {
+	a, db, _ := newDirectApp()
+	out, err := run(a, "-o json categories tree", "")
+	assert.Nil(t, err)
+	var nodes []categoryNode
+	assert.Nil(t, json.Unmarshal([]byte(out), &nodes))
+	assert.Len(t, nodes, len(db.Categories))
+	total := 0
+	for i, node := range nodes {
+		total += node.ProductCount
+		if i > 0 {
+			assert.True(t, nodes[i-1].Category.Position <= node.Category.Position)
+		}
+	}
+	assert.Equal(t, len(db.Products), total)
+
+	out, err = run(a, "categories tree -products", "")
+	assert.Nil(t, err)
+	assert.Contains(t, out, db.Products[0].Id)
+}
+
+func TestCategoriesReorder(t *testing.T) {
+	direct, _, _ := newDirectApp()
+	remote, _, server := newApiApp()
+	defer server.Close()
+
+	for _, a := range []*app{direct, remote} {
+		out, err := run(a, "-o json categories reorder 5 3", "")
+		assert.Nil(t, err)
+		var categories []model.Category
+		assert.Nil(t, json.Unmarshal([]byte(out), &categories))
+		assert.Equal(t, 5, categories[0].Id)
+		assert.Equal(t, 3, categories[1].Id)
+		for i, c := range categories {
+			assert.Equal(t, i+1, c.Position)
+		}
+
+		out, err = run(a, "-o json categories tree", "")
+		assert.Nil(t, err)
+		var nodes []categoryNode
+		assert.Nil(t, json.Unmarshal([]byte(out), &nodes))
+		assert.Equal(t, 5, nodes[0].Category.Id)
+
+		_, err = run(a, "categories reorder 5 5", "")
+		assert.NotNil(t, err)
+		_, err = run(a, "categories reorder 999", "")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	a, db, _ := newDirectApp()
+	_, err := run(a, "users add bob", "secret\n")
+	assert.Nil(t, err)
+	assert.True(t, db.UserExists("bob", "secret"))
+
+	_, err = run(a, "users disable bob", "")
+	assert.Nil(t, err)
+	assert.False(t, db.UserExists("bob", "secret"))
+	_, err = run(a, "users enable bob", "")
+	assert.Nil(t, err)
+	assert.True(t, db.UserExists("bob", "secret"))
+
+	_, err = run(a, "users passwd -password changed bob", "")
+	assert.Nil(t, err)
+	assert.True(t, db.UserExists("bob", "changed"))
+
+	_, err = run(a, "users disable alice", "")
+	assert.Equal(t, services.ErrUserNotFound, err)
+	_, err = run(a, "users add carol", "")
+	assert.NotNil(t, err)
+}
+
+func TestCache(t *testing.T) {
+	a, db, cacher := newDirectApp()
+	_, err := run(a, "cache warm", "")
+	assert.Nil(t, err)
+	cacher.Responses["json:/v1/products"] = "[]"
+
+	out, err := run(a, "-o json cache stats", "")
+	assert.Nil(t, err)
+	var stats cache.Stats
+	assert.Nil(t, json.Unmarshal([]byte(out), &stats))
+	assert.Equal(t, cache.Stats{Products: int64(len(db.Products)), Categories: int64(len(db.Categories)),
+		Requests: 1}, stats)
+
+	out, err = run(a, "cache inspect-key product:"+db.Products[0].Id, "")
+	assert.Nil(t, err)
+	assert.Contains(t, out, `"id": "`+db.Products[0].Id+`"`)
+	_, err = run(a, "cache inspect-key category:999", "")
+	assert.NotNil(t, err)
+
+	_, err = run(a, "cache flush", "")
+	assert.Nil(t, err)
+	stats, _ = cacher.Stats()
+	assert.Equal(t, cache.Stats{}, stats)
+
+	a.cache = nil
+	_, err = run(a, "cache stats", "")
+	assert.NotNil(t, err)
+}
+
+func TestExport(t *testing.T) {
+	direct, db, _ := newDirectApp()
+	remote, _, server := newApiApp()
+	defer server.Close()
+
+	for _, a := range []*app{direct, remote} {
+		out, err := run(a, "export -format ndjson", "")
+		assert.Nil(t, err)
+		assert.Equal(t, len(db.Products), strings.Count(out, "\n"))
+	}
+}
+
+func TestImport(t *testing.T) {
+	direct, _, _ := newDirectApp()
+	remote, _, server := newApiApp()
+	defer server.Close()
+	input := "external_id,title,position,image_url\n" +
+		"lamps,Lamps,3,http://example.com/lamps.png\n" +
+		"broken,,3,http://example.com/broken.png\n"
+
+	for _, a := range []*app{direct, remote} {
+		out, err := run(a, "import -entity category -format csv -", input)
+		assert.Equal(t, "1 lines failed", err.Error())
+		assert.Contains(t, out, "2 lines: 1 created")
+		assert.Contains(t, out, "required")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	a, _, _ := newDirectApp()
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	a.migrator, err = newMigrator(db, "mysql")
+	assert.Nil(t, err)
+	files, err := migrations.For("mysql")
+	assert.Nil(t, err)
+
+	// nothing applied yet
+	mock.ExpectQuery("column_name = 'dirty'").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("table_name = 'schema_migrations'").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	out, err := run(a, "migrate status", "")
+	assert.Nil(t, err)
+	assert.Contains(t, out, "create_tables")
+	assert.Equal(t, len(files)/2, strings.Count(out, "pending"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	_, err = run(a, "migrate to 999", "")
+	assert.Equal(t, "there is no migration 999", err.Error())
+	_, err = run(a, "migrate down zero", "")
+	assert.NotNil(t, err)
+}
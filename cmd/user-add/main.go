@@ -22,7 +22,7 @@ func main() {
 	}
 
 	conf := config.NewConfig()
-	db, err := services.NewDb(conf.MysqlPath)
+	db, err := services.Open(conf.DatabaseUrl)
 	if err != nil {
 		panic(err)
 	}
@@ -3,18 +3,40 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panospet/small-api/pkg/export"
 )
 
 type Config struct {
-	MysqlPath string
-	RedisPath string
+	// DatabaseUrl selects the database by its scheme, see services.Open
+	DatabaseUrl     string
+	RedisPath       string
+	ReadRateLimit   int
+	WriteRateLimit  int
+	TrashRetention  time.Duration
+	CacheControl    map[string]string
+	MaxBatchSize    int
+	CompressMinSize int
+	// MigrateOnStart applies pending migrations before serving
+	MigrateOnStart bool
+	// ApiKeys maps client names to the API keys they authenticate with
+	ApiKeys map[string]string
+	// Feed describes the shop of the XML export
+	Feed export.Feed
 }
 
 func NewConfig() *Config {
-	mysqlPath := os.Getenv("MYSQL_PATH")
-	if mysqlPath == "" {
-		log.Println("Mysql path from env is empty. Using default value")
-		mysqlPath = "bestprice:bestprice@(localhost:3305)/bestprice?parseTime=true"
+	// MYSQL_PATH predates the other databases, and is still read if DATABASE_URL is not set
+	databaseUrl := os.Getenv("DATABASE_URL")
+	if databaseUrl == "" {
+		databaseUrl = os.Getenv("MYSQL_PATH")
+	}
+	if databaseUrl == "" {
+		log.Println("Database url from env is empty. Using default value")
+		databaseUrl = "bestprice:bestprice@(localhost:3305)/bestprice?parseTime=true"
 	}
 	redisPath := os.Getenv("REDIS_PATH")
 	if redisPath == "" {
@@ -22,7 +44,78 @@ func NewConfig() *Config {
 		redisPath = "redis://localhost:6380/1"
 	}
 	return &Config{
-		MysqlPath: mysqlPath,
-		RedisPath: redisPath,
+		DatabaseUrl:     databaseUrl,
+		RedisPath:       redisPath,
+		ReadRateLimit:   intFromEnv("READ_RATE_LIMIT", 600),
+		WriteRateLimit:  intFromEnv("WRITE_RATE_LIMIT", 60),
+		TrashRetention:  durationFromEnv("TRASH_RETENTION", 30*24*time.Hour),
+		CacheControl:    pairsFromEnv("CACHE_CONTROL"),
+		MaxBatchSize:    intFromEnv("MAX_BATCH_SIZE", 1000),
+		CompressMinSize: intFromEnv("COMPRESS_MIN_SIZE", 1024),
+		MigrateOnStart:  boolFromEnv("MIGRATE_ON_START", false),
+		ApiKeys:         pairsFromEnv("API_KEYS"),
+		Feed: export.Feed{
+			Link:         os.Getenv("FEED_LINK"),
+			ProductLink:  os.Getenv("FEED_PRODUCT_LINK"),
+			Availability: os.Getenv("FEED_AVAILABILITY"),
+			Condition:    os.Getenv("FEED_CONDITION"),
+		},
+	}
+}
+
+func intFromEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Println("Invalid value for", name, "from env. Using default value")
+		return defaultValue
+	}
+	return i
+}
+
+func boolFromEnv(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Println("Invalid value for", name, "from env. Using default value")
+		return defaultValue
+	}
+	return b
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Println("Invalid value for", name, "from env. Using default value")
+		return defaultValue
+	}
+	return d
+}
+
+// pairsFromEnv parses names and values separated by semicolons, e.g. Cache-Control values per route in the form
+// "products.list=public, max-age=60;products.get=public, max-age=300".
+func pairsFromEnv(name string) map[string]string {
+	values := map[string]string{}
+	for _, entry := range strings.Split(os.Getenv(name), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			log.Println("Invalid entry", entry, "for", name, "from env. Ignoring it")
+			continue
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
 	}
+	return values
 }
@@ -1,4 +1,3 @@
-ALTER TABLE product DROP FOREIGN KEY fk_product_category_id;
 DROP TABLE IF EXISTS product;
 DROP TABLE IF EXISTS category;
 DROP TABLE IF EXISTS user;
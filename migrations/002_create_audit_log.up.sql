@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `username` VARCHAR(100) NOT NULL,
+  `action` VARCHAR(20) NOT NULL,
+  `entity_type` VARCHAR(20) NOT NULL,
+  `entity_id` VARCHAR(36) NOT NULL,
+  `diff` TEXT NOT NULL,
+  `request_id` VARCHAR(64) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (`id`),
+  INDEX idx_audit_log_entity (`entity_type`, `entity_id`),
+  INDEX idx_audit_log_username (`username`),
+  INDEX idx_audit_log_created_at (`created_at`)
+);
@@ -0,0 +1,4 @@
+DROP INDEX idx_category_deleted_at ON category;
+DROP INDEX idx_product_deleted_at ON product;
+ALTER TABLE category DROP COLUMN `deleted_at`;
+ALTER TABLE product DROP COLUMN `deleted_at`;
@@ -0,0 +1,4 @@
+ALTER TABLE product ADD COLUMN `sku` VARCHAR(64) NULL DEFAULT NULL;
+ALTER TABLE category ADD COLUMN `external_id` VARCHAR(64) NULL DEFAULT NULL;
+CREATE UNIQUE INDEX idx_product_sku ON product (`sku`);
+CREATE UNIQUE INDEX idx_category_external_id ON category (`external_id`);
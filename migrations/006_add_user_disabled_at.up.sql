@@ -0,0 +1 @@
+ALTER TABLE `user` ADD COLUMN `disabled_at` TIMESTAMP NULL DEFAULT NULL;
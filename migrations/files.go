@@ -0,0 +1,49 @@
+// Code generated by go run gen.go; DO NOT EDIT.
+
+package migrations
+
+// files are the sql files of the migrations of every driver, by name.
+var files = map[string]map[string]string{
+	"mysql": {
+		"001_create_tables.down.sql":        "DROP TABLE IF EXISTS product;\nDROP TABLE IF EXISTS category;\nDROP TABLE IF EXISTS user;\n",
+		"001_create_tables.up.sql":          "CREATE TABLE IF NOT EXISTS category (\n  `id` INTEGER NOT NULL AUTO_INCREMENT,\n  `title` VARCHAR(100) NOT NULL,\n  `pos` INTEGER NOT NULL,\n  `image_url` VARCHAR(512) NOT NULL,\n  `created_at` TIMESTAMP NOT NULL DEFAULT NOW(),\n  `updated_at` TIMESTAMP NOT NULL DEFAULT NOW(),\n  PRIMARY KEY (`id`)\n);\n\nCREATE TABLE IF NOT EXISTS product (\n  `id` VARCHAR(36) NOT NULL,\n  `category_id` INT,\n  `title` VARCHAR(100) NOT NULL,\n  `image_url` VARCHAR(512) NOT NULL,\n  `price` FLOAT NOT NULL,\n  `description` TEXT,\n  `created_at` TIMESTAMP NOT NULL DEFAULT NOW(),\n  `updated_at` TIMESTAMP NOT NULL DEFAULT NOW(),\n  PRIMARY KEY (`id`)\n);\n\nALTER TABLE product ADD CONSTRAINT fk_product_category_id FOREIGN KEY (category_id) REFERENCES category(id);\n\nCREATE TABLE IF NOT EXISTS `user` (\n  `id` INTEGER NOT NULL AUTO_INCREMENT,\n  `username` VARCHAR(100) NOT NULL,\n  `password` VARCHAR(60) NOT NULL,\n  `created_at` TIMESTAMP NOT NULL DEFAULT NOW(),\n  PRIMARY KEY (`id`)\n);\n",
+		"002_create_audit_log.down.sql":     "DROP TABLE IF EXISTS audit_log;\n",
+		"002_create_audit_log.up.sql":       "CREATE TABLE IF NOT EXISTS audit_log (\n  `id` BIGINT NOT NULL AUTO_INCREMENT,\n  `username` VARCHAR(100) NOT NULL,\n  `action` VARCHAR(20) NOT NULL,\n  `entity_type` VARCHAR(20) NOT NULL,\n  `entity_id` VARCHAR(36) NOT NULL,\n  `diff` TEXT NOT NULL,\n  `request_id` VARCHAR(64) NOT NULL DEFAULT '',\n  `created_at` TIMESTAMP NOT NULL DEFAULT NOW(),\n  PRIMARY KEY (`id`),\n  INDEX idx_audit_log_entity (`entity_type`, `entity_id`),\n  INDEX idx_audit_log_username (`username`),\n  INDEX idx_audit_log_created_at (`created_at`)\n);\n",
+		"003_add_deleted_at.down.sql":       "DROP INDEX idx_category_deleted_at ON category;\nDROP INDEX idx_product_deleted_at ON product;\nALTER TABLE category DROP COLUMN `deleted_at`;\nALTER TABLE product DROP COLUMN `deleted_at`;\n",
+		"003_add_deleted_at.up.sql":         "ALTER TABLE product ADD COLUMN `deleted_at` TIMESTAMP NULL DEFAULT NULL;\nALTER TABLE category ADD COLUMN `deleted_at` TIMESTAMP NULL DEFAULT NULL;\nCREATE INDEX idx_product_deleted_at ON product (`deleted_at`);\nCREATE INDEX idx_category_deleted_at ON category (`deleted_at`);\n",
+		"004_add_version.down.sql":          "ALTER TABLE category DROP COLUMN `version`;\nALTER TABLE product DROP COLUMN `version`;\n",
+		"004_add_version.up.sql":            "ALTER TABLE product ADD COLUMN `version` INTEGER NOT NULL DEFAULT 1;\nALTER TABLE category ADD COLUMN `version` INTEGER NOT NULL DEFAULT 1;\n",
+		"005_add_external_ids.down.sql":     "DROP INDEX idx_category_external_id ON category;\nDROP INDEX idx_product_sku ON product;\nALTER TABLE category DROP COLUMN `external_id`;\nALTER TABLE product DROP COLUMN `sku`;\n",
+		"005_add_external_ids.up.sql":       "ALTER TABLE product ADD COLUMN `sku` VARCHAR(64) NULL DEFAULT NULL;\nALTER TABLE category ADD COLUMN `external_id` VARCHAR(64) NULL DEFAULT NULL;\nCREATE UNIQUE INDEX idx_product_sku ON product (`sku`);\nCREATE UNIQUE INDEX idx_category_external_id ON category (`external_id`);\n",
+		"006_add_user_disabled_at.down.sql": "ALTER TABLE `user` DROP COLUMN `disabled_at`;\n",
+		"006_add_user_disabled_at.up.sql":   "ALTER TABLE `user` ADD COLUMN `disabled_at` TIMESTAMP NULL DEFAULT NULL;\n",
+	},
+	"postgres": {
+		"001_create_tables.down.sql":        "DROP TABLE IF EXISTS product;\nDROP TABLE IF EXISTS category;\nDROP TABLE IF EXISTS \"user\";\n",
+		"001_create_tables.up.sql":          "CREATE TABLE IF NOT EXISTS category (\n  id SERIAL NOT NULL,\n  title VARCHAR(100) NOT NULL,\n  pos INTEGER NOT NULL,\n  image_url VARCHAR(512) NOT NULL,\n  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  PRIMARY KEY (id)\n);\n\nCREATE TABLE IF NOT EXISTS product (\n  id VARCHAR(36) NOT NULL,\n  category_id INTEGER,\n  title VARCHAR(100) NOT NULL,\n  image_url VARCHAR(512) NOT NULL,\n  price REAL NOT NULL,\n  description TEXT,\n  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  PRIMARY KEY (id)\n);\n\nALTER TABLE product ADD CONSTRAINT fk_product_category_id FOREIGN KEY (category_id) REFERENCES category(id);\n\nCREATE TABLE IF NOT EXISTS \"user\" (\n  id SERIAL NOT NULL,\n  username VARCHAR(100) NOT NULL,\n  password VARCHAR(60) NOT NULL,\n  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  PRIMARY KEY (id)\n);\n",
+		"002_create_audit_log.down.sql":     "DROP TABLE IF EXISTS audit_log;\n",
+		"002_create_audit_log.up.sql":       "CREATE TABLE IF NOT EXISTS audit_log (\n  id BIGSERIAL NOT NULL,\n  username VARCHAR(100) NOT NULL,\n  action VARCHAR(20) NOT NULL,\n  entity_type VARCHAR(20) NOT NULL,\n  entity_id VARCHAR(36) NOT NULL,\n  diff TEXT NOT NULL,\n  request_id VARCHAR(64) NOT NULL DEFAULT '',\n  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  PRIMARY KEY (id)\n);\nCREATE INDEX idx_audit_log_entity ON audit_log (entity_type, entity_id);\nCREATE INDEX idx_audit_log_username ON audit_log (username);\nCREATE INDEX idx_audit_log_created_at ON audit_log (created_at);\n",
+		"003_add_deleted_at.down.sql":       "DROP INDEX idx_category_deleted_at;\nDROP INDEX idx_product_deleted_at;\nALTER TABLE category DROP COLUMN deleted_at;\nALTER TABLE product DROP COLUMN deleted_at;\n",
+		"003_add_deleted_at.up.sql":         "ALTER TABLE product ADD COLUMN deleted_at TIMESTAMPTZ NULL DEFAULT NULL;\nALTER TABLE category ADD COLUMN deleted_at TIMESTAMPTZ NULL DEFAULT NULL;\nCREATE INDEX idx_product_deleted_at ON product (deleted_at);\nCREATE INDEX idx_category_deleted_at ON category (deleted_at);\n",
+		"004_add_version.down.sql":          "ALTER TABLE category DROP COLUMN version;\nALTER TABLE product DROP COLUMN version;\n",
+		"004_add_version.up.sql":            "ALTER TABLE product ADD COLUMN version INTEGER NOT NULL DEFAULT 1;\nALTER TABLE category ADD COLUMN version INTEGER NOT NULL DEFAULT 1;\n",
+		"005_add_external_ids.down.sql":     "DROP INDEX idx_category_external_id;\nDROP INDEX idx_product_sku;\nALTER TABLE category DROP COLUMN external_id;\nALTER TABLE product DROP COLUMN sku;\n",
+		"005_add_external_ids.up.sql":       "ALTER TABLE product ADD COLUMN sku VARCHAR(64) NULL DEFAULT NULL;\nALTER TABLE category ADD COLUMN external_id VARCHAR(64) NULL DEFAULT NULL;\nCREATE UNIQUE INDEX idx_product_sku ON product (sku);\nCREATE UNIQUE INDEX idx_category_external_id ON category (external_id);\n",
+		"006_add_user_disabled_at.down.sql": "ALTER TABLE \"user\" DROP COLUMN disabled_at;\n",
+		"006_add_user_disabled_at.up.sql":   "ALTER TABLE \"user\" ADD COLUMN disabled_at TIMESTAMPTZ NULL DEFAULT NULL;\n",
+	},
+	"sqlite3": {
+		"001_create_tables.down.sql":        "DROP TABLE IF EXISTS product;\nDROP TABLE IF EXISTS category;\nDROP TABLE IF EXISTS \"user\";\n",
+		"001_create_tables.up.sql":          "CREATE TABLE IF NOT EXISTS category (\n  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,\n  title VARCHAR(100) NOT NULL,\n  pos INTEGER NOT NULL,\n  image_url VARCHAR(512) NOT NULL,\n  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\n\nCREATE TABLE IF NOT EXISTS product (\n  id VARCHAR(36) NOT NULL PRIMARY KEY,\n  category_id INTEGER CONSTRAINT fk_product_category_id REFERENCES category(id),\n  title VARCHAR(100) NOT NULL,\n  image_url VARCHAR(512) NOT NULL,\n  price REAL NOT NULL,\n  description TEXT,\n  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\n  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\n\nCREATE TABLE IF NOT EXISTS \"user\" (\n  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,\n  username VARCHAR(100) NOT NULL,\n  password VARCHAR(60) NOT NULL,\n  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\n",
+		"002_create_audit_log.down.sql":     "DROP TABLE IF EXISTS audit_log;\n",
+		"002_create_audit_log.up.sql":       "CREATE TABLE IF NOT EXISTS audit_log (\n  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,\n  username VARCHAR(100) NOT NULL,\n  action VARCHAR(20) NOT NULL,\n  entity_type VARCHAR(20) NOT NULL,\n  entity_id VARCHAR(36) NOT NULL,\n  diff TEXT NOT NULL,\n  request_id VARCHAR(64) NOT NULL DEFAULT '',\n  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE INDEX idx_audit_log_entity ON audit_log (entity_type, entity_id);\nCREATE INDEX idx_audit_log_username ON audit_log (username);\nCREATE INDEX idx_audit_log_created_at ON audit_log (created_at);\n",
+		"003_add_deleted_at.down.sql":       "DROP INDEX idx_category_deleted_at;\nDROP INDEX idx_product_deleted_at;\nALTER TABLE category DROP COLUMN deleted_at;\nALTER TABLE product DROP COLUMN deleted_at;\n",
+		"003_add_deleted_at.up.sql":         "ALTER TABLE product ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;\nALTER TABLE category ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;\nCREATE INDEX idx_product_deleted_at ON product (deleted_at);\nCREATE INDEX idx_category_deleted_at ON category (deleted_at);\n",
+		"004_add_version.down.sql":          "ALTER TABLE category DROP COLUMN version;\nALTER TABLE product DROP COLUMN version;\n",
+		"004_add_version.up.sql":            "ALTER TABLE product ADD COLUMN version INTEGER NOT NULL DEFAULT 1;\nALTER TABLE category ADD COLUMN version INTEGER NOT NULL DEFAULT 1;\n",
+		"005_add_external_ids.down.sql":     "DROP INDEX idx_category_external_id;\nDROP INDEX idx_product_sku;\nALTER TABLE category DROP COLUMN external_id;\nALTER TABLE product DROP COLUMN sku;\n",
+		"005_add_external_ids.up.sql":       "ALTER TABLE product ADD COLUMN sku VARCHAR(64) NULL DEFAULT NULL;\nALTER TABLE category ADD COLUMN external_id VARCHAR(64) NULL DEFAULT NULL;\nCREATE UNIQUE INDEX idx_product_sku ON product (sku);\nCREATE UNIQUE INDEX idx_category_external_id ON category (external_id);\n",
+		"006_add_user_disabled_at.down.sql": "ALTER TABLE \"user\" DROP COLUMN disabled_at;\n",
+		"006_add_user_disabled_at.up.sql":   "ALTER TABLE \"user\" ADD COLUMN disabled_at TIMESTAMP NULL DEFAULT NULL;\n",
+	},
+}
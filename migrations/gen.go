@@ -0,0 +1,52 @@
+// +build ignore
+
+// gen writes files.go, which embeds the sql files of this directory, the ones of MySQL, and of its postgres and
+// sqlite directories in the binaries that apply them.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+// dirs are the directories of the migrations of every driver
+var dirs = []struct {
+	driver string
+	dir    string
+}{{"mysql", "."}, {"postgres", "postgres"}, {"sqlite3", "sqlite"}}
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by go run gen.go; DO NOT EDIT.\n\npackage migrations\n\n")
+	buf.WriteString("// files are the sql files of the migrations of every driver, by name.\n")
+	buf.WriteString("var files = map[string]map[string]string{\n")
+	for _, d := range dirs {
+		paths, err := filepath.Glob(filepath.Join(d.dir, "*.sql"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(&buf, "\t%q: {\n", d.driver)
+		for _, path := range paths {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(&buf, "\t\t%q: %q,\n", filepath.Base(path), content)
+		}
+		buf.WriteString("\t},\n")
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("files.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
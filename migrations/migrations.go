@@ -0,0 +1,21 @@
+// Package migrations holds the schema of the database, as pairs of up and down sql files named
+// {version}_{name}.up.sql and {version}_{name}.down.sql: the ones of MySQL in this directory, and the ones of
+// PostgreSQL and SQLite in the postgres and sqlite directories, with the same versions. The files are embedded in
+// files.go, to be applied by package migrate; run go generate in this directory after adding or changing one.
+package migrations
+
+import "fmt"
+
+//go:generate go run gen.go
+
+// Drivers are the database drivers that there are migrations for.
+var Drivers = []string{"mysql", "postgres", "sqlite3"}
+
+// For returns the files of the migrations of a database driver, by name.
+func For(driver string) (map[string]string, error) {
+	f, ok := files[driver]
+	if !ok {
+		return nil, fmt.Errorf("there are no migrations for %s databases", driver)
+	}
+	return f, nil
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesAreGenerated(t *testing.T) {
+	for _, d := range []struct {
+		driver string
+		dir    string
+	}{{"mysql", "."}, {"postgres", "postgres"}, {"sqlite3", "sqlite"}} {
+		paths, err := filepath.Glob(filepath.Join(d.dir, "*.sql"))
+		assert.Nil(t, err)
+		files, err := For(d.driver)
+		assert.Nil(t, err)
+		assert.Len(t, files, len(paths), "run go generate in the migrations directory")
+		for _, path := range paths {
+			content, err := ioutil.ReadFile(path)
+			assert.Nil(t, err)
+			assert.Equal(t, string(content), files[filepath.Base(path)],
+				"%s changed, run go generate in the migrations directory", path)
+		}
+	}
+}
+
+// TestSameVersions checks that every driver has the same migrations, so that versions mean the same schema.
+func TestSameVersions(t *testing.T) {
+	mysql, _ := For("mysql")
+	for _, driver := range Drivers {
+		files, err := For(driver)
+		assert.Nil(t, err)
+		assert.Len(t, files, len(mysql), driver)
+		for name := range mysql {
+			assert.Contains(t, files, name, driver)
+		}
+	}
+	_, err := For("oracle")
+	assert.NotNil(t, err)
+}
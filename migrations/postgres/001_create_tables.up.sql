@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS category (
+  id SERIAL NOT NULL,
+  title VARCHAR(100) NOT NULL,
+  pos INTEGER NOT NULL,
+  image_url VARCHAR(512) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS product (
+  id VARCHAR(36) NOT NULL,
+  category_id INTEGER,
+  title VARCHAR(100) NOT NULL,
+  image_url VARCHAR(512) NOT NULL,
+  price REAL NOT NULL,
+  description TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+ALTER TABLE product ADD CONSTRAINT fk_product_category_id FOREIGN KEY (category_id) REFERENCES category(id);
+
+CREATE TABLE IF NOT EXISTS "user" (
+  id SERIAL NOT NULL,
+  username VARCHAR(100) NOT NULL,
+  password VARCHAR(60) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGSERIAL NOT NULL,
+  username VARCHAR(100) NOT NULL,
+  action VARCHAR(20) NOT NULL,
+  entity_type VARCHAR(20) NOT NULL,
+  entity_id VARCHAR(36) NOT NULL,
+  diff TEXT NOT NULL,
+  request_id VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+CREATE INDEX idx_audit_log_entity ON audit_log (entity_type, entity_id);
+CREATE INDEX idx_audit_log_username ON audit_log (username);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE product ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE category ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+DROP INDEX idx_category_external_id;
+DROP INDEX idx_product_sku;
+ALTER TABLE category DROP COLUMN external_id;
+ALTER TABLE product DROP COLUMN sku;
@@ -0,0 +1 @@
+ALTER TABLE "user" ADD COLUMN disabled_at TIMESTAMPTZ NULL DEFAULT NULL;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS category (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  title VARCHAR(100) NOT NULL,
+  pos INTEGER NOT NULL,
+  image_url VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS product (
+  id VARCHAR(36) NOT NULL PRIMARY KEY,
+  category_id INTEGER CONSTRAINT fk_product_category_id REFERENCES category(id),
+  title VARCHAR(100) NOT NULL,
+  image_url VARCHAR(512) NOT NULL,
+  price REAL NOT NULL,
+  description TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS "user" (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(100) NOT NULL,
+  password VARCHAR(60) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
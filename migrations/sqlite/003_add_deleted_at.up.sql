@@ -0,0 +1,4 @@
+ALTER TABLE product ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE category ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+CREATE INDEX idx_product_deleted_at ON product (deleted_at);
+CREATE INDEX idx_category_deleted_at ON category (deleted_at);
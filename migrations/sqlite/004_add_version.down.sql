@@ -0,0 +1,2 @@
+ALTER TABLE category DROP COLUMN version;
+ALTER TABLE product DROP COLUMN version;
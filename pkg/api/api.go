@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,17 +10,34 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/export"
 	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/ratelimit"
 	"github.com/panospet/small-api/pkg/services"
 )
 
 type Api struct {
-	Db    services.DbService
-	Cache cache.Cacher
+	Db        services.DbService
+	Cache     cache.Cacher
+	Limiter   ratelimit.Limiter
+	ReadRate  ratelimit.Rate
+	WriteRate ratelimit.Rate
+	// CacheControl maps route names, e.g. "products.list", to the Cache-Control header of their responses
+	CacheControl map[string]string
+	// MaxBatchSize is the maximum number of operations of a batch request, defaultMaxBatchSize if 0
+	MaxBatchSize int
+	// CompressMinSize is the size in bytes from which responses are compressed, defaultCompressMinSize if 0
+	CompressMinSize int
+	// ApiKeys maps the names of clients, e.g. a gateway, to the key they send in an X-Api-Key header instead of
+	// credentials of a user
+	ApiKeys map[string]string
+	// Feed describes the shop of the XML export, export.DefaultFeed for empty fields
+	Feed export.Feed
 }
 
 func NewApi(db services.DbService, cache cache.Cacher) *Api {
@@ -28,87 +47,160 @@ func NewApi(db services.DbService, cache cache.Cacher) *Api {
 	}
 }
 
+type contextKey string
+
+const (
+	userContextKey   contextKey = "user"
+	apiKeyContextKey contextKey = "apiKey"
+)
+
+// Authenticator lets through requests with the credentials of a user, or with one of the API keys of app. The
+// client of an API key is the user of the request, e.g. in the audit log.
 func Authenticator(nextHandler http.HandlerFunc, app *Api) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-Api-Key"); key != "" {
+			client, ok := app.apiKeyClient(key)
+			if !ok {
+				respondWithError(w, http.StatusUnauthorized, "Authorization failed")
+				return
+			}
+			ctx := context.WithValue(r.Context(), apiKeyContextKey, client)
+			nextHandler(w, r.WithContext(context.WithValue(ctx, userContextKey, client)))
+			return
+		}
 		authenticated := false
-		if username, password, ok := r.BasicAuth(); ok {
+		username, password, ok := r.BasicAuth()
+		if ok {
 			authenticated = app.Db.UserExists(username, password)
 		}
 		if !authenticated {
 			respondWithError(w, http.StatusUnauthorized, "Authorization failed")
 			return
 		}
-		nextHandler(w, r)
+		nextHandler(w, r.WithContext(context.WithValue(r.Context(), userContextKey, username)))
+	}
+}
+
+// apiKeyClient returns the client of key, comparing it to every API key in constant time.
+func (a *Api) apiKeyClient(key string) (string, bool) {
+	client, found := "", false
+	for name, k := range a.ApiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			client, found = name, true
+		}
 	}
+	return client, found
+}
+
+// userFromRequest returns the username stored by Authenticator, if the request went through it.
+func userFromRequest(r *http.Request) (string, bool) {
+	username, ok := r.Context().Value(userContextKey).(string)
+	return username, ok
+}
+
+// apiKeyFromRequest returns the client of the API key stored by Authenticator, if the request was authenticated by
+// one.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	client, ok := r.Context().Value(apiKeyContextKey).(string)
+	return client, ok
+}
+
+// authenticated requires credentials for nextHandler, and limits it to rate twice: failed authentications per IP,
+// so that guessing credentials is limited, and authenticated requests per client.
+func (a *Api) authenticated(nextHandler http.HandlerFunc, rate ratelimit.Rate) http.HandlerFunc {
+	return FailedAuthLimiter(Authenticator(RateLimiter(nextHandler, a, rate), a), a, rate)
 }
 
 func (a *Api) Run() {
+	log.Println("API is starting...")
+	err := a.Server(":8080").ListenAndServe()
+	if err != nil {
+		panic(fmt.Sprintf("API error: %s", err))
+	}
+}
+
+// Server returns the server of Run, listening on addr, without starting it.
+func (a *Api) Server(addr string) *http.Server {
+	return &http.Server{Addr: addr, Handler: a.Handler()}
+}
+
+// Handler returns the routes of the API, to be served by a server other than the one of Run, e.g. in tests.
+func (a *Api) Handler() http.Handler {
+	return a.router()
+}
+
+// router registers every route of the API. The OpenAPI document describes all of them.
+func (a *Api) router() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(RequestId)
+	router.Use(CacheController(a))
+	router.Use(Compressor(a))
 	router.HandleFunc("/", a.health)
+	router.HandleFunc("/openapi.json", a.openApi).Methods("GET").Name("openapi")
+	router.HandleFunc("/docs", a.docs).Methods("GET").Name("docs")
 
 	// products
-	router.HandleFunc("/v1/products", a.getListProducts).Methods("GET")
-	router.HandleFunc("/v1/products/{id}", a.getProduct).Methods("GET")
-	router.HandleFunc("/v1/products", Authenticator(a.createProduct, a)).Methods("POST")
-	router.HandleFunc("/v1/products/{id}", Authenticator(a.updateProduct, a)).Methods("PATCH")
-	router.HandleFunc("/v1/products/{id}", Authenticator(a.deleteProduct, a)).Methods("DELETE")
+	router.HandleFunc("/v1/products", RateLimiter(a.getListProducts, a, a.ReadRate)).Methods("GET").Name("products.list")
+	router.HandleFunc("/v1/products/{id}", RateLimiter(a.getProduct, a, a.ReadRate)).Methods("GET").Name("products.get")
+	router.HandleFunc("/v1/products", a.authenticated(a.createProduct, a.WriteRate)).Methods("POST")
+	router.HandleFunc("/v1/products/{id}", a.authenticated(a.updateProduct, a.WriteRate)).Methods("PATCH")
+	router.HandleFunc("/v1/products/{id}", a.authenticated(a.deleteProduct, a.WriteRate)).Methods("DELETE")
+	router.HandleFunc("/v1/products:batch", a.authenticated(a.batchProducts, a.WriteRate)).Methods("POST")
+	router.HandleFunc("/v1/products/{id}/restore", a.authenticated(a.restoreProduct, a.WriteRate)).Methods("POST")
 
 	// categories
-	router.HandleFunc("/v1/categories", a.getListCategories).Methods("GET")
-	router.HandleFunc("/v1/categories/{id}", a.getCategory).Methods("GET")
-	router.HandleFunc("/v1/categories", Authenticator(a.createCategory, a)).Methods("POST")
-	router.HandleFunc("/v1/categories/{id}", Authenticator(a.updateCategory, a)).Methods("PATCH")
-	router.HandleFunc("/v1/categories/{id}", Authenticator(a.deleteCategory, a)).Methods("DELETE")
+	router.HandleFunc("/v1/categories", RateLimiter(a.getListCategories, a, a.ReadRate)).Methods("GET").Name("categories.list")
+	router.HandleFunc("/v1/categories/{id}", RateLimiter(a.getCategory, a, a.ReadRate)).Methods("GET").Name("categories.get")
+	router.HandleFunc("/v1/categories", a.authenticated(a.createCategory, a.WriteRate)).Methods("POST")
+	router.HandleFunc("/v1/categories:reorder", a.authenticated(a.reorderCategories, a.WriteRate)).Methods("POST")
+	router.HandleFunc("/v1/categories/{id}", a.authenticated(a.updateCategory, a.WriteRate)).Methods("PATCH")
+	router.HandleFunc("/v1/categories/{id}", a.authenticated(a.deleteCategory, a.WriteRate)).Methods("DELETE")
+	router.HandleFunc("/v1/categories/{id}/restore", a.authenticated(a.restoreCategory, a.WriteRate)).Methods("POST")
 
-	log.Println("API is starting...")
-	err := http.ListenAndServe(":8080", router)
-	if err != nil {
-		panic(fmt.Sprintf("API error: %s", err))
-	}
+	// export
+	router.HandleFunc("/v1/export/products", RateLimiter(a.exportProducts, a, a.ReadRate)).Methods("GET").Name("export.products")
+
+	// import
+	router.HandleFunc("/v1/import", a.authenticated(a.importEntities, a.WriteRate)).Methods("POST")
+
+	// trash
+	router.HandleFunc("/v1/trash", a.authenticated(a.getTrash, a.ReadRate)).Methods("GET")
+
+	// audit log
+	router.HandleFunc("/v1/audit", a.authenticated(a.getAuditLog, a.ReadRate)).Methods("GET")
+
+	return router
 }
 
 func (a *Api) getListProducts(w http.ResponseWriter, r *http.Request) {
-	var foundInCache bool
-	if cachedRes, err := a.Cache.GetApiRequest(r.URL.String()); err == nil && cachedRes != "" {
-		fmt.Println("found response for", r.URL, "in cache")
-		foundInCache = true
-		respondCachedWithJson(w, http.StatusOK, []byte(cachedRes))
+	format, ok := listFormat(w, r)
+	if !ok {
+		return
+	}
+	sel, err := selectionFromRequest(r, model.Product{}, productIncludes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cacheKey := listCacheKey(r, format)
+	if a.respondWithCachedList(w, r, format, cacheKey) {
+		return
+	}
+	orderBy, err := orderByFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
-	} else if err != nil {
-		log.Println(fmt.Sprintf("error getting response for request '%s' from cache: %s", r.URL.String(), err))
-	}
-	foundInCache = false
-	orderByValue := r.FormValue("orderBy")
-	var asc bool
-	var orderBy string
-	if orderByValue != "" {
-		parts := strings.Split(orderByValue, ":")
-		if len(parts) > 2 {
-			respondWithError(w, http.StatusBadRequest, "Bad order by value. Example \"orderBy=title:asc\"")
-			return
-		}
-		orderBy = parts[0]
-		if len(parts) > 1 {
-			if parts[1] == "asc" {
-				asc = true
-			} else if parts[1] == "desc" {
-				asc = false
-			} else {
-				respondWithError(w, http.StatusBadRequest, "Bad order by value. Example \"orderBy=price:asc\"")
-				return
-			}
-		}
 	}
 	p, err := getPaginationFromRequest(r)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Error in pagination values")
 		return
 	}
-	products, err := a.Db.GetProducts(p.offset, p.limit, orderBy, asc)
+	products, err := a.Db.GetProducts(p.offset, p.limit, orderBy)
 	total := len(products)
 	if err != nil {
 		log.Println("error while getting products", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while getting products")
+		respondWithProblem(w, err)
 		return
 	}
 	if p.start > total-1 {
@@ -119,32 +211,82 @@ func (a *Api) getListProducts(w http.ResponseWriter, r *http.Request) {
 	if p.end > total {
 		end = total
 	}
-	setPaginationHeaders(w, r, p, total)
-	if !foundInCache {
-		go a.cacheResponse(r.URL.String(), products[p.start:end])
+	var items interface{} = products[p.start:end]
+	if sel != nil {
+		items = sel.products(products[p.start:end])
 	}
-	respondWithJSON(w, http.StatusOK, products[p.start:end])
+	body, err := encodeList(format, "products", "product", items)
+	if err != nil {
+		log.Println("error while encoding products", err)
+		respondWithProblem(w, err)
+		return
+	}
+	setPaginationHeaders(w, r, p, total)
+	go a.cacheList(cacheKey, total, body)
+	respondCachedList(w, r, format, body)
 }
 
 func (a *Api) getProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	sel, err := selectionFromRequest(r, model.Product{}, productIncludes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if cacheRes, err := a.Cache.GetProduct(id); err == nil && cacheRes != "" {
 		fmt.Println("got product", id, "from cache")
-		respondCachedWithJson(w, http.StatusOK, []byte(cacheRes))
-		return
+		if sel == nil {
+			etag, lastModified := cachedValidators(cacheRes, formatJson, nil)
+			if notModified(w, r, etag, lastModified) {
+				return
+			}
+			respondCachedWithJson(w, http.StatusOK, []byte(cacheRes))
+			return
+		}
+		var product model.Product
+		if err := json.Unmarshal([]byte(cacheRes), &product); err == nil {
+			a.respondWithSelectedProduct(w, r, product, sel)
+			return
+		}
 	} else if err != nil {
 		log.Println("error getting from cache product with id", id, err)
 	}
 	product, err := a.Db.GetProduct(id)
 	if err != nil {
 		log.Println("error while getting product", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while getting product")
+		respondWithProblem(w, err)
+		return
+	}
+	if sel != nil {
+		a.respondWithSelectedProduct(w, r, product, sel)
+		return
+	}
+	if notModified(w, r, resourceETag(product.Version, formatJson, nil), product.UpdatedAt) {
 		return
 	}
 	respondWithJSON(w, http.StatusOK, product)
 }
 
+// respondWithSelectedProduct writes the selected fields of a product, unless the client has them already. Products
+// read from the cache do not have their category, so it is read separately if it is included.
+func (a *Api) respondWithSelectedProduct(w http.ResponseWriter, r *http.Request, product model.Product,
+	sel *selection) {
+	if sel.includes(includeCategory) && product.Category.Id == 0 {
+		category, err := a.Db.GetCategory(product.CategoryId)
+		if err != nil {
+			log.Println("error while getting category of product", err)
+			respondWithProblem(w, err)
+			return
+		}
+		product.Category = category
+	}
+	if etag, lastModified := productValidators(product, formatJson, sel); notModified(w, r, etag, lastModified) {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sel.product(product))
+}
+
 func (a *Api) createProduct(w http.ResponseWriter, r *http.Request) {
 	var product model.Product
 	raw, err := ioutil.ReadAll(r.Body)
@@ -156,14 +298,27 @@ func (a *Api) createProduct(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid POST request")
 		return
 	}
-
-	id, err := a.Db.AddProduct(product)
+	if errs, err := a.validateProduct(product); err != nil {
+		log.Println("error while validating product", err)
+		respondWithProblem(w, err)
+		return
+	} else if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+	id, err := a.Db.AddProduct(product, actorFromRequest(r))
 	if err != nil {
 		log.Println("product could not be added", err)
-		respondWithError(w, http.StatusInternalServerError, "Product could not be added")
+		respondWithProblem(w, err)
 		return
 	}
-	go a.cacheSetProduct(product)
+	// the stored product is cached, with the version and times that the database gave it
+	if stored, err := a.Db.GetProduct(id); err == nil {
+		go a.cacheSetProduct(stored)
+	} else {
+		log.Println("error while getting created product", err)
+	}
+	w.Header().Set("Location", "/v1/products/"+id)
 	respondWithJSON(w, http.StatusCreated, Response{Message: fmt.Sprintf("Product with id %s was created", id)})
 }
 
@@ -173,35 +328,64 @@ func (a *Api) updateProduct(w http.ResponseWriter, r *http.Request) {
 	product, err := a.Db.GetProduct(id)
 	if err != nil {
 		log.Println("error while getting product", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while getting product")
+		respondWithProblem(w, err)
 		return
 	}
-	raw, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid POST request")
+	if !ifMatch(r, versionETag(product.Version)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Product has been modified. Please fetch it again.")
 		return
 	}
-	if err := json.Unmarshal(raw, &product); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid POST request")
+	var patched model.Product
+	if perr := applyPatch(r, product, &patched); perr != nil {
+		respondWithError(w, perr.status, perr.message)
 		return
 	}
-	err = a.Db.UpdateProduct(product)
+	if errs, err := a.validateProduct(patched); err != nil {
+		log.Println("error while validating product", err)
+		respondWithProblem(w, err)
+		return
+	} else if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+	err = a.Db.UpdateProduct(patched, actorFromRequest(r))
 	if err != nil {
 		log.Println("error while updating product", err)
-		respondWithError(w, http.StatusInternalServerError, "Product could not be updated")
+		respondWithProblem(w, err)
 		return
 	}
-	go a.cacheSetProduct(product)
-	respondWithJSON(w, http.StatusCreated, Response{Message: fmt.Sprintf("Product with id %s was updated", id)})
+	updated, err := a.Db.GetProduct(id)
+	if err != nil {
+		log.Println("error while getting updated product", err)
+		updated = patched
+		updated.Version++
+	}
+	go a.cacheSetProduct(updated)
+	w.Header().Set("ETag", versionETag(updated.Version))
+	respondWithJSON(w, http.StatusOK, updated)
 }
 
 func (a *Api) deleteProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	err := a.Db.DeleteProduct(id)
+	var version int
+	if r.Header.Get("If-Match") != "" {
+		product, err := a.Db.GetProduct(id)
+		if err != nil {
+			log.Println("error while getting product", err)
+			respondWithProblem(w, err)
+			return
+		}
+		if !ifMatch(r, versionETag(product.Version)) {
+			respondWithError(w, http.StatusPreconditionFailed, "Product has been modified. Please fetch it again.")
+			return
+		}
+		version = product.Version
+	}
+	err := a.Db.DeleteProduct(id, version, actorFromRequest(r))
 	if err != nil {
 		log.Println("error while deleting product", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while deleting product")
+		respondWithProblem(w, err)
 		return
 	}
 	go a.cacheDelProduct(id)
@@ -209,54 +393,34 @@ func (a *Api) deleteProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *Api) getListCategories(w http.ResponseWriter, r *http.Request) {
-	var foundInCache bool
-	if cachedRes, err := a.Cache.GetApiRequest(r.URL.String()); err == nil && cachedRes != "" {
-		fmt.Println("found response for", r.URL, "in cache")
-		foundInCache = true
-		respondCachedWithJson(w, http.StatusOK, []byte(cachedRes))
+	format, ok := listFormat(w, r)
+	if !ok {
+		return
+	}
+	sel, err := selectionFromRequest(r, model.Category{}, categoryIncludes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cacheKey := listCacheKey(r, format)
+	if a.respondWithCachedList(w, r, format, cacheKey) {
+		return
+	}
+	orderBy, err := orderByFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
-	} else if err != nil {
-		log.Println(fmt.Sprintf("error getting response for request '%s' from cache: %s", r.URL.String(), err))
-	}
-	foundInCache = false
-	orderByValue := r.FormValue("orderBy")
-	var asc bool
-	var orderBy string
-	if orderByValue != "" {
-		parts := strings.Split(orderByValue, ":")
-		if len(parts) > 2 {
-			respondWithError(w, http.StatusBadRequest, "Bad order by value. Example \"orderBy=title:asc\"")
-			return
-		}
-		orderBy = parts[0]
-		if len(parts) > 1 {
-			if parts[1] == "asc" {
-				asc = true
-			} else if parts[1] == "desc" {
-				asc = false
-			} else {
-				respondWithError(w, http.StatusBadRequest, "Bad order by value. Example \"orderBy=title:asc\"")
-				return
-			}
-		}
 	}
 	p, err := getPaginationFromRequest(r)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Error in pagination values")
 		return
 	}
-	if orderBy == "position" {
-		orderBy = "pos"
-	}
-	categories, err := a.Db.GetCategories(p.offset, p.limit, orderBy, asc)
+	categories, err := a.Db.GetCategories(p.offset, p.limit, orderBy)
 	total := len(categories)
 	if err != nil {
-		if _, ok := err.(*services.ErrSqlInjectionAttempt); ok {
-			respondWithError(w, http.StatusBadRequest, "Bad parameters given (I saw what you did there ;) )")
-			return
-		}
 		log.Println("error while getting categories", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while getting categories")
+		respondWithProblem(w, err)
 		return
 	}
 	if p.start > total-1 {
@@ -267,11 +431,19 @@ func (a *Api) getListCategories(w http.ResponseWriter, r *http.Request) {
 	if p.end > total {
 		end = total
 	}
-	setPaginationHeaders(w, r, p, total)
-	if !foundInCache {
-		go a.cacheResponse(r.URL.String(), categories[p.start:end])
+	var items interface{} = categories[p.start:end]
+	if sel != nil {
+		items = sel.categories(categories[p.start:end])
 	}
-	respondWithJSON(w, http.StatusOK, categories[p.start:end])
+	body, err := encodeList(format, "categories", "category", items)
+	if err != nil {
+		log.Println("error while encoding categories", err)
+		respondWithProblem(w, err)
+		return
+	}
+	setPaginationHeaders(w, r, p, total)
+	go a.cacheList(cacheKey, total, body)
+	respondCachedList(w, r, format, body)
 }
 
 func (a *Api) getCategory(w http.ResponseWriter, r *http.Request) {
@@ -282,17 +454,39 @@ func (a *Api) getCategory(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Bad category id")
 		return
 	}
+	sel, err := selectionFromRequest(r, model.Category{}, categoryIncludes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if cacheRes, err := a.Cache.GetCategory(vars["id"]); err == nil && cacheRes != "" {
 		fmt.Println("got category", id, "from cache")
-		respondCachedWithJson(w, http.StatusOK, []byte(cacheRes))
-		return
+		if etag, lastModified := cachedValidators(cacheRes, formatJson, sel); notModified(w, r, etag, lastModified) {
+			return
+		}
+		if sel == nil {
+			respondCachedWithJson(w, http.StatusOK, []byte(cacheRes))
+			return
+		}
+		var category model.Category
+		if err := json.Unmarshal([]byte(cacheRes), &category); err == nil {
+			respondWithJSON(w, http.StatusOK, sel.category(category))
+			return
+		}
 	} else if err != nil {
 		log.Println("error getting from cache category with id", id, err)
 	}
 	category, err := a.Db.GetCategory(id)
 	if err != nil {
 		log.Println("error while getting category", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while getting category")
+		respondWithProblem(w, err)
+		return
+	}
+	if notModified(w, r, resourceETag(category.Version, formatJson, sel), category.UpdatedAt) {
+		return
+	}
+	if sel != nil {
+		respondWithJSON(w, http.StatusOK, sel.category(category))
 		return
 	}
 	respondWithJSON(w, http.StatusOK, category)
@@ -309,14 +503,27 @@ func (a *Api) createCategory(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid POST request")
 		return
 	}
-	err = a.Db.AddCategory(category)
+	if errs, err := a.validateCategory(category); err != nil {
+		log.Println("error while validating category", err)
+		respondWithProblem(w, err)
+		return
+	} else if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+	id, err := a.Db.AddCategory(category, actorFromRequest(r))
 	if err != nil {
-		log.Println("product could not be added", err)
-		respondWithError(w, http.StatusInternalServerError, "Category could not be added")
+		log.Println("category could not be added", err)
+		respondWithProblem(w, err)
 		return
 	}
-	go a.cacheSetCategory(category)
-	respondWithJSON(w, http.StatusCreated, Response{Message: "Category was created successfully"})
+	if stored, err := a.Db.GetCategory(id); err == nil {
+		go a.cacheSetCategory(stored)
+	} else {
+		log.Println("error while getting created category", err)
+	}
+	w.Header().Set("Location", fmt.Sprintf("/v1/categories/%d", id))
+	respondWithJSON(w, http.StatusCreated, Response{Message: fmt.Sprintf("Category with id %d was created", id)})
 }
 
 func (a *Api) updateCategory(w http.ResponseWriter, r *http.Request) {
@@ -330,26 +537,41 @@ func (a *Api) updateCategory(w http.ResponseWriter, r *http.Request) {
 	category, err := a.Db.GetCategory(id)
 	if err != nil {
 		log.Println("error while getting category", err)
-		respondWithError(w, http.StatusInternalServerError, "Error while getting category")
+		respondWithProblem(w, err)
 		return
 	}
-	raw, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid POST request")
+	if !ifMatch(r, versionETag(category.Version)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Category has been modified. Please fetch it again.")
 		return
 	}
-	if err := json.Unmarshal(raw, &category); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid POST request")
+	var patched model.Category
+	if perr := applyPatch(r, category, &patched); perr != nil {
+		respondWithError(w, perr.status, perr.message)
+		return
+	}
+	if errs, err := a.validateCategory(patched); err != nil {
+		log.Println("error while validating category", err)
+		respondWithProblem(w, err)
+		return
+	} else if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
 		return
 	}
-	err = a.Db.UpdateCategory(category)
+	err = a.Db.UpdateCategory(patched, actorFromRequest(r))
 	if err != nil {
 		log.Println("error while updating category", err)
-		respondWithError(w, http.StatusInternalServerError, "Category could not be updated")
+		respondWithProblem(w, err)
 		return
 	}
-	go a.cacheSetCategory(category)
-	respondWithJSON(w, http.StatusCreated, Response{Message: fmt.Sprintf("Category with id %d was updated", id)})
+	updated, err := a.Db.GetCategory(id)
+	if err != nil {
+		log.Println("error while getting updated category", err)
+		updated = patched
+		updated.Version++
+	}
+	go a.cacheSetCategory(updated)
+	w.Header().Set("ETag", versionETag(updated.Version))
+	respondWithJSON(w, http.StatusOK, updated)
 }
 
 func (a *Api) deleteCategory(w http.ResponseWriter, r *http.Request) {
@@ -360,15 +582,24 @@ func (a *Api) deleteCategory(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Bad category id")
 		return
 	}
-	err = a.Db.DeleteCategory(id)
-	if err != nil {
-		log.Println("error while deleting category", err)
-		if _, ok := err.(*services.ErrCategoryFkConflict); ok {
-			respondWithError(w, http.StatusConflict,
-				"Cannot delete category. There are still products that are using it.")
+	var version int
+	if r.Header.Get("If-Match") != "" {
+		category, err := a.Db.GetCategory(id)
+		if err != nil {
+			log.Println("error while getting category", err)
+			respondWithProblem(w, err)
+			return
+		}
+		if !ifMatch(r, versionETag(category.Version)) {
+			respondWithError(w, http.StatusPreconditionFailed, "Category has been modified. Please fetch it again.")
 			return
 		}
-		respondWithError(w, http.StatusInternalServerError, "Error while deleting category")
+		version = category.Version
+	}
+	err = a.Db.DeleteCategory(id, version, actorFromRequest(r))
+	if err != nil {
+		log.Println("error while deleting category", err)
+		respondWithProblem(w, err)
 		return
 	}
 	go a.cacheDelCategory(id)
@@ -424,19 +655,54 @@ func (a *Api) cacheDelCategory(id int) {
 	}
 }
 
-func (a *Api) cacheResponse(url string, response interface{}) {
-	serialized, err := json.Marshal(response)
+func (a *Api) cacheResponse(key string, body []byte) {
+	err := a.Cache.SetApiRequest(key, string(body))
 	if err != nil {
-		log.Println(fmt.Sprintf("unable to mashal serialized response for request '%s'", url))
+		log.Println(fmt.Sprintf("unable to write serialized response for request '%s' to cache", key))
+	}
+}
+
+// cacheList caches an encoded list after the number of entities it was paginated from, which its pagination headers
+// are computed from.
+func (a *Api) cacheList(key string, total int, body []byte) {
+	a.cacheResponse(key, append([]byte(fmt.Sprintf("%d\n", total)), body...))
+}
+
+// respondWithCachedList writes the list cached by cacheList under key, and returns whether there was one.
+func (a *Api) respondWithCachedList(w http.ResponseWriter, r *http.Request, format string, key string) bool {
+	cached, err := a.Cache.GetApiRequest(key)
+	if err != nil {
+		log.Println(fmt.Sprintf("error getting response for request '%s' from cache: %s", key, err))
+		return false
+	}
+	i := strings.IndexByte(cached, '\n')
+	if i < 0 {
+		return false
 	}
-	err = a.Cache.SetApiRequest(url, string(serialized))
+	total, err := strconv.Atoi(cached[:i])
 	if err != nil {
-		log.Println(fmt.Sprintf("unable to write serialized response for request '%s' to cache", url))
+		return false
 	}
+	p, err := getPaginationFromRequest(r)
+	if err != nil {
+		return false
+	}
+	fmt.Println("found response for", r.URL, "in cache")
+	setPaginationHeaders(w, r, p, total)
+	respondCachedList(w, r, format, []byte(cached[i+1:]))
+	return true
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+// respondCachedList writes an encoded list response, answering with 304 Not Modified if the client has it cached
+// already.
+func respondCachedList(w http.ResponseWriter, r *http.Request, format string, body []byte) {
+	w.Header().Add("Vary", "Accept")
+	if notModified(w, r, bodyETag(body), time.Time{}) {
+		return
+	}
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
 }
 
 func respondCachedWithJson(w http.ResponseWriter, code int, payload []byte) {
@@ -448,16 +714,7 @@ func respondCachedWithJson(w http.ResponseWriter, code int, payload []byte) {
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
 	if err != nil {
-		type ApiError struct {
-			Code    int
-			Message string
-		}
-		apiError := ErrorResponse{Code: 500, Message: "Internal server error",
-			Err: err}
-		response, _ = json.Marshal(apiError)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(code)
-		w.Write(response)
+		respondWithProblem(w, err)
 		return
 	}
 
@@ -466,12 +723,6 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
-type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Err     error  `json:"-"`
-}
-
 type Response struct {
 	Message string `json:"message"`
 }
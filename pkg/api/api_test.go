@@ -2,15 +2,33 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/panospet/small-api/pkg/apperr"
 	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/importer"
 	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/ratelimit"
 	"github.com/panospet/small-api/pkg/services"
+	"github.com/panospet/small-api/pkg/validate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"github.com/vmihailenco/msgpack/v4"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type Suite struct {
@@ -83,8 +101,10 @@ func (s *Suite) TestGetProductsPerPageWithLimit() {
 }
 
 func (s *Suite) TestGetProduct() {
-	req, err := http.NewRequest("GET", "/v1/products/123", nil)
+	id := s.api.Db.(*services.DbServiceMock).Products[0].Id
+	req, err := http.NewRequest("GET", "/v1/products/"+id, nil)
 	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(s.api.getProduct)
 	handler.ServeHTTP(rr, req)
@@ -96,6 +116,7 @@ func (s *Suite) TestGetProduct() {
 }
 
 func (s *Suite) TestPatchProduct() {
+	id := s.api.Db.(*services.DbServiceMock).Products[0].Id
 	reqBody, err := json.Marshal(map[string]interface{}{
 		"title":       "updated",
 		"image_url":   "http://www.bestprice.gr/updated.png",
@@ -103,19 +124,262 @@ func (s *Suite) TestPatchProduct() {
 		"description": "updated",
 	})
 	assert.Nil(s.T(), err)
-	req, err := http.NewRequest("POST", "/v1/products/123", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequest("PATCH", "/v1/products/"+id, bytes.NewBuffer(reqBody))
 	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(s.api.getProduct)
+	handler := http.HandlerFunc(s.api.updateProduct)
 	handler.ServeHTTP(rr, req)
 	assert.Equal(s.T(), http.StatusOK, rr.Code)
-	bodyBytes := []byte(rr.Body.String())
-	type Res struct {
-		Message string
+	var prod model.Product
+	err = json.Unmarshal(rr.Body.Bytes(), &prod)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), id, prod.Id)
+	assert.Equal(s.T(), "updated", prod.Title)
+	assert.Equal(s.T(), float32(123), prod.Price)
+}
+
+func (s *Suite) TestMergePatchClearsField() {
+	id := s.api.Db.(*services.DbServiceMock).Products[0].Id
+	req, err := http.NewRequest("PATCH", "/v1/products/"+id, bytes.NewBufferString(`{"description":null}`))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var prod model.Product
+	err = json.Unmarshal(rr.Body.Bytes(), &prod)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "", prod.Description)
+}
+
+func (s *Suite) TestJsonPatch() {
+	id := s.api.Db.(*services.DbServiceMock).Products[0].Id
+	patch := `[{"op":"test","path":"/title","value":"product0"},{"op":"replace","path":"/price","value":5.5}]`
+	req, err := http.NewRequest("PATCH", "/v1/products/"+id, bytes.NewBufferString(patch))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var prod model.Product
+	err = json.Unmarshal(rr.Body.Bytes(), &prod)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), float32(5.5), prod.Price)
+
+	// the test operation fails now that the product has a different title
+	patch = `[{"op":"test","path":"/title","value":"something else"},{"op":"replace","path":"/price","value":1}]`
+	req, err = http.NewRequest("PATCH", "/v1/products/"+id, bytes.NewBufferString(patch))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusConflict, rr.Code)
+}
+
+func (s *Suite) TestPatchRejectsInvalidChanges() {
+	id := s.api.Db.(*services.DbServiceMock).Products[0].Id
+	cases := map[string]struct {
+		contentType string
+		body        string
+		code        int
+	}{
+		"immutable id":         {"application/merge-patch+json", `{"id":"other"}`, http.StatusUnprocessableEntity},
+		"immutable created_at": {"application/json-patch+json", `[{"op":"remove","path":"/created_at"}]`, http.StatusUnprocessableEntity},
+		"unknown field":        {"application/merge-patch+json", `{"colour":"red"}`, http.StatusUnprocessableEntity},
+		"wrong type":           {"application/merge-patch+json", `{"price":"cheap"}`, http.StatusUnprocessableEntity},
+		"required field":       {"application/merge-patch+json", `{"title":null}`, http.StatusUnprocessableEntity},
+		"malformed":            {"application/merge-patch+json", `{"title":`, http.StatusBadRequest},
+		"unsupported":          {"text/plain", `title=x`, http.StatusUnsupportedMediaType},
+	}
+	for name, c := range cases {
+		req, err := http.NewRequest("PATCH", "/v1/products/"+id, bytes.NewBufferString(c.body))
+		assert.Nil(s.T(), err)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		req.Header.Set("Content-Type", c.contentType)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.api.updateProduct).ServeHTTP(rr, req)
+		assert.Equal(s.T(), c.code, rr.Code, name)
+	}
+}
+
+func (s *Suite) TestCreateProductValidation() {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"category_id": 9999,
+		"title":       strings.Repeat("a", 101),
+		"image_url":   "not a url",
+		"price":       -1,
+	})
+	assert.Nil(s.T(), err)
+	req, err := http.NewRequest("POST", "/v1/products", bytes.NewBuffer(reqBody))
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.createProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, rr.Code)
+
+	var res Problem
+	err = json.Unmarshal(rr.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	codes := make(map[string]string)
+	for _, e := range res.Errors {
+		codes[e.Field] = e.Code
+	}
+	assert.Equal(s.T(), map[string]string{
+		"title":       validate.CodeTooLong,
+		"image_url":   validate.CodeInvalidUrl,
+		"price":       validate.CodeTooSmall,
+		"category_id": validate.CodeNotFound,
+	}, codes)
+}
+
+func (s *Suite) TestPatchCategoryValidation() {
+	id := s.api.Db.(*services.DbServiceMock).Categories[0].Id
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("/v1/categories/%d", id), bytes.NewBufferString(`{"title":"","position":-1}`))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, rr.Code)
+
+	var res Problem
+	err = json.Unmarshal(rr.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "Validation failed", res.Detail)
+	assert.Equal(s.T(), "validation_failed", res.Code)
+	assert.Len(s.T(), res.Errors, 2)
+	assert.Equal(s.T(), validate.FieldError{Field: "title", Code: validate.CodeRequired, Message: "title is required"}, res.Errors[0])
+}
+
+func (s *Suite) TestMissingCategoryIsProblem() {
+	req, err := http.NewRequest("GET", "/v1/categories/9999", nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": "9999"})
+	req.Header.Set("X-Request-Id", "req-404")
+	rr := httptest.NewRecorder()
+	RequestId(http.HandlerFunc(s.api.getCategory)).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusNotFound, rr.Code)
+	assert.Equal(s.T(), "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(s.T(), `{"type":"about:blank","title":"Not Found","status":404,"detail":"Category not found",
+		"code":"not_found","request_id":"req-404"}`, rr.Body.String())
+}
+
+func (s *Suite) TestErrorStatuses() {
+	cases := map[string]struct {
+		err    error
+		status int
+		code   string
+	}{
+		"not found":        {services.ErrProductNotFound, http.StatusNotFound, apperr.CodeNotFound},
+		"version conflict": {services.ErrVersionConflict, http.StatusPreconditionFailed, apperr.CodeVersionConflict},
+		"category in use":  {services.ErrCategoryFkConflict, http.StatusConflict, apperr.CodeCategoryInUse},
+		"bad parameter": {apperr.Validation(apperr.CodeInvalidParameter, "Cannot order by \"colour\""),
+			http.StatusBadRequest, apperr.CodeInvalidParameter},
+		"untyped": {fmt.Errorf("connection refused"), http.StatusInternalServerError, apperr.CodeInternal},
+	}
+	for name, c := range cases {
+		rr := httptest.NewRecorder()
+		respondWithProblem(rr, c.err)
+		assert.Equal(s.T(), c.status, rr.Code, name)
+		var problem Problem
+		err := json.Unmarshal(rr.Body.Bytes(), &problem)
+		assert.Nil(s.T(), err)
+		assert.Equal(s.T(), c.code, problem.Code, name)
+		assert.NotContains(s.T(), problem.Detail, "connection refused", name)
+	}
+}
+
+func (s *Suite) TestBatchProductsPartial() {
+	db := s.api.Db.(*services.DbServiceMock)
+	existing := db.Products[1]
+	body := `{"mode":"partial","operations":[
+		{"op":"create","product":{"category_id":` + strconv.Itoa(db.Categories[1].Id) + `,"title":"new",
+			"image_url":"http://www.bestprice.gr/new.png","price":3}},
+		{"op":"create","product":{"category_id":1,"title":""}},
+		{"op":"delete","id":"` + existing.Id + `"},
+		{"op":"delete","id":"missing"},
+		{"op":"upsert"}]}`
+	req, err := http.NewRequest("POST", "/v1/products:batch", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.batchProducts).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusMultiStatus, rr.Code)
+
+	var res BatchResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, res.Succeeded)
+	assert.Equal(s.T(), 3, res.Failed)
+	var statuses []int
+	for _, r := range res.Results {
+		statuses = append(statuses, r.Status)
 	}
-	var res Res
-	err = json.Unmarshal(bodyBytes, &res)
-	assert.Contains(s.T(), "was updated", res.Message)
+	assert.Equal(s.T(), []int{http.StatusCreated, http.StatusUnprocessableEntity, http.StatusOK,
+		http.StatusNotFound, http.StatusUnprocessableEntity}, statuses)
+	assert.Equal(s.T(), "new", res.Results[0].Product.Title)
+	assert.Equal(s.T(), "validation_failed", res.Results[1].Error.Code)
+	assert.Equal(s.T(), "invalid_operation", res.Results[4].Error.Code)
+	assert.NotNil(s.T(), db.Products[1].DeletedAt)
+}
+
+func (s *Suite) TestBatchProductsAtomic() {
+	db := s.api.Db.(*services.DbServiceMock)
+	products := len(db.Products)
+	body := `{"operations":[
+		{"op":"create","product":{"category_id":` + strconv.Itoa(db.Categories[1].Id) + `,"title":"new",
+			"image_url":"http://www.bestprice.gr/new.png","price":3}},
+		{"op":"delete","id":"missing"}]}`
+	req, err := http.NewRequest("POST", "/v1/products:batch", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.batchProducts).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusMultiStatus, rr.Code)
+
+	var res BatchResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "atomic", res.Mode)
+	assert.Equal(s.T(), 0, res.Succeeded)
+	assert.Equal(s.T(), http.StatusFailedDependency, res.Results[0].Status)
+	assert.Equal(s.T(), "batch_aborted", res.Results[0].Error.Code)
+	assert.Equal(s.T(), http.StatusNotFound, res.Results[1].Status)
+	assert.Len(s.T(), db.Products, products)
+}
+
+func (s *Suite) TestBatchProductsTooLarge() {
+	s.api.MaxBatchSize = 1
+	body := `{"operations":[{"op":"delete","id":"a"},{"op":"delete","id":"b"}]}`
+	req, err := http.NewRequest("POST", "/v1/products:batch", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.batchProducts).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusRequestEntityTooLarge, rr.Code)
+}
+
+func (s *Suite) TestImportProducts() {
+	body := "Code,title,image_url,price,category_id\n" +
+		"x-1,Imported,http://example.com/x.png,3,2\n" +
+		"x-2,,http://example.com/x.png,3,2\n"
+	req, err := http.NewRequest("POST", "/v1/import?columns=sku=Code", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	req.Header.Set("Content-Type", "text/csv")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.importEntities).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var report importer.Report
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(s.T(), 1, report.Created)
+	assert.Equal(s.T(), 1, report.Failed)
+	assert.Equal(s.T(), 3, report.Errors[0].Line)
+
+	req, err = http.NewRequest("POST", "/v1/import", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.importEntities).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, rr.Code)
 }
 
 func (s *Suite) TestGetCategories() {
@@ -133,6 +397,653 @@ func (s *Suite) TestGetCategories() {
 	assert.Len(s.T(), categories, 10)
 }
 
+func (s *Suite) TestRateLimiter() {
+	s.api.Limiter = ratelimit.NewMemoryLimiter()
+	handler := RateLimiter(s.api.getListCategories, &s.api, ratelimit.Rate{Limit: 2, Window: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", "/v1/categories", nil)
+		assert.Nil(s.T(), err)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(s.T(), http.StatusOK, rr.Code)
+		assert.Equal(s.T(), "2", rr.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(s.T(), fmt.Sprintf("%d", 1-i), rr.Header().Get("X-RateLimit-Remaining"))
+		assert.NotEmpty(s.T(), rr.Header().Get("X-RateLimit-Reset"))
+	}
+
+	req, err := http.NewRequest("GET", "/v1/categories", nil)
+	assert.Nil(s.T(), err)
+	req.RemoteAddr = "10.0.0.1:4321"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusTooManyRequests, rr.Code)
+	assert.Equal(s.T(), "0", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.JSONEq(s.T(), `{"type":"about:blank","title":"Too Many Requests","status":429,
+		"detail":"Too many requests","code":"too_many_requests"}`, rr.Body.String())
+
+	// a different client is not affected
+	req, err = http.NewRequest("GET", "/v1/categories", nil)
+	assert.Nil(s.T(), err)
+	req.RemoteAddr = "10.0.0.2:1234"
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+}
+
+func (s *Suite) TestRateLimiterAuthenticated() {
+	s.api.Limiter = ratelimit.NewMemoryLimiter()
+	s.api.ApiKeys = map[string]string{"gateway": "gateway-key", "importer": "importer-key"}
+	assert.Nil(s.T(), s.api.Db.AddUser(model.User{Username: "admin", Password: "secret"}))
+	var users []string
+	handler := s.api.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := userFromRequest(r)
+		users = append(users, username)
+	}, ratelimit.Rate{Limit: 2, Window: time.Minute})
+	do := func(addr string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/v1/products", nil)
+		assert.Nil(s.T(), err)
+		req.RemoteAddr = addr
+		auth(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	wrongPassword := func(r *http.Request) { r.SetBasicAuth("admin", "guess") }
+	password := func(r *http.Request) { r.SetBasicAuth("admin", "secret") }
+	apiKey := func(key string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("X-Api-Key", key) }
+	}
+
+	// failed logins are limited per IP, and then rejected before the credentials are checked
+	assert.Equal(s.T(), http.StatusUnauthorized, do("10.0.0.1:1", wrongPassword).Code)
+	assert.Equal(s.T(), http.StatusUnauthorized, do("10.0.0.1:2", apiKey("guess")).Code)
+	assert.Equal(s.T(), http.StatusTooManyRequests, do("10.0.0.1:3", wrongPassword).Code)
+	assert.Equal(s.T(), http.StatusTooManyRequests, do("10.0.0.1:4", password).Code)
+
+	// authenticated clients are limited per user or API key
+	assert.Equal(s.T(), http.StatusOK, do("10.0.0.2:1", password).Code)
+	rr := do("10.0.0.3:1", password)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.Equal(s.T(), "0", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(s.T(), http.StatusTooManyRequests, do("10.0.0.3:2", password).Code)
+
+	// and do not share a quota when they are behind the same IP
+	for _, key := range []string{"gateway-key", "importer-key"} {
+		assert.Equal(s.T(), http.StatusOK, do("10.0.0.4:1", apiKey(key)).Code)
+		assert.Equal(s.T(), http.StatusOK, do("10.0.0.4:2", apiKey(key)).Code)
+	}
+	assert.Equal(s.T(), http.StatusTooManyRequests, do("10.0.0.4:3", apiKey("gateway-key")).Code)
+	assert.Equal(s.T(), []string{"admin", "admin", "gateway", "gateway", "importer", "importer"}, users)
+}
+
+func (s *Suite) TestCreateProductIsAudited() {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"category_id": 2,
+		"title":       "audited",
+		"image_url":   "http://www.bestprice.gr/audited.png",
+		"price":       10,
+	})
+	assert.Nil(s.T(), err)
+	req, err := http.NewRequest("POST", "/v1/products", bytes.NewBuffer(reqBody))
+	assert.Nil(s.T(), err)
+	req.Header.Set("X-Request-Id", "req-123")
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, "admin"))
+	rr := httptest.NewRecorder()
+	RequestId(http.HandlerFunc(s.api.createProduct)).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusCreated, rr.Code)
+	assert.Equal(s.T(), "req-123", rr.Header().Get("X-Request-Id"))
+	assert.True(s.T(), strings.HasPrefix(rr.Header().Get("Location"), "/v1/products/"))
+
+	req, err = http.NewRequest("GET", "/v1/audit?entity=product&user=admin", nil)
+	assert.Nil(s.T(), err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.getAuditLog).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var entries []model.AuditEntry
+	err = json.Unmarshal(rr.Body.Bytes(), &entries)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), entries, 1)
+	assert.Equal(s.T(), "create", entries[0].Action)
+	assert.Equal(s.T(), "req-123", entries[0].RequestId)
+	assert.Equal(s.T(), "audited", entries[0].Diff["title"].After)
+	assert.Nil(s.T(), entries[0].Diff["title"].Before)
+}
+
+func (s *Suite) TestDeleteAndRestoreProduct() {
+	id := s.api.Db.(*services.DbServiceMock).Products[3].Id
+
+	req, err := http.NewRequest("DELETE", "/v1/products/"+id, nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.deleteProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest("GET", "/v1/trash?entity=product", nil)
+	assert.Nil(s.T(), err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.getTrash).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var items []model.TrashItem
+	err = json.Unmarshal(rr.Body.Bytes(), &items)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), items, 1)
+	assert.Equal(s.T(), id, items[0].EntityId)
+
+	req, err = http.NewRequest("POST", "/v1/products/"+id+"/restore", nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.restoreProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+
+	// restoring again fails, the product is not in the trash anymore
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.restoreProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusNotFound, rr.Code)
+}
+
+func (s *Suite) TestReorderCategories() {
+	db := s.api.Db.(*services.DbServiceMock)
+	last := db.Categories[len(db.Categories)-1].Id
+	body := `{"ids":[` + strconv.Itoa(last) + `]}`
+	req, err := http.NewRequest("POST", "/v1/categories:reorder", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.reorderCategories).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var categories []model.Category
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &categories))
+	if assert.Len(s.T(), categories, len(db.Categories)) {
+		assert.Equal(s.T(), last, categories[0].Id)
+		for i, c := range categories {
+			assert.Equal(s.T(), i+1, c.Position)
+		}
+	}
+
+	for body, status := range map[string]int{
+		`{"ids":[]}`:      http.StatusOK,
+		`{"ids":"1"}`:     http.StatusBadRequest,
+		`{"ids":[1,1]}`:   http.StatusUnprocessableEntity,
+		`{"ids":[99999]}`: http.StatusNotFound,
+	} {
+		req, err := http.NewRequest("POST", "/v1/categories:reorder", bytes.NewBufferString(body))
+		assert.Nil(s.T(), err)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.api.reorderCategories).ServeHTTP(rr, req)
+		assert.Equal(s.T(), status, rr.Code, body)
+	}
+}
+
+func (s *Suite) TestPatchCategoryIfMatch() {
+	req, err := http.NewRequest("GET", "/v1/categories/3", nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.getCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.Equal(s.T(), `"1"`, etag)
+
+	req, err = http.NewRequest("PATCH", "/v1/categories/3", bytes.NewBufferString(`{"title":"updated"}`))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	req.Header.Set("If-Match", `"7"`)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusPreconditionFailed, rr.Code)
+
+	req, err = http.NewRequest("PATCH", "/v1/categories/3", bytes.NewBufferString(`{"title":"updated"}`))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.Equal(s.T(), `"2"`, rr.Header().Get("ETag"))
+
+	// the etag of the first read is stale now
+	req, err = http.NewRequest("DELETE", "/v1/categories/3", nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.deleteCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusPreconditionFailed, rr.Code)
+}
+
+func (s *Suite) TestConditionalGetList() {
+	req, err := http.NewRequest("GET", "/v1/categories", nil)
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.getListCategories).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(s.T(), etag)
+
+	req, err = http.NewRequest("GET", "/v1/categories", nil)
+	assert.Nil(s.T(), err)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.getListCategories).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusNotModified, rr.Code)
+	assert.Equal(s.T(), etag, rr.Header().Get("ETag"))
+	assert.Empty(s.T(), rr.Body.String())
+
+	req, err = http.NewRequest("GET", "/v1/categories?perPage=5", nil)
+	assert.Nil(s.T(), err)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.getListCategories).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+}
+
+func (s *Suite) TestConditionalGetSingle() {
+	category := s.api.Db.(*services.DbServiceMock).Categories[2]
+	catB, err := json.Marshal(category)
+	assert.Nil(s.T(), err)
+	_ = s.api.Cache.SetCategory("2", string(catB))
+
+	req, err := http.NewRequest("GET", "/v1/categories/2", nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	req.Header.Set("If-Modified-Since", category.UpdatedAt.Add(time.Second).UTC().Format(http.TimeFormat))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.getCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusNotModified, rr.Code)
+	assert.Equal(s.T(), `"1"`, rr.Header().Get("ETag"))
+	assert.Equal(s.T(), category.UpdatedAt.UTC().Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+
+	// If-None-Match takes precedence over If-Modified-Since
+	req.Header.Set("If-None-Match", `"5"`)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.getCategory).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+}
+
+func (s *Suite) TestConditionalGetSelection() {
+	product := s.api.Db.(*services.DbServiceMock).Products[0]
+	get := func(query string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/v1/products/"+product.Id+query, nil)
+		assert.Nil(s.T(), err)
+		req = mux.SetURLVars(req, map[string]string{"id": product.Id})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.api.getProduct).ServeHTTP(rr, req)
+		return rr
+	}
+	full := versionETag(product.Version)
+	rr := get("?fields=id,title", full)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	selected := rr.Header().Get("ETag")
+	assert.NotEqual(s.T(), full, selected)
+	assert.NotEqual(s.T(), selected, get("?fields=id,title&include=category", "").Header().Get("ETag"))
+
+	// the order of the fields does not make another representation
+	assert.Equal(s.T(), http.StatusNotModified, get("?fields=title,id", selected).Code)
+	assert.Equal(s.T(), http.StatusOK, get("", selected).Code)
+
+	// the tag of any representation is a precondition on the version
+	req, err := http.NewRequest("PATCH", "/v1/products/"+product.Id, bytes.NewBufferString(`{"title":"selected"}`))
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": product.Id})
+	req.Header.Set("If-Match", selected)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.updateProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+}
+
+func (s *Suite) TestCreatedIsCachedWithVersion() {
+	db := s.api.Db.(*services.DbServiceMock)
+	body := `{"category_id":` + strconv.Itoa(db.Categories[1].Id) + `,"title":"cached",` +
+		`"image_url":"http://www.bestprice.gr/cached.png","price":3}`
+	req, err := http.NewRequest("POST", "/v1/products", bytes.NewBufferString(body))
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.createProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusCreated, rr.Code)
+	id := strings.TrimPrefix(rr.Header().Get("Location"), "/v1/products/")
+
+	assert.Eventually(s.T(), func() bool {
+		cached, err := s.api.Cache.GetProduct(id)
+		return err == nil && cached != ""
+	}, time.Second, 10*time.Millisecond)
+	cached, _ := s.api.Cache.GetProduct(id)
+	etag, lastModified := cachedValidators(cached, formatJson, nil)
+	assert.Equal(s.T(), `"1"`, etag)
+	assert.False(s.T(), lastModified.IsZero())
+
+	req, err = http.NewRequest("GET", "/v1/products/"+id, nil)
+	assert.Nil(s.T(), err)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.api.getProduct).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusNotModified, rr.Code)
+}
+
+func (s *Suite) TestCacheControl() {
+	s.api.CacheControl = map[string]string{"categories.get": "public, max-age=60"}
+	router := mux.NewRouter()
+	router.Use(CacheController(&s.api))
+	router.HandleFunc("/v1/categories/{id}", s.api.getCategory).Methods("GET").Name("categories.get")
+
+	req, err := http.NewRequest("GET", "/v1/categories/2", nil)
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.Equal(s.T(), "public, max-age=60", rr.Header().Get("Cache-Control"))
+
+	// errors are not cached
+	req, err = http.NewRequest("GET", "/v1/categories/abc", nil)
+	assert.Nil(s.T(), err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+	assert.Empty(s.T(), rr.Header().Get("Cache-Control"))
+}
+
+func (s *Suite) TestExportProducts() {
+	req, err := http.NewRequest("GET", "/v1/export/products?format=ndjson&offset=2&limit=3", nil)
+	assert.Nil(s.T(), err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.api.exportProducts).ServeHTTP(rr, req)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.Equal(s.T(), "application/x-ndjson", rr.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	assert.Len(s.T(), lines, 3)
+	var p model.Product
+	assert.Nil(s.T(), json.Unmarshal([]byte(lines[0]), &p))
+	assert.Equal(s.T(), "product2", p.Title)
+
+	req, err = http.NewRequest("GET", "/v1/export/products", nil)
+	assert.Nil(s.T(), err)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rr = httptest.NewRecorder()
+	Compressor(&s.api)(http.HandlerFunc(s.api.exportProducts)).ServeHTTP(rr, req)
+	assert.Equal(s.T(), "gzip", rr.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(rr.Body)
+	assert.Nil(s.T(), err)
+	body, err := ioutil.ReadAll(gz)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), strings.HasPrefix(string(body), "id,sku,title"))
+
+	type withCategory struct {
+		model.Product
+		Category model.Category `json:"category"`
+	}
+	exported := func(url string) []withCategory {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.Nil(s.T(), err)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.api.exportProducts).ServeHTTP(rr, req)
+		assert.Equal(s.T(), http.StatusOK, rr.Code, url)
+		var products []withCategory
+		decoder := json.NewDecoder(rr.Body)
+		for decoder.More() {
+			var p withCategory
+			assert.Nil(s.T(), decoder.Decode(&p))
+			products = append(products, p)
+		}
+		return products
+	}
+	products := exported("/v1/export/products?format=ndjson&page=3&perPage=4")
+	if assert.Len(s.T(), products, 4) {
+		assert.Equal(s.T(), "product8", products[0].Title)
+	}
+	products = exported("/v1/export/products?format=ndjson&page=2&perPage=4&limit=6")
+	assert.Len(s.T(), products, 2)
+	products = exported("/v1/export/products?format=ndjson&category=3,5&orderBy=price:asc")
+	assert.NotEmpty(s.T(), products)
+	for i, p := range products {
+		assert.Contains(s.T(), []int{3, 5}, p.CategoryId)
+		assert.Equal(s.T(), p.CategoryId, p.Category.Id)
+		if i > 0 {
+			assert.True(s.T(), products[i-1].Price <= p.Price)
+		}
+	}
+	products = exported("/v1/export/products?format=ndjson&updatedSince=" +
+		url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)))
+	assert.Empty(s.T(), products)
+
+	for _, query := range []string{"format=xlsx", "category=shoes", "updatedSince=yesterday", "page=-1",
+		"page=2&perPage=4&limit=4", "orderBy=colour"} {
+		req, err = http.NewRequest("GET", "/v1/export/products?"+query, nil)
+		assert.Nil(s.T(), err)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(s.api.exportProducts).ServeHTTP(rr, req)
+		assert.Equal(s.T(), http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func (s *Suite) TestListRepresentations() {
+	get := func(url string, accept string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.Nil(s.T(), err)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.api.getListProducts).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/v1/products?perPage=2", "application/xml")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.Equal(s.T(), "application/xml; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(s.T(), "Accept", rr.Header().Get("Vary"))
+	var list struct {
+		Products []model.Product `xml:"product"`
+	}
+	assert.Nil(s.T(), xml.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(s.T(), list.Products, 2)
+	assert.Equal(s.T(), "product0", list.Products[0].Title)
+
+	rr = get("/v1/products?perPage=2", "application/msgpack")
+	assert.Equal(s.T(), "application/msgpack", rr.Header().Get("Content-Type"))
+	var products []map[string]interface{}
+	assert.Nil(s.T(), msgpack.Unmarshal(rr.Body.Bytes(), &products))
+	assert.Equal(s.T(), "product1", products[1]["title"])
+
+	rr = get("/v1/products?perPage=2&format=csv", "application/json")
+	assert.Equal(s.T(), "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), records, 3)
+	assert.Equal(s.T(), "id", records[0][0])
+
+	rr = get("/v1/products?perPage=2", "image/png")
+	assert.Equal(s.T(), http.StatusNotAcceptable, rr.Code)
+	rr = get("/v1/products?perPage=2&format=yaml", "")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+
+	// every representation is cached on its own
+	for _, key := range []string{"xml:/v1/products?perPage=2", "msgpack:/v1/products?perPage=2"} {
+		key := key
+		assert.Eventually(s.T(), func() bool {
+			cached, err := s.api.Cache.GetApiRequest(key)
+			return err == nil && cached != ""
+		}, time.Second, 10*time.Millisecond, key)
+	}
+	rr = get("/v1/products?perPage=2", "application/json")
+	var fromJson []model.Product
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &fromJson))
+	assert.Len(s.T(), fromJson, 2)
+}
+
+func (s *Suite) TestSparseFieldsets() {
+	get := func(handler http.HandlerFunc, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.Nil(s.T(), err)
+		req = mux.SetURLVars(req, map[string]string{"id": path.Base(req.URL.Path)})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(s.api.getListProducts, "/v1/products?perPage=2&fields=id,title")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var products []map[string]interface{}
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &products))
+	assert.Len(s.T(), products, 2)
+	assert.Len(s.T(), products[0], 2)
+	assert.Equal(s.T(), "product0", products[0]["title"])
+
+	rr = get(s.api.getListProducts, "/v1/products?perPage=2&fields=title&format=csv")
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), [][]string{{"title"}, {"product0"}, {"product1"}}, records)
+
+	rr = get(s.api.getProduct, "/v1/products/"+s.api.Db.(*services.DbServiceMock).Products[0].Id+"?fields=price")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var product map[string]interface{}
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &product))
+	assert.Equal(s.T(), []string{"price"}, keys(product))
+
+	rr = get(s.api.getListCategories, "/v1/categories?fields=id,title,position")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var categories []map[string]interface{}
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &categories))
+	assert.Equal(s.T(), []string{"id", "position", "title"}, keys(categories[0]))
+
+	rr = get(s.api.getListProducts, "/v1/products?fields=id,colour")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+	assert.Contains(s.T(), rr.Body.String(), "colour")
+	rr = get(s.api.getCategory, "/v1/categories/1?fields=name")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+}
+
+func (s *Suite) TestIncludeCategory() {
+	get := func(handler http.HandlerFunc, url string, id string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.Nil(s.T(), err)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	type withCategory struct {
+		Id       string         `json:"id"`
+		Title    string         `json:"title"`
+		Category model.Category `json:"category"`
+	}
+
+	rr := get(s.api.getListProducts, "/v1/products?perPage=2&fields=id,title&include=category", "")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var products []withCategory
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &products))
+	first := s.api.Db.(*services.DbServiceMock).Products[0]
+	assert.Equal(s.T(), first.CategoryId, products[0].Category.Id)
+	assert.NotEmpty(s.T(), products[0].Category.Title)
+
+	// a cached product does not have its category, which is read from the database
+	cached, err := json.Marshal(first)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.api.Cache.SetProduct(first.Id, string(cached)))
+	rr = get(s.api.getProduct, "/v1/products/"+first.Id+"?include=category", first.Id)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var product withCategory
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &product))
+	assert.Equal(s.T(), first.Title, product.Title)
+	assert.Equal(s.T(), first.CategoryId, product.Category.Id)
+
+	rr = get(s.api.getListProducts, "/v1/products?perPage=2&include=category&format=csv", "")
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.Nil(s.T(), err)
+	assert.Contains(s.T(), records[0], "category.title")
+
+	rr = get(s.api.getListProducts, "/v1/products?include=reviews", "")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+	rr = get(s.api.getListCategories, "/v1/categories?include=category", "")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+
+	// the same selection is cached once, whatever the order of the parameters
+	assert.Eventually(s.T(), func() bool {
+		cached, err := s.api.Cache.GetApiRequest("json:/v1/products?fields=id%2Ctitle&include=category&perPage=2")
+		return err == nil && cached != ""
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *Suite) TestIncludedCategoryValidators() {
+	product := s.api.Db.(*services.DbServiceMock).Products[0]
+	get := func(url string, etag string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.Nil(s.T(), err)
+		req.Header.Set("If-None-Match", etag)
+		req = mux.SetURLVars(req, map[string]string{"id": product.Id})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.api.getProduct).ServeHTTP(rr, req)
+		return rr
+	}
+	url := "/v1/products/" + product.Id + "?include=category"
+
+	rr := get(url, "")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.Equal(s.T(), http.StatusNotModified, get(url, etag).Code)
+
+	// a new version of the category is a new representation of the product that includes it
+	category, err := s.api.Db.GetCategory(product.CategoryId)
+	assert.Nil(s.T(), err)
+	category.Title = "renamed"
+	assert.Nil(s.T(), s.api.Db.UpdateCategory(category, nil))
+	rr = get(url, etag)
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.NotEqual(s.T(), etag, rr.Header().Get("ETag"))
+	assert.Equal(s.T(), versionOfETag(etag), versionOfETag(rr.Header().Get("ETag")))
+	assert.Contains(s.T(), rr.Body.String(), "renamed")
+}
+
+func keys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Suite) TestOrderBy() {
+	get := func(handler http.HandlerFunc, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.Nil(s.T(), err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(s.api.getListProducts, "/v1/products?perPage=50&orderBy=category_id:asc,price:desc,title")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var products []model.Product
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &products))
+	assert.Len(s.T(), products, 50)
+	for i := 1; i < len(products); i++ {
+		prev, p := products[i-1], products[i]
+		assert.True(s.T(), prev.CategoryId < p.CategoryId ||
+			(prev.CategoryId == p.CategoryId && prev.Price >= p.Price), i)
+	}
+
+	rr = get(s.api.getListCategories, "/v1/categories?orderBy=position:desc")
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	var categories []model.Category
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &categories))
+	assert.True(s.T(), categories[0].Position > categories[1].Position)
+
+	rr = get(s.api.getListProducts, "/v1/products?orderBy=colour:asc")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+	var problem Problem
+	assert.Nil(s.T(), json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(s.T(), apperr.CodeInvalidParameter, problem.Code)
+	assert.Contains(s.T(), problem.Detail, "category.title")
+	rr = get(s.api.getListCategories, "/v1/categories?orderBy=category.title")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+	rr = get(s.api.getListProducts, "/v1/products?orderBy=title:up")
+	assert.Equal(s.T(), http.StatusBadRequest, rr.Code)
+}
+
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(Suite))
 }
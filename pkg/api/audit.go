@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func (a *Api) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter := model.AuditFilter{
+		EntityType: r.FormValue("entity"),
+		EntityId:   r.FormValue("id"),
+		Username:   r.FormValue("user"),
+	}
+	var err error
+	if filter.From, err = parseAuditTime(r.FormValue("from")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Bad from value. Example \"from=2020-05-18T10:00:00Z\"")
+		return
+	}
+	if filter.To, err = parseAuditTime(r.FormValue("to")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Bad to value. Example \"to=2020-05-18T10:00:00Z\"")
+		return
+	}
+	p, err := getPaginationFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error in pagination values")
+		return
+	}
+	entries, err := a.Db.GetAuditLog(filter, p.offset, p.limit)
+	if err != nil {
+		log.Println("error while getting audit log", err)
+		respondWithProblem(w, err)
+		return
+	}
+	total := len(entries)
+	if total == 0 {
+		respondWithJSON(w, http.StatusOK, []model.AuditEntry{})
+		return
+	}
+	if p.start > total-1 {
+		respondWithError(w, http.StatusBadRequest, "Page does not exist")
+		return
+	}
+	end := p.end
+	if p.end > total {
+		end = total
+	}
+	setPaginationHeaders(w, r, p, total)
+	respondWithJSON(w, http.StatusOK, entries[p.start:end])
+}
+
+// parseAuditTime accepts either a full RFC 3339 timestamp or a plain date.
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time value %s", value)
+	}
+	return t, nil
+}
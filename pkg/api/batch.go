@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+const (
+	batchModeAtomic  = "atomic"
+	batchModePartial = "partial"
+
+	defaultMaxBatchSize = 1000
+)
+
+// BatchRequest is the body of POST /v1/products:batch. Mode is either "atomic" (the default), where the operations
+// are applied all or none, or "partial", where every operation that can be applied is applied.
+type BatchRequest struct {
+	Mode       string            `json:"mode"`
+	Operations []model.ProductOp `json:"operations"`
+}
+
+type BatchItemResult struct {
+	Index   int            `json:"index"`
+	Op      string         `json:"op"`
+	Id      string         `json:"id,omitempty"`
+	Status  int            `json:"status"`
+	Product *model.Product `json:"product,omitempty"`
+	Error   *Problem       `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      string            `json:"mode"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+func (a *Api) batchProducts(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid batch request")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = batchModeAtomic
+	}
+	if req.Mode != batchModeAtomic && req.Mode != batchModePartial {
+		respondWithError(w, http.StatusBadRequest, "Bad mode value. Expected \"atomic\" or \"partial\"")
+		return
+	}
+	if len(req.Operations) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No operations given")
+		return
+	}
+	maxSize := a.MaxBatchSize
+	if maxSize == 0 {
+		maxSize = defaultMaxBatchSize
+	}
+	if len(req.Operations) > maxSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Too many operations, the maximum is "+
+			strconv.Itoa(maxSize))
+		return
+	}
+
+	// invalid products are rejected here, the rest of the checks are done by the database in a single pass
+	results := make([]services.ProductOpResult, len(req.Operations))
+	var ops []model.ProductOp
+	var indexes []int
+	for i, op := range req.Operations {
+		if op.Op == model.BatchOpCreate || op.Op == model.BatchOpUpdate {
+			if errs := validate.Struct(op.Product); len(errs) > 0 {
+				results[i].Err = errs
+				continue
+			}
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+	atomic := req.Mode == batchModeAtomic
+	if atomic && len(ops) < len(req.Operations) {
+		for _, i := range indexes {
+			results[i].Err = services.ErrBatchAborted
+		}
+	} else if len(ops) > 0 {
+		applied, err := a.Db.BatchProducts(ops, atomic, actorFromRequest(r))
+		if err != nil {
+			log.Println("error while applying batch", err)
+			respondWithProblem(w, err)
+			return
+		}
+		for j, i := range indexes {
+			results[i] = applied[j]
+		}
+	}
+
+	res := BatchResponse{Mode: req.Mode, Results: make([]BatchItemResult, len(results))}
+	toCache := make(map[string]model.Product)
+	var toUncache []string
+	for i, result := range results {
+		op := req.Operations[i]
+		item := BatchItemResult{Index: i, Op: op.Op, Id: op.Id}
+		if result.Err != nil {
+			problem := batchProblem(result.Err)
+			item.Status = problem.Status
+			item.Error = &problem
+			res.Failed++
+		} else {
+			item.Status = http.StatusOK
+			switch op.Op {
+			case model.BatchOpCreate:
+				item.Status = http.StatusCreated
+				item.Id = result.Product.Id
+				fallthrough
+			case model.BatchOpUpdate:
+				product := result.Product
+				item.Product = &product
+				toCache[product.Id] = product
+			case model.BatchOpDelete:
+				toUncache = append(toUncache, op.Id)
+			}
+			res.Succeeded++
+		}
+		res.Results[i] = item
+	}
+	go a.cacheBatch(toCache, toUncache)
+
+	status := http.StatusOK
+	if res.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	respondWithJSON(w, status, res)
+}
+
+// batchProblem is the problem of a single failed operation of a batch.
+func batchProblem(err error) Problem {
+	if errs, ok := err.(validate.Errors); ok {
+		return validationProblem(errs)
+	}
+	return problemOf(err)
+}
+
+// cacheBatch updates the cache after a batch, with one round trip for all changed products and one for all deleted.
+func (a *Api) cacheBatch(products map[string]model.Product, deleted []string) {
+	serialized := make(map[string]string)
+	for id, product := range products {
+		s, err := json.Marshal(product)
+		if err != nil {
+			log.Println("error while serializing product", err)
+			continue
+		}
+		serialized[id] = string(s)
+	}
+	if len(serialized) > 0 {
+		if err := a.Cache.SetProducts(serialized); err != nil {
+			log.Println("error while caching products", err)
+		}
+	}
+	if len(deleted) > 0 {
+		if err := a.Cache.DeleteProducts(deleted); err != nil {
+			log.Println("error while deleting products from cache", err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/mux"
+)
+
+const defaultCompressMinSize = 1024
+
+// supported content encodings, the preferred first
+var compressEncodings = []string{"br", "gzip"}
+
+// Compressor compresses responses with brotli or gzip, whichever the client prefers. Responses smaller than the
+// minimum size of the api are sent as they are, since compressing them would not save anything. Responses that
+// stream, like exports, are compressed as they are written.
+func Compressor(app *Api) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			minSize := app.CompressMinSize
+			if minSize == 0 {
+				minSize = defaultCompressMinSize
+			}
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			next.ServeHTTP(cw, r)
+			cw.Close()
+		})
+	}
+}
+
+// acceptedEncoding returns the supported encoding with the highest q value in an Accept-Encoding header, or "" if
+// there is none.
+func acceptedEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range compressEncodings {
+		q := encodingQ(header, encoding)
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// encodingQ returns the q value of an encoding in an Accept-Encoding header, 0 if it is not accepted. The wildcard
+// only stands for the encodings that are not listed.
+func encodingQ(header string, encoding string) float64 {
+	wildcard := 0.0
+	for _, value := range strings.Split(header, ",") {
+		parts := strings.Split(value, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if name == encoding {
+			return q
+		}
+		wildcard = q
+	}
+	return wildcard
+}
+
+// compressWriter holds back the beginning of the response, until it knows whether it reaches the minimum size.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	// responses without a body, or already encoded, are passed on as they are
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		w.Header().Get("Content-Encoding") != "" {
+		w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends what has been written so far. A response that is flushed is streaming, so it is compressed whatever
+// its size.
+func (w *compressWriter) Flush() {
+	if !w.decided && len(w.buf) > 0 {
+		_ = w.start(true)
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends what is held back, uncompressed if it is below the minimum size, and finishes the compressed stream.
+func (w *compressWriter) Close() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		_ = w.start(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+	}
+}
+
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Del("Content-Length")
+		// entity tags are left strong, as clients send them back in If-Match, which only compares strong tags
+		h.Set("Content-Encoding", w.encoding)
+		if w.encoding == "br" {
+			w.encoder = brotli.NewWriter(w.ResponseWriter)
+		} else {
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                      "",
+		"identity":              "",
+		"gzip":                  "gzip",
+		"gzip, deflate, br":     "br",
+		"br;q=0.5, gzip":        "gzip",
+		"*":                     "br",
+		"*;q=0.5, gzip":         "gzip",
+		"br;q=0, *":             "gzip",
+		"gzip;q=0":              "",
+		"GZIP;q=0.8, deflate":   "gzip",
+		"br;q=oops, gzip;q=0.1": "gzip",
+	}
+	for header, expected := range cases {
+		assert.Equal(t, expected, acceptedEncoding(header), header)
+	}
+}
+
+func compressed(body string, code int, acceptEncoding string) *httptest.ResponseRecorder {
+	handler := Compressor(&Api{CompressMinSize: 100})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(code)
+		// written in pieces, as streaming handlers do
+		for _, piece := range strings.SplitAfter(body, ",") {
+			_, _ = w.Write([]byte(piece))
+		}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCompressor(t *testing.T) {
+	large := strings.Repeat("product,", 100)
+
+	rr := compressed(large, http.StatusOK, "gzip")
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+	assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+	gz, err := gzip.NewReader(rr.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(gz)
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+
+	rr = compressed(large, http.StatusOK, "gzip, br")
+	assert.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+	body, err = ioutil.ReadAll(brotli.NewReader(rr.Body))
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+
+	// below the minimum size
+	rr = compressed("product,", http.StatusOK, "gzip")
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "product,", rr.Body.String())
+
+	// errors keep their status
+	rr = compressed(large, http.StatusNotFound, "gzip")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+
+	rr = compressed("", http.StatusNotModified, "gzip")
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+
+	rr = compressed(large, http.StatusOK, "identity")
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+	assert.Equal(t, large, rr.Body.String())
+}
+
+func TestCompressorStreams(t *testing.T) {
+	handler := Compressor(&Api{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first,"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("second"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(rr.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(gz)
+	assert.Nil(t, err)
+	assert.Equal(t, "first,second", string(body))
+}
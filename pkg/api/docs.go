@@ -0,0 +1,99 @@
+package api
+
+// docsPage renders /openapi.json as a list of the operations of the API, with their parameters and responses. It
+// has no external dependencies, so it works wherever the API does.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>small-api</title>
+<style>
+  body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+  h2 { border-bottom: 1px solid #ccc; padding-bottom: .2em; text-transform: capitalize; }
+  details { border: 1px solid #ddd; border-radius: 4px; margin: .5em 0; padding: .4em .8em; }
+  summary { cursor: pointer; }
+  .method { display: inline-block; width: 5em; font-weight: bold; text-transform: uppercase; }
+  .get { color: #1a7f37; } .post { color: #0969da; } .patch { color: #9a6700; } .delete { color: #cf222e; }
+  code, pre { background: #f6f8fa; padding: .1em .3em; }
+  pre { padding: .6em; overflow: auto; }
+  table { border-collapse: collapse; width: 100%; }
+  td, th { text-align: left; vertical-align: top; padding: .2em .5em; border-bottom: 1px solid #eee; }
+</style>
+</head>
+<body>
+<h1 id="title">small-api</h1>
+<p id="description"></p>
+<p>The document itself is at <a href="/openapi.json">/openapi.json</a>.</p>
+<div id="operations"></div>
+<script>
+function el(tag, attrs, children) {
+  var e = document.createElement(tag);
+  Object.keys(attrs || {}).forEach(function (k) { e.setAttribute(k, attrs[k]); });
+  (children || []).forEach(function (c) { e.append(c); });
+  return e;
+}
+function resolve(spec, obj) {
+  if (!obj || !obj.$ref) { return obj; }
+  return obj.$ref.replace("#/", "").split("/").reduce(function (o, k) { return o[k]; }, spec);
+}
+function schemaName(schema) {
+  if (!schema) { return ""; }
+  if (schema.$ref) { return schema.$ref.split("/").pop(); }
+  if (schema.type === "array") { return schemaName(schema.items) + "[]"; }
+  return schema.type || "";
+}
+fetch("/openapi.json").then(function (r) { return r.json(); }).then(function (spec) {
+  document.getElementById("title").textContent = spec.info.title;
+  document.getElementById("description").textContent = spec.info.description;
+  var byTag = {};
+  Object.keys(spec.paths).forEach(function (path) {
+    var item = spec.paths[path];
+    ["get", "post", "patch", "delete"].forEach(function (method) {
+      var op = item[method];
+      if (!op) { return; }
+      var tag = op.tags[0];
+      (byTag[tag] = byTag[tag] || []).push({path: path, method: method, op: op, params: item.parameters || []});
+    });
+  });
+  var root = document.getElementById("operations");
+  Object.keys(byTag).sort().forEach(function (tag) {
+    root.append(el("h2", {}, [tag]));
+    byTag[tag].forEach(function (o) {
+      var params = el("table", {}, [el("tr", {}, [el("th", {}, ["Parameter"]), el("th", {}, ["In"]),
+        el("th", {}, ["Type"]), el("th", {}, ["Description"])])]);
+      o.params.concat(o.op.parameters || []).forEach(function (p) {
+        p = resolve(spec, p);
+        params.append(el("tr", {}, [el("td", {}, [el("code", {}, [p.name + (p.required ? " *" : "")])]),
+          el("td", {}, [p.in]), el("td", {}, [schemaName(p.schema)]), el("td", {}, [p.description || ""])]));
+      });
+      var responses = el("table", {}, [el("tr", {}, [el("th", {}, ["Status"]), el("th", {}, ["Description"]),
+        el("th", {}, ["Body"])])]);
+      Object.keys(o.op.responses).sort().forEach(function (status) {
+        var r = resolve(spec, o.op.responses[status]);
+        var types = Object.keys(r.content || {}).map(function (t) {
+          return t + (r.content[t].schema ? " " + schemaName(r.content[t].schema) : "");
+        });
+        responses.append(el("tr", {}, [el("td", {}, [status]), el("td", {}, [r.description]),
+          el("td", {}, [types.join(", ")])]));
+      });
+      var body = [];
+      if (o.op.requestBody) {
+        body.push(el("p", {}, ["Body: " + Object.keys(o.op.requestBody.content).map(function (t) {
+          return t + " " + schemaName(o.op.requestBody.content[t].schema);
+        }).join(", ")]));
+      }
+      if (o.op.security) { body.push(el("p", {}, ["Requires basic authentication."])); }
+      root.append(el("details", {}, [el("summary", {}, [el("span", {"class": "method " + o.method}, [o.method]),
+        el("code", {}, [o.path]), " " + o.op.summary])].concat(body, [params, responses])));
+    });
+  });
+  root.append(el("h2", {}, ["schemas"]));
+  Object.keys(spec.components.schemas).sort().forEach(function (name) {
+    root.append(el("details", {}, [el("summary", {}, [name]),
+      el("pre", {}, [JSON.stringify(spec.components.schemas[name], null, 2)])]));
+  });
+});
+</script>
+</body>
+</html>
+`
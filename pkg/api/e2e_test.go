@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/migrate"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+// The end to end tests serve the whole API, with its router, middlewares and authentication, on a real HTTP server,
+// and run every scenario once per database backend.
+
+// openDbFunc returns a new, empty database for a single test, and the function that closes it.
+type openDbFunc func(t *testing.T) (services.DbService, func())
+
+var e2eBackends = []struct {
+	name string
+	open openDbFunc
+}{
+	{"memory", openMemoryDb},
+	{"sqlite", openSqliteDb},
+}
+
+func openMemoryDb(t *testing.T) (services.DbService, func()) {
+	db, err := services.NewDbService("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {}
+}
+
+func openSqliteDb(t *testing.T) (services.DbService, func()) {
+	db, err := services.Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewEmbedded(db.Conn.DB, db.Conn.DriverName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		_ = db.Conn.Close()
+	}
+}
+
+// e2eEnv is the API under test, served with an in memory cache, and an admin user to authenticate with.
+type e2eEnv struct {
+	t      *testing.T
+	db     services.DbService
+	cache  *cache.CacherMock
+	server *httptest.Server
+}
+
+const (
+	e2eUsername = "admin"
+	e2ePassword = "secret"
+)
+
+var e2eActor = &model.Actor{Username: e2eUsername, RequestId: "fixture"}
+
+// runEndToEnd runs test on each backend, with a new server and an admin user.
+func runEndToEnd(t *testing.T, test func(t *testing.T, env *e2eEnv)) {
+	for _, backend := range e2eBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			db, closeDb := backend.open(t)
+			defer closeDb()
+			c := cache.NewCacherMock()
+			env := &e2eEnv{t: t, db: db, cache: c, server: httptest.NewServer(NewApi(db, c).Handler())}
+			defer env.server.Close()
+			env.user(e2eUsername, e2ePassword)
+			test(t, env)
+		})
+	}
+}
+
+// user, category and product are fixtures, added to the database directly.
+
+func (e *e2eEnv) user(username string, password string) {
+	if err := e.db.AddUser(model.User{Username: username, Password: password}); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+func (e *e2eEnv) category(title string) int {
+	id, err := e.db.AddCategory(model.Category{Title: title, ImageUrl: "http://example.com/" + title + ".png"},
+		e2eActor)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return id
+}
+
+func (e *e2eEnv) product(categoryId int, title string) string {
+	id, err := e.db.AddProduct(model.Product{CategoryId: categoryId, Title: title,
+		ImageUrl: "http://example.com/" + title + ".png", Price: 10}, e2eActor)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return id
+}
+
+// e2eResponse is a response whose body has already been read.
+type e2eResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// problem decodes the body of an error response.
+func (r e2eResponse) problem(t *testing.T) Problem {
+	var problem Problem
+	assert.Nil(t, json.Unmarshal(r.body, &problem), string(r.body))
+	return problem
+}
+
+// do sends a request to the server, authenticated as the admin unless anonymous is set. Relative urls are resolved
+// against the server.
+func (e *e2eEnv) do(method string, url string, body string, anonymous bool) e2eResponse {
+	if strings.HasPrefix(url, "/") {
+		url = e.server.URL + url
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if !anonymous {
+		req.SetBasicAuth(e2eUsername, e2ePassword)
+	}
+	res, err := e.server.Client().Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return e2eResponse{status: res.StatusCode, header: res.Header, body: b}
+}
+
+func (e *e2eEnv) get(url string) e2eResponse {
+	return e.do("GET", url, "", true)
+}
+
+// waitForCache waits until the responses cached in the background are in the cache.
+func (e *e2eEnv) waitForCache(cached func() bool) {
+	assert.Eventually(e.t, cached, time.Second, 5*time.Millisecond, "the response was not cached")
+}
+
+var linkPattern = regexp.MustCompile(`<([^>]+)>; rel="([a-z]+)"`)
+
+// links parses a Link header into urls by relation.
+func links(header http.Header) map[string]string {
+	rels := make(map[string]string)
+	for _, match := range linkPattern.FindAllStringSubmatch(header.Get("Link"), -1) {
+		rels[match[2]] = match[1]
+	}
+	return rels
+}
+
+func TestEndToEndAuthentication(t *testing.T) {
+	runEndToEnd(t, func(t *testing.T, env *e2eEnv) {
+		categoryId := env.category("lamps")
+		product := fmt.Sprintf(`{"category_id":%d,"title":"Desk lamp","image_url":"http://example.com/lamp.png"}`,
+			categoryId)
+
+		writes := []struct {
+			method string
+			url    string
+		}{
+			{"POST", "/v1/products"},
+			{"PATCH", "/v1/products/1"},
+			{"DELETE", "/v1/products/1"},
+			{"POST", "/v1/products:batch"},
+			{"POST", "/v1/categories"},
+			{"POST", "/v1/categories:reorder"},
+			{"DELETE", fmt.Sprintf("/v1/categories/%d", categoryId)},
+			{"POST", "/v1/import"},
+			{"GET", "/v1/trash"},
+			{"GET", "/v1/audit"},
+		}
+		for _, w := range writes {
+			res := env.do(w.method, w.url, product, true)
+			assert.Equal(t, http.StatusUnauthorized, res.status, "%s %s", w.method, w.url)
+			assert.Equal(t, problemContentType, res.header.Get("Content-Type"))
+			assert.Equal(t, apperr.CodeUnauthorized, res.problem(t).Code)
+		}
+
+		req, err := http.NewRequest("POST", env.server.URL+"/v1/products", strings.NewReader(product))
+		assert.Nil(t, err)
+		req.SetBasicAuth(e2eUsername, "wrong")
+		res, err := env.server.Client().Do(req)
+		assert.Nil(t, err)
+		_ = res.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		// nothing was written by the rejected requests
+		products, err := env.db.GetProducts(0, 0, nil)
+		assert.Nil(t, err)
+		assert.Empty(t, products)
+		_, err = env.db.GetCategory(categoryId)
+		assert.Nil(t, err)
+
+		created := env.do("POST", "/v1/products", product, false)
+		assert.Equal(t, http.StatusCreated, created.status, string(created.body))
+		location := created.header.Get("Location")
+		assert.NotEmpty(t, location)
+		res2 := env.get(location)
+		assert.Equal(t, http.StatusOK, res2.status)
+		assert.Contains(t, string(res2.body), `"title":"Desk lamp"`)
+
+		// reads are public, and routes only answer their own methods
+		assert.Equal(t, http.StatusOK, env.get("/v1/products").status)
+		assert.Equal(t, http.StatusMethodNotAllowed, env.do("PUT", "/v1/products", product, false).status)
+		assert.Equal(t, http.StatusNotFound, env.get("/v1/unknown").status)
+	})
+}
+
+func TestEndToEndPaginationLinks(t *testing.T) {
+	runEndToEnd(t, func(t *testing.T, env *e2eEnv) {
+		categoryId := env.category("lamps")
+		ids := make(map[string]bool)
+		for i := 0; i < 5; i++ {
+			ids[env.product(categoryId, fmt.Sprintf("lamp-%d", i))] = true
+		}
+
+		res := env.get("/v1/products?perPage=2&page=2")
+		assert.Equal(t, http.StatusOK, res.status, string(res.body))
+		rels := links(res.header)
+		assert.Contains(t, rels["self"], "page=2")
+		assert.Contains(t, rels["first"], "page=1")
+		assert.Contains(t, rels["prev"], "page=1")
+		assert.Contains(t, rels["next"], "page=3")
+		assert.Contains(t, rels["last"], "page=3")
+
+		// following the links from the first page goes through every product once
+		seen := make(map[string]bool)
+		url := "/v1/products?perPage=2"
+		pages := 0
+		for url != "" {
+			res := env.get(url)
+			if !assert.Equal(t, http.StatusOK, res.status, string(res.body)) {
+				break
+			}
+			var products []model.Product
+			assert.Nil(t, json.Unmarshal(res.body, &products))
+			for _, p := range products {
+				assert.False(t, seen[p.Id], "%s was on two pages", p.Id)
+				seen[p.Id] = true
+			}
+			pages++
+			rels := links(res.header)
+			if pages == 3 {
+				assert.NotContains(t, rels, "next")
+			}
+			url = rels["next"]
+		}
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, ids, seen)
+
+		res = env.get("/v1/products?perPage=2&page=4")
+		assert.Equal(t, http.StatusBadRequest, res.status)
+	})
+}
+
+func TestEndToEndCache(t *testing.T) {
+	runEndToEnd(t, func(t *testing.T, env *e2eEnv) {
+		categoryId := env.category("lamps")
+		id := env.product(categoryId, "lamp")
+
+		// a list is cached on the way out, and served from the cache afterwards, even once the database changed
+		first := env.get("/v1/products")
+		assert.Equal(t, http.StatusOK, first.status)
+		env.waitForCache(func() bool {
+			stats, err := env.cache.Stats()
+			return err == nil && stats.Requests == 1
+		})
+		env.product(categoryId, "another lamp")
+		second := env.get("/v1/products")
+		assert.Equal(t, http.StatusOK, second.status)
+		assert.Equal(t, string(first.body), string(second.body))
+		assert.Equal(t, first.header.Get("ETag"), second.header.Get("ETag"))
+
+		// a product in the cache is served without asking the database
+		cached, err := json.Marshal(model.Product{Id: id, CategoryId: categoryId, Title: "cached lamp", Version: 1})
+		assert.Nil(t, err)
+		assert.Nil(t, env.cache.SetProduct(id, string(cached)))
+		res := env.get("/v1/products/" + id)
+		assert.Equal(t, http.StatusOK, res.status)
+		assert.Contains(t, string(res.body), `"title":"cached lamp"`)
+
+		// writes through the API update the cache
+		res = env.do("PATCH", "/v1/products/"+id, `{"title":"new lamp"}`, false)
+		assert.Equal(t, http.StatusOK, res.status, string(res.body))
+		env.waitForCache(func() bool {
+			p, err := env.cache.GetProduct(id)
+			return err == nil && strings.Contains(p, `"title":"new lamp"`)
+		})
+		res = env.do("DELETE", "/v1/products/"+id, "", false)
+		assert.Equal(t, http.StatusOK, res.status, string(res.body))
+		env.waitForCache(func() bool {
+			p, err := env.cache.GetProduct(id)
+			return err == nil && p == ""
+		})
+		assert.Equal(t, http.StatusNotFound, env.get("/v1/products/"+id).status)
+
+		// without the cache, responses come from the database
+		env.cache.Err = fmt.Errorf("redis is down")
+		res = env.get("/v1/products")
+		assert.Equal(t, http.StatusOK, res.status)
+		assert.Contains(t, string(res.body), "another lamp")
+		assert.Equal(t, http.StatusOK, env.get(fmt.Sprintf("/v1/categories/%d", categoryId)).status)
+	})
+}
+
+func TestEndToEndCategoryConflicts(t *testing.T) {
+	runEndToEnd(t, func(t *testing.T, env *e2eEnv) {
+		categoryId := env.category("lamps")
+		id := env.product(categoryId, "lamp")
+		categoryUrl := fmt.Sprintf("/v1/categories/%d", categoryId)
+
+		// a category cannot be deleted while products use it
+		res := env.do("DELETE", categoryUrl, "", false)
+		assert.Equal(t, http.StatusConflict, res.status)
+		assert.Equal(t, apperr.CodeCategoryInUse, res.problem(t).Code)
+		assert.Equal(t, http.StatusOK, env.get(categoryUrl).status)
+
+		// products cannot use a category that does not exist
+		res = env.do("POST", "/v1/products", `{"category_id":999,"title":"lamp","image_url":"http://example.com/l.png"}`,
+			false)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+		problem := res.problem(t)
+		assert.Equal(t, apperr.CodeValidationFailed, problem.Code)
+		if assert.Len(t, problem.Errors, 1) {
+			assert.Equal(t, "category_id", problem.Errors[0].Field)
+			assert.Equal(t, validate.CodeNotFound, problem.Errors[0].Code)
+		}
+		res = env.do("PATCH", "/v1/products/"+id, `{"category_id":999}`, false)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+
+		// once its products are gone it can be, and they cannot be restored without it
+		assert.Equal(t, http.StatusOK, env.do("DELETE", "/v1/products/"+id, "", false).status)
+		res = env.do("DELETE", categoryUrl, "", false)
+		assert.Equal(t, http.StatusOK, res.status, string(res.body))
+		res = env.do("POST", "/v1/products/"+id+"/restore", "", false)
+		assert.Equal(t, http.StatusConflict, res.status)
+		assert.Equal(t, apperr.CodeCategoryDeleted, res.problem(t).Code)
+
+		assert.Equal(t, http.StatusOK, env.do("POST", categoryUrl+"/restore", "", false).status)
+		assert.Equal(t, http.StatusOK, env.do("POST", "/v1/products/"+id+"/restore", "", false).status)
+		assert.Equal(t, http.StatusOK, env.get("/v1/products/"+id).status)
+	})
+}
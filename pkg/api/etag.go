@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// versionETag is the entity tag of a single product or category. Every write bumps their version, so the tag
+// changes whenever the resource does.
+func versionETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// resourceETag is the entity tag of a representation of a single product or category. The full json one is tagged
+// with the version alone; the others, e.g. with some fields, add a hash of their format and selection, so that a
+// client that has cached one of them is never told that another one is not modified.
+func resourceETag(version int, format string, sel *selection) string {
+	variant := sel.variant()
+	if format == formatJson && variant == "" {
+		return versionETag(version)
+	}
+	return variantETag(version, format+";"+variant)
+}
+
+func variantETag(version int, variant string) string {
+	sum := sha1.Sum([]byte(variant))
+	return fmt.Sprintf(`"%d-%s"`, version, hex.EncodeToString(sum[:4]))
+}
+
+// productValidators returns the entity tag of a representation of product, and the modification time. When the
+// representation includes the category, both change with the category as well: its version is hashed into the tag,
+// behind the version of the product that If-Match compares.
+func productValidators(product model.Product, format string, sel *selection) (string, time.Time) {
+	if product.Version == 0 {
+		return "", time.Time{}
+	}
+	if !sel.includes(includeCategory) {
+		return resourceETag(product.Version, format, sel), product.UpdatedAt
+	}
+	etag := variantETag(product.Version, fmt.Sprintf("%s;%s;category=%d", format, sel.variant(),
+		product.Category.Version))
+	lastModified := product.UpdatedAt
+	if product.Category.UpdatedAt.After(lastModified) {
+		lastModified = product.Category.UpdatedAt
+	}
+	return etag, lastModified
+}
+
+// versionOfETag returns the version tag of a resource tag, which every representation of the same version shares.
+func versionOfETag(etag string) string {
+	if i := strings.Index(etag, "-"); i > 0 && strings.HasPrefix(etag, `"`) {
+		return etag[:i] + `"`
+	}
+	return etag
+}
+
+// bodyETag is the entity tag of a list response, a hash of the serialized body.
+func bodyETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// cachedValidators returns the entity tag of a representation, and the modification time, of a product or category
+// cached as json.
+func cachedValidators(cached string, format string, sel *selection) (string, time.Time) {
+	var resource struct {
+		Version   int       `json:"version"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	if err := json.Unmarshal([]byte(cached), &resource); err != nil || resource.Version == 0 {
+		return "", time.Time{}
+	}
+	return resourceETag(resource.Version, format, sel), resource.UpdatedAt
+}
+
+// ifMatch reports whether the If-Match precondition of the request holds for a resource with the given etag.
+// Requests without If-Match always match, and the tag of any representation of the resource matches its version.
+func ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || versionOfETag(tag) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifNoneMatch reports whether the If-None-Match header of the request contains the given etag. Unlike If-Match,
+// it uses weak comparison.
+func ifNoneMatch(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || (tag != "" && tag == strings.TrimPrefix(etag, "W/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the validators of a GET response, and answers with 304 Not Modified if the representation
+// the client has cached is still current. It returns true if the response has been written.
+// If-Modified-Since is only evaluated when the request has no If-None-Match, as RFC 7232 requires.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	fresh := false
+	if r.Header.Get("If-None-Match") != "" {
+		fresh = etag != "" && ifNoneMatch(r, etag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		fresh = !lastModified.Truncate(time.Second).After(since)
+	}
+	if fresh {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return fresh
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/panospet/small-api/pkg/export"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// exportProducts streams the products, joined with their category, in the format of the format parameter (csv by
+// default). It takes the orderBy, page, perPage, offset and limit parameters of the listing, and the category and
+// updatedSince filters. Nothing is written until the first product is read, so that errors of the query are still
+// problems.
+func (a *Api) exportProducts(w http.ResponseWriter, r *http.Request) {
+	format := r.FormValue("format")
+	if format == "" {
+		format = export.FormatCsv
+	}
+	contentType, ok := export.ContentTypes[format]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Bad format value. Expected \"csv\", \"ndjson\" or \"xml\"")
+		return
+	}
+	filter, err := streamFilterFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rng, err := rangeFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var encoder export.Encoder
+	start := func() {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="products.`+format+`"`)
+		w.WriteHeader(http.StatusOK)
+		encoder, _ = export.NewEncoder(format, w, a.Feed)
+	}
+	err = export.Products(r.Context(), a.Db, filter, rng, func(p model.Product) error {
+		if encoder == nil {
+			start()
+		}
+		return encoder.Encode(p)
+	})
+	if err != nil {
+		log.Println("error while exporting products", err)
+		if encoder == nil {
+			respondWithProblem(w, err)
+			return
+		}
+		// the response has started, so the client can only tell that it is incomplete by the connection closing
+		panic(http.ErrAbortHandler)
+	}
+	if encoder == nil {
+		start()
+	}
+	if err := encoder.Close(); err != nil {
+		log.Println("error while finishing export", err)
+	}
+}
+
+// streamFilterFromRequest reads the orderBy parameter, the category parameter, comma separated category ids, and the
+// updatedSince parameter, an RFC 3339 time or a date.
+func streamFilterFromRequest(r *http.Request) (model.StreamFilter, error) {
+	var filter model.StreamFilter
+	var err error
+	if filter.OrderBy, err = orderByFromRequest(r); err != nil {
+		return model.StreamFilter{}, err
+	}
+	if v := r.FormValue("category"); v != "" {
+		for _, id := range strings.Split(v, ",") {
+			categoryId, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return model.StreamFilter{}, fmt.Errorf("invalid category id %s", id)
+			}
+			filter.CategoryIds = append(filter.CategoryIds, categoryId)
+		}
+	}
+	if filter.UpdatedSince, err = parseAuditTime(r.FormValue("updatedSince")); err != nil {
+		return model.StreamFilter{}, err
+	}
+	return filter, nil
+}
+
+// rangeFromRequest reads the page and perPage parameters, which select a page of the products like in the listing,
+// or else the offset and limit parameters. Limit 0 means all.
+func rangeFromRequest(r *http.Request) (export.Range, error) {
+	if r.FormValue("page") != "" || r.FormValue("perPage") != "" {
+		p, err := getPaginationFromRequest(r)
+		if err != nil {
+			return export.Range{}, errors.New("Error in pagination values")
+		}
+		return export.Page(p.page, p.perPage, p.offset, p.limit)
+	}
+	var rng export.Range
+	var err error
+	if v := r.FormValue("offset"); v != "" {
+		if rng.Offset, err = strconv.Atoi(v); err != nil || rng.Offset < 0 {
+			return export.Range{}, errors.New("offset must be a non negative number")
+		}
+	}
+	if v := r.FormValue("limit"); v != "" {
+		if rng.Limit, err = strconv.Atoi(v); err != nil || rng.Limit < 0 {
+			return export.Range{}, errors.New("limit must be a non negative number")
+		}
+	}
+	return rng, nil
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v4"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+const includeCategory = "category"
+
+// relations that can be embedded with the include parameter, per entity
+var (
+	productIncludes  = []string{includeCategory}
+	categoryIncludes []string
+)
+
+// selection is what a client asked for with the fields parameter, e.g. "fields=id,title,price", and the include
+// parameter, e.g. "include=category". Entities are reduced to the selected fields, followed by the included
+// relations. All fields are selected if the fields parameter is missing.
+type selection struct {
+	fields  []string
+	include map[string]bool
+}
+
+// selectionFromRequest reads the fields and include parameters, checking them against the json fields of entity
+// and the relations it can include. It returns nil if neither is given.
+func selectionFromRequest(r *http.Request, entity interface{}, includes []string) (*selection, error) {
+	query := r.URL.Query()
+	if query.Get("fields") == "" && query.Get("include") == "" {
+		return nil, nil
+	}
+	s := &selection{include: make(map[string]bool)}
+	allowed := jsonFields(reflect.TypeOf(entity))
+	for _, field := range splitList(query.Get("fields")) {
+		if !contains(allowed, field) {
+			return nil, fmt.Errorf("Bad fields value. Unknown field %q, expected some of %s", field,
+				strings.Join(allowed, ","))
+		}
+		s.fields = append(s.fields, field)
+	}
+	for _, relation := range splitList(query.Get("include")) {
+		if !contains(includes, relation) {
+			if len(includes) == 0 {
+				return nil, fmt.Errorf("Bad include value. Nothing can be included here")
+			}
+			return nil, fmt.Errorf("Bad include value. Unknown relation %q, expected some of %s", relation,
+				strings.Join(includes, ","))
+		}
+		s.include[relation] = true
+	}
+	return s, nil
+}
+
+// variant identifies the representation that s selects, whatever the order of its fields and relations. It is
+// empty for nil, the full representation.
+func (s *selection) variant() string {
+	if s == nil {
+		return ""
+	}
+	fields := append([]string(nil), s.fields...)
+	sort.Strings(fields)
+	var include []string
+	for relation := range s.include {
+		include = append(include, relation)
+	}
+	sort.Strings(include)
+	return "fields=" + strings.Join(fields, ",") + ";include=" + strings.Join(include, ",")
+}
+
+// includes reports whether s includes relation. Nil, the full representation, includes none.
+func (s *selection) includes(relation string) bool {
+	return s != nil && s.include[relation]
+}
+
+func (s *selection) product(p model.Product) resource {
+	res := newResource(p, s.fields)
+	if s.include[includeCategory] {
+		res = append(res, resourceField{includeCategory, newResource(p.Category, nil)})
+	}
+	return res
+}
+
+func (s *selection) products(products []model.Product) []resource {
+	res := make([]resource, len(products))
+	for i, p := range products {
+		res[i] = s.product(p)
+	}
+	return res
+}
+
+func (s *selection) category(c model.Category) resource {
+	return newResource(c, s.fields)
+}
+
+func (s *selection) categories(categories []model.Category) []resource {
+	res := make([]resource, len(categories))
+	for i, c := range categories {
+		res[i] = s.category(c)
+	}
+	return res
+}
+
+// resource is an entity reduced to some of its fields, which keeps the order and the names of its json fields. It
+// is encoded like the entity itself in every representation.
+type resource []resourceField
+
+type resourceField struct {
+	name  string
+	value interface{}
+}
+
+// newResource takes the given json fields of a struct, or all of them if fields is empty. Empty fields that are
+// omitted from its json are omitted here as well.
+func newResource(v interface{}, fields []string) resource {
+	value := reflect.ValueOf(v)
+	t := value.Type()
+	var res resource
+	for i := 0; i < t.NumField(); i++ {
+		name, omitEmpty := jsonName(t.Field(i))
+		if name == "" || (len(fields) > 0 && !contains(fields, name)) {
+			continue
+		}
+		if omitEmpty && value.Field(i).IsZero() {
+			continue
+		}
+		res = append(res, resourceField{name, value.Field(i).Interface()})
+	}
+	return res
+}
+
+func (res resource) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range res {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (res resource) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, f := range res {
+		if err := e.EncodeElement(f.value, xml.StartElement{Name: xml.Name{Local: f.name}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func (res resource) EncodeMsgpack(e *msgpack.Encoder) error {
+	if err := e.EncodeMapLen(len(res)); err != nil {
+		return err
+	}
+	for _, f := range res {
+		if err := e.EncodeString(f.name); err != nil {
+			return err
+		}
+		if err := e.Encode(f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flatten returns the names and values of the fields, with the fields of embedded resources prefixed by their name,
+// e.g. "category.title".
+func (res resource) flatten(prefix string) ([]string, []interface{}) {
+	var names []string
+	var values []interface{}
+	for _, f := range res {
+		if embedded, ok := f.value.(resource); ok {
+			n, v := embedded.flatten(prefix + f.name + ".")
+			names = append(names, n...)
+			values = append(values, v...)
+			continue
+		}
+		names = append(names, prefix+f.name)
+		values = append(values, f.value)
+	}
+	return names, values
+}
+
+// jsonFields returns the names of the json fields of a struct type.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name, _ := jsonName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// jsonName returns the json name of a struct field, "" if it is not part of the json.
+func jsonName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	parts := strings.Split(f.Tag.Get("json"), ",")
+	if parts[0] == "-" {
+		return "", false
+	}
+	name := parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name, len(parts) > 1 && parts[1] == "omitempty"
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
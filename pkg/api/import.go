@@ -0,0 +1,62 @@
+package api
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/panospet/small-api/pkg/importer"
+)
+
+// importEntities streams the request body into the importer. The mapping is given by query parameters: entity,
+// format (or the content type of the body), dry_run, and columns as a comma separated list of field=column.
+func (a *Api) importEntities(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	mapping := importer.Mapping{
+		Entity:    query.Get("entity"),
+		Format:    query.Get("format"),
+		Delimiter: query.Get("delimiter"),
+		Columns:   make(map[string]string),
+	}
+	if mapping.Format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			mapping.Format = importer.FormatCsv
+		case "application/x-ndjson":
+			mapping.Format = importer.FormatNdjson
+		default:
+			respondWithError(w, http.StatusUnsupportedMediaType,
+				"Expected text/csv or application/x-ndjson content, or the format parameter")
+			return
+		}
+	}
+	if columns := query.Get("columns"); columns != "" {
+		for _, pair := range strings.Split(columns, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				respondWithError(w, http.StatusBadRequest, "Bad columns value. Expected field=column,...")
+				return
+			}
+			mapping.Columns[parts[0]] = parts[1]
+		}
+	}
+	if err := mapping.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := importer.Import(a.Db, r.Body, importer.Options{
+		Mapping: mapping,
+		DryRun:  query.Get("dry_run") == "true",
+		Actor:   actorFromRequest(r),
+		Cache:   a.Cache,
+	})
+	if err != nil {
+		log.Println("error while importing", err)
+		respondWithError(w, http.StatusBadRequest, "Could not read input: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
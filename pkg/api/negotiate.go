@@ -0,0 +1,297 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// representations of list responses
+const (
+	formatJson    = "json"
+	formatXml     = "xml"
+	formatMsgpack = "msgpack"
+	formatCsv     = "csv"
+)
+
+// content type of each representation
+var formatContentTypes = map[string]string{
+	formatJson:    "application/json",
+	formatXml:     "application/xml; charset=utf-8",
+	formatMsgpack: "application/msgpack",
+	formatCsv:     "text/csv; charset=utf-8",
+}
+
+// formats in the order the server prefers them, on ties, with their media types. The first media type of a format
+// is the one that a type wildcard, e.g. text/*, stands for; the others only match when listed.
+var formatMediaTypes = []struct {
+	format     string
+	mediaTypes []string
+}{
+	{formatJson, []string{"application/json"}},
+	{formatXml, []string{"application/xml", "text/xml"}},
+	{formatMsgpack, []string{"application/msgpack", "application/x-msgpack"}},
+	{formatCsv, []string{"text/csv"}},
+}
+
+// listFormat picks the representation of a list response: the format parameter if given, otherwise the most
+// preferred media type of the Accept header that is supported. If there is none, it responds with an error and
+// returns false.
+func listFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := formatContentTypes[format]; !ok {
+			respondWithError(w, http.StatusBadRequest,
+				"Bad format value. Expected \"json\", \"xml\", \"msgpack\" or \"csv\"")
+			return "", false
+		}
+		return format, true
+	}
+	format, ok := negotiateFormat(r.Header.Get("Accept"))
+	if !ok {
+		respondWithError(w, http.StatusNotAcceptable,
+			"None of the accepted media types is supported. Use application/json, application/xml, "+
+				"application/msgpack or text/csv")
+	}
+	return format, ok
+}
+
+// mediaRange is a media range of an Accept header, with its quality.
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiateFormat returns the representation of the most preferred supported media type of an Accept header. The q
+// of a format is the one of the most specific range that matches it, so that "*/*, application/json;q=0" refuses
+// JSON, and ties go to the format that is listed rather than matched by a wildcard, then to the first one of
+// formatMediaTypes. JSON, the default, is preferred whenever it is acceptable and either no format is listed, or
+// none of the most preferred ranges is supported, as with the "text/html,application/xml;q=0.9,*/*;q=0.8" of
+// browsers.
+func negotiateFormat(accept string) (string, bool) {
+	if accept == "" {
+		return formatJson, true
+	}
+	var ranges []mediaRange
+	topQ := 0.0
+	for _, value := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+		if q > topQ {
+			topQ = q
+		}
+	}
+	topSupported := false
+	for _, r := range ranges {
+		for _, f := range formatMediaTypes {
+			topSupported = topSupported || (r.q == topQ && specificity(r.mediaType, f.mediaTypes) >= 0)
+		}
+	}
+
+	best, bestQ, bestListed, anyListed, jsonQ := "", 0.0, false, false, 0.0
+	for _, f := range formatMediaTypes {
+		q, listed := formatQ(ranges, f.mediaTypes)
+		if q <= 0 {
+			continue
+		}
+		if f.format == formatJson {
+			jsonQ = q
+		}
+		anyListed = anyListed || listed
+		if q > bestQ || (q == bestQ && listed && !bestListed) {
+			best, bestQ, bestListed = f.format, q, listed
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	if jsonQ > 0 && (!anyListed || !topSupported) {
+		return formatJson, true
+	}
+	return best, true
+}
+
+// formatQ returns the q of the most specific range that matches a format of mediaTypes, 0 if none does, and
+// whether that range lists one of them.
+func formatQ(ranges []mediaRange, mediaTypes []string) (float64, bool) {
+	q, most := 0.0, -1
+	for _, r := range ranges {
+		s := specificity(r.mediaType, mediaTypes)
+		if s > most || (s == most && s >= 0 && r.q > q) {
+			q, most = r.q, s
+		}
+	}
+	return q, most == 2
+}
+
+// specificity tells how a media range matches a format of mediaTypes: 2 if it lists one of them, 1 if it is the
+// type wildcard of the first one, 0 if it is */*, and -1 if it does not match.
+func specificity(mediaRange string, mediaTypes []string) int {
+	switch {
+	case contains(mediaTypes, mediaRange):
+		return 2
+	case mediaRange == strings.SplitN(mediaTypes[0], "/", 2)[0]+"/*":
+		return 1
+	case mediaRange == "*/*":
+		return 0
+	}
+	return -1
+}
+
+// listCacheKey is the key of a cached list response. Each representation is cached on its own, and the query
+// parameters, e.g. fields and include, are sorted so that the same list is cached once however they are ordered.
+func listCacheKey(r *http.Request, format string) string {
+	key := format + ":" + r.URL.Path
+	if query := r.URL.Query().Encode(); query != "" {
+		key += "?" + query
+	}
+	return key
+}
+
+// encodeList encodes a slice of entities. In xml the list is an element named name, holding an element named item
+// for every entity. In csv the columns are the json fields of the entities.
+func encodeList(format string, name string, item string, items interface{}) ([]byte, error) {
+	switch format {
+	case formatXml:
+		body, err := xml.Marshal(xmlList{name: name, item: item, items: reflect.ValueOf(items)})
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), body...), nil
+	case formatMsgpack:
+		var buf bytes.Buffer
+		encoder := msgpack.NewEncoder(&buf).UseJSONTag(true)
+		if err := encoder.Encode(items); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case formatCsv:
+		return encodeCsv(reflect.ValueOf(items))
+	}
+	return json.Marshal(items)
+}
+
+type xmlList struct {
+	name  string
+	item  string
+	items reflect.Value
+}
+
+func (l xmlList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = l.name
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for i := 0; i < l.items.Len(); i++ {
+		item := xml.StartElement{Name: xml.Name{Local: l.item}}
+		if err := e.EncodeElement(l.items.Index(i).Interface(), item); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// encodeCsv writes a slice of structs as csv, with a header line of their json field names. Nested structs, other
+// than times, are left out. Resources are written with the fields they have, the ones of embedded resources
+// prefixed by their name.
+func encodeCsv(items reflect.Value) ([]byte, error) {
+	header, rows := csvRows(items)
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(header))
+	for _, row := range rows {
+		for j, value := range row {
+			record[j] = csvValue(reflect.ValueOf(value))
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// csvRows returns the columns of a slice of structs or resources, and the values of every item in them.
+func csvRows(items reflect.Value) ([]string, [][]interface{}) {
+	var header []string
+	rows := make([][]interface{}, items.Len())
+	if resources, ok := items.Interface().([]resource); ok {
+		// resources leave out empty fields, so the columns are all the fields any of them has
+		byName := make([]map[string]interface{}, len(resources))
+		for i, res := range resources {
+			names, values := res.flatten("")
+			byName[i] = make(map[string]interface{}, len(names))
+			for j, name := range names {
+				if !contains(header, name) {
+					header = append(header, name)
+				}
+				byName[i][name] = values[j]
+			}
+		}
+		for i := range rows {
+			rows[i] = make([]interface{}, len(header))
+			for j, name := range header {
+				rows[i][j] = byName[i][name]
+			}
+		}
+		return header, rows
+	}
+	t := items.Type().Elem()
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _ := jsonName(f)
+		if name == "" || (f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{})) {
+			continue
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+	for i := range rows {
+		rows[i] = make([]interface{}, len(fields))
+		for j, field := range fields {
+			rows[i][j] = items.Index(i).Field(field).Interface()
+		}
+	}
+	return header, rows
+}
+
+func csvValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	}
+	return fmt.Sprint(v.Interface())
+}
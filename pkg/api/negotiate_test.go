@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := map[string]string{
+		"":                                   formatJson,
+		"*/*":                                formatJson,
+		"application/json":                   formatJson,
+		"application/xml":                    formatXml,
+		"text/xml, application/json;q=0.5":   formatXml,
+		"application/json;q=0.5, text/xml":   formatXml,
+		"application/x-msgpack":              formatMsgpack,
+		"text/html, text/csv;q=0.8":          formatCsv,
+		"application/msgpack;q=0, */*;q=0.2": formatJson,
+		"image/png, application/xml;q=0.9":   formatXml,
+		"application/json;q=oops, text/csv":  formatCsv,
+		// browsers list what they render, and take anything else
+		"text/html,application/xml;q=0.9,*/*;q=0.8":                                  formatJson,
+		"text/html, text/csv;q=0.8, */*;q=0.1":                                       formatJson,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8": formatJson,
+		// wildcards only
+		"application/*":                formatJson,
+		"text/*":                       formatCsv,
+		"text/*, */*;q=0.5":            formatJson,
+		"*/*, application/json;q=0":    formatXml,
+		"text/*, application/json;q=0": formatCsv,
+		// ties
+		"application/xml, application/json":        formatJson,
+		"text/*;q=0.9, application/xml;q=0.9":      formatXml,
+		"application/*;q=0.5, text/csv;q=0.5":      formatCsv,
+		"*/*;q=0.5, application/msgpack;q=0.5":     formatMsgpack,
+		"application/x-msgpack, application/*;q=0": formatMsgpack,
+	}
+	for accept, expected := range cases {
+		format, ok := negotiateFormat(accept)
+		assert.True(t, ok, accept)
+		assert.Equal(t, expected, format, accept)
+	}
+
+	_, ok := negotiateFormat("image/png, application/json;q=0")
+	assert.False(t, ok)
+}
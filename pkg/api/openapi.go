@@ -0,0 +1,615 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/importer"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+// object is a JSON object of the OpenAPI document.
+type object = map[string]interface{}
+
+// fields of the entities that are set by the API, and are ignored in request bodies
+var readOnlyFields = []string{"id", "created_at", "updated_at", "version", "deleted_at"}
+
+// openApiSpec describes every route of the API as an OpenAPI 3 document. The schemas are derived from the types
+// that are encoded in the bodies, so they follow the json of the responses.
+func openApiSpec() object {
+	schemas := &schemaSet{defs: object{}}
+	product := schemas.ref(model.Product{})
+	category := schemas.ref(model.Category{})
+	message := schemas.ref(Response{})
+	schemas.defs["Product"].(object)["properties"].(object)[includeCategory] = object{
+		"allOf":       []interface{}{category},
+		"description": "The category of the product, with include=category",
+		"readOnly":    true,
+	}
+	schemas.ref(Problem{})
+	schemas.defs["NewProduct"] = schemas.structSchema(reflect.TypeOf(model.Product{}), true)
+	schemas.defs["NewCategory"] = schemas.structSchema(reflect.TypeOf(model.Category{}), true)
+	schemas.defs["JsonPatch"] = object{
+		"type": "array",
+		"items": object{
+			"type":     "object",
+			"required": []string{"op", "path"},
+			"properties": object{
+				"op":    object{"type": "string", "enum": []string{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  object{"type": "string"},
+				"from":  object{"type": "string"},
+				"value": object{},
+			},
+		},
+	}
+
+	productId := pathParam("id", "The id of the product", object{"type": "string", "format": "uuid"})
+	categoryId := pathParam("id", "The id of the category", object{"type": "integer"})
+	writeSecurity := []object{{"basicAuth": []string{}}, {"apiKey": []string{}}}
+
+	paths := object{
+		"/": object{
+			"get": object{
+				"summary": "Health check",
+				"tags":    []string{"health"},
+				"responses": object{
+					"418": jsonResponse("The API is up", object{
+						"type":       "object",
+						"properties": object{"Message": object{"type": "string"}},
+					}, nil),
+				},
+			},
+		},
+		"/openapi.json": object{
+			"get": object{
+				"summary": "This document",
+				"tags":    []string{"docs"},
+				"responses": object{
+					"200": jsonResponse("The OpenAPI document of the API", object{"type": "object"}, nil),
+				},
+			},
+		},
+		"/docs": object{
+			"get": object{
+				"summary": "Documentation of the API, rendered from this document",
+				"tags":    []string{"docs"},
+				"responses": object{
+					"200": object{"description": "An HTML page", "content": object{"text/html": object{}}},
+				},
+			},
+		},
+		"/v1/products": object{
+			"get": listOperation("List products", "products", product, services.ProductOrderFields(), true),
+			"post": object{
+				"summary":     "Create a product",
+				"tags":        []string{"products"},
+				"security":    writeSecurity,
+				"requestBody": jsonBody(schemas.ref(nil, "NewProduct")),
+				"responses": withProblems(object{
+					"201": jsonResponse("The product was created", message, headerRefs("Location")),
+				}, 400, 401, 409, 422, 429, 500),
+			},
+		},
+		"/v1/products/{id}": object{
+			"parameters": []interface{}{productId},
+			"get":        getOperation("Get a product", "products", product, true),
+			"patch":      patchOperation("Update a product", "products", product, writeSecurity),
+			"delete":     deleteOperation("Delete a product, moving it to the trash", "products", message, writeSecurity),
+		},
+		"/v1/products:batch": object{
+			"post": object{
+				"summary":     "Create, update and delete products in one request",
+				"tags":        []string{"products"},
+				"security":    writeSecurity,
+				"requestBody": jsonBody(schemas.ref(BatchRequest{})),
+				"responses": withProblems(object{
+					"200": jsonResponse("Every operation succeeded", schemas.ref(BatchResponse{}), nil),
+					"207": jsonResponse("Some operations failed", schemas.ref(BatchResponse{}), nil),
+				}, 400, 401, 413, 429, 500),
+			},
+		},
+		"/v1/products/{id}/restore": object{
+			"parameters": []interface{}{productId},
+			"post": object{
+				"summary":  "Restore a deleted product",
+				"tags":     []string{"trash"},
+				"security": writeSecurity,
+				"responses": withProblems(object{
+					"200": jsonResponse("The product was restored", message, nil),
+				}, 401, 404, 409, 429, 500),
+			},
+		},
+		"/v1/categories": object{
+			"get": listOperation("List categories", "categories", category, services.CategoryOrderFields(), false),
+			"post": object{
+				"summary":     "Create a category",
+				"tags":        []string{"categories"},
+				"security":    writeSecurity,
+				"requestBody": jsonBody(schemas.ref(nil, "NewCategory")),
+				"responses": withProblems(object{
+					"201": jsonResponse("The category was created", message, headerRefs("Location")),
+				}, 400, 401, 409, 422, 429, 500),
+			},
+		},
+		"/v1/categories/{id}": object{
+			"parameters": []interface{}{categoryId},
+			"get":        getOperation("Get a category", "categories", category, false),
+			"patch":      patchOperation("Update a category", "categories", category, writeSecurity),
+			"delete": deleteOperation("Delete a category that no product uses, moving it to the trash",
+				"categories", message, writeSecurity),
+		},
+		"/v1/categories:reorder": object{
+			"post": object{
+				"summary":     "Move categories to the first positions, in the order given, in one transaction",
+				"tags":        []string{"categories"},
+				"security":    writeSecurity,
+				"requestBody": jsonBody(schemas.ref(ReorderRequest{})),
+				"responses": withProblems(object{
+					"200": jsonResponse("All the categories, by position", arrayOf(category), nil),
+				}, 400, 401, 404, 422, 429, 500),
+			},
+		},
+		"/v1/categories/{id}/restore": object{
+			"parameters": []interface{}{categoryId},
+			"post": object{
+				"summary":  "Restore a deleted category",
+				"tags":     []string{"trash"},
+				"security": writeSecurity,
+				"responses": withProblems(object{
+					"200": jsonResponse("The category was restored", message, nil),
+				}, 400, 401, 404, 409, 429, 500),
+			},
+		},
+		"/v1/export/products": object{
+			"get": object{
+				"summary": "Stream the product catalog as a file",
+				"tags":    []string{"export"},
+				"parameters": []interface{}{
+					queryParam("format", "Format of the file", object{
+						"type": "string", "enum": []string{"csv", "ndjson", "xml"}, "default": "csv"}),
+					queryParam("page", "Page of the products to export, instead of all of them",
+						object{"type": "integer", "minimum": 1}),
+					queryParam("perPage", "Products per page, 10 if only page is given",
+						object{"type": "integer", "minimum": 1}),
+					object{"$ref": "#/components/parameters/offset"},
+					object{"$ref": "#/components/parameters/limit"},
+					orderByParam(services.ProductOrderFields()),
+					queryParam("category", "Comma separated ids of the categories of the products",
+						object{"type": "string"}),
+					queryParam("updatedSince", "Export the products updated at or after this time, or date",
+						object{"type": "string", "format": "date-time"}),
+				},
+				"responses": withProblems(object{
+					"200": object{
+						"description": "The products, written as they are read",
+						"headers":     object{"Content-Disposition": object{"schema": object{"type": "string"}}},
+						"content": object{
+							"text/csv":             object{},
+							"application/x-ndjson": object{},
+							"application/xml":      object{},
+						},
+					},
+				}, 400, 429, 500),
+			},
+		},
+		"/v1/import": object{
+			"post": object{
+				"summary":  "Import products or categories from a file, creating or updating them by their key",
+				"tags":     []string{"import"},
+				"security": writeSecurity,
+				"parameters": []interface{}{
+					queryParam("entity", "What the file holds", object{
+						"type": "string", "enum": []string{importer.EntityProduct, importer.EntityCategory}}, true),
+					queryParam("format", "Format of the file, taken from the Content-Type header if missing",
+						object{"type": "string", "enum": []string{importer.FormatCsv, importer.FormatNdjson}}),
+					queryParam("delimiter", "Delimiter of csv files", object{"type": "string", "default": ","}),
+					queryParam("columns", "Columns of fields that are named differently in the file, as "+
+						"field=column,...", object{"type": "string"}),
+					queryParam("dry_run", "Validate the file without writing anything", object{"type": "boolean"}),
+				},
+				"requestBody": object{
+					"required": true,
+					"content":  object{"text/csv": object{}, "application/x-ndjson": object{}},
+				},
+				"responses": withProblems(object{
+					"200": jsonResponse("What was imported, and the lines that failed",
+						schemas.ref(importer.Report{}), nil),
+				}, 400, 401, 415, 429, 500),
+			},
+		},
+		"/v1/trash": object{
+			"get": object{
+				"summary":  "List deleted products or categories",
+				"tags":     []string{"trash"},
+				"security": writeSecurity,
+				"parameters": append([]interface{}{
+					queryParam("entity", "Which entities to list, both if missing", object{
+						"type": "string", "enum": []string{model.AuditEntityProduct, model.AuditEntityCategory}}),
+				}, paginationParams()...),
+				"responses": withProblems(object{
+					"200": jsonResponse("The deleted entities", arrayOf(schemas.ref(model.TrashItem{})), nil),
+				}, 400, 401, 429, 500),
+			},
+		},
+		"/v1/audit": object{
+			"get": object{
+				"summary":  "List the changes made to products and categories",
+				"tags":     []string{"audit"},
+				"security": writeSecurity,
+				"parameters": append([]interface{}{
+					queryParam("entity", "Type of the changed entities", object{
+						"type": "string", "enum": []string{model.AuditEntityProduct, model.AuditEntityCategory}}),
+					queryParam("id", "Id of the changed entity", object{"type": "string"}),
+					queryParam("user", "User who made the changes", object{"type": "string"}),
+					queryParam("from", "Changes made since", object{"type": "string", "format": "date-time"}),
+					queryParam("to", "Changes made until", object{"type": "string", "format": "date-time"}),
+				}, paginationParams()...),
+				"responses": withProblems(object{
+					"200": jsonResponse("The changes, newest first", arrayOf(schemas.ref(model.AuditEntry{})), nil),
+				}, 400, 401, 429, 500),
+			},
+		},
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "small-api",
+			"version": "1",
+			"description": "Products and categories of a small catalog. Errors are problem+json documents, and " +
+				"every response has the X-Request-Id header of its request.",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas":    schemas.defs,
+			"parameters": commonParams(),
+			"headers":    commonHeaders(),
+			"responses":  problemResponses(),
+			"securitySchemes": object{
+				"basicAuth": object{"type": "http", "scheme": "basic"},
+				"apiKey":    object{"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+			},
+		},
+	}
+}
+
+func (a *Api) openApi(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, openApiSpec())
+}
+
+func (a *Api) docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(docsPage))
+}
+
+func listOperation(summary string, tag string, item object, orderFields []string, include bool) object {
+	params := append(paginationParams(),
+		orderByParam(orderFields),
+		queryParam("format", "Representation of the list, instead of the one negotiated by the Accept header",
+			object{"type": "string", "enum": []string{formatJson, formatXml, formatMsgpack, formatCsv}}),
+		object{"$ref": "#/components/parameters/fields"},
+	)
+	if include {
+		params = append(params, object{"$ref": "#/components/parameters/include"})
+	}
+	params = append(params, object{"$ref": "#/components/parameters/If-None-Match"})
+	return object{
+		"summary":    summary,
+		"tags":       []string{tag},
+		"parameters": params,
+		"responses": withProblems(object{
+			"200": object{
+				"description": "A page of the list",
+				"headers": headerRefs("Link", "page", "perPage", "limit", "offset", "ETag", "Vary",
+					"Cache-Control"),
+				"content": object{
+					"application/json":    object{"schema": arrayOf(item)},
+					"application/xml":     object{},
+					"application/msgpack": object{},
+					"text/csv":            object{},
+				},
+			},
+			"304": object{"description": "The client has the current list already", "headers": headerRefs("ETag")},
+		}, 400, 406, 422, 429, 500),
+	}
+}
+
+func getOperation(summary string, tag string, entity object, include bool) object {
+	params := []interface{}{
+		object{"$ref": "#/components/parameters/fields"},
+		object{"$ref": "#/components/parameters/If-None-Match"},
+		object{"$ref": "#/components/parameters/If-Modified-Since"},
+	}
+	if include {
+		params = append(params, object{"$ref": "#/components/parameters/include"})
+	}
+	return object{
+		"summary":    summary,
+		"tags":       []string{tag},
+		"parameters": params,
+		"responses": withProblems(object{
+			"200": jsonResponse("The entity", entity, headerRefs("ETag", "Last-Modified", "Cache-Control")),
+			"304": object{
+				"description": "The client has the current version already",
+				"headers":     headerRefs("ETag", "Last-Modified"),
+			},
+		}, 400, 404, 429, 500),
+	}
+}
+
+func patchOperation(summary string, tag string, entity object, security []object) object {
+	return object{
+		"summary":    summary,
+		"tags":       []string{tag},
+		"security":   security,
+		"parameters": []interface{}{object{"$ref": "#/components/parameters/If-Match"}},
+		"requestBody": object{
+			"required": true,
+			"content": object{
+				"application/merge-patch+json": object{"schema": entity},
+				"application/json":             object{"schema": entity},
+				"application/json-patch+json":  object{"schema": object{"$ref": "#/components/schemas/JsonPatch"}},
+			},
+		},
+		"responses": withProblems(object{
+			"200": jsonResponse("The updated entity", entity, headerRefs("ETag")),
+		}, 400, 401, 404, 409, 412, 415, 422, 429, 500),
+	}
+}
+
+func deleteOperation(summary string, tag string, message object, security []object) object {
+	return object{
+		"summary":    summary,
+		"tags":       []string{tag},
+		"security":   security,
+		"parameters": []interface{}{object{"$ref": "#/components/parameters/If-Match"}},
+		"responses": withProblems(object{
+			"200": jsonResponse("The entity was deleted", message, nil),
+		}, 400, 401, 404, 409, 412, 429, 500),
+	}
+}
+
+func paginationParams() []interface{} {
+	return []interface{}{
+		object{"$ref": "#/components/parameters/page"},
+		object{"$ref": "#/components/parameters/perPage"},
+		object{"$ref": "#/components/parameters/limit"},
+		object{"$ref": "#/components/parameters/offset"},
+	}
+}
+
+func orderByParam(fields []string) object {
+	return queryParam("orderBy", "Comma separated fields to order by, each followed by :asc or :desc (the "+
+		"default), e.g. \"category_id:asc,price:desc\". Ties are ordered by id. Fields: "+strings.Join(fields, ", "),
+		object{"type": "string"})
+}
+
+func commonParams() object {
+	return object{
+		"page":    queryParam("page", "Page of the list", object{"type": "integer", "minimum": 1, "default": 1}),
+		"perPage": queryParam("perPage", "Entities per page", object{"type": "integer", "minimum": 1, "default": 10}),
+		"limit": queryParam("limit", "Maximum number of entities, 0 for all",
+			object{"type": "integer", "minimum": 0, "default": 0}),
+		"offset": queryParam("offset", "Number of entities to skip",
+			object{"type": "integer", "minimum": 0, "default": 0}),
+		"fields": queryParam("fields", "Comma separated json fields to return, instead of all of them",
+			object{"type": "string"}),
+		"include": queryParam("include", "Related entities to embed", object{
+			"type": "string", "enum": productIncludes}),
+		"If-None-Match": headerParam("If-None-Match", "Entity tags the client has cached"),
+		"If-Modified-Since": headerParam("If-Modified-Since",
+			"Time the client's copy was last modified, ignored if If-None-Match is given"),
+		"If-Match": headerParam("If-Match",
+			"Entity tag of the version the change is based on. The change fails with 412 if it is outdated"),
+	}
+}
+
+func commonHeaders() object {
+	header := func(description string) object {
+		return object{"description": description, "schema": object{"type": "string"}}
+	}
+	return object{
+		"Link":                  header("first, last, prev, next and self links of the list"),
+		"page":                  header("Page of the list"),
+		"perPage":               header("Entities per page"),
+		"limit":                 header("Limit of the list"),
+		"offset":                header("Offset of the list"),
+		"ETag":                  header("Entity tag of the response"),
+		"Last-Modified":         header("Time the entity was last modified"),
+		"Vary":                  header("Request headers the response depends on"),
+		"Location":              header("Path of the created entity"),
+		"Cache-Control":         header("Caching directives, if configured for the route"),
+		"X-RateLimit-Limit":     header("Requests allowed per window"),
+		"X-RateLimit-Remaining": header("Requests left in the current window"),
+		"X-RateLimit-Reset":     header("Unix time the window resets"),
+		"Retry-After":           header("Seconds to wait before retrying"),
+	}
+}
+
+// problemResponses are the error responses of the operations, named by their status.
+func problemResponses() object {
+	responses := object{}
+	for _, status := range apperr.Statuses() {
+		response := object{
+			"description": http.StatusText(status),
+			"content":     object{problemContentType: object{"schema": object{"$ref": "#/components/schemas/Problem"}}},
+		}
+		if status == http.StatusTooManyRequests {
+			response["headers"] = headerRefs("X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+				"Retry-After")
+		}
+		responses[strconv.Itoa(status)] = response
+	}
+	return responses
+}
+
+// withProblems adds error responses, by status, to the responses of an operation.
+func withProblems(responses object, statuses ...int) object {
+	for _, status := range statuses {
+		code := strconv.Itoa(status)
+		responses[code] = object{"$ref": "#/components/responses/" + code}
+	}
+	return responses
+}
+
+func jsonResponse(description string, schema object, headers object) object {
+	response := object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": schema}},
+	}
+	if headers != nil {
+		response["headers"] = headers
+	}
+	return response
+}
+
+func jsonBody(schema object) object {
+	return object{"required": true, "content": object{"application/json": object{"schema": schema}}}
+}
+
+func headerRefs(names ...string) object {
+	headers := object{}
+	for _, name := range names {
+		headers[name] = object{"$ref": "#/components/headers/" + name}
+	}
+	return headers
+}
+
+func pathParam(name string, description string, schema object) object {
+	return object{"name": name, "in": "path", "required": true, "description": description, "schema": schema}
+}
+
+func queryParam(name string, description string, schema object, required ...bool) object {
+	param := object{"name": name, "in": "query", "description": description, "schema": schema}
+	if len(required) > 0 && required[0] {
+		param["required"] = true
+	}
+	return param
+}
+
+func headerParam(name string, description string) object {
+	return object{"name": name, "in": "header", "description": description, "schema": object{"type": "string"}}
+}
+
+func arrayOf(items object) object {
+	return object{"type": "array", "items": items}
+}
+
+// schemaSet derives schemas from Go types, following their json encoding. Structs are defined once, under their
+// type name, and referenced.
+type schemaSet struct {
+	defs object
+}
+
+// ref returns a reference to the schema of v, or to the one named name if v is nil.
+func (s *schemaSet) ref(v interface{}, name ...string) object {
+	if v == nil {
+		return object{"$ref": "#/components/schemas/" + name[0]}
+	}
+	return s.of(reflect.TypeOf(v))
+}
+
+func (s *schemaSet) of(t reflect.Type) object {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return object{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return object{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Struct:
+		if _, ok := s.defs[t.Name()]; !ok {
+			s.defs[t.Name()] = object{}
+			s.defs[t.Name()] = s.structSchema(t, false)
+		}
+		return object{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return arrayOf(s.of(t.Elem()))
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32:
+		return object{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return object{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return object{"type": "number", "format": "double"}
+	case reflect.Interface:
+		return object{"nullable": true}
+	}
+	return object{}
+}
+
+// structSchema is the schema of the json of a struct. Constraints are taken from the validate tags. Input schemas
+// leave out the read only fields, and require the fields that validation requires.
+func (s *schemaSet) structSchema(t reflect.Type, input bool) object {
+	properties := object{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitEmpty := jsonName(f)
+		if name == "" || (input && contains(readOnlyFields, name)) {
+			continue
+		}
+		property := s.of(f.Type)
+		kind := f.Type.Kind()
+		if !omitEmpty && (kind == reflect.Ptr || kind == reflect.Slice || kind == reflect.Map) {
+			// nil values are encoded as null
+			if _, ok := property["$ref"]; ok {
+				property = object{"allOf": []interface{}{property}}
+			}
+			property["nullable"] = true
+		}
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			parts := strings.SplitN(rule, "=", 2)
+			switch {
+			case parts[0] == "required":
+				required = append(required, name)
+			case parts[0] == "url":
+				property["format"] = "uri"
+			case len(parts) == 2 && (parts[0] == "min" || parts[0] == "max"):
+				n, err := strconv.Atoi(parts[1])
+				if err != nil {
+					continue
+				}
+				key := map[string]string{"min": "minimum", "max": "maximum"}[parts[0]]
+				if property["type"] == "string" {
+					key = map[string]string{"min": "minLength", "max": "maxLength"}[parts[0]]
+				}
+				property[key] = n
+			case len(parts) == 2 && parts[0] == "maxbytes":
+				n, err := strconv.Atoi(parts[1])
+				if err != nil {
+					continue
+				}
+				// JSON Schema counts characters, which are never more than the bytes
+				property["maxLength"] = n
+				property["description"] = "At most " + parts[1] + " bytes long in UTF-8"
+			}
+		}
+		if !input && contains(readOnlyFields, name) && t.PkgPath() == reflect.TypeOf(model.Product{}).PkgPath() {
+			property["readOnly"] = true
+		}
+		properties[name] = property
+	}
+	schema := object{"type": "object", "properties": properties, "additionalProperties": false}
+	if input && len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
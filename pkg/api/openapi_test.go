@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder(problemContentType, func(body io.Reader, header http.Header,
+		schema *openapi3.SchemaRef, encFn openapi3filter.EncodingFn) (interface{}, error) {
+		var value interface{}
+		err := json.NewDecoder(body).Decode(&value)
+		return value, err
+	})
+}
+
+// loadSpec reads the OpenAPI document the way clients do, and checks that it is valid.
+func (s *Suite) loadSpec(router *mux.Router) *openapi3.Swagger {
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	spec, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(rr.Body.Bytes())
+	if !assert.Nil(s.T(), err) {
+		s.T().FailNow()
+	}
+	assert.Nil(s.T(), spec.Validate(context.Background()))
+	return spec
+}
+
+func (s *Suite) TestOpenApiCoversRoutes() {
+	router := s.api.router()
+	spec := s.loadSpec(router)
+
+	registered := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = true
+			item := spec.Paths.Find(path)
+			if assert.NotNil(s.T(), item, "%s is missing from the spec", path) {
+				assert.NotNil(s.T(), item.GetOperation(method), "%s %s is missing from the spec", method, path)
+			}
+		}
+		return nil
+	})
+	assert.Nil(s.T(), err)
+
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			assert.True(s.T(), registered[method+" "+path], "%s %s is not a route", method, path)
+		}
+	}
+}
+
+func (s *Suite) TestResponsesMatchOpenApi() {
+	db := s.api.Db.(*services.DbServiceMock)
+	assert.Nil(s.T(), db.AddUser(model.User{Username: "admin", Password: "secret"}))
+	router := s.api.router()
+	spec := s.loadSpec(router)
+	specRouter := openapi3filter.NewRouter().WithSwagger(spec)
+
+	product := db.Products[1]
+	category := db.Categories[1]
+	categoryId := strconv.Itoa(category.Id)
+	cases := []struct {
+		method  string
+		url     string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{"GET", "/", nil, "", http.StatusTeapot},
+		{"GET", "/docs", nil, "", http.StatusOK},
+		{"GET", "/v1/products?perPage=3", nil, "", http.StatusOK},
+		{"GET", "/v1/products?perPage=3&fields=id,title&include=category", nil, "", http.StatusOK},
+		{"GET", "/v1/products?perPage=3&orderBy=price:asc", map[string]string{"Accept": "text/csv"}, "",
+			http.StatusOK},
+		{"GET", "/v1/products?orderBy=colour", nil, "", http.StatusBadRequest},
+		{"GET", "/v1/products", map[string]string{"Accept": "image/png"}, "", http.StatusNotAcceptable},
+		{"GET", "/v1/products/" + product.Id, nil, "", http.StatusOK},
+		{"GET", "/v1/products/" + product.Id + "?include=category", nil, "", http.StatusOK},
+		{"GET", "/v1/products/" + product.Id, map[string]string{"If-None-Match": versionETag(db.Products[0].Version)},
+			"", http.StatusNotModified},
+		{"POST", "/v1/products", nil, `{"title":"new"}`, http.StatusUnauthorized},
+		{"POST", "/v1/products", auth(nil), `{"category_id":` + categoryId + `,"title":"new",` +
+			`"image_url":"http://www.bestprice.gr/new.png","price":3}`, http.StatusCreated},
+		{"POST", "/v1/products", auth(nil), `{"title":""}`, http.StatusUnprocessableEntity},
+		{"PATCH", "/v1/products/" + product.Id, auth(map[string]string{"Content-Type": mergePatchContentType}),
+			`{"title":"patched"}`, http.StatusOK},
+		{"PATCH", "/v1/products/" + product.Id, auth(map[string]string{"If-Match": `"99"`}), `{}`,
+			http.StatusPreconditionFailed},
+		{"POST", "/v1/products:batch", auth(nil), `{"mode":"partial","operations":[{"op":"delete","id":"` +
+			db.Products[2].Id + `"},{"op":"create","product":{"title":""}}]}`, http.StatusMultiStatus},
+		{"DELETE", "/v1/products/" + db.Products[3].Id, auth(nil), "", http.StatusOK},
+		{"POST", "/v1/products/" + db.Products[3].Id + "/restore", auth(nil), "", http.StatusOK},
+		{"GET", "/v1/categories?orderBy=position:asc", nil, "", http.StatusOK},
+		{"GET", "/v1/categories?include=category", nil, "", http.StatusBadRequest},
+		{"GET", "/v1/categories/" + categoryId + "?fields=title", nil, "", http.StatusOK},
+		{"POST", "/v1/categories", auth(nil), `{"title":"new","position":3,` +
+			`"image_url":"http://www.bestprice.gr/new.png"}`, http.StatusCreated},
+		{"PATCH", "/v1/categories/" + categoryId, auth(nil), `{"title":"patched"}`, http.StatusOK},
+		{"POST", "/v1/categories:reorder", auth(nil), `{"ids":[` + categoryId + `]}`, http.StatusOK},
+		{"POST", "/v1/categories:reorder", auth(nil), `{"ids":[-1]}`, http.StatusNotFound},
+		{"DELETE", "/v1/categories/abc", auth(nil), "", http.StatusBadRequest},
+		{"GET", "/v1/export/products?format=ndjson&limit=2", nil, "", http.StatusOK},
+		{"POST", "/v1/import?entity=category&format=ndjson", auth(nil),
+			`{"external_id":"x1","title":"imported","position":1,"image_url":"http://www.bestprice.gr/i.png"}`,
+			http.StatusOK},
+		{"GET", "/v1/trash", auth(nil), "", http.StatusOK},
+		{"GET", "/v1/audit?entity=product", auth(nil), "", http.StatusOK},
+	}
+	for _, c := range cases {
+		name := c.method + " " + c.url
+		req := httptest.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(s.T(), c.status, rr.Code, name)
+
+		route, pathParams, err := specRouter.FindRoute(c.method, req.URL)
+		if !assert.Nil(s.T(), err, name) {
+			continue
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+			},
+			Status:  rr.Code,
+			Header:  rr.Header(),
+			Body:    ioutil.NopCloser(rr.Body),
+			Options: &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			assert.Fail(s.T(), err.Error(), name)
+		}
+	}
+}
+
+// auth adds the credentials of the test user to headers.
+func auth(headers map[string]string) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Authorization"] = "Basic YWRtaW46c2VjcmV0"
+	return headers
+}
@@ -7,6 +7,8 @@ import (
 	"path"
 	"strconv"
 	"strings"
+
+	"github.com/panospet/small-api/pkg/model"
 )
 
 type Pagination struct {
@@ -65,6 +67,12 @@ func getPaginationFromRequest(r *http.Request) (*Pagination, error) {
 	return &pagination, nil
 }
 
+// orderByFromRequest reads the orderBy parameter, e.g. "orderBy=category_id:asc,price:desc,title". The order is
+// descending by default. Which fields are allowed is up to the storage.
+func orderByFromRequest(r *http.Request) ([]model.Order, error) {
+	return model.ParseOrderBy(r.FormValue("orderBy"))
+}
+
 func setPaginationHeaders(w http.ResponseWriter, r *http.Request, p *Pagination, total int) {
 	w.Header().Add("limit", fmt.Sprintf("%d", p.limit))
 	w.Header().Add("page", fmt.Sprintf("%d", p.page))
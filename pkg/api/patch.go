@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"github.com/panospet/small-api/pkg/patch"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+type patchError struct {
+	status  int
+	message string
+}
+
+// applyPatch applies the body of a PATCH request to the json representation of original, and decodes the result
+// into patched, with the immutable fields of package patch unchanged. It supports JSON Merge Patch (RFC 7396) and
+// JSON Patch (RFC 6902) bodies. Plain application/json bodies are treated as merge patches, as they have always been.
+func applyPatch(r *http.Request, original interface{}, patched interface{}) *patchError {
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return &patchError{http.StatusUnsupportedMediaType, "Invalid Content-Type header"}
+		}
+	}
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return &patchError{http.StatusBadRequest, "Invalid PATCH request"}
+	}
+	doc, err := json.Marshal(original)
+	if err != nil {
+		return &patchError{http.StatusInternalServerError, "Resource could not be serialized"}
+	}
+
+	var result []byte
+	switch mediaType {
+	case "application/json", mergePatchContentType:
+		result, err = jsonpatch.MergePatch(doc, raw)
+		if err != nil {
+			return &patchError{http.StatusBadRequest, "Invalid merge patch document"}
+		}
+	case jsonPatchContentType:
+		ops, err := jsonpatch.DecodePatch(raw)
+		if err != nil {
+			return &patchError{http.StatusBadRequest, "Invalid JSON patch document"}
+		}
+		result, err = ops.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return &patchError{http.StatusConflict, "JSON patch test operation failed"}
+		}
+		if err != nil {
+			return &patchError{http.StatusUnprocessableEntity, fmt.Sprintf("JSON patch could not be applied: %s", err)}
+		}
+	default:
+		return &patchError{http.StatusUnsupportedMediaType, fmt.Sprintf(
+			"Unsupported Content-Type %s. Use %s or %s", mediaType, mergePatchContentType, jsonPatchContentType)}
+	}
+
+	if err := patch.Decode(doc, result, patched); err != nil {
+		return &patchError{http.StatusUnprocessableEntity, err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Code is a stable identifier of the error that clients can rely on,
+// and RequestId is the id to look for in the logs.
+type Problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Detail    string          `json:"detail,omitempty"`
+	Code      string          `json:"code"`
+	RequestId string          `json:"request_id,omitempty"`
+	Errors    validate.Errors `json:"errors,omitempty"`
+}
+
+// respondWithProblem writes err, as returned by the services, as a problem. The cause of internal errors is only
+// logged.
+func respondWithProblem(w http.ResponseWriter, err error) {
+	writeProblem(w, problemOf(err))
+}
+
+// problemOf maps err, as returned by the services, to a problem.
+func problemOf(err error) Problem {
+	e := apperr.As(err)
+	status := e.Status()
+	if status == http.StatusInternalServerError {
+		log.Println("internal error:", err)
+	}
+	return newProblem(status, e.Code, e.Message)
+}
+
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	writeProblem(w, newProblem(code, apperr.CodeOfStatus(code), message))
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, errs validate.Errors) {
+	writeProblem(w, validationProblem(errs))
+}
+
+func validationProblem(errs validate.Errors) Problem {
+	problem := newProblem(http.StatusUnprocessableEntity, apperr.CodeValidationFailed, "Validation failed")
+	problem.Errors = errs
+	return problem
+}
+
+// newProblem returns the problem of a status. Problems have no type of their own, so their title is the one of the
+// status.
+func newProblem(status int, code string, detail string) Problem {
+	return Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail, Code: code}
+}
+
+// writeProblem writes problem with the id of the request, taken from the response headers, where the RequestId
+// middleware puts it.
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	problem.RequestId = w.Header().Get("X-Request-Id")
+	response, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(response)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/panospet/small-api/pkg/ratelimit"
+)
+
+// RateLimiter limits requests per client. Clients are identified by their API key or their username once
+// Authenticator let them through, and by their IP address otherwise.
+func RateLimiter(nextHandler http.HandlerFunc, app *Api, rate ratelimit.Rate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Limiter == nil || rate.Limit <= 0 {
+			nextHandler(w, r)
+			return
+		}
+		res, err := app.Limiter.Allow(rateLimitKey(r), rate)
+		if err != nil {
+			log.Println("error while checking rate limit", err)
+			nextHandler(w, r)
+			return
+		}
+		if !limited(w, res) {
+			nextHandler(w, r)
+		}
+	}
+}
+
+// FailedAuthLimiter limits failed authentications per client IP, so that guessing credentials is limited, while
+// authenticated requests are left to RateLimiter: clients behind the same IP do not share a quota. Once an IP
+// failed too often, its requests are rejected before their credentials are checked.
+func FailedAuthLimiter(nextHandler http.HandlerFunc, app *Api, rate ratelimit.Rate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Limiter == nil || rate.Limit <= 0 {
+			nextHandler(w, r)
+			return
+		}
+		key := fmt.Sprintf("auth:%s", clientIp(r))
+		res, err := app.Limiter.Peek(key, rate)
+		if err != nil {
+			log.Println("error while checking rate limit", err)
+			nextHandler(w, r)
+			return
+		}
+		if !res.Allowed {
+			limited(w, res)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		nextHandler(sw, r)
+		if sw.status != http.StatusUnauthorized {
+			return
+		}
+		if _, err := app.Limiter.Allow(key, rate); err != nil {
+			log.Println("error while counting failed authentication", err)
+		}
+	}
+}
+
+// limited sets the X-RateLimit-* headers of res, and responds with 429 if the request is not allowed.
+func limited(w http.ResponseWriter, res ratelimit.Result) bool {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(res.Reset.Unix(), 10))
+	if res.Allowed {
+		return false
+	}
+	retryAfter := int(time.Until(res.Reset).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondWithError(w, http.StatusTooManyRequests, "Too many requests")
+	return true
+}
+
+// statusWriter records the status of a response, for FailedAuthLimiter to tell failed authentications.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if client, ok := apiKeyFromRequest(r); ok {
+		return fmt.Sprintf("key:%s", client)
+	}
+	if username, ok := userFromRequest(r); ok {
+		return fmt.Sprintf("user:%s", username)
+	}
+	return fmt.Sprintf("ip:%s", clientIp(r))
+}
+
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ReorderRequest is the body of POST /v1/categories:reorder. The categories of Ids move to the first positions, in
+// their order, and the rest of the categories after them, keeping their order. Without ids, the positions are only
+// renumbered from 1.
+type ReorderRequest struct {
+	Ids []int `json:"ids"`
+}
+
+// reorderCategories moves categories in a single transaction, so that no client sees them half moved, and
+// responds with all the categories by position.
+func (a *Api) reorderCategories(w http.ResponseWriter, r *http.Request) {
+	var req ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid reorder request")
+		return
+	}
+	before, err := a.Db.GetCategories(0, 0, nil)
+	if err != nil {
+		log.Println("error while getting categories", err)
+		respondWithProblem(w, err)
+		return
+	}
+	categories, err := a.Db.ReorderCategories(req.Ids, actorFromRequest(r))
+	if err != nil {
+		log.Println("error while reordering categories", err)
+		respondWithProblem(w, err)
+		return
+	}
+	positions := make(map[int]int, len(before))
+	for _, c := range before {
+		positions[c.Id] = c.Position
+	}
+	for _, c := range categories {
+		if positions[c.Id] != c.Position {
+			go a.cacheSetCategory(c)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, categories)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+const requestIdContextKey contextKey = "requestId"
+
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestId gives every request an id, taken from the X-Request-Id header if the client (or a proxy) sent a valid
+// one. The id is sent back in the response headers and is recorded in the audit log.
+func RequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestId.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdContextKey, id)))
+	})
+}
+
+func requestIdFromRequest(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdContextKey).(string)
+	return id
+}
+
+// actorFromRequest returns the authenticated user performing the request, to be recorded in the audit log.
+func actorFromRequest(r *http.Request) *model.Actor {
+	username, _ := userFromRequest(r)
+	return &model.Actor{
+		Username:  username,
+		RequestId: requestIdFromRequest(r),
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func (a *Api) restoreProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	err := a.Db.RestoreProduct(id, actorFromRequest(r))
+	if err != nil {
+		log.Println("error while restoring product", err)
+		respondWithProblem(w, err)
+		return
+	}
+	if product, err := a.Db.GetProduct(id); err == nil {
+		go a.cacheSetProduct(product)
+	}
+	respondWithJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("Product with id %s was restored", id)})
+}
+
+func (a *Api) restoreCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		log.Println("error with category id", err)
+		respondWithError(w, http.StatusBadRequest, "Bad category id")
+		return
+	}
+	err = a.Db.RestoreCategory(id, actorFromRequest(r))
+	if err != nil {
+		log.Println("error while restoring category", err)
+		respondWithProblem(w, err)
+		return
+	}
+	if category, err := a.Db.GetCategory(id); err == nil {
+		go a.cacheSetCategory(category)
+	}
+	respondWithJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("Category with id %d was restored", id)})
+}
+
+func (a *Api) getTrash(w http.ResponseWriter, r *http.Request) {
+	entityType := r.FormValue("entity")
+	if entityType != "" && entityType != model.AuditEntityProduct && entityType != model.AuditEntityCategory {
+		respondWithError(w, http.StatusBadRequest, "Bad entity value. Example \"entity=product\"")
+		return
+	}
+	p, err := getPaginationFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error in pagination values")
+		return
+	}
+	items, err := a.Db.GetTrash(entityType, p.offset, p.limit)
+	if err != nil {
+		log.Println("error while getting trash", err)
+		respondWithProblem(w, err)
+		return
+	}
+	total := len(items)
+	if total == 0 {
+		respondWithJSON(w, http.StatusOK, []model.TrashItem{})
+		return
+	}
+	if p.start > total-1 {
+		respondWithError(w, http.StatusBadRequest, "Page does not exist")
+		return
+	}
+	end := p.end
+	if p.end > total {
+		end = total
+	}
+	setPaginationHeaders(w, r, p, total)
+	respondWithJSON(w, http.StatusOK, items[p.start:end])
+}
+
+// StartTrashPurger periodically hard deletes products and categories that have been in the trash for longer than
+// retention. Every API instance may run it, purging is idempotent.
+func (a *Api) StartTrashPurger(retention time.Duration, interval time.Duration) {
+	go func() {
+		for {
+			purged, err := a.Db.PurgeDeleted(time.Now().Add(-retention))
+			if err != nil {
+				log.Println("error while purging trash", err)
+			} else if purged > 0 {
+				log.Println("purged", purged, "items from trash")
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
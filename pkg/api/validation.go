@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+// validateProduct checks product against the rules of model.Product, and that its category exists. It is used
+// both when creating and when patching products.
+func (a *Api) validateProduct(product model.Product) (validate.Errors, error) {
+	return ValidateProduct(a.Db, product)
+}
+
+// ValidateProduct is the validation of products by the API, for the tools that write them to db directly. The
+// error is the one of reading db, and the validation errors are returned apart.
+func ValidateProduct(db services.DbService, product model.Product) (validate.Errors, error) {
+	errs := validate.Struct(product)
+	if product.CategoryId != 0 {
+		_, err := db.GetCategory(product.CategoryId)
+		if apperr.KindOf(err) == apperr.KindNotFound {
+			errs = append(errs, validate.FieldError{
+				Field:   "category_id",
+				Code:    validate.CodeNotFound,
+				Message: fmt.Sprintf("category with id %d does not exist", product.CategoryId),
+			})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
+
+func (a *Api) validateCategory(category model.Category) (validate.Errors, error) {
+	return validate.Struct(category), nil
+}
@@ -0,0 +1,110 @@
+// Package apperr defines the errors returned by the services, so that callers can tell what went wrong without
+// knowing which database is behind them.
+package apperr
+
+import (
+	"errors"
+)
+
+// Kind is the broad category of an error.
+type Kind string
+
+const (
+	KindNotFound     Kind = "not_found"
+	KindConflict     Kind = "conflict"
+	KindValidation   Kind = "validation"
+	KindUnauthorized Kind = "unauthorized"
+	KindInternal     Kind = "internal"
+)
+
+// Codes identify the exact problem. They are part of the API, so they must never change.
+const (
+	CodeNotFound         = "not_found"
+	CodeDuplicate        = "duplicate"
+	CodeReferenced       = "referenced"
+	CodeVersionConflict  = "version_conflict"
+	CodeCategoryInUse    = "category_in_use"
+	CodeCategoryDeleted  = "category_deleted"
+	CodeInvalidReference = "invalid_reference"
+	CodeInvalidValue     = "invalid_value"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidOperation = "invalid_operation"
+	CodeBatchAborted     = "batch_aborted"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeInternal         = "internal"
+
+	// codes of the errors that the API raises itself
+	CodeBadRequest           = "bad_request"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeConflict             = "conflict"
+	CodeTooLarge             = "too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeTooManyRequests      = "too_many_requests"
+)
+
+// Error is an error of some Kind. Message is meant for the client, while Err, the cause, is only meant for logs.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Wrap returns an error of kind, caused by err.
+func Wrap(err error, kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+func NotFound(message string) *Error {
+	return New(KindNotFound, CodeNotFound, message)
+}
+
+func Conflict(code string, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Validation(code string, message string) *Error {
+	return New(KindValidation, code, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(KindUnauthorized, CodeUnauthorized, message)
+}
+
+// Internal wraps an unexpected error. Its cause is never shown to clients.
+func Internal(err error) *Error {
+	return Wrap(err, KindInternal, CodeInternal, "Internal server error")
+}
+
+// As returns the *Error in the chain of err. Untyped errors are considered Internal.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err)
+}
+
+// KindOf returns the Kind of err, or "" if err is nil.
+func KindOf(err error) Kind {
+	if err == nil {
+		return ""
+	}
+	return As(err).Kind
+}
@@ -0,0 +1,64 @@
+package apperr
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsFindsWrappedError(t *testing.T) {
+	notFound := NotFound("Product not found")
+	err := fmt.Errorf("while getting product: %w", notFound)
+	assert.Equal(t, notFound, As(err))
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
+
+func TestUntypedErrorsAreInternal(t *testing.T) {
+	cause := errors.New("connection refused")
+	e := As(cause)
+	assert.Equal(t, KindInternal, e.Kind)
+	assert.Equal(t, CodeInternal, e.Code)
+	assert.Equal(t, "Internal server error", e.Message)
+	assert.True(t, errors.Is(e, cause))
+	assert.Equal(t, Kind(""), KindOf(nil))
+}
+
+func TestWrapKeepsCause(t *testing.T) {
+	err := Wrap(sql.ErrNoRows, KindNotFound, CodeNotFound, "Category not found")
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.Equal(t, "Category not found: sql: no rows in result set", err.Error())
+}
+
+func TestStatus(t *testing.T) {
+	for _, tt := range []struct {
+		err    *Error
+		status int
+	}{
+		{NotFound("Product not found"), http.StatusNotFound},
+		{Conflict(CodeCategoryInUse, "in use"), http.StatusConflict},
+		{Conflict(CodeVersionConflict, "changed"), http.StatusPreconditionFailed},
+		{Conflict(CodeBatchAborted, "aborted"), http.StatusFailedDependency},
+		// the status of a code depends on its kind
+		{Conflict(CodeDuplicate, "duplicate"), http.StatusConflict},
+		{Validation(CodeDuplicate, "duplicate"), http.StatusUnprocessableEntity},
+		{Validation(CodeInvalidParameter, "bad order"), http.StatusBadRequest},
+		{Unauthorized("who"), http.StatusUnauthorized},
+		{Internal(errors.New("down")), http.StatusInternalServerError},
+		{New("unknown", CodeBadRequest, "unknown kind"), http.StatusInternalServerError},
+	} {
+		assert.Equal(t, tt.status, tt.err.Status(), tt.err.Message)
+	}
+
+	assert.Equal(t, CodeBadRequest, CodeOfStatus(http.StatusBadRequest))
+	assert.Equal(t, CodeVersionConflict, CodeOfStatus(http.StatusPreconditionFailed))
+	assert.Equal(t, CodeValidationFailed, CodeOfStatus(http.StatusUnprocessableEntity))
+	assert.Equal(t, CodeTooManyRequests, CodeOfStatus(http.StatusTooManyRequests))
+	assert.Equal(t, "error", CodeOfStatus(http.StatusTeapot))
+	for _, status := range Statuses() {
+		assert.NotEqual(t, "error", CodeOfStatus(status), status)
+	}
+}
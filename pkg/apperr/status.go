@@ -0,0 +1,73 @@
+package apperr
+
+import (
+	"net/http"
+	"sort"
+)
+
+// statuses is the HTTP status of errors. An error gets the status of the row of its kind and code, or else the one
+// of the first row of its kind, and a status gets the code of its first row. Rows without a kind are the errors
+// that the API raises itself, which are not returned by the services.
+var statuses = []struct {
+	kind   Kind
+	code   string
+	status int
+}{
+	{"", CodeBadRequest, http.StatusBadRequest},
+	{"", CodeNotAcceptable, http.StatusNotAcceptable},
+	{"", CodeTooLarge, http.StatusRequestEntityTooLarge},
+	{"", CodeUnsupportedMediaType, http.StatusUnsupportedMediaType},
+	{"", CodeTooManyRequests, http.StatusTooManyRequests},
+	{KindNotFound, CodeNotFound, http.StatusNotFound},
+	{KindConflict, CodeConflict, http.StatusConflict},
+	{KindConflict, CodeVersionConflict, http.StatusPreconditionFailed},
+	{KindConflict, CodeBatchAborted, http.StatusFailedDependency},
+	{KindValidation, CodeValidationFailed, http.StatusUnprocessableEntity},
+	{KindValidation, CodeInvalidParameter, http.StatusBadRequest},
+	{KindUnauthorized, CodeUnauthorized, http.StatusUnauthorized},
+	{KindInternal, CodeInternal, http.StatusInternalServerError},
+}
+
+// Status returns the HTTP status of the error, 500 if its kind is unknown.
+func (e *Error) Status() int {
+	status := 0
+	for _, row := range statuses {
+		if row.kind == "" || row.kind != e.Kind {
+			continue
+		}
+		if row.code == e.Code {
+			return row.status
+		}
+		if status == 0 {
+			status = row.status
+		}
+	}
+	if status == 0 {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// CodeOfStatus returns the code of the errors that only have an HTTP status, "error" if there is none.
+func CodeOfStatus(status int) string {
+	for _, row := range statuses {
+		if row.status == status {
+			return row.code
+		}
+	}
+	return "error"
+}
+
+// Statuses returns the HTTP statuses of errors, in order.
+func Statuses() []int {
+	var all []int
+	seen := make(map[int]bool)
+	for _, row := range statuses {
+		if !seen[row.status] {
+			seen[row.status] = true
+			all = append(all, row.status)
+		}
+	}
+	sort.Ints(all)
+	return all
+}
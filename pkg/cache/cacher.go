@@ -1,9 +1,27 @@
 package cache
 
+import "time"
+
+// Stats counts what is cached.
+type Stats struct {
+	Products   int64 `json:"products"`
+	Categories int64 `json:"categories"`
+	// Requests is the number of cached list responses
+	Requests int64 `json:"requests"`
+}
+
+// requestTTL is how long responses are cached, as they are not removed when what they list changes
+const requestTTL = 15 * time.Minute
+
+// Cacher caches products and categories by id, serialized, and whole responses of the API by request. Getting
+// what is not cached returns an empty string and no error, while errors tell that the cache can not be used.
 type Cacher interface {
 	SetProduct(id string, prodStr string) error
 	GetProduct(id string) (string, error)
 	DeleteProduct(id string) error
+	// SetProducts and DeleteProducts change many products at once, e.g. after a batch request
+	SetProducts(products map[string]string) error
+	DeleteProducts(ids []string) error
 	SetCategory(id string, catStr string) error
 	GetCategory(id string) (string, error)
 	DeleteCategory(id string) error
@@ -11,4 +29,7 @@ type Cacher interface {
 	GetAllCategories() (map[string]string, error)
 	SetApiRequest(path string, serializedResponse string) error
 	GetApiRequest(path string) (string, error)
+	Stats() (Stats, error)
+	// Flush removes everything cached, products, categories and responses
+	Flush() error
 }
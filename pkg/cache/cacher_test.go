@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/stretchr/testify/assert"
+)
+
+// cacherControl drives a Cacher under test from the outside: expire moves its clock forward, and disconnect makes
+// it unreachable.
+type cacherControl struct {
+	expire     func(d time.Duration)
+	disconnect func()
+}
+
+// newCacherFunc returns a new, empty Cacher for a single test, and the function that closes it.
+type newCacherFunc func(t *testing.T) (Cacher, cacherControl, func())
+
+// testCacher runs the tests that every Cacher has to pass, each one on a new cache given by newCacher.
+func testCacher(t *testing.T, newCacher newCacherFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, c Cacher, control cacherControl)
+	}{
+		{"products", testCacheProducts},
+		{"categories", testCacheCategories},
+		{"requests", testCacheRequests},
+		{"stats and flush", testCacheStatsAndFlush},
+		{"disconnected", testCacheDisconnected},
+		{"concurrency", testCacheConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, control, closeCache := newCacher(t)
+			defer closeCache()
+			tt.test(t, c, control)
+		})
+	}
+}
+
+func TestRedisCacher(t *testing.T) {
+	testCacher(t, func(t *testing.T) (Cacher, cacherControl, func()) {
+		server, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewRedisCache("redis://" + server.Addr() + "/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, cacherControl{expire: server.FastForward, disconnect: server.Close}, func() {
+			_ = c.Client.Close()
+			server.Close()
+		}
+	})
+}
+
+func TestCacherMock(t *testing.T) {
+	testCacher(t, func(t *testing.T) (Cacher, cacherControl, func()) {
+		c := NewCacherMock()
+		now := time.Now()
+		c.now = func() time.Time {
+			return now
+		}
+		return c, cacherControl{
+			expire: func(d time.Duration) {
+				now = now.Add(d)
+			},
+			disconnect: func() {
+				c.Err = errors.New("redis is down")
+			},
+		}, func() {}
+	})
+}
+
+func TestNewRedisCache(t *testing.T) {
+	_, err := NewRedisCache("http://localhost")
+	assert.NotNil(t, err)
+
+	server, err := miniredis.Run()
+	assert.Nil(t, err)
+	addr := server.Addr()
+	server.Close()
+	c, err := NewRedisCache("redis://" + addr + "/1")
+	assert.NotNil(t, err)
+	// a cache that never connected fails without trying
+	assert.NotNil(t, c.SetProduct("1", "{}"))
+	_, err = c.GetProduct("1")
+	assert.NotNil(t, err)
+}
+
+func testCacheProducts(t *testing.T, c Cacher, _ cacherControl) {
+	p, err := c.GetProduct("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", p)
+
+	assert.Nil(t, c.SetProduct("1", `{"id":"1"}`))
+	assert.Nil(t, c.SetProducts(map[string]string{"2": `{"id":"2"}`, "3": `{"id":"3"}`}))
+	assert.Nil(t, c.SetProduct("1", `{"id":"1","title":"new"}`))
+	p, err = c.GetProduct("1")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":"1","title":"new"}`, p)
+
+	all, err := c.GetAllProducts()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"1": `{"id":"1","title":"new"}`, "2": `{"id":"2"}`, "3": `{"id":"3"}`}, all)
+	// the map returned is not the cache itself
+	delete(all, "1")
+	p, err = c.GetProduct("1")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, p)
+
+	assert.Nil(t, c.DeleteProduct("1"))
+	assert.Nil(t, c.DeleteProduct("missing"))
+	assert.Nil(t, c.DeleteProducts([]string{"2", "missing"}))
+	assert.Nil(t, c.DeleteProducts(nil))
+	all, err = c.GetAllProducts()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"3": `{"id":"3"}`}, all)
+}
+
+func testCacheCategories(t *testing.T, c Cacher, _ cacherControl) {
+	category, err := c.GetCategory("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", category)
+
+	assert.Nil(t, c.SetCategory("1", `{"id":1}`))
+	assert.Nil(t, c.SetCategory("2", `{"id":2}`))
+	category, err = c.GetCategory("2")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":2}`, category)
+	all, err := c.GetAllCategories()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"1": `{"id":1}`, "2": `{"id":2}`}, all)
+
+	assert.Nil(t, c.DeleteCategory("1"))
+	assert.Nil(t, c.DeleteCategory("missing"))
+	all, err = c.GetAllCategories()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"2": `{"id":2}`}, all)
+	// products and categories with the same ids are cached apart
+	p, err := c.GetProduct("2")
+	assert.Nil(t, err)
+	assert.Equal(t, "", p)
+}
+
+func testCacheRequests(t *testing.T, c Cacher, control cacherControl) {
+	const key = "json:/v1/products?page=2"
+	response, err := c.GetApiRequest(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "", response)
+
+	assert.Nil(t, c.SetApiRequest(key, `[{"id":"1"}]`))
+	response, err = c.GetApiRequest(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"id":"1"}]`, response)
+
+	control.expire(requestTTL - time.Second)
+	response, err = c.GetApiRequest(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"id":"1"}]`, response)
+	control.expire(time.Second)
+	response, err = c.GetApiRequest(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "", response)
+	stats, err := c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stats.Requests)
+
+	// setting a response again starts its time to live over
+	assert.Nil(t, c.SetApiRequest(key, "[]"))
+	control.expire(requestTTL / 2)
+	assert.Nil(t, c.SetApiRequest(key, "[]"))
+	control.expire(requestTTL / 2)
+	response, err = c.GetApiRequest(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "[]", response)
+}
+
+func testCacheStatsAndFlush(t *testing.T, c Cacher, _ cacherControl) {
+	stats, err := c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{}, stats)
+
+	assert.Nil(t, c.SetProducts(map[string]string{"1": "{}", "2": "{}"}))
+	assert.Nil(t, c.SetCategory("1", "{}"))
+	assert.Nil(t, c.SetApiRequest("json:/v1/products", "[]"))
+	assert.Nil(t, c.SetApiRequest("xml:/v1/categories?page=2", "<categories/>"))
+	stats, err = c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{Products: 2, Categories: 1, Requests: 2}, stats)
+
+	assert.Nil(t, c.Flush())
+	stats, err = c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{}, stats)
+	p, err := c.GetProduct("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", p)
+	response, err := c.GetApiRequest("json:/v1/products")
+	assert.Nil(t, err)
+	assert.Equal(t, "", response)
+	assert.Nil(t, c.Flush())
+}
+
+func testCacheDisconnected(t *testing.T, c Cacher, control cacherControl) {
+	assert.Nil(t, c.SetProduct("1", "{}"))
+	control.disconnect()
+
+	assert.NotNil(t, c.SetProduct("1", "{}"))
+	assert.NotNil(t, c.SetProducts(map[string]string{"2": "{}"}))
+	assert.NotNil(t, c.DeleteProduct("1"))
+	assert.NotNil(t, c.DeleteProducts([]string{"1"}))
+	assert.NotNil(t, c.SetCategory("1", "{}"))
+	assert.NotNil(t, c.DeleteCategory("1"))
+	assert.NotNil(t, c.SetApiRequest("json:/v1/products", "[]"))
+	assert.NotNil(t, c.Flush())
+	for _, get := range []func(string) (string, error){c.GetProduct, c.GetCategory, c.GetApiRequest} {
+		value, err := get("1")
+		assert.NotNil(t, err)
+		assert.Equal(t, "", value)
+	}
+	for _, getAll := range []func() (map[string]string, error){c.GetAllProducts, c.GetAllCategories} {
+		all, err := getAll()
+		assert.NotNil(t, err)
+		assert.NotNil(t, all)
+		assert.Empty(t, all)
+	}
+	_, err := c.Stats()
+	assert.NotNil(t, err)
+}
+
+// testCacheConcurrency is meant for the race detector: go test -race.
+func testCacheConcurrency(t *testing.T, c Cacher, _ cacherControl) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := strconv.Itoa(i)
+			for j := 0; j < 20; j++ {
+				assert.Nil(t, c.SetProduct(id, strconv.Itoa(j)))
+				assert.Nil(t, c.SetProducts(map[string]string{"shared": id}))
+				assert.Nil(t, c.SetCategory(id, "{}"))
+				assert.Nil(t, c.SetApiRequest("json:/v1/products?page="+id, "[]"))
+				_, err := c.GetProduct("shared")
+				assert.Nil(t, err)
+				_, err = c.GetAllProducts()
+				assert.Nil(t, err)
+				_, err = c.GetApiRequest("json:/v1/products?page=" + id)
+				assert.Nil(t, err)
+				_, err = c.Stats()
+				assert.Nil(t, err)
+				assert.Nil(t, c.DeleteCategory(id))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats, err := c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{Products: 9, Categories: 0, Requests: 8}, stats)
+	for i := 0; i < 8; i++ {
+		p, err := c.GetProduct(strconv.Itoa(i))
+		assert.Nil(t, err)
+		assert.Equal(t, "19", p)
+	}
+}
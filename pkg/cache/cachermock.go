@@ -1,9 +1,24 @@
 package cache
 
+import (
+	"sync"
+	"time"
+)
+
+// CacherMock caches in memory, like RedisCacher does in redis, and is safe for concurrent use. Its maps are only
+// meant to be used directly while no other goroutine uses it, e.g. to set up tests.
 type CacherMock struct {
 	Products   map[string]string
 	Categories map[string]string
 	Responses  map[string]string
+	// Err, if set, is returned by every method, as if redis could not be reached
+	Err error
+
+	mu sync.RWMutex
+	// expiries holds when the responses set by SetApiRequest expire, responses put in Responses directly never do
+	expiries map[string]time.Time
+	// now is the clock of expiries, time.Now if nil
+	now func() time.Time
 }
 
 func NewCacherMock() *CacherMock {
@@ -15,55 +30,179 @@ func NewCacherMock() *CacherMock {
 }
 
 func (c *CacherMock) SetProduct(id string, prodStr string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
 	c.Products[id] = prodStr
 	return nil
 }
 
 func (c *CacherMock) GetProduct(id string) (string, error) {
-	if p, ok := c.Products[id]; ok {
-		return p, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Err != nil {
+		return "", c.Err
 	}
-	return "", nil
+	return c.Products[id], nil
 }
 
 func (c *CacherMock) DeleteProduct(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
 	delete(c.Products, id)
 	return nil
 }
 
+func (c *CacherMock) SetProducts(products map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	for id, prodStr := range products {
+		c.Products[id] = prodStr
+	}
+	return nil
+}
+
+func (c *CacherMock) DeleteProducts(ids []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	for _, id := range ids {
+		delete(c.Products, id)
+	}
+	return nil
+}
+
 func (c *CacherMock) SetCategory(id string, catStr string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
 	c.Categories[id] = catStr
 	return nil
 }
 
 func (c *CacherMock) GetCategory(id string) (string, error) {
-	if c, ok := c.Categories[id]; ok {
-		return c, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Err != nil {
+		return "", c.Err
 	}
-	return "", nil
+	return c.Categories[id], nil
 }
 
 func (c *CacherMock) DeleteCategory(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
 	delete(c.Categories, id)
 	return nil
 }
 
+// GetAllProducts returns a copy of the products, which stays the same while the cache changes.
 func (c *CacherMock) GetAllProducts() (map[string]string, error) {
-	return c.Products, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Err != nil {
+		return map[string]string{}, c.Err
+	}
+	return copyMap(c.Products), nil
 }
 
 func (c *CacherMock) GetAllCategories() (map[string]string, error) {
-	return c.Categories, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Err != nil {
+		return map[string]string{}, c.Err
+	}
+	return copyMap(c.Categories), nil
 }
 
 func (c *CacherMock) SetApiRequest(path string, serializedResponse string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	if c.expiries == nil {
+		c.expiries = make(map[string]time.Time)
+	}
 	c.Responses[path] = serializedResponse
+	c.expiries[path] = c.clock().Add(requestTTL)
 	return nil
 }
 
 func (c *CacherMock) GetApiRequest(path string) (string, error) {
-	if response, ok := c.Responses[path]; ok {
-		return response, nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return "", c.Err
+	}
+	c.expire()
+	return c.Responses[path], nil
+}
+
+func (c *CacherMock) Stats() (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return Stats{}, c.Err
+	}
+	c.expire()
+	return Stats{
+		Products:   int64(len(c.Products)),
+		Categories: int64(len(c.Categories)),
+		Requests:   int64(len(c.Responses)),
+	}, nil
+}
+
+func (c *CacherMock) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Products = make(map[string]string)
+	c.Categories = make(map[string]string)
+	c.Responses = make(map[string]string)
+	c.expiries = nil
+	return nil
+}
+
+// expire removes the responses that expired, like redis does.
+func (c *CacherMock) expire() {
+	now := c.clock()
+	for path, expiry := range c.expiries {
+		if !now.Before(expiry) {
+			delete(c.Responses, path)
+			delete(c.expiries, path)
+		}
+	}
+}
+
+func (c *CacherMock) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func copyMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
 	}
-	return "", nil
+	return copied
 }
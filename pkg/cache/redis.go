@@ -3,7 +3,6 @@ package cache
 import (
 	"errors"
 	"fmt"
-	"time"
 
 	"github.com/go-redis/redis"
 )
@@ -46,6 +45,9 @@ func (c *RedisCacher) GetProduct(id string) (string, error) {
 		return "", errors.New("redis client is currently not connected")
 	}
 	hget := c.Client.HGet("product", id)
+	if hget.Err() == redis.Nil {
+		return "", nil
+	}
 	if hget.Err() != nil {
 		return "", errors.New(fmt.Sprintf("error getting product with id %s from redis: %s", id, hget.Err()))
 	}
@@ -63,6 +65,36 @@ func (c *RedisCacher) DeleteProduct(id string) error {
 	return nil
 }
 
+// SetProducts writes all products in a single round trip, using a pipeline.
+func (c *RedisCacher) SetProducts(products map[string]string) error {
+	if !c.connected {
+		return errors.New("redis client is currently not connected")
+	}
+	_, err := c.Client.Pipelined(func(pipe redis.Pipeliner) error {
+		for id, prodStr := range products {
+			pipe.HSet("product", id, prodStr)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.New(fmt.Sprintf("error in redis pipelined hset: %s", err))
+	}
+	return nil
+}
+
+func (c *RedisCacher) DeleteProducts(ids []string) error {
+	if !c.connected {
+		return errors.New("redis client is currently not connected")
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := c.Client.HDel("product", ids...).Err(); err != nil {
+		return errors.New(fmt.Sprintf("error deleting products from redis: %s", err))
+	}
+	return nil
+}
+
 func (c *RedisCacher) GetAllProducts() (map[string]string, error) {
 	if !c.connected {
 		return map[string]string{}, errors.New("redis client is currently not connected")
@@ -89,6 +121,9 @@ func (c *RedisCacher) GetCategory(id string) (string, error) {
 		return "", errors.New("redis client is currently not connected")
 	}
 	hget := c.Client.HGet("category", id)
+	if hget.Err() == redis.Nil {
+		return "", nil
+	}
 	if hget.Err() != nil {
 		return "", errors.New(fmt.Sprintf("error getting category with id %s from redis: %s", id, hget.Err()))
 	}
@@ -122,7 +157,7 @@ func (c *RedisCacher) SetApiRequest(path string, serializedResponse string) erro
 		return errors.New("redis client is currently not connected")
 	}
 	fmt.Println("Redis: setting for request", path)
-	if err := c.Client.Set(path, serializedResponse, 15*time.Minute).Err(); err != nil {
+	if err := c.Client.Set(path, serializedResponse, requestTTL).Err(); err != nil {
 		return errors.New(fmt.Sprintf("error in redis hset: %s", err.Error()))
 	}
 	return nil
@@ -134,8 +169,74 @@ func (c *RedisCacher) GetApiRequest(path string) (string, error) {
 	}
 	fmt.Println("Redis: getting for request", path)
 	hget := c.Client.Get(path)
+	if hget.Err() == redis.Nil {
+		return "", nil
+	}
 	if hget.Err() != nil {
 		return "", errors.New(fmt.Sprintf("error getting request with path %s from redis: %s", path, hget.Err()))
 	}
 	return hget.Val(), nil
 }
+
+// requestKeys matches the keys of cached responses, which are the format and the path of the request, e.g.
+// "json:/v1/products?page=2"
+const requestKeys = "*:/v1/*"
+
+func (c *RedisCacher) Stats() (Stats, error) {
+	if !c.connected {
+		return Stats{}, errors.New("redis client is currently not connected")
+	}
+	var stats Stats
+	var err error
+	if stats.Products, err = c.Client.HLen("product").Result(); err != nil {
+		return Stats{}, errors.New(fmt.Sprintf("error counting products in redis: %s", err))
+	}
+	if stats.Categories, err = c.Client.HLen("category").Result(); err != nil {
+		return Stats{}, errors.New(fmt.Sprintf("error counting categories in redis: %s", err))
+	}
+	err = c.scanRequests(func(keys []string) error {
+		stats.Requests += int64(len(keys))
+		return nil
+	})
+	if err != nil {
+		return Stats{}, errors.New(fmt.Sprintf("error counting requests in redis: %s", err))
+	}
+	return stats, nil
+}
+
+func (c *RedisCacher) Flush() error {
+	if !c.connected {
+		return errors.New("redis client is currently not connected")
+	}
+	if err := c.Client.Del("product", "category").Err(); err != nil {
+		return errors.New(fmt.Sprintf("error deleting products and categories from redis: %s", err))
+	}
+	err := c.scanRequests(func(keys []string) error {
+		return c.Client.Del(keys...).Err()
+	})
+	if err != nil {
+		return errors.New(fmt.Sprintf("error deleting requests from redis: %s", err))
+	}
+	return nil
+}
+
+// scanRequests calls fn with the keys of the cached responses, some at a time. Unlike KEYS, SCAN does not block
+// redis while going through a large database.
+func (c *RedisCacher) scanRequests(fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := c.Client.Scan(cursor, requestKeys, 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
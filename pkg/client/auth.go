@@ -0,0 +1,47 @@
+package client
+
+import "net/http"
+
+// Authenticator adds credentials to the requests of a client. The API itself checks basic credentials and API keys;
+// bearer tokens are meant for gateways in front of it.
+type Authenticator interface {
+	Authenticate(r *http.Request)
+}
+
+// BasicAuth authenticates with the username and password of an API user.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(r *http.Request) {
+	r.SetBasicAuth(a.Username, a.Password)
+}
+
+// BearerToken authenticates with an "Authorization: Bearer" header.
+type BearerToken string
+
+func (t BearerToken) Authenticate(r *http.Request) {
+	r.Header.Set("Authorization", "Bearer "+string(t))
+}
+
+// ApiKey authenticates with a key in a header, "X-Api-Key" if Header is empty.
+type ApiKey struct {
+	Header string
+	Key    string
+}
+
+func (k ApiKey) Authenticate(r *http.Request) {
+	header := k.Header
+	if header == "" {
+		header = "X-Api-Key"
+	}
+	r.Header.Set(header, k.Key)
+}
+
+// AuthFunc turns a function into an Authenticator.
+type AuthFunc func(r *http.Request)
+
+func (f AuthFunc) Authenticate(r *http.Request) {
+	f(r)
+}
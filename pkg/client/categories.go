@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func categoryPath(id int) string {
+	return "/v1/categories/" + strconv.Itoa(id)
+}
+
+// ListCategories returns an iterator over the categories of a list. Nothing is fetched until its first Next.
+func (c *Client) ListCategories(ctx context.Context, opts ListOptions) *CategoryIterator {
+	req, _ := c.newRequest(http.MethodGet, "/v1/categories", nil)
+	req.query = opts.query()
+	return &CategoryIterator{ctx: ctx, pager: pager{client: c, next: req}}
+}
+
+func (c *Client) GetCategory(ctx context.Context, id int) (model.Category, error) {
+	req, _ := c.newRequest(http.MethodGet, categoryPath(id), nil)
+	var category model.Category
+	_, err := c.do(ctx, req, &category)
+	return category, err
+}
+
+// CreateCategory creates a category and returns its id.
+func (c *Client) CreateCategory(ctx context.Context, category model.Category) (int, error) {
+	req, err := c.newRequest(http.MethodPost, "/v1/categories", category)
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.do(ctx, req, nil)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(createdId(res))
+}
+
+// UpdateCategory applies a JSON merge patch to a category and returns the updated category. If version is not 0,
+// it fails with ErrVersionConflict if the category has changed since.
+func (c *Client) UpdateCategory(ctx context.Context, id int, patch interface{}, version int) (model.Category,
+	error) {
+	req, err := c.newRequest(http.MethodPatch, categoryPath(id), patch)
+	if err != nil {
+		return model.Category{}, err
+	}
+	req.contentType = "application/merge-patch+json"
+	versionHeader(req, version)
+	var updated model.Category
+	_, err = c.do(ctx, req, &updated)
+	return updated, err
+}
+
+// ReorderCategories moves the categories of ids to the first positions, in their order, and the rest after them,
+// in one transaction. It returns all the categories by position.
+func (c *Client) ReorderCategories(ctx context.Context, ids []int) ([]model.Category, error) {
+	req, err := c.newRequest(http.MethodPost, "/v1/categories:reorder", struct {
+		Ids []int `json:"ids"`
+	}{ids})
+	if err != nil {
+		return nil, err
+	}
+	var categories []model.Category
+	_, err = c.do(ctx, req, &categories)
+	return categories, err
+}
+
+// DeleteCategory moves a category to the trash. It fails with ErrCategoryInUse if products still use it.
+func (c *Client) DeleteCategory(ctx context.Context, id int, version int) error {
+	req, _ := c.newRequest(http.MethodDelete, categoryPath(id), nil)
+	versionHeader(req, version)
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+// RestoreCategory brings a deleted category back from the trash.
+func (c *Client) RestoreCategory(ctx context.Context, id int) error {
+	req, _ := c.newRequest(http.MethodPost, categoryPath(id)+"/restore", nil)
+	_, err := c.do(ctx, req, nil)
+	return err
+}
@@ -0,0 +1,204 @@
+// Package client is a Go client of the API. Its methods take and return the types of package model, and fail with
+// *Error when the API responds with a problem.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry is how calls that are safe to repeat (GET and DELETE) are retried, when the API cannot be reached or
+// responds with 429, 502, 503 or 504. The wait doubles on every attempt, from MinWait up to MaxWait, unless the
+// API asks for a longer one with a Retry-After header.
+type Retry struct {
+	// Max is the number of retries after the first attempt, 0 to never retry
+	Max     int
+	MinWait time.Duration
+	MaxWait time.Duration
+}
+
+var DefaultRetry = Retry{Max: 3, MinWait: 100 * time.Millisecond, MaxWait: 5 * time.Second}
+
+type Client struct {
+	// BaseURL is the address of the API, e.g. "http://localhost:8080"
+	BaseURL    string
+	HTTPClient *http.Client
+	// Auth authenticates every request, e.g. BasicAuth. Writes fail with ErrUnauthorized without it.
+	Auth  Authenticator
+	Retry Retry
+}
+
+func New(baseURL string, auth Authenticator) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Auth:       auth,
+		Retry:      DefaultRetry,
+	}
+}
+
+// request is a call to the API. The body is kept encoded, so that it can be sent again when retried.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	body        []byte
+	contentType string
+}
+
+func (c *Client) newRequest(method string, path string, body interface{}) (*request, error) {
+	req := &request{method: method, path: path, header: make(http.Header)}
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.body = encoded
+		req.contentType = "application/json"
+	}
+	return req, nil
+}
+
+// do sends a request, retrying it if it is safe to, and decodes a successful json response into out, if given. If
+// out is an io.Writer, the response is copied to it instead. Responses with an error status are returned as *Error.
+func (c *Client) do(ctx context.Context, req *request, out interface{}) (*http.Response, error) {
+	target := req.path
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = c.BaseURL + target
+	}
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+	retries := 0
+	if req.method == http.MethodGet || req.method == http.MethodDelete {
+		retries = c.Retry.Max
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, req, target)
+		if attempt < retries && retryable(res, err) {
+			if werr := c.wait(ctx, attempt, res); werr != nil {
+				return nil, werr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode >= 400 {
+			return res, errorFromResponse(res)
+		}
+		if w, ok := out.(io.Writer); ok {
+			_, err := io.Copy(w, res.Body)
+			return res, err
+		}
+		if out != nil && res.StatusCode != http.StatusNoContent {
+			if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+				return res, fmt.Errorf("could not decode response of %s %s: %w", req.method, req.path, err)
+			}
+		}
+		return res, nil
+	}
+}
+
+func (c *Client) send(ctx context.Context, req *request, target string) (*http.Response, error) {
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.header {
+		httpReq.Header[k] = v
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.Auth != nil {
+		c.Auth.Authenticate(httpReq)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(httpReq)
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// wait sleeps before the next attempt of a request, or until ctx is done. The response of the failed attempt, if
+// any, is discarded.
+func (c *Client) wait(ctx context.Context, attempt int, res *http.Response) error {
+	wait := c.Retry.MinWait << uint(attempt)
+	if wait > c.Retry.MaxWait || wait <= 0 {
+		wait = c.Retry.MaxWait
+	}
+	// jitter, so that clients that failed together do not retry together
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			if after := time.Duration(seconds) * time.Second; after > wait {
+				wait = after
+			}
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Health checks that the API is up.
+func (c *Client) Health(ctx context.Context) error {
+	req, _ := c.newRequest(http.MethodGet, "/", nil)
+	_, err := c.do(ctx, req, nil)
+	var e *Error
+	if asError(err, &e) && e.Status == http.StatusTeapot {
+		// the health check answers with 418
+		return nil
+	}
+	return err
+}
+
+// versionHeader sets the If-Match header of a write, so that it fails with ErrVersionConflict if the entity has
+// changed since version. Version 0 writes unconditionally.
+func versionHeader(req *request, version int) {
+	if version != 0 {
+		req.header.Set("If-Match", `"`+strconv.Itoa(version)+`"`)
+	}
+}
+
+// createdId returns the id of an entity created by a request, the last part of its Location.
+func createdId(res *http.Response) string {
+	location := res.Header.Get("Location")
+	return location[strings.LastIndex(location, "/")+1:]
+}
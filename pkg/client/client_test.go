@@ -0,0 +1,312 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/api"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+// newTestApi serves the API with the mocks, and returns a client authenticated as its admin. The server has to
+// be closed.
+func newTestApi(t *testing.T) (*Client, *services.DbServiceMock, *httptest.Server) {
+	db := services.NewMockDb()
+	assert.Nil(t, db.AddUser(model.User{Username: "admin", Password: "secret"}))
+	server := httptest.NewServer(api.NewApi(db, cache.NewCacherMock()).Handler())
+	return New(server.URL, BasicAuth{Username: "admin", Password: "secret"}), db, server
+}
+
+func newProduct() model.Product {
+	return model.Product{
+		CategoryId: 1,
+		Title:      "Lamp",
+		ImageUrl:   "http://example.com/lamp.png",
+		Price:      12.5,
+	}
+}
+
+func TestHealth(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	assert.Nil(t, c.Health(context.Background()))
+}
+
+func TestListProductsFollowsLinks(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	products, err := c.ListProducts(context.Background(), ListOptions{PerPage: 30}).All()
+	assert.Nil(t, err)
+	assert.Len(t, products, len(db.Products))
+	seen := make(map[string]bool)
+	for _, p := range products {
+		seen[p.Id] = true
+	}
+	assert.Len(t, seen, len(db.Products))
+}
+
+func TestListOptions(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	it := c.ListProducts(context.Background(), ListOptions{
+		PerPage: 50,
+		OrderBy: []model.Order{{Field: "price", Asc: true}},
+		Fields:  []string{"id", "price"},
+		Include: []string{"category"},
+	})
+	var previous float32
+	for i := 0; it.Next(); i++ {
+		p := it.Product()
+		assert.Empty(t, p.Title)
+		assert.Equal(t, p.CategoryId, 0)
+		if i > 0 {
+			assert.True(t, p.Price >= previous)
+		}
+		previous = p.Price
+	}
+	assert.Nil(t, it.Err())
+}
+
+func TestListCategories(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	categories, err := c.ListCategories(context.Background(), ListOptions{PerPage: 3}).All()
+	assert.Nil(t, err)
+	assert.Len(t, categories, len(db.Categories))
+}
+
+func TestListError(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	it := c.ListProducts(context.Background(), ListOptions{OrderBy: []model.Order{{Field: "password"}}})
+	assert.False(t, it.Next())
+	assert.True(t, errors.Is(it.Err(), ErrInvalidParameter))
+}
+
+func TestGetProduct(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	p, err := c.GetProduct(context.Background(), db.Products[0].Id, true)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Products[0].Id, p.Id)
+	assert.Equal(t, p.CategoryId, p.Category.Id)
+	assert.NotEmpty(t, p.Category.Title)
+
+	p, err = c.GetProduct(context.Background(), db.Products[0].Id, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, p.Category.Id)
+}
+
+func TestGetCategoryNotFound(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	_, err := c.GetCategory(context.Background(), 999)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusNotFound, e.Status)
+	assert.NotEmpty(t, e.RequestId)
+}
+
+func TestCreateProduct(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	id, err := c.CreateProduct(context.Background(), newProduct())
+	assert.Nil(t, err)
+	last := db.Products[len(db.Products)-1]
+	assert.Equal(t, last.Id, id)
+	assert.Equal(t, "Lamp", last.Title)
+}
+
+func TestCreateProductValidation(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	p := newProduct()
+	p.Title = ""
+	_, err := c.CreateProduct(context.Background(), p)
+	assert.True(t, errors.Is(err, ErrValidationFailed))
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Len(t, e.Errors, 1)
+	assert.Equal(t, "title", e.Errors[0].Field)
+}
+
+func TestUnauthorized(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	c.Auth = BasicAuth{Username: "admin", Password: "wrong"}
+	_, err := c.CreateProduct(context.Background(), newProduct())
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+}
+
+func TestUpdateProduct(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	product := db.Products[0]
+	updated, err := c.UpdateProduct(context.Background(), product.Id, map[string]interface{}{"price": 99},
+		product.Version)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(99), updated.Price)
+	assert.Equal(t, product.Title, updated.Title)
+
+	_, err = c.UpdateProduct(context.Background(), product.Id, map[string]interface{}{"price": 1}, product.Version)
+	assert.True(t, errors.Is(err, ErrVersionConflict))
+}
+
+func TestDeleteAndRestoreProduct(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	id := db.Products[0].Id
+	assert.Nil(t, c.DeleteProduct(context.Background(), id, 0))
+	assert.Nil(t, c.RestoreProduct(context.Background(), id))
+}
+
+func TestCategoryLifecycle(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	ctx := context.Background()
+	id, err := c.CreateCategory(ctx, model.Category{Title: "Lamps", ImageUrl: "http://example.com/lamps.png"})
+	assert.Nil(t, err)
+	category, err := c.GetCategory(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Lamps", category.Title)
+	updated, err := c.UpdateCategory(ctx, id, map[string]interface{}{"title": "Lights"}, category.Version)
+	assert.Nil(t, err)
+	assert.Equal(t, "Lights", updated.Title)
+	categories, err := c.ReorderCategories(ctx, []int{id})
+	assert.Nil(t, err)
+	if assert.NotEmpty(t, categories) {
+		assert.Equal(t, id, categories[0].Id)
+		assert.Equal(t, 1, categories[0].Position)
+	}
+	_, err = c.ReorderCategories(ctx, []int{id, id})
+	assert.NotNil(t, err)
+	assert.Nil(t, c.DeleteCategory(ctx, id, 0))
+	assert.Nil(t, c.RestoreCategory(ctx, id))
+}
+
+func TestBatchProducts(t *testing.T) {
+	c, _, server := newTestApi(t)
+	defer server.Close()
+	invalid := newProduct()
+	invalid.ImageUrl = "not a url"
+	res, err := c.BatchProducts(context.Background(), BatchPartial, []model.ProductOp{
+		{Op: "create", Product: newProduct()},
+		{Op: "create", Product: invalid},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Succeeded)
+	assert.Equal(t, 1, res.Failed)
+	assert.NotNil(t, res.Results[1].Error)
+	assert.True(t, errors.Is(res.Results[1].Error, ErrValidationFailed))
+}
+
+// flakyServer fails the first failures requests with 503, and counts all of them. It has to be closed.
+func flakyServer(failures int32) (*Client, *httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "title": "Lamps"}`))
+	}))
+	c := New(server.URL, nil)
+	c.Retry = Retry{Max: 3, MinWait: time.Millisecond, MaxWait: 10 * time.Millisecond}
+	return c, server, &calls
+}
+
+func TestExportProducts(t *testing.T) {
+	c, db, server := newTestApi(t)
+	defer server.Close()
+	var out bytes.Buffer
+	err := c.ExportProducts(context.Background(), ExportOptions{Format: "ndjson", Page: 2, PerPage: 5,
+		CategoryIds: []int{db.Products[0].CategoryId}, UpdatedSince: time.Now().Add(-time.Hour)}, &out)
+	assert.Nil(t, err)
+	count := 0
+	for _, p := range db.Products {
+		if p.CategoryId == db.Products[0].CategoryId {
+			count++
+		}
+	}
+	expected := count - 5
+	if expected > 5 {
+		expected = 5
+	}
+	if expected < 0 {
+		expected = 0
+	}
+	assert.Equal(t, expected, strings.Count(out.String(), "\n"))
+
+	out.Reset()
+	err = c.ExportProducts(context.Background(), ExportOptions{UpdatedSince: time.Now().Add(time.Hour)}, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "id,sku,title", strings.SplitN(out.String(), ",description", 2)[0])
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+}
+
+func TestRetriesIdempotentCalls(t *testing.T) {
+	c, server, calls := flakyServer(2)
+	defer server.Close()
+	category, err := c.GetCategory(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Lamps", category.Title)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	c, server, calls := flakyServer(10)
+	defer server.Close()
+	_, err := c.GetCategory(context.Background(), 1)
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusServiceUnavailable, e.Status)
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+}
+
+func TestDoesNotRetryCreate(t *testing.T) {
+	c, server, calls := flakyServer(2)
+	defer server.Close()
+	_, err := c.CreateCategory(context.Background(), model.Category{Title: "Lamps"})
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestAuthenticators(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		auth   Authenticator
+		header string
+		value  string
+	}{
+		{BasicAuth{Username: "admin", Password: "secret"}, "Authorization", "Basic YWRtaW46c2VjcmV0"},
+		{BearerToken("token"), "Authorization", "Bearer token"},
+		{ApiKey{Key: "key"}, "X-Api-Key", "key"},
+		{ApiKey{Header: "X-Key", Key: "key"}, "X-Key", "key"},
+		{AuthFunc(func(r *http.Request) { r.Header.Set("X-Custom", "custom") }), "X-Custom", "custom"},
+	}
+	for _, tt := range tests {
+		_, err := New(server.URL, tt.auth).GetCategory(context.Background(), 1)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.value, header.Get(tt.header))
+	}
+}
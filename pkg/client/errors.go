@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+// Error is a problem the API responded with. It can be compared with errors.Is to the errors below, which match
+// by code.
+type Error struct {
+	Status    int             `json:"status"`
+	Title     string          `json:"title"`
+	Detail    string          `json:"detail"`
+	Code      string          `json:"code"`
+	RequestId string          `json:"request_id"`
+	Errors    validate.Errors `json:"errors"`
+	// RetryAfter is how long the API asked to wait, for 429 and 503 responses
+	RetryAfter time.Duration `json:"-"`
+}
+
+var (
+	ErrNotFound         = &Error{Code: "not_found"}
+	ErrUnauthorized     = &Error{Code: "unauthorized"}
+	ErrBadRequest       = &Error{Code: "bad_request"}
+	ErrInvalidParameter = &Error{Code: "invalid_parameter"}
+	ErrValidationFailed = &Error{Code: "validation_failed"}
+	ErrInvalidReference = &Error{Code: "invalid_reference"}
+	ErrDuplicate        = &Error{Code: "duplicate"}
+	ErrVersionConflict  = &Error{Code: "version_conflict"}
+	ErrCategoryInUse    = &Error{Code: "category_in_use"}
+	ErrTooManyRequests  = &Error{Code: "too_many_requests"}
+	ErrInternal         = &Error{Code: "internal"}
+)
+
+func (e *Error) Error() string {
+	message := e.Detail
+	if message == "" {
+		message = e.Title
+	}
+	for _, fe := range e.Errors {
+		message += "; " + fe.Message
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, message)
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// errorFromResponse reads the problem of a response with an error status. Responses that are not problems, e.g.
+// of a proxy, keep their body as detail.
+func errorFromResponse(res *http.Response) error {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	e := &Error{Status: res.StatusCode, Title: http.StatusText(res.StatusCode)}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" || mediaType == "application/json" {
+		if err := json.Unmarshal(body, e); err != nil {
+			e.Detail = string(body)
+		}
+		e.Status = res.StatusCode
+	} else {
+		e.Detail = string(body)
+	}
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
+
+func asError(err error, target **Error) bool {
+	return err != nil && errors.As(err, target)
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// ListOptions select a list. Zero values are left to the API: pages of 10, ordered by id ascending, all fields.
+type ListOptions struct {
+	// PerPage is the number of entities fetched per request
+	PerPage int
+	// Page is the first page to fetch, 1 if 0
+	Page   int
+	Limit  int
+	Offset int
+	// OrderBy is e.g. []model.Order{{Field: "price", Asc: true}}
+	OrderBy []model.Order
+	// Fields are the only fields to fetch, the rest are left empty
+	Fields []string
+	// Include are the relations to embed, e.g. "category" for products
+	Include []string
+}
+
+func (o ListOptions) query() url.Values {
+	q := make(url.Values)
+	setInt := func(key string, value int) {
+		if value != 0 {
+			q.Set(key, strconv.Itoa(value))
+		}
+	}
+	setInt("perPage", o.PerPage)
+	setInt("page", o.Page)
+	setInt("limit", o.Limit)
+	setInt("offset", o.Offset)
+	if len(o.OrderBy) > 0 {
+		var orders []string
+		for _, order := range o.OrderBy {
+			dir := "desc"
+			if order.Asc {
+				dir = "asc"
+			}
+			orders = append(orders, order.Field+":"+dir)
+		}
+		q.Set("orderBy", strings.Join(orders, ","))
+	}
+	if len(o.Fields) > 0 {
+		q.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if len(o.Include) > 0 {
+		q.Set("include", strings.Join(o.Include, ","))
+	}
+	return q
+}
+
+var linkPattern = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="([^"]*)"`)
+
+// nextLink returns the url of the next page from the Link header of a list response, "" on the last page.
+func nextLink(header http.Header) string {
+	for _, match := range linkPattern.FindAllStringSubmatch(strings.Join(header["Link"], ","), -1) {
+		if match[2] == "next" {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// pager fetches the pages of a list one at a time, following the next links of the API.
+type pager struct {
+	client *Client
+	next   *request
+	err    error
+	done   bool
+}
+
+func (p *pager) fetch(ctx context.Context, page interface{}) bool {
+	if p.done || p.err != nil {
+		return false
+	}
+	res, err := p.client.do(ctx, p.next, page)
+	if err != nil {
+		p.err = err
+		return false
+	}
+	if link := nextLink(res.Header); link != "" {
+		p.next = &request{method: http.MethodGet, path: link, header: make(http.Header)}
+	} else {
+		p.done = true
+	}
+	return true
+}
+
+// ProductIterator goes through a list of products, one page at a time:
+//
+//	it := c.ListProducts(ctx, client.ListOptions{PerPage: 100})
+//	for it.Next() {
+//		p := it.Product()
+//	}
+//	if err := it.Err(); err != nil {
+type ProductIterator struct {
+	ctx     context.Context
+	pager   pager
+	page    []model.Product
+	current model.Product
+}
+
+// Next advances to the next product, fetching the next page if needed. It returns false at the end of the list,
+// or on error.
+func (it *ProductIterator) Next() bool {
+	for len(it.page) == 0 {
+		var page []productWithCategory
+		if !it.pager.fetch(it.ctx, &page) {
+			return false
+		}
+		for _, p := range page {
+			if p.Category != nil {
+				p.Product.Category = *p.Category
+			}
+			it.page = append(it.page, p.Product)
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *ProductIterator) Product() model.Product {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, nil at the end of the list.
+func (it *ProductIterator) Err() error {
+	return it.pager.err
+}
+
+// All returns the rest of the products.
+func (it *ProductIterator) All() ([]model.Product, error) {
+	var products []model.Product
+	for it.Next() {
+		products = append(products, it.Product())
+	}
+	return products, it.Err()
+}
+
+// CategoryIterator goes through a list of categories, like ProductIterator.
+type CategoryIterator struct {
+	ctx     context.Context
+	pager   pager
+	page    []model.Category
+	current model.Category
+}
+
+func (it *CategoryIterator) Next() bool {
+	for len(it.page) == 0 {
+		if !it.pager.fetch(it.ctx, &it.page) {
+			return false
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *CategoryIterator) Category() model.Category {
+	return it.current
+}
+
+func (it *CategoryIterator) Err() error {
+	return it.pager.err
+}
+
+func (it *CategoryIterator) All() ([]model.Category, error) {
+	var categories []model.Category
+	for it.Next() {
+		categories = append(categories, it.Category())
+	}
+	return categories, it.Err()
+}
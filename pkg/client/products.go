@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// productWithCategory is a product as encoded by the API, which has its category only if it was included.
+type productWithCategory struct {
+	model.Product
+	Category *model.Category `json:"category"`
+}
+
+func productPath(id string) string {
+	return "/v1/products/" + url.PathEscape(id)
+}
+
+// ListProducts returns an iterator over the products of a list. Nothing is fetched until its first Next.
+func (c *Client) ListProducts(ctx context.Context, opts ListOptions) *ProductIterator {
+	req, _ := c.newRequest(http.MethodGet, "/v1/products", nil)
+	req.query = opts.query()
+	return &ProductIterator{ctx: ctx, pager: pager{client: c, next: req}}
+}
+
+// GetProduct returns a product, with its category if includeCategory is set.
+func (c *Client) GetProduct(ctx context.Context, id string, includeCategory bool) (model.Product, error) {
+	req, _ := c.newRequest(http.MethodGet, productPath(id), nil)
+	if includeCategory {
+		req.query = url.Values{"include": {"category"}}
+	}
+	var p productWithCategory
+	if _, err := c.do(ctx, req, &p); err != nil {
+		return model.Product{}, err
+	}
+	if p.Category != nil {
+		p.Product.Category = *p.Category
+	}
+	return p.Product, nil
+}
+
+// CreateProduct creates a product and returns its id.
+func (c *Client) CreateProduct(ctx context.Context, product model.Product) (string, error) {
+	req, err := c.newRequest(http.MethodPost, "/v1/products", product)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.do(ctx, req, nil)
+	if err != nil {
+		return "", err
+	}
+	return createdId(res), nil
+}
+
+// UpdateProduct applies a JSON merge patch, e.g. map[string]interface{}{"price": 10}, to a product and returns
+// the updated product. If version is not 0, it fails with ErrVersionConflict if the product has changed since.
+func (c *Client) UpdateProduct(ctx context.Context, id string, patch interface{}, version int) (model.Product,
+	error) {
+	req, err := c.newRequest(http.MethodPatch, productPath(id), patch)
+	if err != nil {
+		return model.Product{}, err
+	}
+	req.contentType = "application/merge-patch+json"
+	versionHeader(req, version)
+	var updated model.Product
+	_, err = c.do(ctx, req, &updated)
+	return updated, err
+}
+
+// DeleteProduct moves a product to the trash. If version is not 0, it fails with ErrVersionConflict if the
+// product has changed since.
+func (c *Client) DeleteProduct(ctx context.Context, id string, version int) error {
+	req, _ := c.newRequest(http.MethodDelete, productPath(id), nil)
+	versionHeader(req, version)
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+// RestoreProduct brings a deleted product back from the trash.
+func (c *Client) RestoreProduct(ctx context.Context, id string) error {
+	req, _ := c.newRequest(http.MethodPost, productPath(id)+"/restore", nil)
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+const (
+	BatchAtomic  = "atomic"
+	BatchPartial = "partial"
+)
+
+type BatchResult struct {
+	Mode      string            `json:"mode"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+type BatchItemResult struct {
+	Index   int            `json:"index"`
+	Op      string         `json:"op"`
+	Id      string         `json:"id"`
+	Status  int            `json:"status"`
+	Product *model.Product `json:"product"`
+	Error   *Error         `json:"error"`
+}
+
+// BatchProducts applies create, update and delete operations in one request. In BatchAtomic mode either all of
+// them are applied or none; in BatchPartial mode the ones that fail are reported in their result.
+func (c *Client) BatchProducts(ctx context.Context, mode string, ops []model.ProductOp) (BatchResult, error) {
+	body := struct {
+		Mode       string            `json:"mode"`
+		Operations []model.ProductOp `json:"operations"`
+	}{strings.ToLower(mode), ops}
+	req, err := c.newRequest(http.MethodPost, "/v1/products:batch", body)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	var res BatchResult
+	_, err = c.do(ctx, req, &res)
+	return res, err
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+// ExportOptions select the products of an export. Zero values export all products, as csv, ordered by id.
+type ExportOptions struct {
+	// Format is csv, ndjson or xml
+	Format  string
+	OrderBy []model.Order
+	// Page and PerPage select a page of the products, like in lists, instead of all of them
+	Page    int
+	PerPage int
+	Offset  int
+	Limit   int
+	// CategoryIds selects the products of these categories
+	CategoryIds []int
+	// UpdatedSince selects the products updated at or after this time
+	UpdatedSince time.Time
+}
+
+// ExportProducts streams the export of the products to w.
+func (c *Client) ExportProducts(ctx context.Context, opts ExportOptions, w io.Writer) error {
+	list := ListOptions{OrderBy: opts.OrderBy, Page: opts.Page, PerPage: opts.PerPage, Offset: opts.Offset,
+		Limit: opts.Limit}
+	req, _ := c.newRequest(http.MethodGet, "/v1/export/products", nil)
+	req.query = list.query()
+	if opts.Format != "" {
+		req.query.Set("format", opts.Format)
+	}
+	if len(opts.CategoryIds) > 0 {
+		ids := make([]string, len(opts.CategoryIds))
+		for i, id := range opts.CategoryIds {
+			ids[i] = strconv.Itoa(id)
+		}
+		req.query.Set("category", strings.Join(ids, ","))
+	}
+	if !opts.UpdatedSince.IsZero() {
+		req.query.Set("updatedSince", opts.UpdatedSince.Format(time.RFC3339))
+	}
+	_, err := c.do(ctx, req, w)
+	return err
+}
+
+// ImportOptions describe the input of an import.
+type ImportOptions struct {
+	// Entity is product or category
+	Entity string
+	// Format is csv or ndjson
+	Format string
+	// Delimiter is the one of csv columns, "," if empty
+	Delimiter string
+	// Columns maps fields to the names of their columns, when they differ
+	Columns map[string]string
+	// DryRun validates everything but stores nothing
+	DryRun bool
+}
+
+type ImportLineError struct {
+	Line    int             `json:"line"`
+	Key     string          `json:"key,omitempty"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Errors  validate.Errors `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	Entity    string            `json:"entity"`
+	DryRun    bool              `json:"dry_run"`
+	Lines     int               `json:"lines"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Failed    int               `json:"failed"`
+	Duration  string            `json:"duration"`
+	Errors    []ImportLineError `json:"errors"`
+}
+
+// Import creates or updates the products or categories of r, matching them by sku or external id. Lines that
+// fail are reported, the rest are imported.
+func (c *Client) Import(ctx context.Context, opts ImportOptions, r io.Reader) (ImportReport, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	req := &request{method: http.MethodPost, path: "/v1/import", query: make(url.Values), header: make(http.Header),
+		body: body, contentType: "text/csv"}
+	if opts.Format == "ndjson" {
+		req.contentType = "application/x-ndjson"
+	}
+	setIfNotEmpty := func(key string, value string) {
+		if value != "" {
+			req.query.Set(key, value)
+		}
+	}
+	setIfNotEmpty("entity", opts.Entity)
+	setIfNotEmpty("format", opts.Format)
+	setIfNotEmpty("delimiter", opts.Delimiter)
+	var columns []string
+	for field, column := range opts.Columns {
+		columns = append(columns, field+"="+column)
+	}
+	setIfNotEmpty("columns", strings.Join(columns, ","))
+	if opts.DryRun {
+		req.query.Set("dry_run", strconv.FormatBool(opts.DryRun))
+	}
+	var report ImportReport
+	_, err = c.do(ctx, req, &report)
+	return report, err
+}
@@ -1,10 +1,11 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"math/rand"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,94 +14,107 @@ import (
 	"github.com/panospet/small-api/pkg/services"
 )
 
-func PopulateRedis(db services.DbService, cacher cache.Cacher, workers int) {
-	prodC := make(chan model.Product)
-	catC := make(chan model.Category)
-	wg := sync.WaitGroup{}
+// populateBatchSize is the number of products read from the database, and cached, at a time.
+const populateBatchSize = 500
 
-	startRedis := time.Now()
-
-	// fill channels with products and categories
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		_ = db.AllProductsToChan(prodC)
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		_ = db.AllCategoriesToChan(catC)
-	}()
+// PopulateResult counts what PopulateRedis cached, and lists the ids of what it could not.
+type PopulateResult struct {
+	Categories       int
+	Products         int
+	FailedCategories []int
+	FailedProducts   []string
+	Duration         time.Duration
+}
 
-	// populate redis with categories
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for cat := range catC {
-			catBytes, _ := json.Marshal(cat)
-			_ = cacher.SetCategory(fmt.Sprintf("%d", cat.Id), string(catBytes))
+// PopulateRedis caches every category and product of the database, the products by workers batches at a time.
+// Entities that cannot be cached are listed in the result, and the others are cached all the same. The error is
+// the one of reading the database, or of ctx.
+func PopulateRedis(ctx context.Context, db services.DbService, cacher cache.Cacher, workers int) (PopulateResult,
+	error) {
+	start := time.Now()
+	var result PopulateResult
+	err := db.StreamCategories(ctx, model.StreamFilter{}, populateBatchSize, func(categories []model.Category) error {
+		for _, c := range categories {
+			encoded, err := json.Marshal(c)
+			if err == nil {
+				err = cacher.SetCategory(strconv.Itoa(c.Id), string(encoded))
+			}
+			if err != nil {
+				result.FailedCategories = append(result.FailedCategories, c.Id)
+				continue
+			}
+			result.Categories++
 		}
-	}()
+		return nil
+	})
+	if err != nil {
+		result.Duration = time.Since(start)
+		return result, err
+	}
 
-	// populate redis with products
+	if workers < 1 {
+		workers = 1
+	}
+	batches := make(chan []model.Product)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for prod := range prodC {
-				prodBytes, _ := json.Marshal(prod)
-				_ = cacher.SetProduct(prod.Id, string(prodBytes))
+			for batch := range batches {
+				cached, failed := cacheProducts(cacher, batch)
+				mu.Lock()
+				result.Products += cached
+				result.FailedProducts = append(result.FailedProducts, failed...)
+				mu.Unlock()
 			}
 		}()
 	}
-
+	err = db.StreamProducts(ctx, model.StreamFilter{}, populateBatchSize, func(products []model.Product) error {
+		select {
+		case batches <- products:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(batches)
 	wg.Wait()
-
-	redisDuration := time.Since(startRedis)
-	fmt.Println("Redis populated. Time:", redisDuration.String())
+	sort.Strings(result.FailedProducts)
+	result.Duration = time.Since(start)
+	return result, err
 }
 
-func PopulateDb(db services.DbService, workers int, amount int) {
-	rand.Seed(time.Now().UnixNano())
-	possibleCategories := []string{"sports", "house", "garden", "electronics", "games", "food", "drinks", "furniture",
-		"space", "mobile", "movies", "tv", "pc", "books", "groceries", "devices", "music", "instruments"}
-	startDb := time.Now()
-	for i := range possibleCategories {
-		err := db.AddCategory(model.Category{
-			Title:    possibleCategories[i],
-			Position: rand.Intn(20) + 1,
-			ImageUrl: fmt.Sprintf("http://www.bestprice.gr/%s.png", possibleCategories[i]),
-		})
+// cacheProducts caches a batch of products at once, and returns how many were cached and the ids of the others.
+func cacheProducts(cacher cache.Cacher, products []model.Product) (int, []string) {
+	var failed []string
+	encoded := make(map[string]string, len(products))
+	for _, p := range products {
+		b, err := json.Marshal(p)
 		if err != nil {
-			panic(fmt.Sprintf("Error while creating category: %s", err.Error()))
+			failed = append(failed, p.Id)
+			continue
 		}
+		encoded[p.Id] = string(b)
 	}
-	products := make(chan model.Product)
-	wg := sync.WaitGroup{}
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for pr := range products {
-				_, err := db.AddProduct(pr)
-				if err != nil {
-					log.Println("error adding product to database:", err)
-				}
-			}
-		}()
+	if len(encoded) == 0 {
+		return 0, failed
 	}
-	for i := 0; i < amount; i++ {
-		products <- model.Product{
-			CategoryId:  rand.Intn(len(possibleCategories)) + 1,
-			Title:       fmt.Sprintf("product %d", i),
-			ImageUrl:    fmt.Sprintf("http://www.bestprice.gr/product%d.png", i),
-			Price:       float32(rand.Intn(200)) + rand.Float32(),
-			Description: fmt.Sprintf("Description for product %d", i),
+	if err := cacher.SetProducts(encoded); err != nil {
+		for id := range encoded {
+			failed = append(failed, id)
 		}
+		return 0, failed
 	}
-	close(products)
-	wg.Wait()
+	return len(encoded), failed
+}
 
-	dbDuration := time.Since(startDb)
-	fmt.Println("Database populated. Time:", dbDuration.String())
+// String summarizes the result, e.g. to be printed by scripts.
+func (r PopulateResult) String() string {
+	s := fmt.Sprintf("cached %d categories and %d products in %s", r.Categories, r.Products, r.Duration)
+	if len(r.FailedCategories) > 0 || len(r.FailedProducts) > 0 {
+		s += fmt.Sprintf(", %d categories and %d products failed", len(r.FailedCategories), len(r.FailedProducts))
+	}
+	return s
 }
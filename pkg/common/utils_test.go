@@ -0,0 +1,82 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+func TestPopulateRedis(t *testing.T) {
+	db := services.NewMockDb()
+	cacher := cache.NewCacherMock()
+	result, err := PopulateRedis(context.Background(), db, cacher, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, len(db.Categories), result.Categories)
+	assert.Equal(t, len(db.Products), result.Products)
+	assert.Empty(t, result.FailedCategories)
+	assert.Empty(t, result.FailedProducts)
+	assert.Contains(t, result.String(), "cached 18 categories and ")
+	assert.NotContains(t, result.String(), "failed")
+
+	stats, err := cacher.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, cache.Stats{Products: int64(len(db.Products)), Categories: int64(len(db.Categories))}, stats)
+	cached, err := cacher.GetCategory(strconv.Itoa(db.Categories[0].Id))
+	assert.Nil(t, err)
+	assert.Contains(t, cached, `"title":"`+db.Categories[0].Title+`"`)
+	cached, err = cacher.GetProduct(db.Products[0].Id)
+	assert.Nil(t, err)
+	assert.Contains(t, cached, `"id":"`+db.Products[0].Id+`"`)
+}
+
+func TestPopulateRedisFailures(t *testing.T) {
+	db := services.NewMockDb()
+	cacher := cache.NewCacherMock()
+	cacher.Err = errors.New("redis is down")
+	result, err := PopulateRedis(context.Background(), db, cacher, 2)
+	// what could not be cached is reported, it is not an error of populating
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Categories)
+	assert.Equal(t, 0, result.Products)
+	assert.Len(t, result.FailedCategories, len(db.Categories))
+	assert.Len(t, result.FailedProducts, len(db.Products))
+	assert.Contains(t, result.String(), "failed")
+}
+
+func TestPopulateRedisCancelled(t *testing.T) {
+	db := services.NewMockDb()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := PopulateRedis(ctx, db, cache.NewCacherMock(), 2)
+	assert.NotNil(t, err)
+
+	// the products stop being read when ctx is done, even while they are being cached
+	db = services.NewMockDb()
+	for i := 0; i < 2*populateBatchSize; i++ {
+		_, err := db.AddProduct(model.Product{CategoryId: 1, Title: "p", ImageUrl: "http://example.com/p.png"}, nil)
+		assert.Nil(t, err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cacher := &cancellingCacher{CacherMock: cache.NewCacherMock(), cancel: cancel}
+	result, err := PopulateRedis(ctx, db, cacher, 1)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, result.Products < len(db.Products), result.Products)
+}
+
+// cancellingCacher cancels the context of the test once products are cached.
+type cancellingCacher struct {
+	*cache.CacherMock
+	cancel func()
+}
+
+func (c *cancellingCacher) SetProducts(products map[string]string) error {
+	c.cancel()
+	return c.CacherMock.SetProducts(products)
+}
@@ -0,0 +1,241 @@
+// Package export writes products one at a time in the formats of the catalog export: CSV, NDJSON, and an XML
+// shopping feed that partners can ingest.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+const (
+	FormatCsv    = "csv"
+	FormatNdjson = "ndjson"
+	FormatXml    = "xml"
+
+	// Currency of all prices in the feed
+	Currency = "EUR"
+)
+
+var ContentTypes = map[string]string{
+	FormatCsv:    "text/csv; charset=utf-8",
+	FormatNdjson: "application/x-ndjson",
+	FormatXml:    "application/xml; charset=utf-8",
+}
+
+// Feed describes the shop of the XML feed. Products have no page in the catalog, so their links are made from
+// ProductLink.
+type Feed struct {
+	// Link is the website of the shop, the link of the channel
+	Link string
+	// ProductLink is the page of a product, where {id} is replaced by its id and {sku} by its sku, or its id if it
+	// has none
+	ProductLink string
+	// Availability of every product: in_stock, out_of_stock, preorder or backorder
+	Availability string
+	// Condition of every product: new, refurbished or used
+	Condition string
+}
+
+// DefaultFeed links to the products of the API on localhost, all of them in stock and new.
+func DefaultFeed() Feed {
+	return Feed{
+		Link:         "http://localhost:8080",
+		ProductLink:  "http://localhost:8080/v1/products/{id}",
+		Availability: "in_stock",
+		Condition:    "new",
+	}
+}
+
+// withDefaults returns the feed with the empty fields of DefaultFeed.
+func (f Feed) withDefaults() Feed {
+	d := DefaultFeed()
+	if f.Link == "" {
+		f.Link = d.Link
+	}
+	if f.ProductLink == "" {
+		f.ProductLink = d.ProductLink
+	}
+	if f.Availability == "" {
+		f.Availability = d.Availability
+	}
+	if f.Condition == "" {
+		f.Condition = d.Condition
+	}
+	return f
+}
+
+// Encoder writes products to its output as they come. Close must be called after the last product, to finish the
+// document.
+type Encoder interface {
+	Encode(p model.Product) error
+	Close() error
+}
+
+// NewEncoder returns an encoder of the given format, which writes to w. XML feeds are the ones of feed, whose empty
+// fields are the ones of DefaultFeed, and the other formats ignore it.
+func NewEncoder(format string, w io.Writer, feed Feed) (Encoder, error) {
+	switch format {
+	case FormatCsv:
+		return &csvEncoder{writer: csv.NewWriter(w)}, nil
+	case FormatNdjson:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}, nil
+	case FormatXml:
+		return &xmlEncoder{w: w, encoder: xml.NewEncoder(w), feed: feed.withDefaults()}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected csv, ndjson or xml", format)
+}
+
+var csvHeader = []string{"id", "sku", "title", "description", "price", "image_url", "category_id", "category",
+	"category_external_id", "created_at", "updated_at"}
+
+type csvEncoder struct {
+	writer  *csv.Writer
+	started bool
+}
+
+func (c *csvEncoder) Encode(p model.Product) error {
+	if !c.started {
+		c.started = true
+		if err := c.writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	return c.writer.Write([]string{
+		p.Id,
+		stringOrEmpty(p.Sku),
+		p.Title,
+		p.Description,
+		strconv.FormatFloat(float64(p.Price), 'f', 2, 32),
+		p.ImageUrl,
+		strconv.Itoa(p.CategoryId),
+		p.Category.Title,
+		stringOrEmpty(p.Category.ExternalId),
+		p.CreatedAt.Format(time.RFC3339),
+		p.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+func (c *csvEncoder) Close() error {
+	if !c.started {
+		c.started = true
+		_ = c.writer.Write(csvHeader)
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+// ndjsonProduct is a product with its category, which is not part of the json of products elsewhere.
+type ndjsonProduct struct {
+	model.Product
+	Category model.Category `json:"category"`
+}
+
+func (n *ndjsonEncoder) Encode(p model.Product) error {
+	return n.encoder.Encode(ndjsonProduct{Product: p, Category: p.Category})
+}
+
+func (n *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// feedItem is a product in the layout of shopping feeds (RSS 2.0 with the g: namespace of Google Merchant Center).
+type feedItem struct {
+	XMLName      xml.Name `xml:"item"`
+	Id           string   `xml:"g:id"`
+	Title        string   `xml:"title"`
+	Description  string   `xml:"description"`
+	Link         string   `xml:"link"`
+	ImageLink    string   `xml:"g:image_link"`
+	Price        string   `xml:"g:price"`
+	Availability string   `xml:"g:availability"`
+	Condition    string   `xml:"g:condition"`
+	ProductType  string   `xml:"g:product_type,omitempty"`
+	Updated      string   `xml:"g:updated"`
+}
+
+const (
+	feedHeader = xml.Header + `<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0">
+<channel>
+`
+	feedFooter = "\n</channel>\n</rss>\n"
+)
+
+type xmlEncoder struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	feed    Feed
+	started bool
+}
+
+func (x *xmlEncoder) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	if _, err := io.WriteString(x.w, feedHeader); err != nil {
+		return err
+	}
+	channel := [][2]string{{"title", "small-api catalog"}, {"link", x.feed.Link},
+		{"description", "All products of the catalog"}}
+	for _, field := range channel {
+		if err := x.encoder.EncodeElement(field[1], xml.StartElement{Name: xml.Name{Local: field[0]}}); err != nil {
+			return err
+		}
+	}
+	return x.encoder.Flush()
+}
+
+// Encode writes a feed item, identified by the sku of the product if it has one.
+func (x *xmlEncoder) Encode(p model.Product) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	id := p.Id
+	if p.Sku != nil {
+		id = *p.Sku
+	}
+	link := strings.NewReplacer("{id}", url.PathEscape(p.Id), "{sku}", url.PathEscape(id)).Replace(x.feed.ProductLink)
+	return x.encoder.Encode(feedItem{
+		Id:           id,
+		Title:        p.Title,
+		Description:  p.Description,
+		Link:         link,
+		ImageLink:    p.ImageUrl,
+		Price:        fmt.Sprintf("%.2f %s", p.Price, Currency),
+		Availability: x.feed.Availability,
+		Condition:    x.feed.Condition,
+		ProductType:  p.Category.Title,
+		Updated:      p.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+func (x *xmlEncoder) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	if err := x.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(x.w, feedFooter)
+	return err
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,98 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func products() []model.Product {
+	sku := "a-1"
+	return []model.Product{
+		{Id: "1", Sku: &sku, Title: "First, with comma", Price: 10.5, ImageUrl: "http://example.com/1.png",
+			CategoryId: 2, Category: model.Category{Id: 2, Title: "shoes"}},
+		{Id: "2", Title: "Second <b>", Description: "line\nbreak", Price: 3, CategoryId: 2,
+			Category: model.Category{Id: 2, Title: "shoes"}},
+	}
+}
+
+func encode(t *testing.T, format string, products []model.Product) string {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(format, &buf, Feed{Link: "https://shop.example.com",
+		ProductLink: "https://shop.example.com/p/{sku}?id={id}"})
+	assert.Nil(t, err)
+	for _, p := range products {
+		assert.Nil(t, enc.Encode(p))
+	}
+	assert.Nil(t, enc.Close())
+	return buf.String()
+}
+
+func TestCsv(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(encode(t, FormatCsv, products()))).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, "First, with comma", records[1][2])
+	assert.Equal(t, "10.50", records[1][4])
+	assert.Equal(t, "shoes", records[1][7])
+	assert.Equal(t, "line\nbreak", records[2][3])
+
+	records, err = csv.NewReader(strings.NewReader(encode(t, FormatCsv, nil))).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{csvHeader}, records)
+}
+
+func TestNdjson(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(encode(t, FormatNdjson, products())), "\n")
+	assert.Len(t, lines, 2)
+	var p struct {
+		Sku      string         `json:"sku"`
+		Category model.Category `json:"category"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &p))
+	assert.Equal(t, "a-1", p.Sku)
+	assert.Equal(t, "shoes", p.Category.Title)
+}
+
+func TestXmlFeed(t *testing.T) {
+	var feed struct {
+		Link  string `xml:"channel>link"`
+		Items []struct {
+			Id           string `xml:"http://base.google.com/ns/1.0 id"`
+			Title        string `xml:"title"`
+			Link         string `xml:"link"`
+			Price        string `xml:"http://base.google.com/ns/1.0 price"`
+			Availability string `xml:"http://base.google.com/ns/1.0 availability"`
+			Condition    string `xml:"http://base.google.com/ns/1.0 condition"`
+			Type         string `xml:"http://base.google.com/ns/1.0 product_type"`
+		} `xml:"channel>item"`
+	}
+	assert.Nil(t, xml.Unmarshal([]byte(encode(t, FormatXml, products())), &feed))
+	assert.Equal(t, "https://shop.example.com", feed.Link)
+	assert.Len(t, feed.Items, 2)
+	assert.Equal(t, "a-1", feed.Items[0].Id)
+	assert.Equal(t, "https://shop.example.com/p/a-1?id=1", feed.Items[0].Link)
+	assert.Equal(t, "10.50 EUR", feed.Items[0].Price)
+	// fields left empty are the ones of the default feed
+	assert.Equal(t, "in_stock", feed.Items[0].Availability)
+	assert.Equal(t, "new", feed.Items[0].Condition)
+	assert.Equal(t, "shoes", feed.Items[0].Type)
+	assert.Equal(t, "2", feed.Items[1].Id)
+	assert.Equal(t, "https://shop.example.com/p/2?id=2", feed.Items[1].Link)
+	assert.Equal(t, "Second <b>", feed.Items[1].Title)
+
+	assert.Nil(t, xml.Unmarshal([]byte(encode(t, FormatXml, nil)), &feed))
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewEncoder("xlsx", &bytes.Buffer{}, DefaultFeed())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"context"
+	"errors"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// ProductStreamer reads products in batches, like services.DbService does.
+type ProductStreamer interface {
+	StreamProducts(ctx context.Context, filter model.StreamFilter, batchSize int, fn func([]model.Product) error) error
+}
+
+// Range selects the products of an export by their place in it: the first Offset are skipped, and at most Limit
+// are exported, all of them if Limit is 0.
+type Range struct {
+	Offset int
+	Limit  int
+}
+
+// Page returns the range of a page of perPage products, within the ones that offset and limit select, like the
+// pages of lists. Page is 1 and perPage 10 if they are 0.
+func Page(page int, perPage int, offset int, limit int) (Range, error) {
+	if page == 0 {
+		page = 1
+	}
+	if perPage == 0 {
+		perPage = 10
+	}
+	if page < 1 || perPage < 1 || offset < 0 || limit < 0 {
+		return Range{}, errors.New("page and perPage must be positive, offset and limit non negative")
+	}
+	start, end := perPage*(page-1), perPage*page
+	if limit > 0 && end > limit {
+		end = limit
+	}
+	if end <= start {
+		return Range{}, errors.New("page does not exist")
+	}
+	return Range{Offset: offset + start, Limit: end - start}, nil
+}
+
+// errRangeEnd stops the stream once the last product of a range is exported.
+var errRangeEnd = errors.New("end of range")
+
+// Products calls fn for the products of db that match filter and are in rng, in the order of filter. They are read
+// a batch at a time, so an export of any size takes constant memory, and no query is open while fn runs. It stops
+// at the first error of fn, which is returned, or when ctx is done.
+func Products(ctx context.Context, db ProductStreamer, filter model.StreamFilter, rng Range,
+	fn func(model.Product) error) error {
+	skipped, exported := 0, 0
+	err := db.StreamProducts(ctx, filter, 0, func(products []model.Product) error {
+		for _, p := range products {
+			if skipped < rng.Offset {
+				skipped++
+				continue
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+			exported++
+			if exported == rng.Limit {
+				return errRangeEnd
+			}
+		}
+		return nil
+	})
+	if err == errRangeEnd {
+		return nil
+	}
+	return err
+}
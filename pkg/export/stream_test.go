@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// batchStreamer streams ten products in batches of three, and counts the batches read.
+type batchStreamer struct {
+	batches int
+}
+
+func (s *batchStreamer) StreamProducts(ctx context.Context, filter model.StreamFilter, batchSize int,
+	fn func([]model.Product) error) error {
+	var products []model.Product
+	for i := 0; i < 10; i++ {
+		products = append(products, model.Product{Id: strconv.Itoa(i)})
+	}
+	for from := 0; from < len(products); from += 3 {
+		to := from + 3
+		if to > len(products) {
+			to = len(products)
+		}
+		s.batches++
+		if err := fn(products[from:to]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestProducts(t *testing.T) {
+	export := func(rng Range) ([]string, int) {
+		db := &batchStreamer{}
+		var ids []string
+		err := Products(context.Background(), db, model.StreamFilter{}, rng, func(p model.Product) error {
+			ids = append(ids, p.Id)
+			return nil
+		})
+		assert.Nil(t, err)
+		return ids, db.batches
+	}
+	ids, batches := export(Range{})
+	assert.Len(t, ids, 10)
+	assert.Equal(t, 4, batches)
+	ids, batches = export(Range{Offset: 2, Limit: 3})
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+	// the batches after the range are not read
+	assert.Equal(t, 2, batches)
+	ids, _ = export(Range{Offset: 8, Limit: 5})
+	assert.Equal(t, []string{"8", "9"}, ids)
+	ids, _ = export(Range{Offset: 20})
+	assert.Empty(t, ids)
+
+	stop := errors.New("stop")
+	err := Products(context.Background(), &batchStreamer{}, model.StreamFilter{}, Range{}, func(model.Product) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+}
+
+func TestPage(t *testing.T) {
+	rng, err := Page(0, 0, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, Range{Offset: 0, Limit: 10}, rng)
+	rng, err = Page(3, 4, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, Range{Offset: 10, Limit: 4}, rng)
+	// the last page of a limit is cut short
+	rng, err = Page(2, 4, 0, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, Range{Offset: 4, Limit: 2}, rng)
+	_, err = Page(3, 4, 0, 8)
+	assert.NotNil(t, err)
+	_, err = Page(-1, 4, 0, 0)
+	assert.NotNil(t, err)
+}
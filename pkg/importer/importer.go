@@ -0,0 +1,290 @@
+// Package importer reads products or categories from CSV or NDJSON files and upserts them by their external ids.
+package importer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/cache"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+const (
+	DefaultBatchSize = 500
+	DefaultWorkers   = 4
+)
+
+type Options struct {
+	Mapping Mapping
+	// BatchSize is the number of rows upserted in a single transaction
+	BatchSize int
+	Workers   int
+	// DryRun validates everything, including against the database, but rolls back all changes
+	DryRun bool
+	Actor  *model.Actor
+	// Cache, if set, gets the entities that were updated removed from it
+	Cache cache.Cacher
+}
+
+// LineError is the reason a line of the input was not imported.
+type LineError struct {
+	Line    int             `json:"line"`
+	Key     string          `json:"key,omitempty"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Errors  validate.Errors `json:"errors,omitempty"`
+}
+
+type Report struct {
+	Entity    string      `json:"entity"`
+	DryRun    bool        `json:"dry_run"`
+	Lines     int         `json:"lines"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Failed    int         `json:"failed"`
+	Duration  string      `json:"duration"`
+	Errors    []LineError `json:"errors"`
+}
+
+// row is a line of the input that is ready to be upserted.
+type row struct {
+	line     int
+	key      string
+	product  model.Product
+	category model.Category
+}
+
+// Import reads all entities from r and upserts them in batches, using a pool of workers. Lines that can not be
+// imported are listed in the report; an error is only returned if the input as a whole can not be read.
+func Import(db services.DbService, r io.Reader, opts Options) (Report, error) {
+	start := time.Now()
+	if err := opts.Mapping.Validate(); err != nil {
+		return Report{}, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	report := Report{Entity: opts.Mapping.Entity, DryRun: opts.DryRun, Errors: []LineError{}}
+	mu := sync.Mutex{}
+
+	// the rows of a key all go to the same worker, in their order in the input, so that an entity is never upserted
+	// by two batches at the same time, and its last row is the one that stays. A batch has a key at most once, as
+	// upserts reject the others.
+	queues := make([]chan []row, opts.Workers)
+	wg := sync.WaitGroup{}
+	for i := range queues {
+		queues[i] = make(chan []row, 1)
+		wg.Add(1)
+		go func(batches <-chan []row) {
+			defer wg.Done()
+			for batch := range batches {
+				results, err := upsert(db, batch, opts)
+				mu.Lock()
+				report.add(batch, results, err)
+				mu.Unlock()
+				if err == nil && !opts.DryRun && opts.Cache != nil {
+					uncache(opts.Cache, opts.Mapping.Entity, results)
+				}
+			}
+		}(queues[i])
+	}
+
+	reader := newRecordReader(r, opts.Mapping)
+	pending := make([][]row, opts.Workers)
+	pendingKeys := make([]map[string]bool, opts.Workers)
+	send := func(w int) {
+		queues[w] <- pending[w]
+		pending[w], pendingKeys[w] = nil, nil
+	}
+	var readErr error
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		mu.Lock()
+		report.Lines++
+		mu.Unlock()
+		parsed, lineErr := parse(rec, opts.Mapping)
+		if lineErr != nil {
+			mu.Lock()
+			report.fail(*lineErr)
+			mu.Unlock()
+			continue
+		}
+		key := strings.ToLower(parsed.key)
+		w := workerOf(key, opts.Workers)
+		if pendingKeys[w][key] {
+			send(w)
+		}
+		if pendingKeys[w] == nil {
+			pendingKeys[w] = make(map[string]bool)
+		}
+		pending[w] = append(pending[w], parsed)
+		pendingKeys[w][key] = true
+		if len(pending[w]) == opts.BatchSize {
+			send(w)
+		}
+	}
+	for w := range queues {
+		if len(pending[w]) > 0 && readErr == nil {
+			send(w)
+		}
+		close(queues[w])
+	}
+	wg.Wait()
+
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+	report.Duration = time.Since(start).String()
+	return report, readErr
+}
+
+// workerOf returns the worker of the rows of key, out of workers. Keys are lower case, as the ones that differ only
+// in case are the same entity for MySQL.
+func workerOf(key string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
+
+func upsert(db services.DbService, batch []row, opts Options) ([]services.UpsertResult, error) {
+	if opts.Mapping.Entity == EntityCategory {
+		categories := make([]model.Category, len(batch))
+		for i, r := range batch {
+			categories[i] = r.category
+		}
+		return db.UpsertCategories(categories, opts.Actor, opts.DryRun)
+	}
+	products := make([]model.Product, len(batch))
+	for i, r := range batch {
+		products[i] = r.product
+	}
+	return db.UpsertProducts(products, opts.Actor, opts.DryRun)
+}
+
+func uncache(cacher cache.Cacher, entity string, results []services.UpsertResult) {
+	var ids []string
+	for _, result := range results {
+		if result.Err == nil && result.Status == services.UpsertUpdated {
+			ids = append(ids, result.Id)
+		}
+	}
+	if entity == EntityProduct {
+		if err := cacher.DeleteProducts(ids); err != nil {
+			log.Println("error while deleting imported products from cache", err)
+		}
+		return
+	}
+	for _, id := range ids {
+		if err := cacher.DeleteCategory(id); err != nil {
+			log.Println("error while deleting imported category from cache", err)
+		}
+	}
+}
+
+// add counts the results of a batch. If the whole batch failed, all its lines fail with the same error.
+func (r *Report) add(batch []row, results []services.UpsertResult, err error) {
+	for i, row := range batch {
+		result := services.UpsertResult{Err: err}
+		if err == nil {
+			result = results[i]
+		}
+		if result.Err != nil {
+			e := apperr.As(result.Err)
+			r.fail(LineError{Line: row.line, Key: row.key, Code: e.Code, Message: e.Message})
+			continue
+		}
+		switch result.Status {
+		case services.UpsertCreated:
+			r.Created++
+		case services.UpsertUpdated:
+			r.Updated++
+		case services.UpsertUnchanged:
+			r.Unchanged++
+		}
+	}
+}
+
+func (r *Report) fail(lineErr LineError) {
+	r.Failed++
+	r.Errors = append(r.Errors, lineErr)
+}
+
+// parse turns a record into a row, validating it like the API does.
+func parse(rec record, m Mapping) (row, *LineError) {
+	if rec.err != nil {
+		return row{}, &LineError{Line: rec.line, Code: apperr.CodeInvalidValue, Message: rec.err.Error()}
+	}
+	value := func(field string) string {
+		return strings.TrimSpace(rec.values[m.column(field)])
+	}
+	var errs validate.Errors
+	number := func(field string, parse func(string) error) {
+		if v := value(field); v != "" {
+			if err := parse(v); err != nil {
+				errs = append(errs, validate.FieldError{Field: field, Code: validate.CodeNotNumber,
+					Message: fmt.Sprintf("%s must be a number", field)})
+			}
+		}
+	}
+	r := row{line: rec.line, key: value(keyFields[m.Entity])}
+	if r.key == "" {
+		errs = append(errs, validate.FieldError{Field: keyFields[m.Entity], Code: validate.CodeRequired,
+			Message: fmt.Sprintf("%s is required", keyFields[m.Entity])})
+	}
+	if m.Entity == EntityCategory {
+		r.category = model.Category{ExternalId: &r.key, Title: value("title"), ImageUrl: value("image_url")}
+		number("position", func(v string) (err error) {
+			r.category.Position, err = strconv.Atoi(v)
+			return err
+		})
+		errs = append(errs, validate.Struct(r.category)...)
+	} else {
+		r.product = model.Product{Sku: &r.key, Title: value("title"), ImageUrl: value("image_url"),
+			Description: value("description")}
+		number("price", func(v string) error {
+			price, err := strconv.ParseFloat(v, 32)
+			r.product.Price = float32(price)
+			return err
+		})
+		number("category_id", func(v string) (err error) {
+			r.product.CategoryId, err = strconv.Atoi(v)
+			return err
+		})
+		if category := value("category"); category != "" && r.product.CategoryId == 0 {
+			r.product.Category.ExternalId = &category
+		}
+		for _, fe := range validate.Struct(r.product) {
+			// the category may also be given by its external id
+			if fe.Field == "category_id" && fe.Code == validate.CodeRequired && r.product.Category.ExternalId != nil {
+				continue
+			}
+			errs = append(errs, fe)
+		}
+	}
+	if len(errs) > 0 {
+		return row{}, &LineError{Line: rec.line, Key: r.key, Code: apperr.CodeValidationFailed,
+			Message: "Validation failed", Errors: errs}
+	}
+	return r, nil
+}
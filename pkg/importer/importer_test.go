@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/services"
+	"github.com/panospet/small-api/pkg/validate"
+)
+
+var opts = Options{BatchSize: 2}
+
+func TestImportProductsCsv(t *testing.T) {
+	db := services.NewMockDb()
+	input := `SKU;Name;Image;Price;Category
+a-1;First;http://example.com/1.png;10.5;2
+a-2;Second;http://example.com/2.png;abc;2
+;Third;http://example.com/3.png;1;2
+a-4;Fourth;not-a-url;1;2
+a-5;Fifth;http://example.com/5.png;1;2
+`
+	o := opts
+	o.Mapping = Mapping{Format: FormatCsv, Delimiter: ";",
+		Columns: map[string]string{"sku": "SKU", "title": "Name", "image_url": "Image", "price": "Price",
+			"category_id": "Category"}}
+	products := len(db.Products)
+	report, err := Import(db, strings.NewReader(input), o)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, report.Lines)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 3, report.Failed)
+	assert.Equal(t, products+2, len(db.Products))
+	assert.Equal(t, 3, report.Errors[0].Line)
+	assert.Equal(t, validate.CodeNotNumber, report.Errors[0].Errors[0].Code)
+	assert.Equal(t, 4, report.Errors[1].Line)
+	assert.Equal(t, validate.CodeRequired, report.Errors[1].Errors[0].Code)
+	assert.Equal(t, 5, report.Errors[2].Line)
+	assert.Equal(t, "a-4", report.Errors[2].Key)
+	assert.Equal(t, validate.CodeInvalidUrl, report.Errors[2].Errors[0].Code)
+	for _, p := range db.Products[products:] {
+		if *p.Sku == "a-1" {
+			assert.Equal(t, 10.5, float64(p.Price))
+		}
+	}
+}
+
+func TestImportProductsUpdatesBySku(t *testing.T) {
+	db := services.NewMockDb()
+	input := `{"sku": "a-1", "title": "First", "image_url": "http://example.com/1.png", "price": 1, "category_id": 2}
+
+{"sku": "a-1", "title": "Again", "image_url": "http://example.com/1.png", "price": 2, "category_id": 2}
+{"sku": "a-2", "title": "Second", "image_url": "http://example.com/2.png", "category_id": 1000}
+{"sku": "a-3"
+`
+	o := opts
+	o.BatchSize = 1
+	o.Mapping = Mapping{Format: FormatNdjson}
+	report, err := Import(db, strings.NewReader(input), o)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, report.Lines)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Updated)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 4, report.Errors[0].Line)
+	assert.Equal(t, apperr.CodeInvalidReference, report.Errors[0].Code)
+	assert.Equal(t, 5, report.Errors[1].Line)
+	assert.Equal(t, "Again", db.Products[len(db.Products)-1].Title)
+}
+
+func TestImportSameSkuInManyBatches(t *testing.T) {
+	db := services.NewMockDb()
+	var input strings.Builder
+	for version := 0; version < 4; version++ {
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&input, `{"sku": "s-%d", "title": "v%d", "image_url": "http://example.com/%d.png", "price": 1, `+
+				`"category_id": 2}`+"\n", i, version, i)
+		}
+	}
+	o := opts
+	o.BatchSize = 3
+	o.Workers = 4
+	o.Mapping = Mapping{Format: FormatNdjson}
+	products := len(db.Products)
+	report, err := Import(db, strings.NewReader(input.String()), o)
+	assert.Nil(t, err)
+	assert.Equal(t, 40, report.Lines)
+	assert.Equal(t, 10, report.Created)
+	assert.Equal(t, 30, report.Updated)
+	assert.Empty(t, report.Errors)
+	// every sku is created once, and ends up with its last line
+	if assert.Len(t, db.Products, products+10) {
+		for _, p := range db.Products[products:] {
+			assert.Equal(t, "v3", p.Title, *p.Sku)
+		}
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	db := services.NewMockDb()
+	input := "external_id,title,position,image_url\nc-1,Shoes,1,http://example.com/c.png\n"
+	o := opts
+	o.DryRun = true
+	o.Mapping = Mapping{Entity: EntityCategory, Format: FormatCsv}
+	categories := len(db.Categories)
+	report, err := Import(db, strings.NewReader(input), o)
+	assert.Nil(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, categories, len(db.Categories))
+}
+
+func TestImportBadMapping(t *testing.T) {
+	o := opts
+	o.Mapping = Mapping{Format: FormatCsv, Columns: map[string]string{"colour": "Colour"}}
+	_, err := Import(services.NewMockDb(), strings.NewReader(""), o)
+	assert.NotNil(t, err)
+
+	o.Mapping = Mapping{Format: "xlsx"}
+	_, err = Import(services.NewMockDb(), strings.NewReader(""), o)
+	assert.NotNil(t, err)
+}
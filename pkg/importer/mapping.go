@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	EntityProduct  = "product"
+	EntityCategory = "category"
+
+	FormatCsv    = "csv"
+	FormatNdjson = "ndjson"
+)
+
+// fields that can be imported per entity. The key fields are required, as entities are upserted by them. Products
+// refer to their category either by category_id or by the external id of the category, in the category field.
+var (
+	productFields  = []string{"sku", "title", "image_url", "price", "description", "category_id", "category"}
+	categoryFields = []string{"external_id", "title", "position", "image_url"}
+	keyFields      = map[string]string{EntityProduct: "sku", EntityCategory: "external_id"}
+)
+
+// Mapping describes an input file: which entity it holds, its format, and the column (or json key) of each field.
+// Fields that are not in Columns are read from the column with the same name.
+type Mapping struct {
+	Entity    string            `json:"entity"`
+	Format    string            `json:"format"`
+	Delimiter string            `json:"delimiter"`
+	Columns   map[string]string `json:"columns"`
+}
+
+// LoadMapping reads a mapping from a json file, e.g.
+//
+//	{"entity": "product", "format": "csv", "delimiter": ";", "columns": {"sku": "SKU", "title": "Name"}}
+func LoadMapping(path string) (Mapping, error) {
+	var m Mapping
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return m, fmt.Errorf("invalid mapping file %s: %s", path, err)
+	}
+	return m, nil
+}
+
+// FormatFromPath guesses the format of a file from its extension.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCsv
+	case ".ndjson", ".jsonl":
+		return FormatNdjson
+	}
+	return ""
+}
+
+// Validate checks the mapping and fills in its defaults.
+func (m *Mapping) Validate() error {
+	if m.Entity == "" {
+		m.Entity = EntityProduct
+	}
+	var fields []string
+	switch m.Entity {
+	case EntityProduct:
+		fields = productFields
+	case EntityCategory:
+		fields = categoryFields
+	default:
+		return fmt.Errorf("unknown entity %q, expected product or category", m.Entity)
+	}
+	if m.Format != FormatCsv && m.Format != FormatNdjson {
+		return fmt.Errorf("unknown format %q, expected csv or ndjson", m.Format)
+	}
+	if len([]rune(m.Delimiter)) > 1 {
+		return fmt.Errorf("delimiter must be a single character")
+	}
+	for field := range m.Columns {
+		if !contains(fields, field) {
+			return fmt.Errorf("unknown %s field %q, expected one of %s", m.Entity, field, strings.Join(fields, ", "))
+		}
+	}
+	if m.Columns == nil {
+		m.Columns = make(map[string]string)
+	}
+	for _, field := range fields {
+		if m.Columns[field] == "" {
+			m.Columns[field] = field
+		}
+	}
+	return nil
+}
+
+// column returns the column of field.
+func (m *Mapping) column(field string) string {
+	return m.Columns[field]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
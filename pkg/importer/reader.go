@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maximum length of a single NDJSON line
+const maxLineSize = 1024 * 1024
+
+// record is a single row of the input, by column name.
+type record struct {
+	line   int
+	values map[string]string
+	err    error
+}
+
+// recordReader reads the input one record at a time. Errors of a single record are returned within it, while
+// errors of the whole input are returned as err. io.EOF is returned at the end.
+type recordReader interface {
+	Read() (rec record, err error)
+}
+
+func newRecordReader(r io.Reader, m Mapping) recordReader {
+	if m.Format == FormatNdjson {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		return &ndjsonReader{scanner: scanner}
+	}
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+	if m.Delimiter != "" {
+		reader.Comma = []rune(m.Delimiter)[0]
+	}
+	return &csvReader{reader: reader}
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+	line   int
+}
+
+func (c *csvReader) Read() (record, error) {
+	if c.header == nil {
+		header, err := c.reader.Read()
+		if err == io.EOF {
+			return record{}, errors.New("empty csv file, expected a header line")
+		}
+		if err != nil {
+			return record{}, err
+		}
+		c.header = append([]string(nil), header...)
+		c.line = 1
+	}
+	values, err := c.reader.Read()
+	if err == io.EOF {
+		return record{}, io.EOF
+	}
+	c.line++
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return record{line: parseErr.Line, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return record{}, err
+	}
+	if len(values) != len(c.header) {
+		return record{line: c.line, err: fmt.Errorf("expected %d columns, got %d", len(c.header), len(values))}, nil
+	}
+	rec := record{line: c.line, values: make(map[string]string, len(values))}
+	for i, v := range values {
+		rec.values[c.header[i]] = v
+	}
+	return rec, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (n *ndjsonReader) Read() (record, error) {
+	for n.scanner.Scan() {
+		n.line++
+		raw := n.scanner.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return record{line: n.line, err: fmt.Errorf("invalid json: %s", err)}, nil
+		}
+		rec := record{line: n.line, values: make(map[string]string, len(object))}
+		for key, value := range object {
+			rec.values[key] = stringValue(value)
+		}
+		return rec, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		return record{}, err
+	}
+	return record{}, io.EOF
+}
+
+// stringValue turns a json value into the string it would be in a csv file.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// dialect holds what differs between the databases that migrations are applied to.
+type dialect struct {
+	// lock waits until the connection holds the lock of the migrations, for timeout at most
+	lock   func(ctx context.Context, conn *sql.Conn, timeout time.Duration) error
+	unlock func(conn *sql.Conn)
+	// tables counts the tables named schema_migrations
+	tables string
+	// dirtyColumns counts the dirty columns of schema_migrations, which only the table of golang-migrate has
+	dirtyColumns string
+	// appliedAt selects applied_at in seconds since the epoch
+	appliedAt string
+	// timestamp is the type of applied_at
+	timestamp string
+}
+
+// lockKey identifies the lock of the migrations among the advisory locks of Postgres
+const lockKey = 7340143
+
+var dialects = map[string]dialect{
+	"mysql": {
+		lock: func(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+			var locked sql.NullInt64
+			err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(timeout.Seconds())).Scan(&locked)
+			if err != nil {
+				return err
+			}
+			if !locked.Valid || locked.Int64 != 1 {
+				return errLocked(timeout)
+			}
+			return nil
+		},
+		unlock: func(conn *sql.Conn) {
+			var released sql.NullInt64
+			_ = conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName).Scan(&released)
+		},
+		tables: `SELECT COUNT(*) FROM information_schema.tables
+    WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'`,
+		dirtyColumns: `SELECT COUNT(*) FROM information_schema.columns
+    WHERE table_schema = DATABASE() AND table_name = 'schema_migrations' AND column_name = 'dirty'`,
+		appliedAt: "UNIX_TIMESTAMP(applied_at)",
+		timestamp: "TIMESTAMP",
+	},
+	"postgres": {
+		// pg_advisory_lock waits forever, so trying again is what makes the timeout
+		lock: func(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+			deadline := time.Now().Add(timeout)
+			for {
+				var locked bool
+				if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&locked); err != nil {
+					return err
+				}
+				if locked {
+					return nil
+				}
+				if time.Now().After(deadline) {
+					return errLocked(timeout)
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(500 * time.Millisecond):
+				}
+			}
+		},
+		unlock: func(conn *sql.Conn) {
+			var released bool
+			_ = conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey).Scan(&released)
+		},
+		tables: `SELECT COUNT(*) FROM information_schema.tables
+    WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`,
+		dirtyColumns: `SELECT COUNT(*) FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'dirty'`,
+		appliedAt: "CAST(EXTRACT(EPOCH FROM applied_at) AS BIGINT)",
+		timestamp: "TIMESTAMPTZ",
+	},
+	// SQLite databases are files of a single host, used by a single instance, so there is nothing to lock
+	"sqlite3": {
+		lock: func(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+			return nil
+		},
+		unlock:       func(conn *sql.Conn) {},
+		tables:       "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+		dirtyColumns: "SELECT COUNT(*) FROM pragma_table_info('schema_migrations') WHERE name = 'dirty'",
+		appliedAt:    "CAST(strftime('%s', applied_at) AS INTEGER)",
+		timestamp:    "TIMESTAMP",
+	},
+}
+
+func errLocked(timeout time.Duration) error {
+	return fmt.Errorf("another instance has been migrating for over %s", timeout)
+}
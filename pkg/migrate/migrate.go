@@ -0,0 +1,466 @@
+// Package migrate applies the migrations of the schema to MySQL, PostgreSQL or SQLite, keeping track of them in the
+// schema_migrations table. Instances that migrate at the same time wait for each other, and migrations whose file
+// changed after they were applied stop all further migrations, as the schema may not be the one the files describe.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/migrations"
+)
+
+// Migration is a change of the schema, and the one that reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the up sql of a migration, which is what was applied.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Parse returns the migrations of files named {version}_{name}.up.sql and {version}_{name}.down.sql, by version.
+func Parse(files map[string]string) ([]Migration, error) {
+	byVersion := make(map[int]*Migration)
+	for file, content := range files {
+		match := filePattern.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("%s is not named {version}_{name}.up.sql or {version}_{name}.down.sql", file)
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version <= 0 {
+			return nil, fmt.Errorf("%s: versions start from 1", file)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", m, file)
+		}
+		if match[3] == "up" {
+			m.Up = content
+		} else {
+			m.Down = content
+		}
+	}
+	var migrations []Migration
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// State is a migration as known to the database.
+type State struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time `json:"applied_at"`
+	// Modified is set if the file of an applied migration changed since
+	Modified bool `json:"modified"`
+	// Unknown is set for applied migrations that are not among the files, e.g. ones of a newer release
+	Unknown bool `json:"unknown"`
+}
+
+const (
+	// lockName identifies the lock of the migrations among the named locks of MySQL
+	lockName           = "small-api.schema_migrations"
+	defaultLockTimeout = time.Minute
+)
+
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	dialect    dialect
+	migrations []Migration
+	// LockTimeout is how long to wait for another instance that is migrating, a minute if 0
+	LockTimeout time.Duration
+	// Log, if set, is told about every migration applied or reverted
+	Log func(format string, v ...interface{})
+}
+
+// New returns the migrator of a database of the given driver: mysql, postgres or sqlite3.
+func New(db *sql.DB, driver string, migrations []Migration) (*Migrator, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("cannot migrate %s databases", driver)
+	}
+	return &Migrator{db: db, driver: driver, dialect: d, migrations: migrations}, nil
+}
+
+// NewEmbedded returns the migrator of the migrations embedded from the migrations directory, the ones of driver.
+func NewEmbedded(db *sql.DB, driver string) (*Migrator, error) {
+	files, err := migrations.For(driver)
+	if err != nil {
+		return nil, err
+	}
+	all, err := Parse(files)
+	if err != nil {
+		return nil, err
+	}
+	return New(db, driver, all)
+}
+
+// applied is a row of schema_migrations.
+type applied struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Status returns the state of every migration, known or applied, by version.
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	rows, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var states []State
+	for _, mig := range m.migrations {
+		state := State{Version: mig.Version, Name: mig.Name}
+		if a, ok := rows[mig.Version]; ok {
+			appliedAt := a.appliedAt
+			state.AppliedAt = &appliedAt
+			// rows converted from golang-migrate have no checksum
+			state.Modified = a.checksum != "" && a.checksum != mig.Checksum()
+		}
+		states = append(states, state)
+	}
+	for _, a := range rows {
+		if m.find(a.version) == nil {
+			appliedAt := a.appliedAt
+			states = append(states, State{Version: a.version, Name: a.name, AppliedAt: &appliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Version < states[j].Version
+	})
+	return states, nil
+}
+
+// Up applies all pending migrations, and returns how many.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	if len(m.migrations) == 0 {
+		return 0, nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the last steps migrations applied, and returns how many.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, rows map[int]applied) error {
+		for _, version := range versionsDesc(rows) {
+			if count == steps {
+				break
+			}
+			if err := m.down(ctx, conn, *m.find(version)); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// To applies or reverts migrations until version is the last one applied, 0 to revert them all, and returns how
+// many it applied or reverted.
+func (m *Migrator) To(ctx context.Context, version int) (int, error) {
+	if version != 0 && m.find(version) == nil {
+		return 0, fmt.Errorf("there is no migration %d", version)
+	}
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, rows map[int]applied) error {
+		for _, v := range versionsDesc(rows) {
+			if v <= version {
+				break
+			}
+			if err := m.down(ctx, conn, *m.find(v)); err != nil {
+				return err
+			}
+			count++
+		}
+		for _, mig := range m.migrations {
+			if _, ok := rows[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+			if err := m.up(ctx, conn, mig); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func versionsDesc(rows map[int]applied) []int {
+	var versions []int
+	for v := range rows {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions
+}
+
+// locked runs fn holding the lock of the migrations, with the migrations applied so far. Locks belong to the
+// connection that got them, so everything runs on the same one.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, rows map[int]applied) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	timeout := m.LockTimeout
+	if timeout == 0 {
+		timeout = defaultLockTimeout
+	}
+	if err := m.dialect.lock(ctx, conn, timeout); err != nil {
+		return err
+	}
+	defer m.dialect.unlock(conn)
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	rows, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, a := range rows {
+		mig := m.find(a.version)
+		if mig == nil {
+			return fmt.Errorf("migration %d is applied, but it is not known to this release", a.version)
+		}
+		if a.checksum != mig.Checksum() {
+			return fmt.Errorf("migration %s changed since it was applied, revert the change of the file", mig)
+		}
+	}
+	return fn(conn, rows)
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  checksum CHAR(64) NOT NULL,
+  applied_at %s NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (version)
+)`
+
+// createTable creates schema_migrations, converting the one of golang-migrate, which only has the last version
+// and whether it failed, if the database was migrated with it.
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	legacy, err := m.isLegacy(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if !legacy {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(createTable, m.dialect.timestamp))
+		return err
+	}
+	last, err := legacyVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "DROP TABLE schema_migrations"); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(createTable, m.dialect.timestamp)); err != nil {
+		return err
+	}
+	for _, mig := range m.migrations {
+		if mig.Version > last {
+			break
+		}
+		if err := m.insertApplied(ctx, conn, mig); err != nil {
+			return err
+		}
+	}
+	m.log("converted schema_migrations of golang-migrate at version %d", last)
+	return nil
+}
+
+func (m *Migrator) isLegacy(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, m.dialect.dirtyColumns).Scan(&count)
+	return count > 0, err
+}
+
+func legacyVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	var dirty bool
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("golang-migrate failed at migration %d, fix the schema and its dirty flag first", version)
+	}
+	return version, nil
+}
+
+// applied returns the migrations applied, by version. Databases that were migrated with golang-migrate, and not
+// converted yet, have all migrations up to its version applied.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]applied, error) {
+	rows := make(map[int]applied)
+	legacy, err := m.isLegacy(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		last, err := legacyVersion(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		for _, mig := range m.migrations {
+			if mig.Version <= last {
+				rows[mig.Version] = applied{version: mig.Version, name: mig.Name}
+			}
+		}
+		return rows, nil
+	}
+	var exists int
+	err = conn.QueryRowContext(ctx, m.dialect.tables).Scan(&exists)
+	if err != nil || exists == 0 {
+		return rows, err
+	}
+	result, err := conn.QueryContext(ctx,
+		"SELECT version, name, checksum, "+m.dialect.appliedAt+" FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var a applied
+		var appliedAt int64
+		if err := result.Scan(&a.version, &a.name, &a.checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		a.appliedAt = time.Unix(appliedAt, 0)
+		rows[a.version] = a
+	}
+	return rows, result.Err()
+}
+
+func (m *Migrator) insertApplied(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	_, err := conn.ExecContext(ctx, m.bind("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)"),
+		mig.Version, mig.Name, mig.Checksum())
+	return err
+}
+
+// bind turns the ? placeholders of a query into the ones of the driver.
+func (m *Migrator) bind(q string) string {
+	return sqlx.Rebind(sqlx.BindType(m.driver), q)
+}
+
+// up applies a migration. MySQL commits every schema change on its own, so if a statement fails the ones before
+// it stay applied, and have to be reverted by hand before trying again.
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if err := execAll(ctx, conn, mig.Up); err != nil {
+		return fmt.Errorf("migration %s failed: %w", mig, err)
+	}
+	if err := m.insertApplied(ctx, conn, mig); err != nil {
+		return err
+	}
+	m.log("applied %s", mig)
+	return nil
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if err := execAll(ctx, conn, mig.Down); err != nil {
+		return fmt.Errorf("reverting migration %s failed: %w", mig, err)
+	}
+	if _, err := conn.ExecContext(ctx, m.bind("DELETE FROM schema_migrations WHERE version = ?"), mig.Version); err != nil {
+		return err
+	}
+	m.log("reverted %s", mig)
+	return nil
+}
+
+func execAll(ctx context.Context, conn *sql.Conn, sql string) error {
+	for _, statement := range Statements(sql) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Statements splits the sql of a migration into its statements, which are run one by one, as the driver does not
+// run many at once by default. Statements end with a semicolon at the end of a line; lines starting with -- are
+// comments.
+func Statements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";"); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+func (m *Migrator) log(format string, v ...interface{}) {
+	if m.Log != nil {
+		m.Log(format, v...)
+	}
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// Actor identifies who performs a write operation, so that it can be recorded in the audit log.
+type Actor struct {
+	Username  string
+	RequestId string
+}
+
+type AuditEntry struct {
+	Id         int64     `db:"id" json:"id"`
+	Username   string    `db:"username" json:"username"`
+	Action     string    `db:"action" json:"action"`
+	EntityType string    `db:"entity_type" json:"entity_type"`
+	EntityId   string    `db:"entity_id" json:"entity_id"`
+	Diff       Diff      `db:"diff" json:"diff"`
+	RequestId  string    `db:"request_id" json:"request_id"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type AuditFilter struct {
+	EntityType string
+	EntityId   string
+	Username   string
+	From       time.Time
+	To         time.Time
+}
+
+// Change holds the values of a single field before and after a write operation.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff maps the json field names of an entity to their changes. It is stored as json in the database.
+type Diff map[string]Change
+
+// fields that change on every write and would only add noise to the diff
+var ignoredDiffFields = map[string]bool{"created_at": true, "updated_at": true}
+
+// NewDiff compares the json representations of before and after. A nil before or after stands for an entity
+// that does not exist yet or does not exist anymore.
+func NewDiff(before interface{}, after interface{}) (Diff, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+	diff := Diff{}
+	for field, value := range beforeFields {
+		if ignoredDiffFields[field] {
+			continue
+		}
+		if afterValue, ok := afterFields[field]; !ok || !reflect.DeepEqual(value, afterValue) {
+			diff[field] = Change{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if ignoredDiffFields[field] {
+			continue
+		}
+		if _, ok := beforeFields[field]; !ok {
+			diff[field] = Change{Before: nil, After: value}
+		}
+	}
+	return diff, nil
+}
+
+func toFields(entity interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if entity == nil {
+		return fields, nil
+	}
+	raw, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &fields)
+	return fields, err
+}
+
+func (d Diff) Value() (driver.Value, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (d *Diff) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, d)
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case nil:
+		*d = nil
+		return nil
+	}
+	return errors.New("unsupported type for audit diff")
+}
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+
+	AuditEntityProduct  = "product"
+	AuditEntityCategory = "category"
+)
@@ -0,0 +1,16 @@
+package model
+
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+// ProductOp is a single operation of a batch request. Create and update take the whole product, while update and
+// delete refer to an existing product by Id. A Version other than 0 is checked like in single updates and deletes.
+type ProductOp struct {
+	Op      string  `json:"op"`
+	Id      string  `json:"id,omitempty"`
+	Version int     `json:"version,omitempty"`
+	Product Product `json:"product"`
+}
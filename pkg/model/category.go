@@ -2,11 +2,15 @@ package model
 
 import "time"
 
+// Category is validated with the rules of its validate tags, which match the columns of the category table.
 type Category struct {
-	Id        int       `db:"id" json:"id"`
-	Title     string    `db:"title" json:"title"`
-	Position  int       `db:"pos" json:"position"`
-	ImageUrl  string    `db:"image_url" json:"image_url"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	Id         int        `db:"id" json:"id" xml:"id"`
+	ExternalId *string    `db:"external_id" json:"external_id,omitempty" xml:"external_id,omitempty" validate:"max=64"`
+	Title      string     `db:"title" json:"title" xml:"title" validate:"required,max=100"`
+	Position   int        `db:"pos" json:"position" xml:"position" validate:"min=0"`
+	ImageUrl   string     `db:"image_url" json:"image_url" xml:"image_url" validate:"required,max=512,url"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at" xml:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at" xml:"updated_at"`
+	Version    int        `db:"version" json:"version" xml:"version"`
+	DeletedAt  *time.Time `db:"deleted_at" json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
 }
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+// Order is one field of the order of a listing, e.g. "price:desc". Fields are the public (json) names, which the
+// storage maps to its own columns.
+type Order struct {
+	Field string
+	Asc   bool
+}
+
+var ErrBadOrderBy = errors.New("Bad order by value. Example \"orderBy=category_id:asc,price:desc,title\"")
+
+// ParseOrderBy parses a comma separated list of fields, each optionally followed by ":asc" or ":desc". The order is
+// descending by default.
+func ParseOrderBy(value string) ([]Order, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var orders []Order
+	for _, part := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(part), ":")
+		if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "asc" && parts[1] != "desc") {
+			return nil, ErrBadOrderBy
+		}
+		orders = append(orders, Order{Field: parts[0], Asc: len(parts) == 2 && parts[1] == "asc"})
+	}
+	return orders, nil
+}
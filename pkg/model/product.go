@@ -2,14 +2,18 @@ package model
 
 import "time"
 
+// Product is validated with the rules of its validate tags, which match the columns of the product table.
 type Product struct {
-	Id          string    `db:"id" json:"id"`
-	CategoryId  int       `db:"category_id" json:"category_id"`
-	Title       string    `db:"title" json:"title"`
-	ImageUrl    string    `db:"image_url" json:"image_url"`
-	Price       float32   `db:"price" json:"price"`
-	Description string    `db:"description" json:"description"`
-	CreatedAt   time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
-	Category    Category  `db:"cat" json:"-"`
+	Id          string     `db:"id" json:"id" xml:"id"`
+	Sku         *string    `db:"sku" json:"sku,omitempty" xml:"sku,omitempty" validate:"max=64"`
+	CategoryId  int        `db:"category_id" json:"category_id" xml:"category_id" validate:"required"`
+	Title       string     `db:"title" json:"title" xml:"title" validate:"required,max=100"`
+	ImageUrl    string     `db:"image_url" json:"image_url" xml:"image_url" validate:"required,max=512,url"`
+	Price       float32    `db:"price" json:"price" xml:"price" validate:"min=0"`
+	Description string     `db:"description" json:"description" xml:"description" validate:"maxbytes=65535"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at" xml:"updated_at"`
+	Version     int        `db:"version" json:"version" xml:"version"`
+	DeletedAt   *time.Time `db:"deleted_at" json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
+	Category    Category   `db:"cat" json:"-" xml:"-"`
 }
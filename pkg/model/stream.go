@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// StreamFilter selects the entities streamed by the storage, and their order. Empty fields select everything.
+type StreamFilter struct {
+	// CategoryIds selects the categories with these ids, or the products in them
+	CategoryIds []int
+	// UpdatedSince selects the entities updated at or after this time
+	UpdatedSince time.Time
+	// OrderBy orders the products like their listing, by id if empty. Categories are always ordered by id.
+	OrderBy []Order
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// TrashItem is a soft deleted product or category.
+type TrashItem struct {
+	EntityType string    `db:"entity_type" json:"entity_type"`
+	EntityId   string    `db:"entity_id" json:"entity_id"`
+	Title      string    `db:"title" json:"title"`
+	DeletedAt  time.Time `db:"deleted_at" json:"deleted_at"`
+}
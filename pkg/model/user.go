@@ -7,4 +7,6 @@ type User struct {
 	Username  string    `db:"username"`
 	Password  string    `db:"password"`
 	CreatedAt time.Time `db:"created_at"`
+	// DisabledAt is set for users who can no longer authenticate
+	DisabledAt *time.Time `db:"disabled_at"`
 }
@@ -0,0 +1,79 @@
+// Package patch changes entities through their json, the same way for the API and for smallctl.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// ImmutableFields are managed by the storage, or by imports for external ids, and cannot be changed by a patch.
+var ImmutableFields = []string{"id", "created_at", "updated_at", "version", "deleted_at", "sku", "external_id"}
+
+// ImmutableFieldError is the error of a patch that changes one of the ImmutableFields.
+type ImmutableFieldError struct {
+	Field string
+}
+
+func (e *ImmutableFieldError) Error() string {
+	return fmt.Sprintf("Field %s cannot be changed", e.Field)
+}
+
+// DecodeError is the error of a patched document that is not an entity any more, e.g. with an unknown field.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Invalid resource after patch: %s", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Merge applies a JSON Merge Patch (RFC 7396) to the json of original, and decodes the result into patched.
+func Merge(original interface{}, mergePatch []byte, patched interface{}) error {
+	doc, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	result, err := jsonpatch.MergePatch(doc, mergePatch)
+	if err != nil {
+		return err
+	}
+	return Decode(doc, result, patched)
+}
+
+// Decode decodes result, the patched json document doc, into patched. It returns an *ImmutableFieldError if the
+// patch changed an immutable field, and a *DecodeError if result does not decode.
+func Decode(doc []byte, result []byte, patched interface{}) error {
+	if field, changed := immutableFieldChanged(doc, result); changed {
+		return &ImmutableFieldError{Field: field}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(patched); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+func immutableFieldChanged(before []byte, after []byte) (string, bool) {
+	var beforeFields, afterFields map[string]interface{}
+	if err := json.Unmarshal(before, &beforeFields); err != nil {
+		return "", false
+	}
+	if err := json.Unmarshal(after, &afterFields); err != nil {
+		return "", false
+	}
+	for _, field := range ImmutableFields {
+		if !reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			return field, true
+		}
+	}
+	return "", false
+}
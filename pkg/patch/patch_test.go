@@ -0,0 +1,33 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func TestMerge(t *testing.T) {
+	sku := "a-1"
+	original := model.Product{Id: "1", Sku: &sku, Title: "Lamp", Price: 10, Version: 2}
+
+	var patched model.Product
+	assert.Nil(t, Merge(original, []byte(`{"title": "Desk", "description": null, "sku": "a-1"}`), &patched))
+	assert.Equal(t, "Desk", patched.Title)
+	assert.Equal(t, float32(10), patched.Price)
+	assert.Equal(t, 2, patched.Version)
+
+	for field, mergePatch := range map[string]string{
+		"sku":     `{"sku": null}`,
+		"version": `{"version": 3}`,
+		"id":      `{"id": "2"}`,
+	} {
+		err := Merge(original, []byte(mergePatch), &patched)
+		if assert.IsType(t, &ImmutableFieldError{}, err, field) {
+			assert.Equal(t, field, err.(*ImmutableFieldError).Field)
+		}
+	}
+	assert.IsType(t, &DecodeError{}, Merge(original, []byte(`{"colour": "red"}`), &patched))
+	assert.NotNil(t, Merge(original, []byte(`[`), &patched))
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Rate describes how many requests are allowed in a time window. A zero Limit disables rate limiting.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Result is the outcome of a single Allow or Peek call, enough to fill the X-RateLimit-* response headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Limiter counts requests per key and tells whether a new one is allowed.
+// Both implementations use a sliding window counter: the count of the current fixed window plus the count of
+// the previous window, weighted by how much of it still overlaps with the sliding window.
+// Peek tells whether a new request would be allowed, without counting one.
+type Limiter interface {
+	Allow(key string, rate Rate) (Result, error)
+	Peek(key string, rate Rate) (Result, error)
+}
+
+func windowStart(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window)
+}
+
+func evaluate(now time.Time, rate Rate, previous int64, current int64) Result {
+	start := windowStart(now, rate.Window)
+	overlap := 1 - float64(now.Sub(start))/float64(rate.Window)
+	estimated := int(math.Floor(float64(previous)*overlap)) + int(current)
+	remaining := rate.Limit - estimated
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{
+		Allowed:   estimated <= rate.Limit,
+		Limit:     rate.Limit,
+		Remaining: remaining,
+		Reset:     start.Add(rate.Window),
+	}
+}
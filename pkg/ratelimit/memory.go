@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type counter struct {
+	start    time.Time
+	current  int64
+	previous int64
+}
+
+// MemoryLimiter keeps counters in process memory. Limits only hold for a single API instance.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(key string, rate Rate) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	start := windowStart(now, rate.Window)
+	m.sweep(now, rate.Window)
+
+	c, ok := m.counters[key]
+	if !ok {
+		c = &counter{start: start}
+		m.counters[key] = c
+	}
+	c.previous, c.current = c.slide(start, rate.Window)
+	c.start = start
+	c.current++
+	return evaluate(now, rate, c.previous, c.current), nil
+}
+
+func (m *MemoryLimiter) Peek(key string, rate Rate) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var previous, current int64
+	if c, ok := m.counters[key]; ok {
+		previous, current = c.slide(windowStart(now, rate.Window), rate.Window)
+	}
+	return evaluate(now, rate, previous, current+1), nil
+}
+
+// slide returns the counts of the previous and the current window, as they are once the window starting at start
+// is the current one.
+func (c *counter) slide(start time.Time, window time.Duration) (int64, int64) {
+	switch {
+	case c.start.Equal(start):
+		return c.previous, c.current
+	case c.start.Add(window).Equal(start):
+		return c.current, 0
+	default:
+		return 0, 0
+	}
+}
+
+// sweep drops counters that have not been touched for two windows, so that idle clients do not pile up.
+func (m *MemoryLimiter) sweep(now time.Time, window time.Duration) {
+	if now.Sub(m.lastSweep) < window {
+		return
+	}
+	m.lastSweep = now
+	for key, c := range m.counters {
+		if now.Sub(c.start) >= 2*window {
+			delete(m.counters, key)
+		}
+	}
+}
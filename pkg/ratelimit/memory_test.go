@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Date(2020, 5, 20, 10, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	rate := Rate{Limit: 3, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow("client", rate)
+		assert.Nil(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2-i, res.Remaining)
+		assert.Equal(t, now.Add(time.Minute), res.Reset)
+	}
+	res, err := limiter.Allow("client", rate)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// other keys are counted separately
+	res, err = limiter.Allow("other", rate)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+	now := time.Date(2020, 5, 20, 10, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	rate := Rate{Limit: 4, Window: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		res, _ := limiter.Allow("client", rate)
+		assert.True(t, res.Allowed)
+	}
+
+	// half of the previous window still overlaps: 4 * 0.5 = 2 requests are counted from it
+	now = now.Add(90 * time.Second)
+	res, _ := limiter.Allow("client", rate)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	res, _ = limiter.Allow("client", rate)
+	assert.True(t, res.Allowed)
+	res, _ = limiter.Allow("client", rate)
+	assert.False(t, res.Allowed)
+
+	// two windows later everything is forgotten
+	now = now.Add(2 * time.Minute)
+	res, _ = limiter.Allow("client", rate)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 3, res.Remaining)
+}
+
+func TestMemoryLimiterPeek(t *testing.T) {
+	now := time.Date(2020, 5, 20, 10, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	rate := Rate{Limit: 2, Window: time.Minute}
+
+	res, err := limiter.Peek("client", rate)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	// peeking does not count
+	_, _ = limiter.Peek("client", rate)
+	limiter.Allow("client", rate)
+	limiter.Allow("client", rate)
+	res, _ = limiter.Peek("client", rate)
+	assert.False(t, res.Allowed)
+
+	// the next window still counts the previous one
+	now = now.Add(90 * time.Second)
+	res, _ = limiter.Peek("client", rate)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisLimiter keeps counters in redis, so that limits hold across all API instances.
+// If redis cannot be reached, it falls back to an in-memory limiter instead of rejecting or letting through
+// every request.
+type RedisLimiter struct {
+	Client   *redis.Client
+	fallback *MemoryLimiter
+	now      func() time.Time
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{
+		Client:   client,
+		fallback: NewMemoryLimiter(),
+		now:      time.Now,
+	}
+}
+
+func (l *RedisLimiter) Allow(key string, rate Rate) (Result, error) {
+	now := l.now()
+	currentKey, previousKey := l.keys(key, now, rate.Window)
+
+	pipe := l.Client.TxPipeline()
+	incr := pipe.Incr(currentKey)
+	pipe.PExpire(currentKey, 2*rate.Window)
+	prev := pipe.Get(previousKey)
+	_, err := pipe.Exec()
+	if err != nil && err != redis.Nil {
+		log.Println("rate limiter: redis unavailable, using in-memory fallback:", err)
+		return l.fallback.Allow(key, rate)
+	}
+	var previous int64
+	if prev.Err() == nil {
+		previous, _ = strconv.ParseInt(prev.Val(), 10, 64)
+	}
+	return evaluate(now, rate, previous, incr.Val()), nil
+}
+
+func (l *RedisLimiter) Peek(key string, rate Rate) (Result, error) {
+	now := l.now()
+	currentKey, previousKey := l.keys(key, now, rate.Window)
+
+	counts, err := l.Client.MGet(currentKey, previousKey).Result()
+	if err != nil {
+		log.Println("rate limiter: redis unavailable, using in-memory fallback:", err)
+		return l.fallback.Peek(key, rate)
+	}
+	current, previous := countOf(counts[0]), countOf(counts[1])
+	return evaluate(now, rate, previous, current+1), nil
+}
+
+// keys returns the redis keys of the counters of the current and the previous window of key.
+func (l *RedisLimiter) keys(key string, now time.Time, window time.Duration) (string, string) {
+	start := windowStart(now, window)
+	return fmt.Sprintf("ratelimit:%s:%d", key, start.UnixNano()),
+		fmt.Sprintf("ratelimit:%s:%d", key, start.Add(-window).UnixNano())
+}
+
+// countOf parses a counter returned by MGET, which is nil for a window nothing was counted in.
+func countOf(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	count, _ := strconv.ParseInt(s, 10, 64)
+	return count
+}
@@ -0,0 +1,243 @@
+package seed
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// Generator generates the catalog of a profile. Everything comes from its own source of random numbers, so the same
+// profile and seed give the same categories and products, with the same ids.
+type Generator struct {
+	rand       *rand.Rand
+	categories []plannedCategory
+	brands     []string
+	adjectives []string
+	imageUrl   string
+}
+
+// plannedCategory is a category of the flattened trees, with the settings it inherited.
+type plannedCategory struct {
+	title       string
+	products    int
+	price       Distribution
+	description Length
+	nouns       []string
+}
+
+func NewGenerator(profile Profile, seed int64) *Generator {
+	g := &Generator{
+		rand:       rand.New(rand.NewSource(seed)),
+		brands:     profile.Brands,
+		adjectives: profile.Adjectives,
+		imageUrl:   profile.ImageUrl,
+	}
+	if len(g.brands) == 0 {
+		g.brands = defaultBrands
+	}
+	if len(g.adjectives) == 0 {
+		g.adjectives = defaultAdjectives
+	}
+	if g.imageUrl == "" {
+		g.imageUrl = defaultImageUrl
+	}
+	defaults := plannedCategory{products: defaultProducts, price: defaultPrice, description: defaultDescription}
+	inherit(&defaults, profile.Products, profile.Price, profile.Description)
+	g.plan("", defaults, profile.Categories)
+	return g
+}
+
+// plan flattens the trees of categories, parents first.
+func (g *Generator) plan(parent string, defaults plannedCategory, categories []CategoryProfile) {
+	for _, c := range categories {
+		planned := defaults
+		planned.title = joinTitle(parent, c.Title)
+		inherit(&planned, c.Products, c.Price, c.Description)
+		planned.nouns = c.Nouns
+		if len(planned.nouns) == 0 {
+			words := strings.Fields(c.Title)
+			planned.nouns = []string{strings.ToLower(words[len(words)-1])}
+		}
+		g.categories = append(g.categories, planned)
+		g.plan(planned.title, planned, c.Children)
+	}
+}
+
+func inherit(c *plannedCategory, products *int, price *Distribution, description *Length) {
+	if products != nil {
+		c.products = *products
+	}
+	if price != nil {
+		c.price = *price
+	}
+	if description != nil {
+		c.description = *description
+	}
+}
+
+// Scale changes the number of products of each category, so that there are total products in all, in the same
+// proportions as in the profile.
+func (g *Generator) Scale(total int) {
+	current := g.Products()
+	if current == 0 {
+		return
+	}
+	assigned := 0
+	remainders := make([]float64, len(g.categories))
+	for i := range g.categories {
+		exact := float64(g.categories[i].products) * float64(total) / float64(current)
+		g.categories[i].products = int(exact)
+		remainders[i] = exact - math.Floor(exact)
+		assigned += g.categories[i].products
+	}
+	// the products left by rounding down go to the categories that lost the most
+	for ; assigned < total; assigned++ {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		g.categories[largest].products++
+		remainders[largest] = -1
+	}
+}
+
+// Products returns the number of products that will be generated.
+func (g *Generator) Products() int {
+	total := 0
+	for _, c := range g.categories {
+		total += c.products
+	}
+	return total
+}
+
+// Categories returns the categories, numbered from firstId in the order of the profile.
+func (g *Generator) Categories(firstId int) []model.Category {
+	categories := make([]model.Category, len(g.categories))
+	for i, c := range g.categories {
+		categories[i] = model.Category{
+			Id:       firstId + i,
+			Title:    c.title,
+			Position: i + 1,
+			ImageUrl: g.imageUrl + slug(c.title) + ".png",
+		}
+	}
+	return categories
+}
+
+// EachProduct calls fn with every product, category after category, the categories being numbered from firstId.
+// It stops at the first error of fn, and returns it.
+func (g *Generator) EachProduct(firstId int, fn func(p model.Product) error) error {
+	for i, c := range g.categories {
+		for j := 0; j < c.products; j++ {
+			if err := fn(g.product(firstId+i, c)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Generator) product(categoryId int, c plannedCategory) model.Product {
+	id := g.uuid()
+	title := fmt.Sprintf("%s %s %s %s%d", g.pick(g.brands), g.pick(g.adjectives), g.pick(c.nouns),
+		string(rune('A'+g.rand.Intn(26))), g.rand.Intn(900)+100)
+	return model.Product{
+		Id:          id,
+		CategoryId:  categoryId,
+		Title:       title,
+		ImageUrl:    g.imageUrl + "product-" + id[:8] + ".png",
+		Price:       float32(g.price(c.price)),
+		Description: g.description(c.description),
+	}
+}
+
+// uuid returns a random (version 4) uuid made from the numbers of the generator.
+func (g *Generator) uuid() string {
+	var b [16]byte
+	g.rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	id, _ := uuid.FromBytes(b[:])
+	return id.String()
+}
+
+func (g *Generator) pick(words []string) string {
+	return words[g.rand.Intn(len(words))]
+}
+
+func (g *Generator) price(d Distribution) float64 {
+	var price float64
+	switch d.Kind {
+	case DistributionUniform:
+		price = d.Min + g.rand.Float64()*(d.Max-d.Min)
+	case DistributionNormal:
+		price = d.Mean + g.rand.NormFloat64()*d.StdDev
+	case DistributionLognormal:
+		price = math.Exp(math.Log(d.Mean) + g.rand.NormFloat64()*d.StdDev)
+	}
+	if price < d.Min {
+		price = d.Min
+	}
+	if d.Max != 0 && price > d.Max {
+		price = d.Max
+	}
+	return math.Round(price*100) / 100
+}
+
+var loremWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor
+incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi
+aliquip ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat nulla pariatur
+excepteur sint occaecat cupidatat non proident sunt culpa qui officia deserunt mollit anim id est laborum`)
+
+// description returns sentences of lorem ipsum, of a number of words within l.
+func (g *Generator) description(l Length) string {
+	n := l.Min + g.rand.Intn(l.Max-l.Min+1)
+	if n == 0 {
+		return ""
+	}
+	var b strings.Builder
+	sentence := 0
+	for i := 0; i < n; i++ {
+		word := g.pick(loremWords)
+		if sentence == 0 {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			word = strings.ToUpper(word[:1]) + word[1:]
+		} else {
+			b.WriteString(" ")
+		}
+		b.WriteString(word)
+		sentence++
+		if sentence >= 6+g.rand.Intn(8) || i == n-1 {
+			b.WriteString(".")
+			sentence = 0
+		}
+	}
+	return b.String()
+}
+
+// slug turns a title into a name for urls, e.g. "Books and music / Books" into "books-and-music-books".
+func slug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,211 @@
+// Package seed generates catalogs of categories and products for development and performance testing. What is
+// generated is described by a profile, and the same profile and seed always give the same catalog.
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	DistributionUniform   = "uniform"
+	DistributionNormal    = "normal"
+	DistributionLognormal = "lognormal"
+
+	// titleSeparator joins the titles of the categories of a tree, as categories have no parent
+	titleSeparator = " / "
+)
+
+// Profile describes the catalog to generate. Categories form trees, which are flattened into categories titled
+// after their path, e.g. "Electronics / Laptops", as the catalog has no sub categories. Products, Price and
+// Description are the defaults of the categories that do not set their own, and of their sub categories.
+type Profile struct {
+	Categories  []CategoryProfile `json:"categories"`
+	Products    *int              `json:"products,omitempty"`
+	Price       *Distribution     `json:"price,omitempty"`
+	Description *Length           `json:"description,omitempty"`
+	// Brands and Adjectives are combined with the nouns of a category into product titles
+	Brands     []string `json:"brands,omitempty"`
+	Adjectives []string `json:"adjectives,omitempty"`
+	// ImageUrl is the url that image names are appended to
+	ImageUrl string `json:"image_url,omitempty"`
+}
+
+// CategoryProfile is a category, with the number of products to generate in it, and its sub categories.
+type CategoryProfile struct {
+	Title       string        `json:"title"`
+	Products    *int          `json:"products,omitempty"`
+	Price       *Distribution `json:"price,omitempty"`
+	Description *Length       `json:"description,omitempty"`
+	// Nouns are what products of the category are, e.g. "laptop", the last word of the title by default
+	Nouns    []string          `json:"nouns,omitempty"`
+	Children []CategoryProfile `json:"children,omitempty"`
+}
+
+// Distribution is the distribution of prices. Uniform prices are between Min and Max. Normal prices have a mean
+// of Mean and a standard deviation of StdDev. Lognormal prices have a median of Mean, and their logarithms have a
+// standard deviation of StdDev, which suits prices: most are low, few are very high. Prices are kept between Min
+// and Max, if Max is set, and rounded to cents.
+type Distribution struct {
+	Kind   string  `json:"distribution"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max,omitempty"`
+	Mean   float64 `json:"mean,omitempty"`
+	StdDev float64 `json:"stddev,omitempty"`
+}
+
+// Length is the number of words of descriptions, between Min and Max.
+type Length struct {
+	Min int `json:"min_words"`
+	Max int `json:"max_words"`
+}
+
+var (
+	defaultProducts    = 50
+	defaultPrice       = Distribution{Kind: DistributionLognormal, Min: 1, Max: 5000, Mean: 50, StdDev: 1}
+	defaultDescription = Length{Min: 10, Max: 60}
+	defaultBrands      = []string{"Acme", "Northwind", "Globex", "Initech", "Umbrella", "Hooli", "Vandelay",
+		"Stark", "Wayne", "Soylent", "Tyrell", "Cyberdyne"}
+	defaultAdjectives = []string{"Compact", "Classic", "Pro", "Ultra", "Lite", "Smart", "Deluxe", "Essential",
+		"Premium", "Eco", "Portable", "Wireless", "Vintage", "Sport"}
+	defaultImageUrl = "http://www.bestprice.gr/"
+)
+
+// LoadProfile reads a profile from a json file.
+func LoadProfile(path string) (Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Profile{}, err
+	}
+	defer f.Close()
+	return ReadProfile(f)
+}
+
+// ReadProfile reads a profile in json, and checks it.
+func ReadProfile(r io.Reader) (Profile, error) {
+	var profile Profile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		return Profile{}, fmt.Errorf("invalid profile: %s", err)
+	}
+	if err := profile.Validate(); err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// DefaultProfile is the profile used when none is given: a thousand products in twenty categories.
+func DefaultProfile() Profile {
+	profile, err := ReadProfile(strings.NewReader(defaultProfile))
+	if err != nil {
+		panic(err)
+	}
+	return profile
+}
+
+// Validate checks that the profile describes a catalog that can be generated.
+func (p Profile) Validate() error {
+	if len(p.Categories) == 0 {
+		return fmt.Errorf("invalid profile: no categories")
+	}
+	if err := validateSettings("profile", p.Products, p.Price, p.Description); err != nil {
+		return err
+	}
+	return validateCategories("", p.Categories)
+}
+
+func validateCategories(parent string, categories []CategoryProfile) error {
+	for _, c := range categories {
+		title := joinTitle(parent, c.Title)
+		if strings.TrimSpace(c.Title) == "" {
+			return fmt.Errorf("invalid profile: category without title in %q", parent)
+		}
+		if len(title) > 100 {
+			return fmt.Errorf("invalid profile: title of category %q is longer than 100 characters", title)
+		}
+		if err := validateSettings(fmt.Sprintf("category %q", title), c.Products, c.Price, c.Description); err != nil {
+			return err
+		}
+		if err := validateCategories(title, c.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSettings(of string, products *int, price *Distribution, description *Length) error {
+	if products != nil && *products < 0 {
+		return fmt.Errorf("invalid profile: negative number of products in %s", of)
+	}
+	if price != nil {
+		switch price.Kind {
+		case DistributionUniform, DistributionNormal, DistributionLognormal:
+		default:
+			return fmt.Errorf("invalid profile: unknown price distribution %q in %s, expected uniform, normal or "+
+				"lognormal", price.Kind, of)
+		}
+		if price.Min < 0 || (price.Max != 0 && price.Max < price.Min) ||
+			(price.Kind == DistributionUniform && price.Max == 0) {
+			return fmt.Errorf("invalid profile: invalid price range in %s", of)
+		}
+		if price.Kind != DistributionUniform && (price.Mean <= 0 || price.StdDev < 0) {
+			return fmt.Errorf("invalid profile: invalid price mean or stddev in %s", of)
+		}
+	}
+	if description != nil && (description.Min < 0 || description.Max < description.Min) {
+		return fmt.Errorf("invalid profile: invalid description length in %s", of)
+	}
+	return nil
+}
+
+func joinTitle(parent string, title string) string {
+	if parent == "" {
+		return title
+	}
+	return parent + titleSeparator + title
+}
+
+const defaultProfile = `{
+  "products": 0,
+  "description": {"min_words": 10, "max_words": 60},
+  "categories": [
+    {"title": "Electronics",
+      "price": {"distribution": "lognormal", "mean": 250, "stddev": 0.8, "min": 10, "max": 3000},
+      "children": [
+        {"title": "Mobile phones", "products": 100, "nouns": ["phone", "smartphone", "phone case", "charger"]},
+        {"title": "Laptops", "products": 80, "nouns": ["laptop", "notebook", "laptop bag"]},
+        {"title": "Televisions", "products": 60, "nouns": ["TV", "television", "soundbar"]},
+        {"title": "Headphones", "products": 80, "nouns": ["headphones", "earbuds", "headset"],
+          "price": {"distribution": "lognormal", "mean": 60, "stddev": 0.7, "min": 5, "max": 600}}
+      ]},
+    {"title": "Home", "price": {"distribution": "lognormal", "mean": 80, "stddev": 0.7, "min": 3, "max": 2000},
+      "children": [
+        {"title": "Furniture", "products": 70, "nouns": ["chair", "table", "sofa", "bookcase", "desk"]},
+        {"title": "Kitchen", "products": 90, "nouns": ["blender", "kettle", "toaster", "pan", "knife set"]},
+        {"title": "Garden", "products": 60, "nouns": ["lawn mower", "hose", "planter", "grill"]}
+      ]},
+    {"title": "Sports", "price": {"distribution": "lognormal", "mean": 50, "stddev": 0.6, "min": 5, "max": 1500},
+      "children": [
+        {"title": "Cycling", "products": 50, "nouns": ["bike", "helmet", "bike light", "saddle"]},
+        {"title": "Running", "products": 60, "nouns": ["running shoes", "running jacket", "watch"]},
+        {"title": "Fitness", "products": 50, "nouns": ["dumbbells", "yoga mat", "kettlebell"]}
+      ]},
+    {"title": "Books and music", "price": {"distribution": "uniform", "min": 5, "max": 40},
+      "children": [
+        {"title": "Books", "products": 100, "nouns": ["novel", "cookbook", "guide", "biography"],
+          "description": {"min_words": 30, "max_words": 120}},
+        {"title": "Music", "products": 50, "nouns": ["album", "vinyl", "box set"]},
+        {"title": "Instruments", "products": 30, "nouns": ["guitar", "keyboard", "violin", "drum kit"],
+          "price": {"distribution": "lognormal", "mean": 300, "stddev": 0.7, "min": 20, "max": 4000}}
+      ]},
+    {"title": "Games", "price": {"distribution": "normal", "mean": 45, "stddev": 15, "min": 5, "max": 90},
+      "children": [
+        {"title": "Video games", "products": 80, "nouns": ["game", "controller", "expansion"]},
+        {"title": "Board games", "products": 40, "nouns": ["board game", "card game", "puzzle"]}
+      ]}
+  ]
+}`
@@ -0,0 +1,135 @@
+package seed
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+var (
+	categoryColumns = []string{"id", "title", "pos", "image_url"}
+	productColumns  = []string{"id", "category_id", "title", "image_url", "price", "description"}
+)
+
+// Result counts what Seed wrote.
+type Result struct {
+	Categories int
+	Products   int
+	Duration   time.Duration
+}
+
+// Seed writes the catalog of g to w, in inserts of batchSize rows, and closes w. Progress, if not nil, is told of
+// the products written as they are.
+func Seed(g *Generator, w Writer, batchSize int, progress *Progress) (Result, error) {
+	start := time.Now()
+	result, err := seed(g, w, batchSize, progress)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+func seed(g *Generator, w Writer, batchSize int, progress *Progress) (Result, error) {
+	var result Result
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	firstId, err := w.FirstCategoryId()
+	if err != nil {
+		return result, err
+	}
+	categories := g.Categories(firstId)
+	rows := make([][]interface{}, 0, batchSize)
+	for _, c := range categories {
+		rows = append(rows, []interface{}{c.Id, c.Title, c.Position, c.ImageUrl})
+		if len(rows) == batchSize {
+			if err := w.Insert("category", categoryColumns, rows); err != nil {
+				return result, err
+			}
+			rows = make([][]interface{}, 0, batchSize)
+		}
+	}
+	if err := w.Insert("category", categoryColumns, rows); err != nil {
+		return result, err
+	}
+	// products reference the categories, which have to be there first
+	if err := w.Flush(); err != nil {
+		return result, err
+	}
+	result.Categories = len(categories)
+
+	rows = make([][]interface{}, 0, batchSize)
+	flush := func() error {
+		if err := w.Insert("product", productColumns, rows); err != nil {
+			return err
+		}
+		result.Products += len(rows)
+		progress.add(len(rows))
+		rows = make([][]interface{}, 0, batchSize)
+		return nil
+	}
+	err = g.EachProduct(firstId, func(p model.Product) error {
+		rows = append(rows, []interface{}{p.Id, p.CategoryId, p.Title, p.ImageUrl, p.Price, p.Description})
+		if len(rows) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	progress.done()
+	return result, err
+}
+
+// Progress prints how many of Total rows were written, and how fast, at most once per Interval.
+type Progress struct {
+	Out      io.Writer
+	Total    int
+	Interval time.Duration
+
+	start   time.Time
+	printed time.Time
+	written int
+}
+
+func (p *Progress) add(n int) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	if p.start.IsZero() {
+		p.start = now
+		p.printed = now
+	}
+	p.written += n
+	if now.Sub(p.printed) >= p.Interval {
+		p.printed = now
+		p.print(now)
+	}
+}
+
+func (p *Progress) done() {
+	if p == nil || p.start.IsZero() {
+		return
+	}
+	p.print(time.Now())
+}
+
+func (p *Progress) print(now time.Time) {
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.written) / elapsed
+	}
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.written) * 100 / float64(p.Total)
+	}
+	_, _ = fmt.Fprintf(p.Out, "%d/%d products (%.0f%%), %.0f products/s\n", p.written, p.Total, percent, rate)
+}
@@ -0,0 +1,297 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/migrate"
+	"github.com/panospet/small-api/pkg/model"
+	"github.com/panospet/small-api/pkg/services"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func products(t *testing.T, g *Generator) []model.Product {
+	var products []model.Product
+	assert.Nil(t, g.EachProduct(1, func(p model.Product) error {
+		products = append(products, p)
+		return nil
+	}))
+	return products
+}
+
+func dump(t *testing.T, g *Generator, driver string, batchSize int) string {
+	var buf bytes.Buffer
+	w, err := NewDumpWriter(&buf, driver)
+	assert.Nil(t, err)
+	_, err = Seed(g, w, batchSize, nil)
+	assert.Nil(t, err)
+	return buf.String()
+}
+
+func TestDefaultProfile(t *testing.T) {
+	g := NewGenerator(DefaultProfile(), 1)
+	assert.Equal(t, 1000, g.Products())
+	categories := g.Categories(1)
+	assert.Len(t, categories, 20)
+	assert.Equal(t, model.Category{Id: 1, Title: "Electronics", Position: 1,
+		ImageUrl: "http://www.bestprice.gr/electronics.png"}, categories[0])
+	assert.Equal(t, "Electronics / Mobile phones", categories[1].Title)
+	assert.Equal(t, "http://www.bestprice.gr/books-and-music-books.png", categories[14].ImageUrl)
+
+	perCategory := make(map[int]int)
+	for _, p := range products(t, g) {
+		perCategory[p.CategoryId]++
+		assert.Len(t, p.Id, 36)
+		assert.NotEmpty(t, p.Title)
+		assert.True(t, strings.HasPrefix(p.ImageUrl, "http://www.bestprice.gr/product-"))
+		assert.True(t, p.Price >= 3 && p.Price <= 4000, p.Price)
+	}
+	// the top categories only hold the ones below them
+	assert.Equal(t, 0, perCategory[1])
+	assert.Equal(t, 100, perCategory[2])
+}
+
+func TestReadProfile(t *testing.T) {
+	profile, err := ReadProfile(strings.NewReader(`{"products": 3, "categories": [{"title": "a",
+		"price": {"distribution": "uniform", "min": 1, "max": 2}, "children": [{"title": "b", "nouns": ["thing"]}]}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, *profile.Products)
+	assert.Equal(t, "thing", profile.Categories[0].Children[0].Nouns[0])
+
+	invalid := []string{
+		`{"categories": []}`,
+		`{"categories": [{"title": " "}]}`,
+		`{"categories": [{"title": "a", "colour": "red"}]}`,
+		`{"categories": [{"title": "a", "products": -1}]}`,
+		`{"categories": [{"title": "a", "children": [{"title": "b", "products": -1}]}]}`,
+		`{"categories": [{"title": "` + strings.Repeat("a", 60) + `", "children": [{"title": "` +
+			strings.Repeat("b", 40) + `"}]}]}`,
+		`{"categories": [{"title": "a", "price": {"distribution": "poisson", "mean": 1}}]}`,
+		`{"categories": [{"title": "a", "price": {"distribution": "uniform", "min": 1}}]}`,
+		`{"categories": [{"title": "a", "price": {"distribution": "normal", "min": 1, "max": 2}}]}`,
+		`{"price": {"distribution": "normal", "mean": 10, "min": 5, "max": 2}, "categories": [{"title": "a"}]}`,
+		`{"description": {"min_words": 5, "max_words": 2}, "categories": [{"title": "a"}]}`,
+	}
+	for _, p := range invalid {
+		_, err := ReadProfile(strings.NewReader(p))
+		assert.NotNil(t, err, p)
+	}
+	_, err = LoadProfile("missing.json")
+	assert.NotNil(t, err)
+}
+
+func TestGeneratorInheritance(t *testing.T) {
+	profile := Profile{
+		Products:    intPtr(2),
+		Description: &Length{Min: 0, Max: 0},
+		Brands:      []string{"Acme"},
+		Adjectives:  []string{"Red"},
+		ImageUrl:    "http://img/",
+		Categories: []CategoryProfile{
+			{Title: "Home", Price: &Distribution{Kind: DistributionUniform, Min: 5, Max: 5}, Children: []CategoryProfile{
+				{Title: "Garden tools", Products: intPtr(3)},
+			}},
+			{Title: "Toys", Products: intPtr(0)},
+		},
+	}
+	g := NewGenerator(profile, 1)
+	assert.Equal(t, 5, g.Products())
+	categories := g.Categories(10)
+	assert.Equal(t, []string{"Home", "Home / Garden tools", "Toys"},
+		[]string{categories[0].Title, categories[1].Title, categories[2].Title})
+	assert.Equal(t, 11, categories[1].Id)
+	assert.Equal(t, "http://img/home-garden-tools.png", categories[1].ImageUrl)
+
+	var counts = make(map[int]int)
+	assert.Nil(t, g.EachProduct(10, func(p model.Product) error {
+		counts[p.CategoryId]++
+		assert.Equal(t, float32(5), p.Price)
+		assert.Equal(t, "", p.Description)
+		assert.True(t, strings.HasPrefix(p.Title, "Acme Red "), p.Title)
+		if p.CategoryId == 11 {
+			// the nouns default to the last word of the title
+			assert.True(t, strings.HasPrefix(p.Title, "Acme Red tools "), p.Title)
+		}
+		return nil
+	}))
+	assert.Equal(t, map[int]int{10: 2, 11: 3}, counts)
+
+	err := g.EachProduct(1, func(p model.Product) error {
+		return fmt.Errorf("stop")
+	})
+	assert.EqualError(t, err, "stop")
+}
+
+func TestGeneratorIsReproducible(t *testing.T) {
+	first := dump(t, NewGenerator(DefaultProfile(), 42), "mysql", 100)
+	assert.Equal(t, first, dump(t, NewGenerator(DefaultProfile(), 42), "mysql", 100))
+	assert.NotEqual(t, first, dump(t, NewGenerator(DefaultProfile(), 43), "mysql", 100))
+
+	ids := make(map[string]bool)
+	for _, p := range products(t, NewGenerator(DefaultProfile(), 42)) {
+		assert.False(t, ids[p.Id])
+		ids[p.Id] = true
+	}
+}
+
+func TestPrices(t *testing.T) {
+	distributions := []Distribution{
+		{Kind: DistributionUniform, Min: 10, Max: 20},
+		{Kind: DistributionNormal, Mean: 50, StdDev: 10, Min: 30, Max: 70},
+		{Kind: DistributionLognormal, Mean: 100, StdDev: 1, Min: 1, Max: 10000},
+	}
+	for _, d := range distributions {
+		g := NewGenerator(Profile{Categories: []CategoryProfile{{Title: "a", Products: intPtr(2001), Price: &d}}}, 1)
+		var prices []float64
+		for _, p := range products(t, g) {
+			price := float64(p.Price)
+			assert.True(t, price >= d.Min && price <= d.Max, "%s: %f", d.Kind, price)
+			prices = append(prices, price)
+		}
+		sort.Float64s(prices)
+		median := prices[len(prices)/2]
+		switch d.Kind {
+		case DistributionUniform:
+			assert.InDelta(t, 15, median, 1)
+		default:
+			assert.InDelta(t, d.Mean, median, d.Mean/10, d.Kind)
+		}
+	}
+}
+
+func TestDescriptions(t *testing.T) {
+	g := NewGenerator(Profile{Description: &Length{Min: 3, Max: 20},
+		Categories: []CategoryProfile{{Title: "a", Products: intPtr(200)}}}, 1)
+	lengths := make(map[int]bool)
+	for _, p := range products(t, g) {
+		words := len(strings.Fields(p.Description))
+		assert.True(t, words >= 3 && words <= 20, p.Description)
+		assert.True(t, strings.HasSuffix(p.Description, "."))
+		assert.Equal(t, strings.ToUpper(p.Description[:1]), p.Description[:1])
+		lengths[words] = true
+	}
+	assert.Len(t, lengths, 18)
+}
+
+func TestScale(t *testing.T) {
+	profile := Profile{Categories: []CategoryProfile{
+		{Title: "a", Products: intPtr(1)},
+		{Title: "b", Products: intPtr(1)},
+		{Title: "c", Products: intPtr(2)},
+		{Title: "d", Products: intPtr(0)},
+	}}
+	g := NewGenerator(profile, 1)
+	g.Scale(1001)
+	assert.Equal(t, 1001, g.Products())
+	counts := make(map[int]int)
+	for _, p := range products(t, g) {
+		counts[p.CategoryId]++
+	}
+	assert.Equal(t, map[int]int{1: 250, 2: 250, 3: 501}, counts)
+
+	g.Scale(0)
+	assert.Equal(t, 0, g.Products())
+	g.Scale(10)
+	assert.Equal(t, 0, g.Products())
+}
+
+func TestDumpWriter(t *testing.T) {
+	_, err := NewDumpWriter(&bytes.Buffer{}, "oracle")
+	assert.NotNil(t, err)
+
+	profile := Profile{Products: intPtr(5), Categories: []CategoryProfile{{Title: `Tom's \ tools`}}}
+	mysql := dump(t, NewGenerator(profile, 1), "mysql", 2)
+	assert.Equal(t, 4, strings.Count(mysql, "INSERT INTO"))
+	assert.Contains(t, mysql, "INSERT INTO category (id, title, pos, image_url) VALUES "+
+		`(1,'Tom''s \\ tools',1,'http://www.bestprice.gr/tom-s-tools.png');`)
+	assert.Contains(t, mysql, "INSERT INTO product (id, category_id, title, image_url, price, description) VALUES ")
+	assert.NotContains(t, mysql, "setval")
+
+	sqlite := dump(t, NewGenerator(profile, 1), "sqlite3", 2)
+	assert.Contains(t, sqlite, `'Tom''s \ tools'`)
+	postgres := dump(t, NewGenerator(profile, 1), "postgres", 2)
+	assert.True(t, strings.HasSuffix(postgres,
+		"SELECT setval(pg_get_serial_sequence('category', 'id'), (SELECT MAX(id) FROM category));\n"))
+}
+
+func openMigrated(t *testing.T) *services.AppDb {
+	db, err := services.Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewEmbedded(db.Conn.DB, db.Conn.DriverName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDbWriter(t *testing.T) {
+	db := openMigrated(t)
+	defer db.Conn.Close()
+	existing, err := db.AddCategory(model.Category{Title: "existing", ImageUrl: "http://example.com/e.png"}, nil)
+	assert.Nil(t, err)
+
+	g := NewGenerator(DefaultProfile(), 7)
+	var out bytes.Buffer
+	result, err := Seed(g, NewDbWriter(db.Conn, 4), 64, &Progress{Out: &out, Total: g.Products()})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, result.Categories)
+	assert.Equal(t, 1000, result.Products)
+	assert.Contains(t, out.String(), "1000/1000 products (100%)")
+
+	categories, err := db.GetCategories(0, 0, nil)
+	assert.Nil(t, err)
+	assert.Len(t, categories, 21)
+	products, err := db.GetProducts(0, 0, nil)
+	assert.Nil(t, err)
+	assert.Len(t, products, 1000)
+	// the categories were numbered after the one there, and the ones added later after them
+	expected := NewGenerator(DefaultProfile(), 7).Categories(existing + 1)
+	category, err := db.GetCategory(existing + 2)
+	assert.Nil(t, err)
+	assert.Equal(t, expected[1].Title, category.Title)
+	next, err := db.AddCategory(model.Category{Title: "next", ImageUrl: "http://example.com/n.png"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, existing+21, next)
+
+	// the dump of the same seed gives the same catalog
+	dumped := openMigrated(t)
+	defer dumped.Conn.Close()
+	for _, statement := range strings.SplitAfter(dump(t, NewGenerator(DefaultProfile(), 7), "sqlite3", 64), ";\n") {
+		if strings.TrimSpace(statement) != "" {
+			_, err := dumped.Conn.Exec(statement)
+			assert.Nil(t, err)
+		}
+	}
+	fromDump, err := dumped.GetProducts(0, 0, []model.Order{{Field: "title"}})
+	assert.Nil(t, err)
+	assert.Len(t, fromDump, 1000)
+	byId := make(map[string]model.Product)
+	for _, p := range products {
+		byId[p.Id] = p
+	}
+	for _, p := range fromDump {
+		if assert.Contains(t, byId, p.Id) {
+			assert.Equal(t, byId[p.Id].Title, p.Title)
+			assert.Equal(t, byId[p.Id].CategoryId, p.CategoryId+existing)
+		}
+	}
+
+	// a failing insert fails the seed
+	g = NewGenerator(DefaultProfile(), 7)
+	_, err = Seed(g, NewDbWriter(db.Conn, 2), 64, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,208 @@
+package seed
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Writer writes rows in multi-row inserts, to a database or to a SQL dump.
+type Writer interface {
+	// FirstCategoryId returns the id that the categories written should be numbered from.
+	FirstCategoryId() (int, error)
+	// Insert writes rows of the values of columns in table.
+	Insert(table string, columns []string, rows [][]interface{}) error
+	// Flush returns once every row inserted so far is written.
+	Flush() error
+	// Close flushes the writer, and brings the sequences of ids past the rows written.
+	Close() error
+}
+
+// dbWriter executes the inserts on workers connections at a time. Inserts return as soon as a worker takes them.
+type dbWriter struct {
+	db      *sqlx.DB
+	inserts chan insert
+	workers sync.WaitGroup
+	pending sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewDbWriter returns a writer that inserts into db, with workers inserts running at the same time.
+func NewDbWriter(db *sqlx.DB, workers int) Writer {
+	if workers < 1 {
+		workers = 1
+	}
+	w := &dbWriter{db: db, inserts: make(chan insert)}
+	for i := 0; i < workers; i++ {
+		w.workers.Add(1)
+		go w.work()
+	}
+	return w
+}
+
+type insert struct {
+	query string
+	args  []interface{}
+}
+
+func (w *dbWriter) work() {
+	defer w.workers.Done()
+	for i := range w.inserts {
+		if _, err := w.db.Exec(i.query, i.args...); err != nil {
+			w.fail(err)
+		}
+		w.pending.Done()
+	}
+}
+
+func (w *dbWriter) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *dbWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// FirstCategoryId numbers the categories after the ones in the database.
+func (w *dbWriter) FirstCategoryId() (int, error) {
+	var max int
+	err := w.db.Get(&max, "SELECT COALESCE(MAX(id), 0) FROM category")
+	return max + 1, err
+}
+
+func (w *dbWriter) Insert(table string, columns []string, rows [][]interface{}) error {
+	if err := w.failed(); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		values[i] = placeholders
+		args = append(args, row...)
+	}
+	w.pending.Add(1)
+	w.inserts <- insert{query: w.db.Rebind(insertInto(table, columns) + strings.Join(values, ",")), args: args}
+	return nil
+}
+
+func (w *dbWriter) Flush() error {
+	w.pending.Wait()
+	return w.failed()
+}
+
+func (w *dbWriter) Close() error {
+	close(w.inserts)
+	w.workers.Wait()
+	if err := w.failed(); err != nil {
+		return err
+	}
+	if q := resetSequence(w.db.DriverName()); q != "" {
+		_, err := w.db.Exec(q)
+		return err
+	}
+	return nil
+}
+
+// dumpWriter writes the inserts as SQL statements, for the database of driver.
+type dumpWriter struct {
+	w      *bufio.Writer
+	driver string
+}
+
+// NewDumpWriter returns a writer of a SQL dump for the database of driver: "mysql", "postgres" or "sqlite3". The dump
+// is meant for a database migrated but empty, and its categories are numbered from 1.
+func NewDumpWriter(w io.Writer, driver string) (Writer, error) {
+	switch driver {
+	case "mysql", "postgres", "sqlite3":
+		return &dumpWriter{w: bufio.NewWriter(w), driver: driver}, nil
+	}
+	return nil, fmt.Errorf("unknown dialect %q, expected mysql, postgres or sqlite3", driver)
+}
+
+func (d *dumpWriter) FirstCategoryId() (int, error) {
+	return 1, nil
+}
+
+func (d *dumpWriter) Insert(table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	_, _ = d.w.WriteString(insertInto(table, columns))
+	for i, row := range rows {
+		if i > 0 {
+			_, _ = d.w.WriteString(",\n")
+		}
+		_ = d.w.WriteByte('(')
+		for j, value := range row {
+			if j > 0 {
+				_ = d.w.WriteByte(',')
+			}
+			_, _ = d.w.WriteString(d.literal(value))
+		}
+		_ = d.w.WriteByte(')')
+	}
+	_, err := d.w.WriteString(";\n")
+	return err
+}
+
+// literal writes a value as SQL. Strings are quoted, with backslashes escaped for MySQL, which reads them as escapes.
+func (d *dumpWriter) literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		v = strings.Replace(v, "'", "''", -1)
+		if d.driver == "mysql" {
+			v = strings.Replace(v, `\`, `\\`, -1)
+		}
+		return "'" + v + "'"
+	case int:
+		return strconv.Itoa(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', 2, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	panic(fmt.Sprintf("seed: no SQL literal for %T", value))
+}
+
+func (d *dumpWriter) Flush() error {
+	return d.w.Flush()
+}
+
+func (d *dumpWriter) Close() error {
+	if q := resetSequence(d.driver); q != "" {
+		_, _ = d.w.WriteString(q + ";\n")
+	}
+	return d.w.Flush()
+}
+
+func insertInto(table string, columns []string) string {
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES "
+}
+
+// resetSequence returns the statement that makes the ids of the categories added later follow the ones inserted,
+// which were given. Only Postgres needs it: the other databases move their auto increments past inserted ids.
+func resetSequence(driver string) string {
+	if driver == "postgres" {
+		return "SELECT setval(pg_get_serial_sequence('category', 'id'), (SELECT MAX(id) FROM category))"
+	}
+	return ""
+}
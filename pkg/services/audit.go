@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// addAuditEntry records a write operation of actor, within the transaction of the operation itself.
+func addAuditEntry(tx *sqlx.Tx, actor *model.Actor, action string, entityType string, entityId string,
+	before interface{}, after interface{}) error {
+	if actor == nil {
+		return nil
+	}
+	diff, err := model.NewDiff(before, after)
+	if err != nil {
+		return err
+	}
+	q := `INSERT INTO audit_log (username, action, entity_type, entity_id, diff, request_id) VALUES (?,?,?,?,?,?)`
+	_, err = tx.Exec(tx.Rebind(q), actor.Username, action, entityType, entityId, diff, actor.RequestId)
+	return err
+}
+
+// auditChange is a single change recorded by addAuditEntries.
+type auditChange struct {
+	action   string
+	entityId string
+	before   interface{}
+	after    interface{}
+}
+
+// addAuditEntries records many write operations of actor on entities of the same type with a single statement.
+func addAuditEntries(tx *sqlx.Tx, actor *model.Actor, entityType string, changes []auditChange) error {
+	if actor == nil || len(changes) == 0 {
+		return nil
+	}
+	var values []string
+	var args []interface{}
+	for _, c := range changes {
+		diff, err := model.NewDiff(c.before, c.after)
+		if err != nil {
+			return err
+		}
+		values = append(values, "(?,?,?,?,?,?)")
+		args = append(args, actor.Username, c.action, entityType, c.entityId, diff, actor.RequestId)
+	}
+	q := `INSERT INTO audit_log (username, action, entity_type, entity_id, diff, request_id) VALUES ` +
+		strings.Join(values, ",")
+	_, err := tx.Exec(tx.Rebind(q), args...)
+	return err
+}
+
+func (a *AppDb) GetAuditLog(filter model.AuditFilter, offset int, limit int) ([]model.AuditEntry, error) {
+	var entries []model.AuditEntry
+	var conditions []string
+	var args []interface{}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type=?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityId != "" {
+		conditions = append(conditions, "entity_id=?")
+		args = append(args, filter.EntityId)
+	}
+	if filter.Username != "" {
+		conditions = append(conditions, "username=?")
+		args = append(args, filter.Username)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at>=?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at<=?")
+		args = append(args, filter.To.UTC())
+	}
+	q := "SELECT * FROM audit_log"
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	q += " ORDER BY id DESC"
+	if limit != 0 {
+		q += fmt.Sprintf(` LIMIT %d OFFSET %d `, limit, offset)
+	}
+	rows, err := a.Conn.Queryx(a.Conn.Rebind(q), args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry model.AuditEntry
+		err = rows.StructScan(&entry)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
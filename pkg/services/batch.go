@@ -0,0 +1,255 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// ErrBatchAborted is the result of the operations that were fine, but were not applied because others in the same
+// atomic batch failed.
+var ErrBatchAborted = apperr.Conflict(apperr.CodeBatchAborted, "Not applied, another operation of the batch failed")
+
+// errRollback makes inTx roll back a batch whose failures are already reported per operation.
+var errRollback = errors.New("rollback")
+
+// ProductOpResult is the outcome of a single operation of a batch. Product is the product as stored after a create or
+// an update, and Err is nil if the operation succeeded.
+type ProductOpResult struct {
+	Product model.Product
+	Err     error
+}
+
+// BatchProducts applies ops within a single transaction, using one multi-row statement per kind of operation. Every
+// op gets its own result. If atomic is true, a single failing op rolls back the whole batch, otherwise the ops that
+// can be applied are applied. The returned error is only set if the batch could not be run at all.
+func (a *AppDb) BatchProducts(ops []model.ProductOp, atomic bool, actor *model.Actor) ([]ProductOpResult, error) {
+	var results []ProductOpResult
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		results = make([]ProductOpResult, len(ops))
+		current, err := lockProducts(tx, ops)
+		if err != nil {
+			return err
+		}
+		var categoryIds []int
+		for _, op := range ops {
+			if op.Op == model.BatchOpCreate || op.Op == model.BatchOpUpdate {
+				categoryIds = append(categoryIds, op.Product.CategoryId)
+			}
+		}
+		categories, err := existingCategories(tx, categoryIds)
+		if err != nil {
+			return err
+		}
+
+		var creates, updates, deletes []int
+		changed := make(map[string]int)
+		for i, op := range ops {
+			switch op.Op {
+			case model.BatchOpCreate:
+				results[i].Err = checkCategory(categories, op.Product.CategoryId)
+				creates = append(creates, i)
+			case model.BatchOpUpdate, model.BatchOpDelete:
+				p, ok := current[op.Id]
+				if j, dup := changed[op.Id]; dup {
+					results[i].Err = apperr.Validation(apperr.CodeInvalidOperation,
+						fmt.Sprintf("Product %s is already changed by operation %d", op.Id, j))
+					continue
+				}
+				changed[op.Id] = i
+				if !ok {
+					results[i].Err = ErrProductNotFound
+				} else if op.Version != 0 && op.Version != p.Version {
+					results[i].Err = ErrVersionConflict
+				} else if op.Op == model.BatchOpUpdate {
+					results[i].Err = checkCategory(categories, op.Product.CategoryId)
+					updates = append(updates, i)
+				} else {
+					deletes = append(deletes, i)
+				}
+			default:
+				results[i].Err = apperr.Validation(apperr.CodeInvalidOperation,
+					fmt.Sprintf("Unknown operation %q, expected create, update or delete", op.Op))
+			}
+		}
+		if atomic && anyFailed(results) {
+			for i := range results {
+				if results[i].Err == nil {
+					results[i].Err = ErrBatchAborted
+				}
+			}
+			return errRollback
+		}
+		creates, updates, deletes = succeeded(results, creates), succeeded(results, updates), succeeded(results, deletes)
+
+		var audit []auditChange
+		var written []string
+		if len(creates) > 0 {
+			var values []string
+			var args []interface{}
+			for _, i := range creates {
+				p := ops[i].Product
+				p.Id = uuid.New().String()
+				values = append(values, "(?,?,?,?,?,?)")
+				args = append(args, p.Id, p.CategoryId, p.Title, p.ImageUrl, p.Price, p.Description)
+				audit = append(audit, auditChange{model.AuditActionCreate, p.Id, nil, p})
+				written = append(written, p.Id)
+				results[i].Product = p
+			}
+			q := `INSERT INTO product (id, category_id, title, image_url, price, description) VALUES ` +
+				strings.Join(values, ",")
+			if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+				return err
+			}
+		}
+		if len(updates) > 0 {
+			// the products are locked and known to exist, so the upsert only ever updates
+			var values []string
+			var args []interface{}
+			for _, i := range updates {
+				p := ops[i].Product
+				p.Id = ops[i].Id
+				values = append(values, "(?,?,?,?,?,?)")
+				args = append(args, p.Id, p.CategoryId, p.Title, p.ImageUrl, p.Price, p.Description)
+				audit = append(audit, auditChange{model.AuditActionUpdate, p.Id, current[p.Id], p})
+				written = append(written, p.Id)
+			}
+			q := `INSERT INTO product (id, category_id, title, image_url, price, description) VALUES ` +
+				strings.Join(values, ",") + upsertClause(tx, "product", "id", changedProductColumns, "")
+			if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+				return err
+			}
+		}
+		if len(deletes) > 0 {
+			var ids []string
+			for _, i := range deletes {
+				ids = append(ids, ops[i].Id)
+				audit = append(audit, auditChange{model.AuditActionDelete, ops[i].Id, current[ops[i].Id], nil})
+			}
+			q, args, err := sqlx.In(`UPDATE product SET deleted_at=CURRENT_TIMESTAMP, version=version+1 WHERE id IN (?)`,
+				ids)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+				return err
+			}
+		}
+		if err := addAuditEntries(tx, actor, model.AuditEntityProduct, audit); err != nil {
+			return err
+		}
+		if len(written) == 0 {
+			return nil
+		}
+
+		q, args, err := sqlx.In(`SELECT * FROM product WHERE id IN (?)`, written)
+		if err != nil {
+			return err
+		}
+		var stored []model.Product
+		if err := tx.Select(&stored, tx.Rebind(q), args...); err != nil {
+			return err
+		}
+		byId := make(map[string]model.Product)
+		for _, p := range stored {
+			byId[p.Id] = p
+		}
+		for _, i := range append(creates, updates...) {
+			id := ops[i].Id
+			if ops[i].Op == model.BatchOpCreate {
+				id = results[i].Product.Id
+			}
+			results[i].Product = byId[id]
+		}
+		return nil
+	})
+	if err == errRollback {
+		return results, nil
+	}
+	if err != nil {
+		return nil, dbError(err, nil)
+	}
+	return results, nil
+}
+
+// changedProductColumns are the columns of products that updates change
+var changedProductColumns = []string{"category_id", "title", "image_url", "price", "description"}
+
+// lockProducts selects for update the products that ops update or delete.
+func lockProducts(tx *sqlx.Tx, ops []model.ProductOp) (map[string]model.Product, error) {
+	current := make(map[string]model.Product)
+	var ids []string
+	for _, op := range ops {
+		if op.Op == model.BatchOpUpdate || op.Op == model.BatchOpDelete {
+			ids = append(ids, op.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return current, nil
+	}
+	q, args, err := sqlx.In(`SELECT * FROM product WHERE id IN (?) AND deleted_at IS NULL`+dialectOf(tx).forUpdate, ids)
+	if err != nil {
+		return nil, err
+	}
+	var products []model.Product
+	if err := tx.Select(&products, tx.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		current[p.Id] = p
+	}
+	return current, nil
+}
+
+// existingCategories returns which of the categories with the given ids exist.
+func existingCategories(tx *sqlx.Tx, ids []int) (map[int]bool, error) {
+	existing := make(map[int]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+	q, args, err := sqlx.In(`SELECT id FROM category WHERE id IN (?) AND deleted_at IS NULL`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var found []int
+	if err := tx.Select(&found, tx.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+func checkCategory(existing map[int]bool, id int) error {
+	if existing[id] {
+		return nil
+	}
+	return apperr.Validation(apperr.CodeInvalidReference, fmt.Sprintf("Category with id %d does not exist", id))
+}
+
+func anyFailed(results []ProductOpResult) bool {
+	for _, r := range results {
+		if r.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// succeeded filters indexes, keeping the ones whose result has no error so far.
+func succeeded(results []ProductOpResult, indexes []int) []int {
+	var ok []int
+	for _, i := range indexes {
+		if results[i].Err == nil {
+			ok = append(ok, i)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+var productColumns = []string{"id", "category_id", "title", "image_url", "price", "description", "created_at",
+	"updated_at", "version"}
+
+func (s *Suite) TestBatchProductsPartial() {
+	ops := []model.ProductOp{
+		{Op: model.BatchOpCreate, Product: model.Product{CategoryId: 3, Title: "new",
+			ImageUrl: "http://www.bestprice.gr/new.png", Price: 5}},
+		{Op: model.BatchOpDelete, Id: "abc"},
+		{Op: model.BatchOpDelete, Id: "missing"},
+	}
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE id IN (?, ?) AND deleted_at IS NULL FOR UPDATE")).
+		WithArgs("abc", "missing").WillReturnRows(sqlmock.NewRows(productColumns).AddRow(
+		"abc", 3, "old", "http://www.bestprice.gr/old.png", 1, "", time.Now(), time.Now(), 2))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM category WHERE id IN (?) AND deleted_at IS NULL")).
+		WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO product (id, category_id, title, image_url, price, description) VALUES (?,?,?,?,?,?)")).
+		WithArgs(sqlmock.AnyArg(), 3, "new", "http://www.bestprice.gr/new.png", float32(5), "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE product SET deleted_at=CURRENT_TIMESTAMP, version=version+1 WHERE id IN (?)")).
+		WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE id IN (?)")).
+		WillReturnRows(sqlmock.NewRows(productColumns).AddRow(
+			"new-id", 3, "new", "http://www.bestprice.gr/new.png", 5, "", time.Now(), time.Now(), 1))
+	s.dbMock.ExpectCommit()
+
+	results, err := s.appDb.BatchProducts(ops, false, nil)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), results, 3)
+	assert.Nil(s.T(), results[0].Err)
+	assert.Nil(s.T(), results[1].Err)
+	assert.Equal(s.T(), ErrProductNotFound, results[2].Err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestBatchProductsAtomicRollsBack() {
+	ops := []model.ProductOp{
+		{Op: model.BatchOpUpdate, Id: "abc", Version: 1, Product: model.Product{CategoryId: 3, Title: "new"}},
+		{Op: model.BatchOpCreate, Product: model.Product{CategoryId: 4, Title: "other"}},
+	}
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE id IN (?) AND deleted_at IS NULL FOR UPDATE")).
+		WithArgs("abc").WillReturnRows(sqlmock.NewRows(productColumns).AddRow(
+		"abc", 3, "old", "http://www.bestprice.gr/old.png", 1, "", time.Now(), time.Now(), 2))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM category WHERE id IN (?, ?) AND deleted_at IS NULL")).
+		WithArgs(3, 4).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	s.dbMock.ExpectRollback()
+
+	results, err := s.appDb.BatchProducts(ops, true, nil)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), ErrVersionConflict, results[0].Err)
+	assert.Equal(s.T(), ErrBatchAborted, results[1].Err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
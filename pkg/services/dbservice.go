@@ -1,20 +1,63 @@
 package services
 
-import "github.com/panospet/small-api/pkg/model"
+import (
+	"context"
+	"strings"
+	"time"
 
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// DbService is the storage used by the API. Write methods take the acting user, whose change is recorded in the
+// audit log within the same transaction. A nil actor skips the audit log, e.g. for populate scripts.
+// Deleting products and categories is a soft delete: they are kept in the trash until restored or purged.
+// Updates and deletes only succeed if the version given (in the entity for updates) is still the current one,
+// otherwise they return ErrVersionConflict. Version 0 skips this check.
+// Errors are typed (see package apperr), e.g. missing entities are apperr.KindNotFound errors.
 type DbService interface {
-	GetProducts(offset int, limit int, orderBy string, asc bool) ([]model.Product, error)
+	GetProducts(offset int, limit int, orderBy []model.Order) ([]model.Product, error)
 	GetProduct(id string) (model.Product, error)
-	AddProduct(product model.Product) (string, error)
-	UpdateProduct(product model.Product) error
-	DeleteProduct(id string) error
-	GetCategories(offset int, limit int, orderBy string, asc bool) ([]model.Category, error)
+	AddProduct(product model.Product, actor *model.Actor) (string, error)
+	UpdateProduct(product model.Product, actor *model.Actor) error
+	DeleteProduct(id string, version int, actor *model.Actor) error
+	BatchProducts(ops []model.ProductOp, atomic bool, actor *model.Actor) ([]ProductOpResult, error)
+	UpsertProducts(products []model.Product, actor *model.Actor, dryRun bool) ([]UpsertResult, error)
+	UpsertCategories(categories []model.Category, actor *model.Actor, dryRun bool) ([]UpsertResult, error)
+	GetCategories(offset int, limit int, orderBy []model.Order) ([]model.Category, error)
 	GetCategory(id int) (model.Category, error)
-	AddCategory(category model.Category) error
-	UpdateCategory(category model.Category) error
-	DeleteCategory(id int) error
+	AddCategory(category model.Category, actor *model.Actor) (int, error)
+	UpdateCategory(category model.Category, actor *model.Actor) error
+	// ReorderCategories moves the categories of ids to the top, in their order, and returns all categories by position
+	ReorderCategories(ids []int, actor *model.Actor) ([]model.Category, error)
+	DeleteCategory(id int, version int, actor *model.Actor) error
 	AddUser(user model.User) error
+	// UserExists tells if the credentials are the ones of a user who is not disabled
 	UserExists(username string, password string) bool
-	AllCategoriesToChan(catC chan model.Category) chan error
-	AllProductsToChan(prodC chan model.Product) chan error
-}
\ No newline at end of file
+	SetUserDisabled(username string, disabled bool) error
+	SetUserPassword(username string, password string) error
+	StreamProducts(ctx context.Context, filter model.StreamFilter, batchSize int, fn func([]model.Product) error) error
+	StreamCategories(ctx context.Context, filter model.StreamFilter, batchSize int,
+		fn func([]model.Category) error) error
+	GetAuditLog(filter model.AuditFilter, offset int, limit int) ([]model.AuditEntry, error)
+	RestoreProduct(id string, actor *model.Actor) error
+	RestoreCategory(id int, actor *model.Actor) error
+	GetTrash(entityType string, offset int, limit int) ([]model.TrashItem, error)
+	PurgeDeleted(before time.Time) (int64, error)
+}
+
+// NewDbService returns the DbService of url: the in memory one of NewMemoryDb for memory://, otherwise the database
+// opened by Open.
+func NewDbService(url string) (DbService, error) {
+	if strings.HasPrefix(url, "memory://") {
+		db, err := NewMemoryDb(url)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	db, err := Open(url)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -1,17 +1,34 @@
 package services
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/panospet/small-api/internal/passwd"
+	"github.com/panospet/small-api/pkg/apperr"
 	"github.com/panospet/small-api/pkg/model"
 	"math/rand"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// DbServiceMock keeps products and categories in memory and behaves like AppDb: deleted entities stay in the trash
+// with their DeletedAt set, and references between them are checked like the foreign keys of the database do.
+// It is safe for concurrent use, which makes it a backend for development as well as for tests, see NewMemoryDb.
+// Its fields are only meant to be used directly while no other goroutine uses it, e.g. to set up tests.
 type DbServiceMock struct {
 	Products   []model.Product
 	Categories []model.Category
+	AuditLog   []model.AuditEntry
+	// Users holds the users added, with their hashed passwords
+	Users []model.User
+
+	mu sync.RWMutex
 }
 
 func NewMockDb() *DbServiceMock {
@@ -23,110 +40,859 @@ func NewMockDb() *DbServiceMock {
 	}
 }
 
-func (s *DbServiceMock) GetProducts(offset int, limit int, orderBy string, asc bool) ([]model.Product, error) {
-	return s.Products, nil
+// NewMemoryDb returns a DbServiceMock for a url of the form memory://username:password@?sample=true. The user of the
+// url, if any, is added, and sample fills the catalog with the generated one of NewMockDb, otherwise it starts empty.
+// Everything is lost when the process exits, so it only suits development and tests.
+func NewMemoryDb(rawUrl string) (*DbServiceMock, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "memory" {
+		return nil, fmt.Errorf("unknown in memory database %s, expected memory://", u.Scheme)
+	}
+	db := &DbServiceMock{}
+	if sample := u.Query().Get("sample"); sample != "" {
+		generate, err := strconv.ParseBool(sample)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample %q, expected true or false", sample)
+		}
+		if generate {
+			db = NewMockDb()
+		}
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		if err := db.AddUser(model.User{Username: u.User.Username(), Password: password}); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (s *DbServiceMock) GetProducts(offset int, limit int, orderBy []model.Order) ([]model.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	products, err := s.listProducts(orderBy)
+	if err != nil {
+		return nil, err
+	}
+	from, to := pageOf(len(products), offset, limit)
+	return products[from:to], nil
+}
+
+// listProducts returns the products that are not deleted, joined with their category, in the given order.
+func (s *DbServiceMock) listProducts(orderBy []model.Order) ([]model.Product, error) {
+	var products []model.Product
+	for _, p := range s.Products {
+		if p.DeletedAt == nil {
+			products = append(products, s.joined(p))
+		}
+	}
+	return products, sortProducts(products, orderBy)
 }
 
 func (s *DbServiceMock) GetProduct(id string) (model.Product, error) {
-	return s.Products[0], nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.productIndex(id, false)
+	if i < 0 {
+		return model.Product{}, ErrProductNotFound
+	}
+	return s.joined(s.Products[i]), nil
 }
 
-func (s *DbServiceMock) AddProduct(product model.Product) (string, error) {
-	id := uuid.New().String()
-	product.Id = id
+func (s *DbServiceMock) AddProduct(product model.Product, actor *model.Actor) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// like the foreign key, which does not know about soft deletes
+	if s.categoryIndex(product.CategoryId, true) < 0 {
+		return "", missingCategory(product.CategoryId)
+	}
+	product.Id = uuid.New().String()
+	s.insertProduct(product, actor)
+	return product.Id, nil
+}
+
+func (s *DbServiceMock) insertProduct(product model.Product, actor *model.Actor) model.Product {
+	now := time.Now()
+	product.Version = 1
+	product.CreatedAt, product.UpdatedAt, product.DeletedAt = now, now, nil
+	product.Category = model.Category{}
 	s.Products = append(s.Products, product)
-	return id, nil
+	s.audit(actor, model.AuditActionCreate, model.AuditEntityProduct, product.Id, nil, product)
+	return product
 }
 
-func (s *DbServiceMock) UpdateProduct(product model.Product) error {
-	s.Products[0] = product
+func (s *DbServiceMock) UpdateProduct(product model.Product, actor *model.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.productIndex(product.Id, false)
+	if i < 0 {
+		return ErrProductNotFound
+	}
+	if product.Version != 0 && product.Version != s.Products[i].Version {
+		return ErrVersionConflict
+	}
+	if s.categoryIndex(product.CategoryId, true) < 0 {
+		return missingCategory(product.CategoryId)
+	}
+	s.updateProduct(i, product, actor)
 	return nil
 }
 
-func (s *DbServiceMock) DeleteProduct(id string) error {
-	index := 0
-	for i, p := range s.Products {
-		if p.Id == id {
-			index = i
-			break
-		}
+// updateProduct sets the columns that updates change of the product at index i to the ones of product, and bumps its
+// version.
+func (s *DbServiceMock) updateProduct(i int, product model.Product, actor *model.Actor) model.Product {
+	before := s.Products[i]
+	after := before
+	after.CategoryId = product.CategoryId
+	after.Title = product.Title
+	after.ImageUrl = product.ImageUrl
+	after.Price = product.Price
+	after.Description = product.Description
+	after.Version++
+	after.UpdatedAt = time.Now()
+	after.DeletedAt = nil
+	s.audit(actor, model.AuditActionUpdate, model.AuditEntityProduct, after.Id, before, after)
+	s.Products[i] = after
+	return after
+}
+
+func (s *DbServiceMock) DeleteProduct(id string, version int, actor *model.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.productIndex(id, false)
+	if i < 0 {
+		return ErrProductNotFound
 	}
-	if index == 0 {
-		return errors.New("product not found")
+	if version != 0 && version != s.Products[i].Version {
+		return ErrVersionConflict
 	}
-	removeProdFromSlice(s.Products, index)
+	s.deleteProduct(i, actor)
 	return nil
 }
 
-func (s *DbServiceMock) GetCategories(offset int, limit int, orderBy string, asc bool) ([]model.Category, error) {
-	return s.Categories, nil
+func (s *DbServiceMock) deleteProduct(i int, actor *model.Actor) {
+	s.audit(actor, model.AuditActionDelete, model.AuditEntityProduct, s.Products[i].Id, s.Products[i], nil)
+	now := time.Now()
+	s.Products[i].DeletedAt = &now
+	s.Products[i].Version++
 }
 
-func (s *DbServiceMock) GetCategory(id int) (model.Category, error) {
+// BatchProducts checks every op against the products as they were before the batch, like AppDb, and only then
+// applies the ones that can be applied.
+func (s *DbServiceMock) BatchProducts(ops []model.ProductOp, atomic bool, actor *model.Actor) ([]ProductOpResult,
+	error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]ProductOpResult, len(ops))
+	changed := make(map[string]int)
+	for i, op := range ops {
+		switch op.Op {
+		case model.BatchOpCreate:
+			results[i].Err = s.checkCategory(op.Product.CategoryId)
+		case model.BatchOpUpdate, model.BatchOpDelete:
+			if j, dup := changed[op.Id]; dup {
+				results[i].Err = apperr.Validation(apperr.CodeInvalidOperation,
+					fmt.Sprintf("Product %s is already changed by operation %d", op.Id, j))
+				continue
+			}
+			changed[op.Id] = i
+			j := s.productIndex(op.Id, false)
+			if j < 0 {
+				results[i].Err = ErrProductNotFound
+			} else if op.Version != 0 && op.Version != s.Products[j].Version {
+				results[i].Err = ErrVersionConflict
+			} else if op.Op == model.BatchOpUpdate {
+				results[i].Err = s.checkCategory(op.Product.CategoryId)
+			}
+		default:
+			results[i].Err = apperr.Validation(apperr.CodeInvalidOperation,
+				fmt.Sprintf("Unknown operation %q, expected create, update or delete", op.Op))
+		}
+	}
+	if atomic && anyFailed(results) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrBatchAborted
+			}
+		}
+		return results, nil
+	}
+	for i, op := range ops {
+		if results[i].Err != nil {
+			continue
+		}
+		switch op.Op {
+		case model.BatchOpCreate:
+			product := op.Product
+			product.Id = uuid.New().String()
+			results[i].Product = s.insertProduct(product, actor)
+		case model.BatchOpUpdate:
+			results[i].Product = s.updateProduct(s.productIndex(op.Id, false), op.Product, actor)
+		case model.BatchOpDelete:
+			s.deleteProduct(s.productIndex(op.Id, false), actor)
+		}
+	}
+	return results, nil
+}
+
+func (s *DbServiceMock) UpsertProducts(products []model.Product, actor *model.Actor, dryRun bool) ([]UpsertResult,
+	error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]UpsertResult, len(products))
+	seen := make(map[string]int)
+	for i, product := range products {
+		if product.Sku == nil || *product.Sku == "" {
+			results[i].Err = apperr.Validation(apperr.CodeInvalidValue, "Product has no sku")
+			continue
+		}
+		sku, key := *product.Sku, upsertKey(*product.Sku)
+		if j, ok := seen[key]; ok {
+			results[i].Err = apperr.Validation(apperr.CodeDuplicate,
+				fmt.Sprintf("Sku %s is used by product %d of the same batch", sku, j))
+			continue
+		}
+		seen[key] = i
+		if product.CategoryId == 0 && product.Category.ExternalId != nil {
+			j := s.categoryByExternalId(*product.Category.ExternalId, false)
+			if j < 0 {
+				results[i].Err = apperr.Validation(apperr.CodeInvalidReference,
+					fmt.Sprintf("Category with external id %s does not exist", *product.Category.ExternalId))
+				continue
+			}
+			product.CategoryId = s.Categories[j].Id
+		} else if err := s.checkCategory(product.CategoryId); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		j := -1
+		for k, p := range s.Products {
+			if p.Sku != nil && upsertKey(*p.Sku) == key {
+				j = k
+			}
+		}
+		if j < 0 {
+			product.Id = uuid.New().String()
+			results[i] = UpsertResult{Id: product.Id, Status: UpsertCreated}
+			if !dryRun {
+				s.insertProduct(product, actor)
+			}
+			continue
+		}
+		before := s.Products[j]
+		results[i] = UpsertResult{Id: before.Id, Status: UpsertUpdated}
+		if before.DeletedAt == nil && sameProduct(before, product) {
+			results[i].Status = UpsertUnchanged
+		} else if !dryRun {
+			s.updateProduct(j, product, actor)
+		}
+	}
+	return results, nil
+}
+
+func (s *DbServiceMock) UpsertCategories(categories []model.Category, actor *model.Actor, dryRun bool) ([]UpsertResult,
+	error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]UpsertResult, len(categories))
+	seen := make(map[string]int)
+	// ids that a dry run would have given to the categories it creates
+	nextId := s.nextCategoryId()
+	for i, category := range categories {
+		if category.ExternalId == nil || *category.ExternalId == "" {
+			results[i].Err = apperr.Validation(apperr.CodeInvalidValue, "Category has no external id")
+			continue
+		}
+		externalId, key := *category.ExternalId, upsertKey(*category.ExternalId)
+		if j, ok := seen[key]; ok {
+			results[i].Err = apperr.Validation(apperr.CodeDuplicate,
+				fmt.Sprintf("External id %s is used by category %d of the same batch", externalId, j))
+			continue
+		}
+		seen[key] = i
+
+		j := s.categoryByExternalId(externalId, true)
+		if j < 0 {
+			results[i].Status = UpsertCreated
+			if dryRun {
+				results[i].Id = strconv.Itoa(nextId)
+				nextId++
+			} else {
+				results[i].Id = strconv.Itoa(s.insertCategory(category, actor))
+			}
+			continue
+		}
+		before := s.Categories[j]
+		results[i] = UpsertResult{Id: strconv.Itoa(before.Id), Status: UpsertUpdated}
+		if before.DeletedAt == nil && sameCategory(before, category) {
+			results[i].Status = UpsertUnchanged
+		} else if !dryRun {
+			s.updateCategory(j, category, actor)
+		}
+	}
+	return results, nil
+}
+
+func (s *DbServiceMock) GetCategories(offset int, limit int, orderBy []model.Order) ([]model.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := checkOrder(orderBy, categoryOrderColumns); err != nil {
+		return nil, err
+	}
+	var categories []model.Category
 	for _, c := range s.Categories {
-		if c.Id == id {
-			return c, nil
+		if c.DeletedAt == nil {
+			categories = append(categories, c)
 		}
 	}
-	return model.Category{}, errors.New("product not found")
+	sort.SliceStable(categories, func(i, j int) bool {
+		return orderLess(orderBy, reflect.ValueOf(categories[i]), reflect.ValueOf(categories[j]))
+	})
+	from, to := pageOf(len(categories), offset, limit)
+	return categories[from:to], nil
+}
+
+func (s *DbServiceMock) GetCategory(id int) (model.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.categoryIndex(id, false)
+	if i < 0 {
+		return model.Category{}, ErrCategoryNotFound
+	}
+	return s.Categories[i], nil
+}
+
+func (s *DbServiceMock) AddCategory(category model.Category, actor *model.Actor) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertCategory(category, actor), nil
 }
 
-func (s *DbServiceMock) AddCategory(category model.Category) error {
-	category.Id = s.Categories[len(s.Categories)-1].Id + 1
+func (s *DbServiceMock) insertCategory(category model.Category, actor *model.Actor) int {
+	now := time.Now()
+	category.Id = s.nextCategoryId()
+	category.Version = 1
+	category.CreatedAt, category.UpdatedAt, category.DeletedAt = now, now, nil
 	s.Categories = append(s.Categories, category)
+	s.audit(actor, model.AuditActionCreate, model.AuditEntityCategory, strconv.Itoa(category.Id), nil, category)
+	return category.Id
+}
+
+// nextCategoryId returns the id of the next category added, which follows the ones of all categories, like the ids
+// given by the database.
+func (s *DbServiceMock) nextCategoryId() int {
+	id := 1
+	for _, c := range s.Categories {
+		if c.Id >= id {
+			id = c.Id + 1
+		}
+	}
+	return id
+}
+
+func (s *DbServiceMock) UpdateCategory(category model.Category, actor *model.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.categoryIndex(category.Id, false)
+	if i < 0 {
+		return ErrCategoryNotFound
+	}
+	if category.Version != 0 && category.Version != s.Categories[i].Version {
+		return ErrVersionConflict
+	}
+	s.updateCategory(i, category, actor)
 	return nil
 }
 
-func (s *DbServiceMock) UpdateCategory(category model.Category) error {
-	for i, c := range s.Categories {
-		if c.Id == category.Id {
-			s.Categories[i] = category
-			return nil
+func (s *DbServiceMock) ReorderCategories(ids []int, actor *model.Actor) ([]model.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.categoriesByPosition()
+	ordered, err := reorder(current, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range ordered {
+		if i := s.categoryIndex(c.Id, false); s.Categories[i].Position != c.Position {
+			s.updateCategory(i, c, actor)
 		}
 	}
-	return errors.New("category not found")
+	return s.categoriesByPosition(), nil
 }
 
-func (s *DbServiceMock) DeleteCategory(id int) error {
-	index := 0
-	for i, c := range s.Categories {
-		if c.Id == id {
-			index = i
-			break
+// categoriesByPosition returns the categories that are not deleted, by position.
+func (s *DbServiceMock) categoriesByPosition() []model.Category {
+	var categories []model.Category
+	for _, c := range s.Categories {
+		if c.DeletedAt == nil {
+			categories = append(categories, c)
 		}
 	}
-	if index == 0 {
-		return errors.New("category not found")
+	byPosition := []model.Order{{Field: "position", Asc: true}}
+	sort.SliceStable(categories, func(i, j int) bool {
+		return orderLess(byPosition, reflect.ValueOf(categories[i]), reflect.ValueOf(categories[j]))
+	})
+	return categories
+}
+
+// updateCategory is updateProduct for the category at index i.
+func (s *DbServiceMock) updateCategory(i int, category model.Category, actor *model.Actor) {
+	before := s.Categories[i]
+	after := before
+	after.Title = category.Title
+	after.Position = category.Position
+	after.ImageUrl = category.ImageUrl
+	after.Version++
+	after.UpdatedAt = time.Now()
+	after.DeletedAt = nil
+	s.audit(actor, model.AuditActionUpdate, model.AuditEntityCategory, strconv.Itoa(after.Id), before, after)
+	s.Categories[i] = after
+}
+
+func (s *DbServiceMock) DeleteCategory(id int, version int, actor *model.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.categoryIndex(id, false)
+	if i < 0 {
+		return ErrCategoryNotFound
 	}
-	removeCatFromSlice(s.Categories, index)
+	for _, p := range s.Products {
+		if p.CategoryId == id && p.DeletedAt == nil {
+			return ErrCategoryFkConflict
+		}
+	}
+	if version != 0 && version != s.Categories[i].Version {
+		return ErrVersionConflict
+	}
+	s.audit(actor, model.AuditActionDelete, model.AuditEntityCategory, strconv.Itoa(id), s.Categories[i], nil)
+	now := time.Now()
+	s.Categories[i].DeletedAt = &now
+	s.Categories[i].Version++
 	return nil
 }
 
 func (s *DbServiceMock) AddUser(user model.User) error {
-	return errors.New("method not implemented")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.Password = passwd.Hash([]byte(user.Password))
+	user.CreatedAt = time.Now()
+	s.Users = append(s.Users, user)
+	return nil
 }
 
 func (s *DbServiceMock) UserExists(username string, password string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.Users {
+		if u.Username == username && u.DisabledAt == nil {
+			return passwd.Authenticate(u.Password, []byte(password))
+		}
+	}
 	return false
 }
 
-func (s *DbServiceMock) AllCategoriesToChan(catC chan model.Category) chan error {
-	errC := make(chan error)
-	return errC
+func (s *DbServiceMock) SetUserDisabled(username string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateUser(username, func(u *model.User) {
+		u.DisabledAt = nil
+		if disabled {
+			now := time.Now()
+			u.DisabledAt = &now
+		}
+	})
+}
+
+func (s *DbServiceMock) SetUserPassword(username string, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateUser(username, func(u *model.User) {
+		u.Password = passwd.Hash([]byte(password))
+	})
 }
 
-func (s *DbServiceMock) AllProductsToChan(prodC chan model.Product) chan error {
-	errC := make(chan error)
-	return errC
+func (s *DbServiceMock) updateUser(username string, update func(u *model.User)) error {
+	for i := range s.Users {
+		if s.Users[i].Username == username {
+			update(&s.Users[i])
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// StreamProducts calls fn with batches of the products, like AppDb does. They are copied first, and fn is called
+// without the lock.
+func (s *DbServiceMock) StreamProducts(ctx context.Context, filter model.StreamFilter, batchSize int,
+	fn func([]model.Product) error) error {
+	s.mu.RLock()
+	var products []model.Product
+	for _, p := range s.Products {
+		if p.DeletedAt == nil && streamed(filter, p.CategoryId, p.UpdatedAt) {
+			products = append(products, s.joined(p))
+		}
+	}
+	s.mu.RUnlock()
+	if err := sortProducts(products, filter.OrderBy); err != nil {
+		return err
+	}
+	for _, batch := range batches(len(products), batchSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(products[batch[0]:batch[1]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DbServiceMock) StreamCategories(ctx context.Context, filter model.StreamFilter, batchSize int,
+	fn func([]model.Category) error) error {
+	s.mu.RLock()
+	var categories []model.Category
+	for _, c := range s.Categories {
+		if c.DeletedAt == nil && streamed(filter, c.Id, c.UpdatedAt) {
+			categories = append(categories, c)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Id < categories[j].Id
+	})
+	for _, batch := range batches(len(categories), batchSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(categories[batch[0]:batch[1]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamed tells if an entity of the given category, updated at updatedAt, matches filter.
+func streamed(filter model.StreamFilter, categoryId int, updatedAt time.Time) bool {
+	if !filter.UpdatedSince.IsZero() && updatedAt.Before(filter.UpdatedSince) {
+		return false
+	}
+	if len(filter.CategoryIds) == 0 {
+		return true
+	}
+	for _, id := range filter.CategoryIds {
+		if id == categoryId {
+			return true
+		}
+	}
+	return false
+}
+
+// batches returns the ranges of the batches of batchSize of n entities.
+func batches(n int, batchSize int) [][2]int {
+	batchSize = batchOf(batchSize)
+	var ranges [][2]int
+	for from := 0; from < n; from += batchSize {
+		to := from + batchSize
+		if to > n {
+			to = n
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+	return ranges
+}
+
+func (s *DbServiceMock) GetAuditLog(filter model.AuditFilter, offset int, limit int) ([]model.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []model.AuditEntry
+	for i := len(s.AuditLog) - 1; i >= 0; i-- {
+		e := s.AuditLog[i]
+		if (filter.EntityType != "" && e.EntityType != filter.EntityType) ||
+			(filter.EntityId != "" && e.EntityId != filter.EntityId) ||
+			(filter.Username != "" && e.Username != filter.Username) ||
+			(!filter.From.IsZero() && e.CreatedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && e.CreatedAt.After(filter.To)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	from, to := pageOf(len(entries), offset, limit)
+	return entries[from:to], nil
+}
+
+func (s *DbServiceMock) RestoreProduct(id string, actor *model.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.productIndex(id, true)
+	if i < 0 || s.Products[i].DeletedAt == nil {
+		return apperr.NotFound("Product not found in trash")
+	}
+	if c := s.categoryIndex(s.Products[i].CategoryId, true); c >= 0 && s.Categories[c].DeletedAt != nil {
+		return ErrCategoryDeleted
+	}
+	s.Products[i].DeletedAt = nil
+	s.Products[i].Version++
+	s.audit(actor, model.AuditActionRestore, model.AuditEntityProduct, id, nil, s.Products[i])
+	return nil
+}
+
+func (s *DbServiceMock) RestoreCategory(id int, actor *model.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.categoryIndex(id, true)
+	if i < 0 || s.Categories[i].DeletedAt == nil {
+		return apperr.NotFound("Category not found in trash")
+	}
+	s.Categories[i].DeletedAt = nil
+	s.Categories[i].Version++
+	s.audit(actor, model.AuditActionRestore, model.AuditEntityCategory, strconv.Itoa(id), nil, s.Categories[i])
+	return nil
+}
+
+// GetTrash lists soft deleted products and categories, most recently deleted first, like AppDb.
+func (s *DbServiceMock) GetTrash(entityType string, offset int, limit int) ([]model.TrashItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []model.TrashItem
+	if entityType == "" || entityType == model.AuditEntityProduct {
+		for _, p := range s.Products {
+			if p.DeletedAt != nil {
+				items = append(items, model.TrashItem{EntityType: model.AuditEntityProduct, EntityId: p.Id,
+					Title: p.Title, DeletedAt: *p.DeletedAt})
+			}
+		}
+	}
+	if entityType == "" || entityType == model.AuditEntityCategory {
+		for _, c := range s.Categories {
+			if c.DeletedAt != nil {
+				items = append(items, model.TrashItem{EntityType: model.AuditEntityCategory,
+					EntityId: strconv.Itoa(c.Id), Title: c.Title, DeletedAt: *c.DeletedAt})
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	from, to := pageOf(len(items), offset, limit)
+	return items[from:to], nil
+}
+
+// PurgeDeleted keeps the deleted categories that products still refer to, even deleted ones, like the foreign key.
+func (s *DbServiceMock) PurgeDeleted(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var purged int64
+	var products []model.Product
+	for _, p := range s.Products {
+		if p.DeletedAt != nil && p.DeletedAt.Before(before) {
+			purged++
+			continue
+		}
+		products = append(products, p)
+	}
+	s.Products = products
+	var categories []model.Category
+	for _, c := range s.Categories {
+		if c.DeletedAt != nil && c.DeletedAt.Before(before) && !s.categoryUsed(c.Id) {
+			purged++
+			continue
+		}
+		categories = append(categories, c)
+	}
+	s.Categories = categories
+	return purged, nil
+}
+
+func (s *DbServiceMock) categoryUsed(id int) bool {
+	for _, p := range s.Products {
+		if p.CategoryId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// productIndex returns the index of the product with id in Products, -1 if there is none. Deleted products are only
+// found if withDeleted is true.
+func (s *DbServiceMock) productIndex(id string, withDeleted bool) int {
+	for i, p := range s.Products {
+		if p.Id == id && (withDeleted || p.DeletedAt == nil) {
+			return i
+		}
+	}
+	return -1
+}
+
+// categoryIndex is productIndex for categories.
+func (s *DbServiceMock) categoryIndex(id int, withDeleted bool) int {
+	for i, c := range s.Categories {
+		if c.Id == id && (withDeleted || c.DeletedAt == nil) {
+			return i
+		}
+	}
+	return -1
+}
+
+// categoryByExternalId is categoryIndex by the external id of categories, compared regardless of case.
+func (s *DbServiceMock) categoryByExternalId(externalId string, withDeleted bool) int {
+	for i, c := range s.Categories {
+		if c.ExternalId != nil && upsertKey(*c.ExternalId) == upsertKey(externalId) &&
+			(withDeleted || c.DeletedAt == nil) {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkCategory returns the error of writing a product in the category with id, if it does not exist or is deleted.
+func (s *DbServiceMock) checkCategory(id int) error {
+	return checkCategory(map[int]bool{id: s.categoryIndex(id, false) >= 0}, id)
+}
+
+// joined returns p along its category, which may be deleted, like the join of the products query.
+func (s *DbServiceMock) joined(p model.Product) model.Product {
+	if i := s.categoryIndex(p.CategoryId, true); i >= 0 {
+		p.Category = s.Categories[i]
+	}
+	return p
+}
+
+func missingCategory(id int) error {
+	return apperr.Validation(apperr.CodeInvalidReference, fmt.Sprintf("Category with id %d does not exist", id))
+}
+
+// pageOf returns the range of a listing of n entities that offset and limit select. Like in the queries, offset is
+// only used along a limit.
+func pageOf(n int, offset int, limit int) (int, int) {
+	if limit == 0 {
+		return 0, n
+	}
+	if offset > n {
+		offset = n
+	}
+	if offset+limit > n {
+		return offset, n
+	}
+	return offset, offset + limit
+}
+
+func (s *DbServiceMock) audit(actor *model.Actor, action string, entityType string, entityId string,
+	before interface{}, after interface{}) {
+	if actor == nil {
+		return
+	}
+	diff, _ := model.NewDiff(before, after)
+	s.AuditLog = append(s.AuditLog, model.AuditEntry{
+		Id:         int64(len(s.AuditLog) + 1),
+		Username:   actor.Username,
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Diff:       diff,
+		RequestId:  actor.RequestId,
+		CreatedAt:  time.Now(),
+	})
 }
 
 var possibleCategories = []string{"sports", "house", "garden", "electronics", "games", "food", "drinks", "furniture",
 	"space", "mobile", "movies", "tv", "pc", "books", "groceries", "devices", "music", "instruments"}
 
+// sortProducts sorts products, joined with their category, like the products query does.
+func sortProducts(products []model.Product, orderBy []model.Order) error {
+	if err := checkOrder(orderBy, productOrderColumns); err != nil {
+		return err
+	}
+	sort.SliceStable(products, func(i, j int) bool {
+		return orderLess(orderBy, reflect.ValueOf(products[i]), reflect.ValueOf(products[j]))
+	})
+	return nil
+}
+
+// orderLess reports whether entity a comes before entity b in the given order, followed by the id ascending.
+func orderLess(orderBy []model.Order, a reflect.Value, b reflect.Value) bool {
+	for _, o := range append(orderBy, model.Order{Field: "id", Asc: true}) {
+		c := compareValues(orderValue(a, o.Field), orderValue(b, o.Field))
+		if c != 0 {
+			return (c < 0) == o.Asc
+		}
+	}
+	return false
+}
+
+// orderValue returns the field of an entity with the given json name. Products are ordered by the position and
+// the title of their category as well.
+func orderValue(v reflect.Value, field string) interface{} {
+	switch field {
+	case "position":
+		if c := v.FieldByName("Category"); c.IsValid() {
+			return c.FieldByName("Position").Interface()
+		}
+	case "category.title":
+		return v.FieldByName("Category").FieldByName("Title").Interface()
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name == field {
+			return v.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+// compareValues returns -1, 0 or 1 as a is less than, equal to or greater than b, which have the same type.
+func compareValues(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareFloats(float64(a), float64(b.(int)))
+	case float32:
+		return compareFloats(float64(a), float64(b.(float32)))
+	case string:
+		return strings.Compare(a, b.(string))
+	case *string:
+		var x, y string
+		if a != nil {
+			x = *a
+		}
+		if b := b.(*string); b != nil {
+			y = *b
+		}
+		return strings.Compare(x, y)
+	case time.Time:
+		switch bt := b.(time.Time); {
+		case a.Before(bt):
+			return -1
+		case a.After(bt):
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// generateProducts returns the sample products, product0 to product199 in the order of their ids, which is the
+// order they are listed in.
 func generateProducts() []model.Product {
+	ids := make([]string, 200)
+	for i := range ids {
+		ids[i] = uuid.New().String()
+	}
+	sort.Strings(ids)
 	var products []model.Product
-	for i := 0; i < 200; i++ {
-		products = append(products, generateProduct(i))
+	for i, id := range ids {
+		products = append(products, generateProduct(i, id))
 	}
 	return products
 }
@@ -139,6 +905,7 @@ func generateCategories() []model.Category {
 			Title:     possibleCategories[i],
 			Position:  i,
 			ImageUrl:  fmt.Sprintf("http://www.bestprice.gr/cat%d.png", i),
+			Version:   1,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		})
@@ -146,26 +913,19 @@ func generateCategories() []model.Category {
 	return categories
 }
 
-func generateProduct(i int) model.Product {
-	id := uuid.New().String()
+func generateProduct(i int, id string) model.Product {
 	rand.Seed(time.Now().UnixNano())
+	// category ids are 0 to len(possibleCategories)-1, and 0 is not a valid category id
 	return model.Product{
 		Id:          id,
-		CategoryId:  rand.Intn(len(possibleCategories)) + 1,
+		CategoryId:  rand.Intn(len(possibleCategories)-1) + 1,
 		Title:       fmt.Sprintf("product%d", i),
 		ImageUrl:    fmt.Sprintf("http://www.bestprice.gr/product%d.png", i),
 		Price:       float32(rand.Intn(200)) + rand.Float32(),
 		Description: fmt.Sprintf("Description product %d", i),
+		Version:     1,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 		Category:    model.Category{},
 	}
 }
-
-func removeProdFromSlice(slice []model.Product, s int) []model.Product {
-	return append(slice[:s], slice[s+1:]...)
-}
-
-func removeCatFromSlice(slice []model.Category, s int) []model.Category {
-	return append(slice[:s], slice[s+1:]...)
-}
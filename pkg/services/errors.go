@@ -0,0 +1,121 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/panospet/small-api/pkg/apperr"
+)
+
+var (
+	ErrProductNotFound  = apperr.NotFound("Product not found")
+	ErrCategoryNotFound = apperr.NotFound("Category not found")
+	ErrUserNotFound     = apperr.NotFound("User not found")
+	ErrVersionConflict  = apperr.Conflict(apperr.CodeVersionConflict,
+		"The entity was modified in the meantime, version does not match")
+	ErrCategoryFkConflict = apperr.Conflict(apperr.CodeCategoryInUse,
+		"Cannot delete category, there are products that use this category_id")
+	ErrCategoryDeleted = apperr.Conflict(apperr.CodeCategoryDeleted,
+		"Cannot restore product, its category is deleted")
+)
+
+// MySQL error numbers, see https://dev.mysql.com/doc/mysql-errors/5.7/en/server-error-reference.html
+const (
+	mysqlErrBadNull         = 1048
+	mysqlErrDupEntry        = 1062
+	mysqlErrOutOfRange      = 1264
+	mysqlErrIncorrectValue  = 1366
+	mysqlErrDataTooLong     = 1406
+	mysqlErrRowIsReferenced = 1451
+	mysqlErrNoReferencedRow = 1452
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqErrStringDataRightTruncation = "22001"
+	pqErrNumericValueOutOfRange    = "22003"
+	pqErrInvalidTextRepresentation = "22P02"
+	pqErrNotNullViolation          = "23502"
+	pqErrForeignKeyViolation       = "23503"
+	pqErrUniqueViolation           = "23505"
+)
+
+// kinds of errors of the database that dbError turns into typed ones
+const (
+	errDuplicate = iota + 1
+	errReferenced
+	errNoReferencedRow
+	errInvalidValue
+)
+
+// dbError turns an error of the database into a typed one. sql.ErrNoRows becomes notFound, if given.
+func dbError(err error, notFound error) error {
+	if err == nil {
+		return nil
+	}
+	if notFound != nil && errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	switch errorKind(err) {
+	case errDuplicate:
+		return apperr.Wrap(err, apperr.KindConflict, apperr.CodeDuplicate, "An entity with the same key already exists")
+	case errReferenced:
+		return apperr.Wrap(err, apperr.KindConflict, apperr.CodeReferenced, "The entity is still referenced")
+	case errNoReferencedRow:
+		return apperr.Wrap(err, apperr.KindValidation, apperr.CodeInvalidReference,
+			"A referenced entity does not exist")
+	case errInvalidValue:
+		return apperr.Wrap(err, apperr.KindValidation, apperr.CodeInvalidValue, "A value does not fit its field")
+	}
+	return err
+}
+
+// errorKind tells the kind of an error of MySQL, Postgres or SQLite, 0 if it is none of the ones of dbError.
+func errorKind(err error) int {
+	var mysqlErr *mysql.MySQLError
+	var pqErr *pq.Error
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case mysqlErrDupEntry:
+			return errDuplicate
+		case mysqlErrRowIsReferenced:
+			return errReferenced
+		case mysqlErrNoReferencedRow:
+			return errNoReferencedRow
+		case mysqlErrBadNull, mysqlErrOutOfRange, mysqlErrIncorrectValue, mysqlErrDataTooLong:
+			return errInvalidValue
+		}
+	case errors.As(err, &pqErr):
+		switch pqErr.Code {
+		case pqErrUniqueViolation:
+			return errDuplicate
+		// Postgres does not tell apart deleting a referenced row from referencing a missing one
+		case pqErrForeignKeyViolation:
+			if strings.HasPrefix(strings.ToUpper(pqErr.Message), "UPDATE OR DELETE") {
+				return errReferenced
+			}
+			return errNoReferencedRow
+		case pqErrNotNullViolation, pqErrStringDataRightTruncation, pqErrNumericValueOutOfRange,
+			pqErrInvalidTextRepresentation:
+			return errInvalidValue
+		}
+	case errors.As(err, &sqliteErr):
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return errDuplicate
+		// nor does SQLite, but deletes are soft, so only inserts and updates can fail on a foreign key
+		case sqlite3.ErrConstraintForeignKey:
+			return errNoReferencedRow
+		case sqlite3.ErrConstraintNotNull:
+			return errInvalidValue
+		}
+	}
+	return 0
+}
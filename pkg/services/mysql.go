@@ -1,10 +1,9 @@
 package services
 
 import (
+	"database/sql"
 	"fmt"
-	"regexp"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
@@ -12,10 +11,12 @@ import (
 	"github.com/panospet/small-api/pkg/model"
 )
 
+// AppDb is the DbService of MySQL, PostgreSQL and SQLite databases, see Open.
 type AppDb struct {
 	Conn *sqlx.DB
 }
 
+// NewDb connects to MySQL.
 func NewDb(mysqlPath string) (*AppDb, error) {
 	db, err := sqlx.Connect("mysql", mysqlPath)
 	if err != nil {
@@ -24,124 +25,205 @@ func NewDb(mysqlPath string) (*AppDb, error) {
 	return &AppDb{Conn: db}, nil
 }
 
-var valid = regexp.MustCompile("^[A-Za-z0-9_]+$")
+// inTx runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise.
+func (a *AppDb) inTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := a.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-func (a *AppDb) GetProducts(offset int, limit int, orderBy string, asc bool) ([]model.Product, error) {
-	var products []model.Product
-	q := `SELECT
-      product.*,
-      cat.id "cat.id",
-      cat.title "cat.title",
-      cat.pos "cat.pos",
-      cat.image_url "cat.image_url",
-      cat.created_at "cat.created_at",
-      cat.updated_at "cat.updated_at"
-    FROM
-      product JOIN category cat ON product.category_id = cat.id`
-	sort := "desc"
-	if asc == true {
-		sort = "asc"
+// execOne executes a statement that is expected to affect exactly one row, returning sql.ErrNoRows otherwise.
+func execOne(tx *sqlx.Tx, q string, args ...interface{}) error {
+	res, err := tx.Exec(tx.Rebind(q), args...)
+	if err != nil {
+		return err
 	}
-	if orderBy == "position" {
-		q += fmt.Sprintf(` ORDER BY cat.pos %s`, sort)
-	} else if len(orderBy) > 0 {
-		if !valid.MatchString(orderBy) {
-			return products, &ErrSqlInjectionAttempt{}
-		}
-		q += fmt.Sprintf(` ORDER BY %s %s`, orderBy, sort)
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
-	if limit != 0 {
-		q += fmt.Sprintf(` LIMIT %d OFFSET %d `, limit, offset)
+	if affected == 0 {
+		return sql.ErrNoRows
 	}
-	rows, err := a.Conn.Queryx(q)
+	return nil
+}
+
+// versionConflictOrNotFound tells why a versioned write on table did not affect any row: either the row does not
+// exist (sql.ErrNoRows, turned into a not found error by dbError), or it was changed in the meantime
+// (ErrVersionConflict).
+func versionConflictOrNotFound(tx *sqlx.Tx, table string, id interface{}) error {
+	var exists int
+	q := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id=? AND deleted_at IS NULL", table)
+	err := tx.Get(&exists, tx.Rebind(q), id)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	return ErrVersionConflict
+}
+
+// selectForUpdate selects the row of table that matches where, and locks it until the end of the transaction.
+func selectForUpdate(tx *sqlx.Tx, dest interface{}, table string, where string, args ...interface{}) error {
+	q := fmt.Sprintf("SELECT * FROM %s WHERE %s", table, where) + dialectOf(tx).forUpdate
+	return tx.QueryRowx(tx.Rebind(q), args...).StructScan(dest)
+}
+
+func (a *AppDb) GetProducts(offset int, limit int, orderBy []model.Order) ([]model.Product, error) {
+	var products []model.Product
+	q, err := productsQuery(offset, limit, orderBy)
 	if err != nil {
 		return products, err
 	}
+	rows, err := a.Conn.Queryx(q)
+	if err != nil {
+		return products, dbError(err, nil)
+	}
 	for rows.Next() {
 		var p model.Product
 		err = rows.StructScan(&p)
 		if err != nil {
-			return products, err
+			return products, dbError(err, nil)
 		}
 		products = append(products, p)
 	}
 	return products, nil
 }
 
-func (a *AppDb) GetProduct(id string) (model.Product, error) {
-	q := `SELECT
+// productSelect selects products joined with their category, whose columns are prefixed with "cat.".
+const productSelect = `SELECT
       product.*,
       cat.id "cat.id",
+      cat.external_id "cat.external_id",
       cat.title "cat.title",
       cat.pos "cat.pos",
       cat.image_url "cat.image_url",
       cat.created_at "cat.created_at",
-      cat.updated_at "cat.updated_at"
+      cat.updated_at "cat.updated_at",
+      cat.version "cat.version",
+      cat.deleted_at "cat.deleted_at"
     FROM
-      product JOIN category cat ON product.category_id = cat.id WHERE product.id=?`
+      product JOIN category cat ON product.category_id = cat.id`
+
+// productsQuery selects the products that are not deleted, joined with their category, in the order and the range
+// of the listing.
+func productsQuery(offset int, limit int, orderBy []model.Order) (string, error) {
+	q := productSelect + `
+    WHERE product.deleted_at IS NULL`
+	order, err := orderByClause(orderBy, productOrderColumns)
+	if err != nil {
+		return "", err
+	}
+	q += order
+	if limit != 0 {
+		q += fmt.Sprintf(` LIMIT %d OFFSET %d `, limit, offset)
+	}
+	return q, nil
+}
+
+func (a *AppDb) GetProduct(id string) (model.Product, error) {
+	q := productSelect + ` WHERE product.id=? AND product.deleted_at IS NULL`
 	var product model.Product
-	err := a.Conn.QueryRowx(q, id).StructScan(&product)
+	err := a.Conn.QueryRowx(a.Conn.Rebind(q), id).StructScan(&product)
 	if err != nil {
-		return model.Product{}, err
+		return model.Product{}, dbError(err, ErrProductNotFound)
 	}
 	return product, nil
 }
 
-func (a *AppDb) AddProduct(product model.Product) (string, error) {
+func (a *AppDb) AddProduct(product model.Product, actor *model.Actor) (string, error) {
 	id := uuid.New().String()
 	product.Id = id
-	q := `INSERT INTO product (id, category_id, title, image_url, price, description) VALUES (?,?,?,?,?,?);`
-	_, err := a.Conn.Exec(q, product.Id, product.CategoryId, product.Title, product.ImageUrl, product.Price, product.Description)
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		q := `INSERT INTO product (id, category_id, title, image_url, price, description) VALUES (?,?,?,?,?,?)`
+		_, err := tx.Exec(tx.Rebind(q), product.Id, product.CategoryId, product.Title, product.ImageUrl, product.Price,
+			product.Description)
+		if err != nil {
+			return err
+		}
+		return addAuditEntry(tx, actor, model.AuditActionCreate, model.AuditEntityProduct, id, nil, product)
+	})
 	if err != nil {
-		return "", err
+		return "", dbError(err, nil)
 	}
-	return id, err
+	return id, nil
 }
 
-func (a *AppDb) UpdateProduct(product model.Product) error {
-	q := `UPDATE product SET category_id=?, title=?, image_url=?, price=?, description=?, updated_at=NOW() WHERE id=?`
-	_, err := a.Conn.Exec(q, product.CategoryId, product.Title, product.ImageUrl, product.Price, product.Description, product.Id)
-	if err != nil {
-		return err
-	}
-	return nil
+func (a *AppDb) UpdateProduct(product model.Product, actor *model.Actor) error {
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var before model.Product
+		if actor != nil {
+			err := selectForUpdate(tx, &before, "product", "id=? AND deleted_at IS NULL", product.Id)
+			if err != nil {
+				return err
+			}
+		}
+		q := `UPDATE product SET category_id=?, title=?, image_url=?, price=?, description=?, version=version+1,
+      updated_at=CURRENT_TIMESTAMP WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)`
+		err := execOne(tx, q, product.CategoryId, product.Title, product.ImageUrl, product.Price, product.Description,
+			product.Id, product.Version, product.Version)
+		if err == sql.ErrNoRows {
+			return versionConflictOrNotFound(tx, "product", product.Id)
+		}
+		if err != nil {
+			return err
+		}
+		return addAuditEntry(tx, actor, model.AuditActionUpdate, model.AuditEntityProduct, product.Id, before, product)
+	})
+	return dbError(err, ErrProductNotFound)
 }
 
-func (a *AppDb) DeleteProduct(id string) error {
-	q := `DELETE FROM product WHERE id=?`
-	_, err := a.Conn.Exec(q, id)
-	if err != nil {
-		return err
-	}
-	return nil
+func (a *AppDb) DeleteProduct(id string, version int, actor *model.Actor) error {
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var before model.Product
+		if actor != nil {
+			err := selectForUpdate(tx, &before, "product", "id=? AND deleted_at IS NULL", id)
+			if err != nil {
+				return err
+			}
+		}
+		q := `UPDATE product SET deleted_at=CURRENT_TIMESTAMP, version=version+1
+      WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)`
+		err := execOne(tx, q, id, version, version)
+		if err == sql.ErrNoRows {
+			return versionConflictOrNotFound(tx, "product", id)
+		}
+		if err != nil {
+			return err
+		}
+		return addAuditEntry(tx, actor, model.AuditActionDelete, model.AuditEntityProduct, id, before, nil)
+	})
+	return dbError(err, ErrProductNotFound)
 }
 
-func (a *AppDb) GetCategories(offset int, limit int, orderBy string, asc bool) ([]model.Category, error) {
+func (a *AppDb) GetCategories(offset int, limit int, orderBy []model.Order) ([]model.Category, error) {
 	var categories []model.Category
 	var args []interface{}
-	q := "SELECT * FROM category"
-	if len(orderBy) > 0 {
-		if !valid.MatchString(orderBy) {
-			return categories, &ErrSqlInjectionAttempt{}
-		}
-		sort := "desc"
-		if asc == true {
-			sort = "asc"
-		}
-		q += fmt.Sprintf(` ORDER BY %s %s`, orderBy, sort)
+	q := "SELECT * FROM category WHERE deleted_at IS NULL"
+	order, err := orderByClause(orderBy, categoryOrderColumns)
+	if err != nil {
+		return categories, err
 	}
+	q += order
 	if limit != 0 {
 		q += fmt.Sprintf(` LIMIT %d OFFSET %d `, limit, offset)
 	}
 	rows, err := a.Conn.Queryx(q, args...)
 	if err != nil {
-		return categories, err
+		return categories, dbError(err, nil)
 	}
 	for rows.Next() {
 		var cat model.Category
 		err = rows.StructScan(&cat)
 		if err != nil {
-			return categories, err
+			return categories, dbError(err, nil)
 		}
 		categories = append(categories, cat)
 	}
@@ -150,110 +232,155 @@ func (a *AppDb) GetCategories(offset int, limit int, orderBy string, asc bool) (
 
 func (a *AppDb) GetCategory(id int) (model.Category, error) {
 	var category model.Category
-	err := a.Conn.QueryRowx("SELECT * FROM category WHERE id=?", id).StructScan(&category)
+	q := a.Conn.Rebind("SELECT * FROM category WHERE id=? AND deleted_at IS NULL")
+	err := a.Conn.QueryRowx(q, id).StructScan(&category)
 	if err != nil {
-		return model.Category{}, err
+		return model.Category{}, dbError(err, ErrCategoryNotFound)
 	}
 	return category, nil
 }
 
-func (a *AppDb) AddCategory(category model.Category) error {
-	q := `INSERT INTO category (title, pos, image_url) VALUES (?,?,?);`
-	_, err := a.Conn.Exec(q, category.Title, category.Position, category.ImageUrl)
+func (a *AppDb) AddCategory(category model.Category, actor *model.Actor) (int, error) {
+	var id int64
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		q := `INSERT INTO category (title, pos, image_url) VALUES (?,?,?)`
+		var err error
+		id, err = insertId(tx, q, category.Title, category.Position, category.ImageUrl)
+		if err != nil {
+			return err
+		}
+		category.Id = int(id)
+		return addAuditEntry(tx, actor, model.AuditActionCreate, model.AuditEntityCategory, fmt.Sprintf("%d", id),
+			nil, category)
+	})
 	if err != nil {
-		return err
+		return 0, dbError(err, nil)
 	}
-	return nil
+	return int(id), nil
 }
 
-func (a *AppDb) UpdateCategory(category model.Category) error {
-	q := `UPDATE category SET title=?, pos=?, image_url=?, updated_at=NOW() WHERE id=?`
-	_, err := a.Conn.Exec(q, category.Title, category.Position, category.ImageUrl, category.Id)
-	if err != nil {
-		return err
-	}
-	return nil
+func (a *AppDb) UpdateCategory(category model.Category, actor *model.Actor) error {
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var before model.Category
+		if actor != nil {
+			err := selectForUpdate(tx, &before, "category", "id=? AND deleted_at IS NULL", category.Id)
+			if err != nil {
+				return err
+			}
+		}
+		q := `UPDATE category SET title=?, pos=?, image_url=?, version=version+1, updated_at=CURRENT_TIMESTAMP
+      WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)`
+		err := execOne(tx, q, category.Title, category.Position, category.ImageUrl, category.Id, category.Version,
+			category.Version)
+		if err == sql.ErrNoRows {
+			return versionConflictOrNotFound(tx, "category", category.Id)
+		}
+		if err != nil {
+			return err
+		}
+		return addAuditEntry(tx, actor, model.AuditActionUpdate, model.AuditEntityCategory,
+			fmt.Sprintf("%d", category.Id), before, category)
+	})
+	return dbError(err, ErrCategoryNotFound)
 }
 
-func (a *AppDb) DeleteCategory(id int) error {
-	q := `DELETE FROM category WHERE id=?`
-	_, err := a.Conn.Exec(q, id)
-	if err != nil {
-		me, ok := err.(*mysql.MySQLError)
-		if ok && me.Number == 1451 {
-			return &ErrCategoryFkConflict{}
+func (a *AppDb) DeleteCategory(id int, version int, actor *model.Actor) error {
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var before model.Category
+		if actor != nil {
+			err := selectForUpdate(tx, &before, "category", "id=? AND deleted_at IS NULL", id)
+			if err != nil {
+				return err
+			}
 		}
-		return err
-	}
-	return nil
+		// the foreign key does not protect soft deleted categories, so products still using it are counted here
+		var products int
+		q := tx.Rebind("SELECT COUNT(*) FROM product WHERE category_id=? AND deleted_at IS NULL")
+		err := tx.Get(&products, q, id)
+		if err != nil {
+			return err
+		}
+		if products > 0 {
+			return ErrCategoryFkConflict
+		}
+		q = `UPDATE category SET deleted_at=CURRENT_TIMESTAMP, version=version+1
+      WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)`
+		err = execOne(tx, q, id, version, version)
+		if err == sql.ErrNoRows {
+			return versionConflictOrNotFound(tx, "category", id)
+		}
+		if err != nil {
+			return err
+		}
+		return addAuditEntry(tx, actor, model.AuditActionDelete, model.AuditEntityCategory, fmt.Sprintf("%d", id),
+			before, nil)
+	})
+	return dbError(err, ErrCategoryNotFound)
 }
 
 func (a *AppDb) AddUser(user model.User) error {
-	q := `INSERT INTO user (username, password) VALUES (?,?);`
-	_, err := a.Conn.Exec(q, user.Username, passwd.Hash([]byte(user.Password)))
+	q := fmt.Sprintf(`INSERT INTO %s (username, password) VALUES (?,?)`, dialectOf(a.Conn).user)
+	_, err := a.Conn.Exec(a.Conn.Rebind(q), user.Username, passwd.Hash([]byte(user.Password)))
 	if err != nil {
-		return err
+		return dbError(err, nil)
 	}
 	return nil
 }
 
 func (a *AppDb) UserExists(username string, password string) bool {
 	var user model.User
-	err := a.Conn.QueryRowx("SELECT * FROM user WHERE username=?", username).StructScan(&user)
+	q := fmt.Sprintf("SELECT * FROM %s WHERE username=? AND disabled_at IS NULL", dialectOf(a.Conn).user)
+	err := a.Conn.QueryRowx(a.Conn.Rebind(q), username).StructScan(&user)
 	if err != nil {
 		return false
 	}
 	return passwd.Authenticate(user.Password, []byte(password))
 }
 
-type ErrSqlInjectionAttempt struct{}
-
-func (s *ErrSqlInjectionAttempt) Error() string {
-	return "value contains malicious chars for sql injection"
-}
-
-type ErrCategoryFkConflict struct{}
-
-func (s *ErrCategoryFkConflict) Error() string {
-	return "cannot delete category, there are products that use this category_id"
+func (a *AppDb) SetUserDisabled(username string, disabled bool) error {
+	disabledAt := "NULL"
+	if disabled {
+		disabledAt = "CURRENT_TIMESTAMP"
+	}
+	q := fmt.Sprintf(`UPDATE %s SET disabled_at=%s WHERE username=?`, dialectOf(a.Conn).user, disabledAt)
+	res, err := a.Conn.Exec(a.Conn.Rebind(q), username)
+	if err != nil {
+		return dbError(err, nil)
+	}
+	return a.userUpdated(res, username)
 }
 
-func (a *AppDb) AllProductsToChan(prodC chan model.Product) chan error {
-	errC := make(chan error)
-	defer close(prodC)
-	defer close(errC)
-	q := "SELECT * FROM product"
-	rows, err := a.Conn.Queryx(q)
+func (a *AppDb) SetUserPassword(username string, password string) error {
+	q := fmt.Sprintf(`UPDATE %s SET password=? WHERE username=?`, dialectOf(a.Conn).user)
+	res, err := a.Conn.Exec(a.Conn.Rebind(q), passwd.Hash([]byte(password)), username)
 	if err != nil {
-		errC <- err
+		return dbError(err, nil)
 	}
-	for rows.Next() {
-		var p model.Product
-		err = rows.StructScan(&p)
-		if err != nil {
-			errC <- err
-		}
-		prodC <- p
+	return a.userUpdated(res, username)
+}
+
+// userUpdated tells apart an update of a user that changed nothing from one of a missing user, as MySQL reports
+// only changed rows as affected.
+func (a *AppDb) userUpdated(res sql.Result, username string) error {
+	if affected, err := res.RowsAffected(); err != nil || affected > 0 {
+		return err
 	}
-	return errC
+	var id int
+	q := fmt.Sprintf("SELECT id FROM %s WHERE username=?", dialectOf(a.Conn).user)
+	err := a.Conn.Get(&id, a.Conn.Rebind(q), username)
+	return dbError(err, ErrUserNotFound)
 }
 
-func (a *AppDb) AllCategoriesToChan(catC chan model.Category) chan error {
-	errC := make(chan error)
-	defer close(catC)
-	defer close(errC)
-	q := "SELECT * FROM category"
-	rows, err := a.Conn.Queryx(q)
-	if err != nil {
-		errC <- err
+// insertId executes an insert of a single row, and returns its id.
+func insertId(tx *sqlx.Tx, q string, args ...interface{}) (int64, error) {
+	var id int64
+	if dialectOf(tx).returning {
+		err := tx.Get(&id, tx.Rebind(q+" RETURNING id"), args...)
+		return id, err
 	}
-	for rows.Next() {
-		var c model.Category
-		err = rows.StructScan(&c)
-		if err != nil {
-			errC <- err
-		}
-		catC <- c
+	res, err := tx.Exec(tx.Rebind(q), args...)
+	if err != nil {
+		return 0, err
 	}
-	return errC
+	return res.LastInsertId()
 }
@@ -8,11 +8,13 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/panospet/small-api/pkg/apperr"
 	"github.com/panospet/small-api/pkg/model"
 )
 
@@ -46,14 +48,17 @@ func (s *Suite) TestGetAllProducts() {
 	s.dbMock.ExpectQuery(regexp.QuoteMeta(`SELECT
       product.*,
       cat.id "cat.id",
+      cat.external_id "cat.external_id",
       cat.title "cat.title",
       cat.pos "cat.pos",
       cat.image_url "cat.image_url",
       cat.created_at "cat.created_at",
-      cat.updated_at "cat.updated_at"
+      cat.updated_at "cat.updated_at",
+      cat.version "cat.version",
+      cat.deleted_at "cat.deleted_at"
     FROM
       product JOIN category cat ON product.category_id = cat.id`)).WillReturnRows(rows)
-	res, err := s.appDb.GetProducts(0, 0, "id", true)
+	res, err := s.appDb.GetProducts(0, 0, []model.Order{{Field: "id", Asc: true}})
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), 2, len(res))
 	assert.Equal(s.T(), "test description", res[0].Description)
@@ -68,11 +73,14 @@ func (s *Suite) TestGetProduct() {
 	s.dbMock.ExpectQuery(regexp.QuoteMeta(`SELECT
       product.*,
       cat.id "cat.id",
+      cat.external_id "cat.external_id",
       cat.title "cat.title",
       cat.pos "cat.pos",
       cat.image_url "cat.image_url",
       cat.created_at "cat.created_at",
-      cat.updated_at "cat.updated_at"
+      cat.updated_at "cat.updated_at",
+      cat.version "cat.version",
+      cat.deleted_at "cat.deleted_at"
     FROM
       product JOIN category cat ON product.category_id = cat.id WHERE product.id=?`)).WithArgs("asdf").WillReturnRows(rows)
 	res, err := s.appDb.GetProduct("asdf")
@@ -88,13 +96,67 @@ func (s *Suite) TestAddProduct() {
 		Price:       12.12,
 		Description: "test description",
 	}
-	q := `INSERT INTO product (id, category_id, title, image_url, price, description) VALUES (?,?,?,?,?,?);`
+	q := `INSERT INTO product (id, category_id, title, image_url, price, description) VALUES (?,?,?,?,?,?)`
+	s.dbMock.ExpectBegin()
 	s.dbMock.ExpectExec(regexp.QuoteMeta(q)).WithArgs(sqlmock.AnyArg(), product.CategoryId,
 		product.Title, product.ImageUrl, product.Price, product.Description).WillReturnResult(
 		sqlmock.NewResult(1, 1))
-	id, err := s.appDb.AddProduct(product)
+	s.dbMock.ExpectCommit()
+	id, err := s.appDb.AddProduct(product, nil)
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), 36, len(id))
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestGetMissingProduct() {
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT")).WithArgs("asdf").WillReturnError(sql.ErrNoRows)
+	_, err := s.appDb.GetProduct("asdf")
+	assert.Equal(s.T(), ErrProductNotFound, err)
+	assert.Equal(s.T(), apperr.KindNotFound, apperr.KindOf(err))
+}
+
+func (s *Suite) TestAddProductOfMissingCategory() {
+	product := model.Product{CategoryId: 99, Title: "test", ImageUrl: "http://www.bestprice.gr/test.png"}
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO product")).WillReturnError(&mysql.MySQLError{
+		Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails"})
+	s.dbMock.ExpectRollback()
+	_, err := s.appDb.AddProduct(product, nil)
+	e := apperr.As(err)
+	assert.Equal(s.T(), apperr.KindValidation, e.Kind)
+	assert.Equal(s.T(), apperr.CodeInvalidReference, e.Code)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestAddExistingUser() {
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `user`")).WillReturnError(&mysql.MySQLError{
+		Number: 1062, Message: "Duplicate entry 'admin' for key 'username'"})
+	err := s.appDb.AddUser(model.User{Username: "admin", Password: "admin"})
+	e := apperr.As(err)
+	assert.Equal(s.T(), apperr.KindConflict, e.Kind)
+	assert.Equal(s.T(), apperr.CodeDuplicate, e.Code)
+}
+
+func (s *Suite) TestSetUserDisabled() {
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET disabled_at=CURRENT_TIMESTAMP WHERE username=?")).WithArgs(
+		"admin").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(s.T(), s.appDb.SetUserDisabled("admin", true))
+
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET disabled_at=NULL WHERE username=?")).WithArgs(
+		"admin").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM `user` WHERE username=?")).WithArgs("admin").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	assert.Nil(s.T(), s.appDb.SetUserDisabled("admin", false))
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestSetPasswordOfMissingUser() {
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE `user` SET password=? WHERE username=?")).WithArgs(
+		sqlmock.AnyArg(), "nobody").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM `user` WHERE username=?")).WithArgs(
+		"nobody").WillReturnError(sql.ErrNoRows)
+	err := s.appDb.SetUserPassword("nobody", "secret")
+	assert.Equal(s.T(), ErrUserNotFound, err)
 }
 
 func (s *Suite) TestUpdateProduct() {
@@ -107,20 +169,76 @@ func (s *Suite) TestUpdateProduct() {
 		Price:       12.12,
 		Description: "test description",
 	}
-	q := `UPDATE product SET category_id=?, title=?, image_url=?, price=?, description=?, updated_at=NOW() WHERE id=?`
+	q := `UPDATE product SET category_id=?, title=?, image_url=?, price=?, description=?, version=version+1,
+      updated_at=CURRENT_TIMESTAMP WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)`
+	s.dbMock.ExpectBegin()
 	s.dbMock.ExpectExec(regexp.QuoteMeta(q)).WithArgs(product.CategoryId,
-		product.Title, product.ImageUrl, product.Price, product.Description, product.Id).WillReturnResult(
+		product.Title, product.ImageUrl, product.Price, product.Description, product.Id, 0, 0).WillReturnResult(
+		sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+	err := s.appDb.UpdateProduct(product, nil)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestUpdateProductWithAuditLog() {
+	id := uuid.New().String()
+	product := model.Product{
+		Id:          id,
+		CategoryId:  3,
+		Title:       "test",
+		ImageUrl:    "http://www.bestprice.gr/test.png",
+		Price:       12.12,
+		Description: "updated description",
+	}
+	rows := sqlmock.NewRows([]string{"id", "category_id", "title", "image_url", "price", "description", "created_at", "updated_at"}).AddRow(
+		id, 3, "test", "http://www.bestprice.gr/test.png", 12.12, "test description", time.Now(), time.Now())
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE id=? AND deleted_at IS NULL FOR UPDATE")).WithArgs(id).WillReturnRows(rows)
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE product SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	q := `INSERT INTO audit_log (username, action, entity_type, entity_id, diff, request_id) VALUES (?,?,?,?,?,?)`
+	s.dbMock.ExpectExec(regexp.QuoteMeta(q)).WithArgs("admin", "update", "product", id,
+		`{"description":{"before":"test description","after":"updated description"}}`, "req-1").WillReturnResult(
 		sqlmock.NewResult(1, 1))
-	err := s.appDb.UpdateProduct(product)
+	s.dbMock.ExpectCommit()
+	err := s.appDb.UpdateProduct(product, &model.Actor{Username: "admin", RequestId: "req-1"})
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestUpdateProductAuditLogFailureRollsBack() {
+	id := uuid.New().String()
+	rows := sqlmock.NewRows([]string{"id", "category_id", "title", "image_url", "price", "description", "created_at", "updated_at"}).AddRow(
+		id, 3, "test", "http://www.bestprice.gr/test.png", 12.12, "test description", time.Now(), time.Now())
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE id=? AND deleted_at IS NULL FOR UPDATE")).WithArgs(id).WillReturnRows(rows)
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE product SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_log")).WillReturnError(sql.ErrConnDone)
+	s.dbMock.ExpectRollback()
+	err := s.appDb.UpdateProduct(model.Product{Id: id}, &model.Actor{Username: "admin"})
+	assert.Equal(s.T(), sql.ErrConnDone, err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestGetAuditLog() {
+	rows := sqlmock.NewRows([]string{"id", "username", "action", "entity_type", "entity_id", "diff", "request_id", "created_at"}).AddRow(
+		2, "admin", "update", "product", "abc", `{"price":{"before":1,"after":2}}`, "req-2", time.Now())
+	q := "SELECT * FROM audit_log WHERE entity_type=? AND entity_id=? AND username=? ORDER BY id DESC LIMIT 10 OFFSET 0"
+	s.dbMock.ExpectQuery(regexp.QuoteMeta(q)).WithArgs("product", "abc", "admin").WillReturnRows(rows)
+	res, err := s.appDb.GetAuditLog(model.AuditFilter{EntityType: "product", EntityId: "abc", Username: "admin"}, 0, 10)
 	assert.Nil(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), "update", res[0].Action)
+	assert.Equal(s.T(), model.Change{Before: float64(1), After: float64(2)}, res[0].Diff["price"])
 }
 
 func (s *Suite) TestGetAllCategories() {
 	rows := sqlmock.NewRows([]string{"id", "title", "pos", "image_url", "created_at", "updated_at"}).AddRow(
 		1, "cat1", 2, "http://www.bestprice.gr/cat1.png", time.Now(), time.Now()).AddRow(
 		2, "cat2", 6, "http://www.bestprice.gr/cat2.png", time.Now(), time.Now())
-	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM category")).WillReturnRows(rows)
-	res, err := s.appDb.GetCategories(0, 0, "id", true)
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM category WHERE deleted_at IS NULL ORDER BY id asc")).
+		WillReturnRows(rows)
+	res, err := s.appDb.GetCategories(0, 0, []model.Order{{Field: "id", Asc: true}})
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), 2, len(res))
 	assert.Equal(s.T(), "cat1", res[0].Title)
@@ -144,11 +262,14 @@ func (s *Suite) TestAddCategory() {
 		Position: 2,
 		ImageUrl: "http://www.bestprice.gr/cat2.png",
 	}
-	q := `INSERT INTO category (title, pos, image_url) VALUES (?,?,?);`
+	q := `INSERT INTO category (title, pos, image_url) VALUES (?,?,?)`
+	s.dbMock.ExpectBegin()
 	s.dbMock.ExpectExec(regexp.QuoteMeta(q)).WithArgs(category.Title, category.Position, category.ImageUrl).WillReturnResult(
-		sqlmock.NewResult(1, 1))
-	err := s.appDb.AddCategory(category)
+		sqlmock.NewResult(7, 1))
+	s.dbMock.ExpectCommit()
+	id, err := s.appDb.AddCategory(category, nil)
 	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 7, id)
 }
 
 func (s *Suite) TestUpdateCategory() {
@@ -158,11 +279,88 @@ func (s *Suite) TestUpdateCategory() {
 		Position: 2,
 		ImageUrl: "http://www.bestprice.gr/cat2.png",
 	}
-	q := `UPDATE category SET title=?, pos=?, image_url=?, updated_at=NOW() WHERE id=?`
-	s.dbMock.ExpectExec(regexp.QuoteMeta(q)).WithArgs(category.Title, category.Position, category.ImageUrl, category.Id).WillReturnResult(
+	q := `UPDATE category SET title=?, pos=?, image_url=?, version=version+1, updated_at=CURRENT_TIMESTAMP
+      WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)`
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(q)).WithArgs(category.Title, category.Position, category.ImageUrl, category.Id,
+		0, 0).WillReturnResult(
 		sqlmock.NewResult(1, 1))
-	err := s.appDb.UpdateCategory(category)
+	s.dbMock.ExpectCommit()
+	err := s.appDb.UpdateCategory(category, nil)
+	assert.Nil(s.T(), err)
+}
+
+func (s *Suite) TestDeleteProductIsSoftDelete() {
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE product SET deleted_at=CURRENT_TIMESTAMP, version=version+1 WHERE id=? AND deleted_at IS NULL")).WithArgs(
+		"abc", 0, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.dbMock.ExpectCommit()
+	err := s.appDb.DeleteProduct("abc", 0, nil)
 	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestDeleteMissingProduct() {
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE product SET deleted_at=CURRENT_TIMESTAMP")).WithArgs(
+		"abc", 0, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM product WHERE id=? AND deleted_at IS NULL")).WithArgs(
+		"abc").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	s.dbMock.ExpectRollback()
+	err := s.appDb.DeleteProduct("abc", 0, nil)
+	assert.Equal(s.T(), ErrProductNotFound, err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestDeleteCategoryInUse() {
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM product WHERE category_id=? AND deleted_at IS NULL")).WithArgs(
+		3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	s.dbMock.ExpectRollback()
+	err := s.appDb.DeleteCategory(3, 0, nil)
+	assert.Equal(s.T(), ErrCategoryFkConflict, err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestRestoreProductOfDeletedCategory() {
+	rows := sqlmock.NewRows([]string{"id", "category_id", "title", "image_url", "price", "description", "created_at", "updated_at", "deleted_at"}).AddRow(
+		"abc", 3, "test", "http://www.bestprice.gr/test.png", 12.12, "test description", time.Now(), time.Now(), time.Now())
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE id=? AND deleted_at IS NOT NULL FOR UPDATE")).WithArgs(
+		"abc").WillReturnRows(rows)
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM category WHERE id=? AND deleted_at IS NOT NULL")).WithArgs(
+		3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	s.dbMock.ExpectRollback()
+	err := s.appDb.RestoreProduct("abc", nil)
+	assert.Equal(s.T(), ErrCategoryDeleted, err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestPurgeDeleted() {
+	before := time.Now().UTC()
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("DELETE FROM product WHERE deleted_at IS NOT NULL AND deleted_at<?")).WithArgs(
+		before).WillReturnResult(sqlmock.NewResult(0, 5))
+	s.dbMock.ExpectExec(regexp.QuoteMeta("DELETE FROM category WHERE deleted_at IS NOT NULL AND deleted_at<?")).WithArgs(
+		before).WillReturnResult(sqlmock.NewResult(0, 2))
+	s.dbMock.ExpectCommit()
+	purged, err := s.appDb.PurgeDeleted(before)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(7), purged)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestUpdateProductVersionConflict() {
+	product := model.Product{Id: "abc", CategoryId: 3, Title: "test", Version: 4}
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("UPDATE product SET")).WithArgs(product.CategoryId, product.Title,
+		product.ImageUrl, product.Price, product.Description, "abc", 4, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM product WHERE id=? AND deleted_at IS NULL")).WithArgs(
+		"abc").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	s.dbMock.ExpectRollback()
+	err := s.appDb.UpdateProduct(product, nil)
+	assert.Equal(s.T(), ErrVersionConflict, err)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
 }
 
 func TestSuite(t *testing.T) {
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// Fields that listings can be ordered by, with their column in the listing query. Only these reach the query.
+var (
+	productOrderColumns = map[string]string{
+		"id":             "product.id",
+		"sku":            "product.sku",
+		"category_id":    "product.category_id",
+		"title":          "product.title",
+		"image_url":      "product.image_url",
+		"price":          "product.price",
+		"description":    "product.description",
+		"created_at":     "product.created_at",
+		"updated_at":     "product.updated_at",
+		"position":       "cat.pos",
+		"category.title": "cat.title",
+	}
+	categoryOrderColumns = map[string]string{
+		"id":          "id",
+		"external_id": "external_id",
+		"title":       "title",
+		"position":    "pos",
+		"image_url":   "image_url",
+		"created_at":  "created_at",
+		"updated_at":  "updated_at",
+	}
+)
+
+// ProductOrderFields returns the fields that products can be ordered by.
+func ProductOrderFields() []string {
+	return orderFields(productOrderColumns)
+}
+
+// CategoryOrderFields returns the fields that categories can be ordered by.
+func CategoryOrderFields() []string {
+	return orderFields(categoryOrderColumns)
+}
+
+func orderFields(columns map[string]string) []string {
+	fields := make([]string, 0, len(columns))
+	for field := range columns {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// orderTerm is a column of an ORDER BY clause, and its direction.
+type orderTerm struct {
+	column string
+	asc    bool
+}
+
+// orderByClause returns the ORDER BY clause of a listing, by id if there is no order. It ends with the id,
+// ascending, so that entities with equal values keep the same order across pages.
+func orderByClause(orders []model.Order, columns map[string]string) (string, error) {
+	terms, err := orderTerms(orders, columns)
+	if err != nil {
+		return "", err
+	}
+	return orderByTerms(terms), nil
+}
+
+func orderByTerms(terms []orderTerm) string {
+	clause := make([]string, len(terms))
+	for i, term := range terms {
+		dir := "desc"
+		if term.asc {
+			dir = "asc"
+		}
+		clause[i] = term.column + " " + dir
+	}
+	return " ORDER BY " + strings.Join(clause, ", ")
+}
+
+// orderTerms returns the terms of the ORDER BY clause of orderByClause.
+func orderTerms(orders []model.Order, columns map[string]string) ([]orderTerm, error) {
+	if err := checkOrder(orders, columns); err != nil {
+		return nil, err
+	}
+	terms := make([]orderTerm, 0, len(orders)+1)
+	byId := false
+	for _, o := range orders {
+		terms = append(terms, orderTerm{columns[o.Field], o.Asc})
+		byId = byId || o.Field == "id"
+	}
+	if !byId {
+		terms = append(terms, orderTerm{columns["id"], true})
+	}
+	return terms, nil
+}
+
+// checkOrder returns a validation error naming the allowed fields if any field of orders is not one of columns.
+func checkOrder(orders []model.Order, columns map[string]string) error {
+	for _, o := range orders {
+		if _, ok := columns[o.Field]; !ok {
+			return apperr.Validation(apperr.CodeInvalidParameter, fmt.Sprintf("Cannot order by %q, expected some of %s",
+				o.Field, strings.Join(orderFields(columns), ",")))
+		}
+	}
+	return nil
+}
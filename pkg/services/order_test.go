@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func TestOrderByClause(t *testing.T) {
+	order := []model.Order{{Field: "category_id", Asc: true}, {Field: "price"}, {Field: "category.title", Asc: true}}
+	clause, err := orderByClause(order, productOrderColumns)
+	assert.Nil(t, err)
+	assert.Equal(t,
+		" ORDER BY product.category_id asc, product.price desc, cat.title asc, product.id asc", clause)
+
+	clause, err = orderByClause([]model.Order{{Field: "position"}, {Field: "id"}}, categoryOrderColumns)
+	assert.Nil(t, err)
+	assert.Equal(t, " ORDER BY pos desc, id desc", clause)
+
+	clause, err = orderByClause(nil, productOrderColumns)
+	assert.Nil(t, err)
+	assert.Equal(t, " ORDER BY product.id asc", clause)
+}
+
+func TestOrderByUnknownField(t *testing.T) {
+	for _, field := range []string{"pos", "category.title", "title; DROP TABLE category"} {
+		_, err := orderByClause([]model.Order{{Field: field}}, categoryOrderColumns)
+		assert.Equal(t, apperr.KindValidation, apperr.KindOf(err), field)
+		assert.Contains(t, err.Error(), "created_at,external_id,id,image_url,position,title,updated_at", field)
+	}
+}
+
+func TestMockOrder(t *testing.T) {
+	db := NewMockDb()
+	products, err := db.GetProducts(0, 0, []model.Order{{Field: "category_id", Asc: true}, {Field: "price"}})
+	assert.Nil(t, err)
+	for i := 1; i < len(products); i++ {
+		prev, p := products[i-1], products[i]
+		assert.True(t, prev.CategoryId < p.CategoryId ||
+			(prev.CategoryId == p.CategoryId && prev.Price >= p.Price), i)
+	}
+	_, err = db.GetProducts(0, 0, []model.Order{{Field: "colour"}})
+	assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// ReorderCategories gives the categories of ids the first positions, in their order, and the rest of the categories
+// the positions after them, keeping their order. The categories whose position changes are updated in one
+// transaction, so that either all of them move or none, and the categories are returned by position.
+func (a *AppDb) ReorderCategories(ids []int, actor *model.Actor) ([]model.Category, error) {
+	var categories []model.Category
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var current []model.Category
+		q := "SELECT * FROM category WHERE deleted_at IS NULL ORDER BY pos, id" + dialectOf(tx).forUpdate
+		if err := tx.Select(&current, tx.Rebind(q)); err != nil {
+			return err
+		}
+		ordered, err := reorder(current, ids)
+		if err != nil {
+			return err
+		}
+		before := make(map[int]model.Category, len(current))
+		for _, c := range current {
+			before[c.Id] = c
+		}
+		update, err := tx.Preparex(tx.Rebind(`UPDATE category SET pos=?, version=version+1,
+      updated_at=CURRENT_TIMESTAMP WHERE id=?`))
+		if err != nil {
+			return err
+		}
+		defer update.Close()
+		var changes []auditChange
+		for _, c := range ordered {
+			if before[c.Id].Position == c.Position {
+				continue
+			}
+			if _, err := update.Exec(c.Position, c.Id); err != nil {
+				return err
+			}
+			changes = append(changes, auditChange{model.AuditActionUpdate, strconv.Itoa(c.Id), before[c.Id], c})
+		}
+		if err := addAuditEntries(tx, actor, model.AuditEntityCategory, changes); err != nil {
+			return err
+		}
+		return tx.Select(&categories, "SELECT * FROM category WHERE deleted_at IS NULL ORDER BY pos, id")
+	})
+	return categories, dbError(err, ErrCategoryNotFound)
+}
+
+// reorder returns categories, which are ordered by position, with the ones of ids first and positions from 1 in
+// their new order. It fails if an id is not one of categories, or is listed twice.
+func reorder(categories []model.Category, ids []int) ([]model.Category, error) {
+	byId := make(map[int]model.Category, len(categories))
+	for _, c := range categories {
+		byId[c.Id] = c
+	}
+	listed := make(map[int]bool, len(ids))
+	ordered := make([]model.Category, 0, len(categories))
+	for _, id := range ids {
+		if listed[id] {
+			return nil, apperr.Validation(apperr.CodeDuplicate, fmt.Sprintf("Category %d is listed twice", id))
+		}
+		c, ok := byId[id]
+		if !ok {
+			return nil, apperr.NotFound(fmt.Sprintf("Category %d not found", id))
+		}
+		listed[id] = true
+		ordered = append(ordered, c)
+	}
+	for _, c := range categories {
+		if !listed[c.Id] {
+			ordered = append(ordered, c)
+		}
+	}
+	for i := range ordered {
+		ordered[i].Position = i + 1
+	}
+	return ordered, nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/pkg/model"
+)
+
+// defaultStreamBatchSize is the batch size of StreamProducts and StreamCategories when none is given.
+const defaultStreamBatchSize = 1000
+
+// StreamProducts calls fn with the products that are not deleted and match filter, joined with their category, in
+// batches of batchSize ordered by id, or by filter.OrderBy. Each batch is a query of its own, which starts after the
+// last product of the one before, so that no query stays open while fn runs and none reads through the products
+// before it, however many products there are. It stops at the first error of fn, which is returned, or when ctx is
+// done.
+func (a *AppDb) StreamProducts(ctx context.Context, filter model.StreamFilter, batchSize int,
+	fn func([]model.Product) error) error {
+	if len(filter.OrderBy) > 0 {
+		return a.streamOrderedProducts(ctx, filter, batchSize, fn)
+	}
+	where, args := streamWhere("product", "category_id", filter)
+	q := productSelect + " WHERE product.deleted_at IS NULL AND product.id>?" + where + " ORDER BY product.id LIMIT ?"
+	last := ""
+	for {
+		var products []model.Product
+		err := a.selectBatch(ctx, &products, q, append(append([]interface{}{last}, args...), batchOf(batchSize))...)
+		if err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+		if err := fn(products); err != nil {
+			return err
+		}
+		last = products[len(products)-1].Id
+	}
+}
+
+// streamOrderedProducts is StreamProducts in the order of filter.OrderBy. A batch starts after the last product of
+// the one before in that order, whose values the database reads by its id, so that they are compared as they are
+// stored. A product that changes while it is the last one moves the stream along with it.
+func (a *AppDb) streamOrderedProducts(ctx context.Context, filter model.StreamFilter, batchSize int,
+	fn func([]model.Product) error) error {
+	terms, err := orderTerms(filter.OrderBy, productOrderColumns)
+	if err != nil {
+		return err
+	}
+	where, args := streamWhere("product", "category_id", filter)
+	order := orderByTerms(terms)
+	join, after := keyset(terms, dialectOf(a.Conn))
+	q := productSelect + " WHERE product.deleted_at IS NULL" + where + order + " LIMIT ?"
+	next := productSelect + join + " WHERE product.deleted_at IS NULL AND " + after + where + order + " LIMIT ?"
+	var last []interface{}
+	for {
+		var products []model.Product
+		batchArgs := append(append(last, args...), batchOf(batchSize))
+		if err := a.selectBatch(ctx, &products, q, batchArgs...); err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+		if err := fn(products); err != nil {
+			return err
+		}
+		q, last = next, []interface{}{products[len(products)-1].Id}
+	}
+}
+
+// nullableOrderColumns are the order columns of products that can be NULL.
+var nullableOrderColumns = map[string]bool{"product.sku": true, "product.description": true}
+
+// keyset returns the join of the product whose id is the argument, as lastrow with the columns of terms as k0, k1
+// etc., and the condition of the products that come after it in the order of terms, which ends with the id.
+func keyset(terms []orderTerm, d dialect) (string, string) {
+	columns := make([]string, len(terms))
+	var equal, after []string
+	for i, term := range terms {
+		columns[i] = fmt.Sprintf("%s AS k%d", term.column, i)
+		key := fmt.Sprintf("lastrow.k%d", i)
+		nullable := nullableOrderColumns[term.column]
+		greater := greaterThan(term.column, key, nullable, d.nullsFirst)
+		if !term.asc {
+			greater = greaterThan(key, term.column, nullable, d.nullsFirst)
+		}
+		after = append(after, "("+strings.Join(append(equal[:len(equal):len(equal)], greater), " AND ")+")")
+		equal = append(equal, equalTo(term.column, key, nullable))
+	}
+	join := " CROSS JOIN (SELECT " + strings.Join(columns, ", ") +
+		" FROM product JOIN category cat ON product.category_id = cat.id WHERE product.id=?) lastrow"
+	return join, "(" + strings.Join(after, " OR ") + ")"
+}
+
+// greaterThan is the condition of a coming after b in ascending order, where NULL comes first if nullsFirst.
+func greaterThan(a string, b string, nullable bool, nullsFirst bool) string {
+	if !nullable {
+		return a + ">" + b
+	}
+	if nullsFirst {
+		return "(" + a + ">" + b + " OR (" + a + " IS NOT NULL AND " + b + " IS NULL))"
+	}
+	return "(" + a + ">" + b + " OR (" + a + " IS NULL AND " + b + " IS NOT NULL))"
+}
+
+// equalTo is the condition of a being equal to b, where NULL equals NULL.
+func equalTo(a string, b string, nullable bool) string {
+	if !nullable {
+		return a + "=" + b
+	}
+	return "(" + a + "=" + b + " OR (" + a + " IS NULL AND " + b + " IS NULL))"
+}
+
+// StreamCategories calls fn with the categories that are not deleted and match filter, in batches of batchSize
+// ordered by id, like StreamProducts.
+func (a *AppDb) StreamCategories(ctx context.Context, filter model.StreamFilter, batchSize int,
+	fn func([]model.Category) error) error {
+	where, args := streamWhere("category", "id", filter)
+	q := "SELECT * FROM category WHERE deleted_at IS NULL AND id>?" + where + " ORDER BY id LIMIT ?"
+	last := 0
+	for {
+		var categories []model.Category
+		err := a.selectBatch(ctx, &categories, q, append(append([]interface{}{last}, args...), batchOf(batchSize))...)
+		if err != nil {
+			return err
+		}
+		if len(categories) == 0 {
+			return nil
+		}
+		if err := fn(categories); err != nil {
+			return err
+		}
+		last = categories[len(categories)-1].Id
+	}
+}
+
+// selectBatch selects a batch of q, whose arguments are args.
+func (a *AppDb) selectBatch(ctx context.Context, dest interface{}, q string, args ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return dbError(sqlx.SelectContext(ctx, a.Conn, dest, a.Conn.Rebind(q), args...), nil)
+}
+
+// batchOf returns batchSize, or defaultStreamBatchSize if it is not positive.
+func batchOf(batchSize int) int {
+	if batchSize <= 0 {
+		return defaultStreamBatchSize
+	}
+	return batchSize
+}
+
+// streamWhere returns the conditions of filter on table, whose category id is in column, and their arguments.
+func streamWhere(table string, column string, filter model.StreamFilter) (string, []interface{}) {
+	var where string
+	var args []interface{}
+	if len(filter.CategoryIds) > 0 {
+		where += " AND " + table + "." + column + " IN (?" + strings.Repeat(",?", len(filter.CategoryIds)-1) + ")"
+		for _, id := range filter.CategoryIds {
+			args = append(args, id)
+		}
+	}
+	if !filter.UpdatedSince.IsZero() {
+		// SQLite compares times as text, which is only right in the same time zone as CURRENT_TIMESTAMP
+		where += " AND " + table + ".updated_at>=?"
+		args = append(args, filter.UpdatedSince.UTC())
+	}
+	return where, args
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func (s *Suite) TestStreamProducts() {
+	columns := append(productColumns, "cat.id", "cat.title")
+	rows := sqlmock.NewRows(columns).
+		AddRow("a", 3, "first", "http://www.bestprice.gr/1.png", 1, "", time.Now(), time.Now(), 1, 3, "shoes").
+		AddRow("b", 3, "second", "http://www.bestprice.gr/2.png", 2, "", time.Now(), time.Now(), 1, 3, "shoes")
+	q := regexp.QuoteMeta("WHERE product.deleted_at IS NULL AND product.id>? AND product.category_id IN (?) " +
+		"ORDER BY product.id LIMIT ?")
+	s.dbMock.ExpectQuery(q).WithArgs("", 3, 2).WillReturnRows(rows)
+	// the next batch starts after the last id of the one before
+	s.dbMock.ExpectQuery(q).WithArgs("b", 3, 2).WillReturnRows(sqlmock.NewRows(columns))
+
+	var streamed []model.Product
+	err := s.appDb.StreamProducts(context.Background(), model.StreamFilter{CategoryIds: []int{3}}, 2,
+		func(products []model.Product) error {
+			streamed = append(streamed, products...)
+			return nil
+		})
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), streamed, 2)
+	assert.Equal(s.T(), "shoes", streamed[1].Category.Title)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
+
+func (s *Suite) TestStreamOrderedProducts() {
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(productColumns).
+			AddRow("a", 3, "first", "http://www.bestprice.gr/1.png", 1, "", time.Now(), time.Now(), 1).
+			AddRow("b", 3, "second", "http://www.bestprice.gr/2.png", 2, "", time.Now(), time.Now(), 1)
+	}
+	order := " ORDER BY product.sku desc, product.title asc, product.id asc LIMIT ?"
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("WHERE product.deleted_at IS NULL" + order)).WithArgs(2).
+		WillReturnRows(rows())
+	// the next batch starts after the last product of the one before, in the order of the stream
+	s.dbMock.ExpectQuery(regexp.QuoteMeta(" CROSS JOIN (SELECT product.sku AS k0, product.title AS k1, "+
+		"product.id AS k2 FROM product JOIN category cat ON product.category_id = cat.id WHERE product.id=?) lastrow "+
+		"WHERE product.deleted_at IS NULL AND "+
+		"(((lastrow.k0>product.sku OR (lastrow.k0 IS NOT NULL AND product.sku IS NULL))) OR "+
+		"((product.sku=lastrow.k0 OR (product.sku IS NULL AND lastrow.k0 IS NULL)) AND product.title>lastrow.k1) OR "+
+		"((product.sku=lastrow.k0 OR (product.sku IS NULL AND lastrow.k0 IS NULL)) AND product.title=lastrow.k1 AND "+
+		"product.id>lastrow.k2))"+order)).WithArgs("b", 2).WillReturnRows(rows())
+
+	stop := errors.New("stop")
+	calls := 0
+	filter := model.StreamFilter{OrderBy: []model.Order{{Field: "sku"}, {Field: "title", Asc: true}}}
+	err := s.appDb.StreamProducts(context.Background(), filter, 2, func(products []model.Product) error {
+		calls++
+		if calls == 2 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(s.T(), stop, err)
+	assert.Equal(s.T(), 2, calls)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+
+	filter.OrderBy = []model.Order{{Field: "title;drop"}}
+	err = s.appDb.StreamProducts(context.Background(), filter, 2, nil)
+	assert.Equal(s.T(), apperr.KindValidation, apperr.KindOf(err))
+}
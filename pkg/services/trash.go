@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func (a *AppDb) RestoreProduct(id string, actor *model.Actor) error {
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var product model.Product
+		err := selectForUpdate(tx, &product, "product", "id=? AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		}
+		var deletedCategories int
+		err = tx.Get(&deletedCategories, tx.Rebind("SELECT COUNT(*) FROM category WHERE id=? AND deleted_at IS NOT NULL"),
+			product.CategoryId)
+		if err != nil {
+			return err
+		}
+		if deletedCategories > 0 {
+			return ErrCategoryDeleted
+		}
+		if err := execOne(tx, `UPDATE product SET deleted_at=NULL, version=version+1 WHERE id=?`, id); err != nil {
+			return err
+		}
+		product.DeletedAt = nil
+		product.Version++
+		return addAuditEntry(tx, actor, model.AuditActionRestore, model.AuditEntityProduct, id, nil, product)
+	})
+	return dbError(err, apperr.NotFound("Product not found in trash"))
+}
+
+func (a *AppDb) RestoreCategory(id int, actor *model.Actor) error {
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		var category model.Category
+		err := selectForUpdate(tx, &category, "category", "id=? AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		}
+		if err := execOne(tx, `UPDATE category SET deleted_at=NULL, version=version+1 WHERE id=?`, id); err != nil {
+			return err
+		}
+		category.DeletedAt = nil
+		category.Version++
+		return addAuditEntry(tx, actor, model.AuditActionRestore, model.AuditEntityCategory, fmt.Sprintf("%d", id),
+			nil, category)
+	})
+	return dbError(err, apperr.NotFound("Category not found in trash"))
+}
+
+// GetTrash lists soft deleted products and categories, most recently deleted first. An empty entityType lists both.
+func (a *AppDb) GetTrash(entityType string, offset int, limit int) ([]model.TrashItem, error) {
+	var items []model.TrashItem
+	var parts []string
+	if entityType == "" || entityType == model.AuditEntityProduct {
+		parts = append(parts, `SELECT 'product' AS entity_type, id AS entity_id, title, deleted_at
+      FROM product WHERE deleted_at IS NOT NULL`)
+	}
+	if entityType == "" || entityType == model.AuditEntityCategory {
+		parts = append(parts, fmt.Sprintf(`SELECT 'category' AS entity_type, CAST(id AS %s) AS entity_id, title,
+      deleted_at FROM category WHERE deleted_at IS NOT NULL`, dialectOf(a.Conn).text))
+	}
+	if len(parts) == 0 {
+		return items, nil
+	}
+	q := parts[0]
+	if len(parts) > 1 {
+		q += " UNION ALL " + parts[1]
+	}
+	q += " ORDER BY deleted_at DESC"
+	if limit != 0 {
+		q += fmt.Sprintf(` LIMIT %d OFFSET %d `, limit, offset)
+	}
+	rows, err := a.Conn.Queryx(q)
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item model.TrashItem
+		err = rows.StructScan(&item)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// PurgeDeleted hard deletes products and categories that were soft deleted before the given time. Categories that
+// are still referenced by a product in the trash are kept until the product is purged as well.
+func (a *AppDb) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		// SQLite compares times as text, which is only right in the same time zone as CURRENT_TIMESTAMP
+		before = before.UTC()
+		res, err := tx.Exec(tx.Rebind("DELETE FROM product WHERE deleted_at IS NOT NULL AND deleted_at<?"), before)
+		if err != nil {
+			return err
+		}
+		products, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		res, err = tx.Exec(tx.Rebind(`DELETE FROM category WHERE deleted_at IS NOT NULL AND deleted_at<?
+      AND NOT EXISTS (SELECT 1 FROM product WHERE product.category_id=category.id)`), before)
+		if err != nil {
+			return err
+		}
+		categories, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		purged = products + categories
+		return nil
+	})
+	return purged, dbError(err, nil)
+}
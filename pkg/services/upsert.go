@@ -0,0 +1,288 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+const (
+	UpsertCreated   = "created"
+	UpsertUpdated   = "updated"
+	UpsertUnchanged = "unchanged"
+)
+
+// UpsertResult is the outcome of upserting a single product or category: the id of the stored entity and whether it
+// was created, updated or left unchanged. Err is set if it could not be stored.
+type UpsertResult struct {
+	Id     string
+	Status string
+	Err    error
+}
+
+// UpsertProducts creates or updates products by their sku, within a single transaction and with a single statement.
+// Skus are compared regardless of case, and the stored one keeps its case.
+// Products with category id 0 are put in the category whose external id is the one of their Category. Soft deleted
+// products are restored when they are upserted again. Products that can not be stored get an error in their result,
+// while the rest are stored anyway. A dry run rolls everything back, but still returns the results.
+func (a *AppDb) UpsertProducts(products []model.Product, actor *model.Actor, dryRun bool) ([]UpsertResult, error) {
+	var results []UpsertResult
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		results = make([]UpsertResult, len(products))
+		var skus []string
+		var categoryIds []int
+		var categoryExternalIds []string
+		for _, p := range products {
+			if p.Sku != nil {
+				skus = append(skus, upsertKey(*p.Sku))
+			}
+			if p.CategoryId != 0 {
+				categoryIds = append(categoryIds, p.CategoryId)
+			} else if p.Category.ExternalId != nil {
+				categoryExternalIds = append(categoryExternalIds, *p.Category.ExternalId)
+			}
+		}
+		current := make(map[string]model.Product)
+		if len(skus) > 0 {
+			d := dialectOf(tx)
+			q, args, err := sqlx.In(`SELECT * FROM product WHERE `+d.foldCase("sku")+` IN (?)`+d.forUpdate, skus)
+			if err != nil {
+				return err
+			}
+			var existing []model.Product
+			if err := tx.Select(&existing, tx.Rebind(q), args...); err != nil {
+				return err
+			}
+			for _, p := range existing {
+				current[upsertKey(*p.Sku)] = p
+			}
+		}
+		categories, err := existingCategories(tx, categoryIds)
+		if err != nil {
+			return err
+		}
+		byExternalId, err := categoryIdsByExternalId(tx, categoryExternalIds)
+		if err != nil {
+			return err
+		}
+
+		var values []string
+		var args []interface{}
+		var audit []auditChange
+		seen := make(map[string]int)
+		for i, p := range products {
+			if p.Sku == nil || *p.Sku == "" {
+				results[i].Err = apperr.Validation(apperr.CodeInvalidValue, "Product has no sku")
+				continue
+			}
+			sku, key := *p.Sku, upsertKey(*p.Sku)
+			if j, ok := seen[key]; ok {
+				results[i].Err = apperr.Validation(apperr.CodeDuplicate,
+					fmt.Sprintf("Sku %s is used by product %d of the same batch", sku, j))
+				continue
+			}
+			seen[key] = i
+			if p.CategoryId == 0 && p.Category.ExternalId != nil {
+				id, ok := byExternalId[upsertKey(*p.Category.ExternalId)]
+				if !ok {
+					results[i].Err = apperr.Validation(apperr.CodeInvalidReference,
+						fmt.Sprintf("Category with external id %s does not exist", *p.Category.ExternalId))
+					continue
+				}
+				p.CategoryId = id
+			} else if err := checkCategory(categories, p.CategoryId); err != nil {
+				results[i].Err = err
+				continue
+			}
+
+			before, exists := current[key]
+			if exists {
+				p.Id, p.Sku = before.Id, before.Sku
+				sku = *before.Sku
+				results[i] = UpsertResult{Id: p.Id, Status: UpsertUpdated}
+				if before.DeletedAt == nil && sameProduct(before, p) {
+					results[i].Status = UpsertUnchanged
+					continue
+				}
+				audit = append(audit, auditChange{model.AuditActionUpdate, p.Id, before, p})
+			} else {
+				p.Id = uuid.New().String()
+				results[i] = UpsertResult{Id: p.Id, Status: UpsertCreated}
+				audit = append(audit, auditChange{model.AuditActionCreate, p.Id, nil, p})
+			}
+			values = append(values, "(?,?,?,?,?,?,?)")
+			args = append(args, p.Id, sku, p.CategoryId, p.Title, p.ImageUrl, p.Price, p.Description)
+		}
+		if len(values) > 0 {
+			q := `INSERT INTO product (id, sku, category_id, title, image_url, price, description) VALUES ` +
+				strings.Join(values, ",") + upsertClause(tx, "product", "sku", changedProductColumns, ", deleted_at=NULL")
+			if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+				return err
+			}
+		}
+		if err := addAuditEntries(tx, actor, model.AuditEntityProduct, audit); err != nil {
+			return err
+		}
+		if dryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		return nil, dbError(err, nil)
+	}
+	return results, nil
+}
+
+// UpsertCategories creates or updates categories by their external id, like UpsertProducts by sku.
+func (a *AppDb) UpsertCategories(categories []model.Category, actor *model.Actor, dryRun bool) ([]UpsertResult,
+	error) {
+	var results []UpsertResult
+	err := a.inTx(func(tx *sqlx.Tx) error {
+		results = make([]UpsertResult, len(categories))
+		var externalIds []string
+		for _, c := range categories {
+			if c.ExternalId != nil {
+				externalIds = append(externalIds, upsertKey(*c.ExternalId))
+			}
+		}
+		current := make(map[string]model.Category)
+		if len(externalIds) > 0 {
+			d := dialectOf(tx)
+			q, args, err := sqlx.In(`SELECT * FROM category WHERE `+d.foldCase("external_id")+` IN (?)`+d.forUpdate,
+				externalIds)
+			if err != nil {
+				return err
+			}
+			var existing []model.Category
+			if err := tx.Select(&existing, tx.Rebind(q), args...); err != nil {
+				return err
+			}
+			for _, c := range existing {
+				current[upsertKey(*c.ExternalId)] = c
+			}
+		}
+
+		var values []string
+		var args []interface{}
+		var written []string
+		changes := make(map[string]auditChange)
+		seen := make(map[string]int)
+		for i, c := range categories {
+			if c.ExternalId == nil || *c.ExternalId == "" {
+				results[i].Err = apperr.Validation(apperr.CodeInvalidValue, "Category has no external id")
+				continue
+			}
+			externalId, key := *c.ExternalId, upsertKey(*c.ExternalId)
+			if j, ok := seen[key]; ok {
+				results[i].Err = apperr.Validation(apperr.CodeDuplicate,
+					fmt.Sprintf("External id %s is used by category %d of the same batch", externalId, j))
+				continue
+			}
+			seen[key] = i
+			before, exists := current[key]
+			if exists {
+				c.Id, c.ExternalId = before.Id, before.ExternalId
+				externalId = *before.ExternalId
+				results[i] = UpsertResult{Id: strconv.Itoa(c.Id), Status: UpsertUpdated}
+				if before.DeletedAt == nil && sameCategory(before, c) {
+					results[i].Status = UpsertUnchanged
+					continue
+				}
+				changes[externalId] = auditChange{model.AuditActionUpdate, "", before, c}
+			} else {
+				results[i].Status = UpsertCreated
+				changes[externalId] = auditChange{model.AuditActionCreate, "", nil, c}
+			}
+			written = append(written, externalId)
+			values = append(values, "(?,?,?,?)")
+			args = append(args, externalId, c.Title, c.Position, c.ImageUrl)
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		q := `INSERT INTO category (external_id, title, pos, image_url) VALUES ` + strings.Join(values, ",") +
+			upsertClause(tx, "category", "external_id", []string{"title", "pos", "image_url"}, ", deleted_at=NULL")
+		if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+			return err
+		}
+		// ids of new categories are only known after the insert
+		ids, err := categoryIdsByExternalId(tx, written)
+		if err != nil {
+			return err
+		}
+		var audit []auditChange
+		for i, c := range categories {
+			if results[i].Err != nil || results[i].Status != UpsertCreated {
+				continue
+			}
+			results[i].Id = strconv.Itoa(ids[upsertKey(*c.ExternalId)])
+		}
+		for _, externalId := range written {
+			change := changes[externalId]
+			change.entityId = strconv.Itoa(ids[upsertKey(externalId)])
+			audit = append(audit, change)
+		}
+		if err := addAuditEntries(tx, actor, model.AuditEntityCategory, audit); err != nil {
+			return err
+		}
+		if dryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		return nil, dbError(err, nil)
+	}
+	return results, nil
+}
+
+// categoryIdsByExternalId maps the given external ids to the ids of the categories that are not deleted. Both are
+// compared regardless of case, so the map is keyed by upsertKey.
+func categoryIdsByExternalId(tx *sqlx.Tx, externalIds []string) (map[string]int, error) {
+	ids := make(map[string]int)
+	if len(externalIds) == 0 {
+		return ids, nil
+	}
+	keys := make([]string, len(externalIds))
+	for i, externalId := range externalIds {
+		keys[i] = upsertKey(externalId)
+	}
+	q, args, err := sqlx.In(`SELECT id, external_id FROM category WHERE `+dialectOf(tx).foldCase("external_id")+
+		` IN (?) AND deleted_at IS NULL`, keys)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Id         int    `db:"id"`
+		ExternalId string `db:"external_id"`
+	}
+	if err := tx.Select(&rows, tx.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ids[upsertKey(row.ExternalId)] = row.Id
+	}
+	return ids, nil
+}
+
+// upsertKey is the key that a sku or an external id is unique by: like the importer, which batches the lines of the
+// same key together, and the collation of MySQL, it ignores case.
+func upsertKey(key string) string {
+	return strings.ToLower(key)
+}
+
+func sameProduct(a model.Product, b model.Product) bool {
+	return a.CategoryId == b.CategoryId && a.Title == b.Title && a.ImageUrl == b.ImageUrl && a.Price == b.Price &&
+		a.Description == b.Description
+}
+
+func sameCategory(a model.Category, b model.Category) bool {
+	return a.Title == b.Title && a.Position == b.Position && a.ImageUrl == b.ImageUrl
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/panospet/small-api/pkg/apperr"
+	"github.com/panospet/small-api/pkg/model"
+)
+
+func (s *Suite) TestUpsertProducts() {
+	sku := func(s string) *string { return &s }
+	shoes := "shoes"
+	products := []model.Product{
+		{Sku: sku("a-1"), CategoryId: 3, Title: "same", ImageUrl: "http://www.bestprice.gr/1.png", Price: 1},
+		{Sku: sku("a-2"), Title: "new", ImageUrl: "http://www.bestprice.gr/2.png", Price: 2,
+			Category: model.Category{ExternalId: &shoes}},
+		{Sku: sku("a-2"), CategoryId: 3, Title: "twice"},
+		{Sku: sku("a-3"), CategoryId: 9, Title: "missing category"},
+	}
+	columns := append(productColumns, "sku", "deleted_at")
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product WHERE sku IN (?, ?, ?, ?) FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(
+			"abc", 3, "same", "http://www.bestprice.gr/1.png", 1, "", time.Now(), time.Now(), 2, "a-1", nil))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM category WHERE id IN (?, ?, ?) AND deleted_at IS NULL")).
+		WithArgs(3, 3, 9).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	s.dbMock.ExpectQuery(regexp.QuoteMeta("SELECT id, external_id FROM category WHERE external_id IN (?)")).
+		WithArgs("shoes").WillReturnRows(sqlmock.NewRows([]string{"id", "external_id"}).AddRow(4, "shoes"))
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO product (id, sku, category_id, title, image_url, price, description) VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE")).
+		WithArgs(sqlmock.AnyArg(), "a-2", 4, "new", "http://www.bestprice.gr/2.png", float32(2), "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.dbMock.ExpectRollback()
+
+	results, err := s.appDb.UpsertProducts(products, nil, true)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), UpsertResult{Id: "abc", Status: UpsertUnchanged}, results[0])
+	assert.Equal(s.T(), UpsertCreated, results[1].Status)
+	assert.Equal(s.T(), apperr.CodeDuplicate, apperr.As(results[2].Err).Code)
+	assert.Equal(s.T(), apperr.CodeInvalidReference, apperr.As(results[3].Err).Code)
+	assert.Nil(s.T(), s.dbMock.ExpectationsWereMet())
+}
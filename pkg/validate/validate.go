@@ -0,0 +1,135 @@
+// Package validate checks structs against rules declared in their `validate` struct tags, e.g.
+//
+//	Title string `json:"title" validate:"required,max=100"`
+//
+// Supported rules are required, max=N (maximum length of strings, in characters), maxbytes=N (maximum length of
+// strings in UTF-8, for columns whose limit is in bytes, like TEXT in MySQL), min=N (minimum value of numbers) and
+// url.
+// Fields are reported by their json name. Optional (pointer) fields are only checked when set.
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	CodeRequired   = "required"
+	CodeTooLong    = "too_long"
+	CodeTooSmall   = "too_small"
+	CodeInvalidUrl = "invalid_url"
+	CodeNotFound   = "not_found"
+	CodeNotNumber  = "not_number"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	var messages []string
+	for _, fe := range e {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Struct validates v, which must be a struct or a pointer to a struct, and returns all rule violations.
+func Struct(v interface{}) Errors {
+	var errs Errors
+	value := reflect.Indirect(reflect.ValueOf(v))
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if fe := check(name, value.Field(i), rule); fe != nil {
+				errs = append(errs, *fe)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func check(name string, value reflect.Value, rule string) *FieldError {
+	parts := strings.SplitN(rule, "=", 2)
+	// optional values are only checked when set
+	if value.Kind() == reflect.Ptr && parts[0] != "required" {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch parts[0] {
+	case "required":
+		if value.IsZero() {
+			return &FieldError{name, CodeRequired, fmt.Sprintf("%s is required", name)}
+		}
+	case "max":
+		max := mustAtoi(rule, parts)
+		if value.Kind() == reflect.String && utf8.RuneCountInString(value.String()) > max {
+			return &FieldError{name, CodeTooLong, fmt.Sprintf("%s must be at most %d characters long", name, max)}
+		}
+	case "maxbytes":
+		max := mustAtoi(rule, parts)
+		if value.Kind() == reflect.String && len(value.String()) > max {
+			return &FieldError{name, CodeTooLong, fmt.Sprintf("%s must be at most %d bytes long", name, max)}
+		}
+	case "min":
+		min := mustAtoi(rule, parts)
+		var number float64
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			number = float64(value.Int())
+		case reflect.Float32, reflect.Float64:
+			number = value.Float()
+		default:
+			panic(fmt.Sprintf("validate: rule %s only applies to numbers", rule))
+		}
+		if number < float64(min) {
+			return &FieldError{name, CodeTooSmall, fmt.Sprintf("%s must be at least %d", name, min)}
+		}
+	case "url":
+		if value.String() != "" && !isUrl(value.String()) {
+			return &FieldError{name, CodeInvalidUrl, fmt.Sprintf("%s must be a valid http(s) url", name)}
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %s", rule))
+	}
+	return nil
+}
+
+func mustAtoi(rule string, parts []string) int {
+	if len(parts) != 2 {
+		panic(fmt.Sprintf("validate: rule %s needs a value", rule))
+	}
+	i, err := strconv.Atoi(parts[1])
+	if err != nil {
+		panic(fmt.Sprintf("validate: bad value for rule %s", rule))
+	}
+	return i
+}
+
+func isUrl(value string) bool {
+	u, err := url.ParseRequestURI(value)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
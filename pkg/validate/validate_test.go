@@ -0,0 +1,54 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	Title    string  `json:"title" validate:"required,max=5"`
+	Note     string  `json:"note" validate:"maxbytes=4"`
+	Link     string  `json:"link,omitempty" validate:"url"`
+	Price    float32 `json:"price" validate:"min=0"`
+	Position int     `json:"position" validate:"required,min=1"`
+	Ignored  string  `json:"ignored"`
+}
+
+func TestValidStruct(t *testing.T) {
+	errs := Struct(item{Title: "ok", Link: "https://www.bestprice.gr/a.png", Price: 0, Position: 1})
+	assert.Empty(t, errs)
+}
+
+func TestInvalidStruct(t *testing.T) {
+	errs := Struct(&item{Title: strings.Repeat("ά", 6), Link: "www.bestprice.gr", Price: -1})
+	assert.Equal(t, Errors{
+		{Field: "title", Code: CodeTooLong, Message: "title must be at most 5 characters long"},
+		{Field: "link", Code: CodeInvalidUrl, Message: "link must be a valid http(s) url"},
+		{Field: "price", Code: CodeTooSmall, Message: "price must be at least 0"},
+		{Field: "position", Code: CodeRequired, Message: "position is required"},
+	}, errs)
+}
+
+func TestMaxBytes(t *testing.T) {
+	// two characters of two bytes each fit, three do not, however few characters they are
+	assert.Empty(t, Struct(item{Title: "ok", Note: "άά", Position: 1}))
+	assert.Equal(t, Errors{
+		{Field: "note", Code: CodeTooLong, Message: "note must be at most 4 bytes long"},
+	}, Struct(item{Title: "ok", Note: "άάά", Position: 1}))
+}
+
+func TestOnlyFirstViolationPerField(t *testing.T) {
+	errs := Struct(item{Title: "", Position: -3})
+	assert.Len(t, errs, 2)
+	assert.Equal(t, CodeRequired, errs[0].Code)
+	assert.Equal(t, CodeTooSmall, errs[1].Code)
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	type bad struct {
+		Title string `validate:"shiny"`
+	}
+	assert.Panics(t, func() { Struct(bad{}) })
+}